@@ -87,6 +87,7 @@ func main() {
 
 	// Créer le hub avec la base de données
 	hub := server.NewHub(db)
+	hub.SetLogRetention(config.LogRetentionDays)
 
 	// Créer le serveur API
 	apiServer := server.NewAPIServer(hub, tokenManager, config.AuthToken, config, db)
@@ -9,6 +9,7 @@ require (
 	github.com/glebarez/sqlite v1.11.0
 	github.com/golang-jwt/jwt/v5 v5.0.0
 	github.com/gorilla/websocket v1.5.0
+	golang.org/x/net v0.10.0
 	golang.org/x/oauth2 v0.32.0
 	gorm.io/driver/mysql v1.5.2
 	gorm.io/gorm v1.25.7
@@ -43,7 +44,6 @@ require (
 	golang.org/x/arch v0.3.0 // indirect
 	golang.org/x/crypto v0.9.0 // indirect
 	golang.org/x/exp v0.0.0-20250620022241-b7579e27df2b // indirect
-	golang.org/x/net v0.10.0 // indirect
 	golang.org/x/sys v0.36.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 	google.golang.org/protobuf v1.30.0 // indirect
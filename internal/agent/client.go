@@ -3,13 +3,12 @@ package agent
 import (
 	"context"
 	"crypto/tls"
-	"encoding/base64"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/signal"
-	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -29,6 +28,16 @@ type Client struct {
 	fileManager    *FileManager
 	serviceManager *ServiceManager
 	logManager     *LogManager
+	logShipper     *LogShipper
+	logger         *Logger
+	metricsCollector *MetricsCollector
+	processManager   *ProcessManager
+	networkDiagnostics *NetworkDiagnostics
+	inventoryCollector *InventoryCollector
+	inventoryRefresh   chan struct{}
+	printerRefresh     chan struct{}
+	serviceRefresh     chan struct{}
+	packageManager     *PackageManager
 	conn           *websocket.Conn
 	connected      bool
 	reconnect      bool
@@ -36,10 +45,15 @@ type Client struct {
 	disconnectChan chan struct{}
 	messageChan    chan *common.Message
 	mu             sync.RWMutex
+	writeMu        sync.Mutex // Une seule écriture WebSocket à la fois
 	agentID        string
 	agentName      string
 	lastLogTime    time.Time // Pour limiter les logs de heartbeat
 	logMutex       sync.Mutex
+	exports        map[string]*logExport // Exports de logs en cours, par ID de message
+	exportsMu      sync.Mutex
+	serviceLogs    map[string]context.CancelFunc // Suivis de logs de conteneurs en cours, par ID de message
+	serviceLogsMu  sync.Mutex
 }
 
 // NewClient crée un nouveau client agent
@@ -59,12 +73,32 @@ func NewClient(config *common.Config, tokenManager *auth.TokenManager) *Client {
 	}
 
 	executor := NewExecutor("")
-	printerMonitor := NewPrinterMonitor()
+	printerMonitor := NewPrinterMonitor(config.CUPSURL)
 	fileManager := NewFileManager("", config.ChunkSize)
-	serviceManager := NewServiceManager()
+	serviceManager := NewServiceManager(config.DockerHost)
 	logManager := NewLogManager(1000)
 
-	return &Client{
+	// Rediriger le package log vers le logger à niveaux (buffer de l'agent, fichier avec rotation)
+	// pour les composants qui n'utilisent pas directement le logger
+	logger, err := NewLogger(config, logManager)
+	log.SetFlags(0)
+	log.SetOutput(logger)
+	if err != nil {
+		logger.Errorf("agent", "[AGENT] Erreur lors de l'ouverture du fichier de log: %v", err)
+	}
+
+	// Sources de logs configurées (chemins glob, format, regroupement multi-lignes)
+	if config.LogSourcesFile != "" {
+		definitions, err := LoadLogSourceDefinitions(config.LogSourcesFile)
+		if err != nil {
+			logger.Errorf("agent", "[AGENT] Erreur lors du chargement des sources de logs: %v", err)
+		} else {
+			logManager.SetSourceDefinitions(definitions)
+			logger.Infof("agent", "[AGENT] %d source(s) de logs configurée(s)", len(definitions))
+		}
+	}
+
+	client := &Client{
 		config:         config,
 		tokenManager:   tokenManager,
 		executor:       executor,
@@ -72,19 +106,37 @@ func NewClient(config *common.Config, tokenManager *auth.TokenManager) *Client {
 		fileManager:    fileManager,
 		serviceManager: serviceManager,
 		logManager:     logManager,
+		logger:         logger,
+		metricsCollector: NewMetricsCollector(),
+		processManager:   NewProcessManager(),
+		networkDiagnostics: NewNetworkDiagnostics(),
+		inventoryCollector: NewInventoryCollector(),
+		inventoryRefresh:   make(chan struct{}, 1),
+		printerRefresh:     make(chan struct{}, 1),
+		serviceRefresh:     make(chan struct{}, 1),
+		packageManager:     NewPackageManager(),
 		connected:      false,
 		reconnect:      true,
 		stopChan:       make(chan struct{}),
 		disconnectChan:  make(chan struct{}, 1),
+		exports:        make(map[string]*logExport),
+		serviceLogs:    make(map[string]context.CancelFunc),
 		messageChan:    make(chan *common.Message, 100),
 		agentID:        agentID,
 		agentName:      agentName,
 	}
+
+	// Expédition continue des logs vers le serveur si des sources sont configurées
+	if config.LogShipSources != "" {
+		client.logShipper = NewLogShipper(logManager, logger, config.LogShipSources, config.LogShipInterval, client.sendLogBatch)
+	}
+
+	return client
 }
 
 // Start démarre le client agent
 func (c *Client) Start() error {
-	log.Printf("Démarrage de l'agent %s (%s)", c.agentName, c.agentID)
+	c.logger.Infof("agent", "Démarrage de l'agent %s (%s)", c.agentName, c.agentID)
 
 	// Gérer les signaux système
 	sigChan := make(chan os.Signal, 1)
@@ -92,16 +144,21 @@ func (c *Client) Start() error {
 
 	go func() {
 		<-sigChan
-		log.Println("Signal d'arrêt reçu, fermeture de l'agent...")
+		c.logger.Infof("agent", "Signal d'arrêt reçu, fermeture de l'agent...")
 		c.Stop()
 	}()
 
+	// L'expédition des logs survit aux reconnexions, les lots sont conservés hors ligne
+	if c.logShipper != nil {
+		go c.logShipper.Run(c.stopChan)
+	}
+
 	// Boucle de connexion avec reconnexion automatique
 	for c.reconnect {
 		if err := c.connect(); err != nil {
-			log.Printf("Erreur de connexion: %v", err)
+			c.logger.Errorf("agent", "Erreur de connexion: %v", err)
 			if c.reconnect {
-				log.Printf("Reconnexion dans %v...", c.config.ReconnectDelay)
+				c.logger.Infof("agent", "Reconnexion dans %v...", c.config.ReconnectDelay)
 				time.Sleep(c.config.ReconnectDelay)
 				continue
 			}
@@ -112,6 +169,10 @@ func (c *Client) Start() error {
 		go c.handleMessages()
 		go c.sendHeartbeat()
 		go c.sendPrinterStatus()
+		go c.sendServiceStatus()
+		go c.sendSystemInfo()
+		go c.sendMetrics()
+		go c.sendInventory()
 
 		// Attendre la déconnexion ou l'arrêt
 		select {
@@ -120,7 +181,7 @@ func (c *Client) Start() error {
 			return nil
 		case <-c.disconnectChan:
 			// Déconnexion inattendue, relancer la reconnexion
-			log.Println("Déconnexion détectée, reconnexion automatique...")
+			c.logger.Warnf("agent", "Déconnexion détectée, reconnexion automatique...")
 			// Recréer le canal pour la prochaine déconnexion
 			c.disconnectChan = make(chan struct{}, 1)
 		}
@@ -142,7 +203,8 @@ func (c *Client) Stop() {
 	}
 
 	close(c.stopChan)
-	log.Println("Agent arrêté")
+	c.logger.Infof("agent", "Agent arrêté")
+	c.logger.Close()
 }
 
 // connect établit la connexion WebSocket
@@ -159,12 +221,12 @@ func (c *Client) connect() error {
 			},
 			HandshakeTimeout: 30 * time.Second, // Timeout plus long pour le handshake
 		}
-		log.Printf("Tentative de connexion WSS (WebSocket Secure) à %s", serverURL)
+		c.logger.Debugf("agent", "Tentative de connexion WSS (WebSocket Secure) à %s", serverURL)
 	} else {
 		dialer = &websocket.Dialer{
 			HandshakeTimeout: 30 * time.Second,
 		}
-		log.Printf("Tentative de connexion WS (WebSocket) à %s", serverURL)
+		c.logger.Debugf("agent", "Tentative de connexion WS (WebSocket) à %s", serverURL)
 	}
 
 	// Connexion WebSocket
@@ -187,7 +249,7 @@ func (c *Client) connect() error {
 	c.connected = true
 	c.mu.Unlock()
 
-	log.Printf("Connecté au serveur %s", serverURL)
+	c.logger.Infof("agent", "Connecté au serveur %s", serverURL)
 
 	// Authentification
 	if err := c.authenticate(); err != nil {
@@ -237,10 +299,13 @@ func (c *Client) authenticate() error {
 
 			switch msg.Type {
 			case common.MessageTypeAuthSuccess:
-				log.Println("Authentification réussie")
+				c.logger.Infof("agent", "Authentification réussie")
 				return nil
 			case common.MessageTypeAuthError:
-				return fmt.Errorf("authentification échouée: %v", msg.Data)
+				if errorData, err := common.DecodePayload[common.ErrorData](msg); err == nil {
+					return fmt.Errorf("authentification échouée: %s", errorData.Message)
+				}
+				return fmt.Errorf("authentification échouée: %s", string(msg.Data))
 			}
 		}
 	}
@@ -260,7 +325,7 @@ func (c *Client) handleMessages() {
 
 		_, message, err := conn.ReadMessage()
 		if err != nil {
-			log.Printf("Erreur de lecture WebSocket: %v", err)
+			c.logger.Errorf("agent", "Erreur de lecture WebSocket: %v", err)
 			c.disconnect()
 			// Signaler la déconnexion pour relancer la reconnexion
 			select {
@@ -272,13 +337,13 @@ func (c *Client) handleMessages() {
 
 		msg, err := common.FromJSON(message)
 		if err != nil {
-			log.Printf("Erreur de parsing du message: %v", err)
+			c.logger.Errorf("agent", "Erreur de parsing du message: %v", err)
 			continue
 		}
 
 		// Traiter le message
 		if err := c.processMessage(msg); err != nil {
-			log.Printf("Erreur de traitement du message: %v", err)
+			c.logger.Errorf("agent", "Erreur de traitement du message: %v", err)
 		}
 	}
 }
@@ -288,7 +353,7 @@ func (c *Client) processMessage(msg *common.Message) error {
 	// Log tous les messages sauf heartbeat (pour éviter la pollution)
 	// Les heartbeats sont loggés séparément avec limitation de fréquence
 	if msg.Type != common.MessageTypeHeartbeat {
-		log.Printf("[AGENT] processMessage - Message reçu: Type=%s, ID=%s, AgentID=%s", msg.Type, msg.ID, msg.AgentID)
+		c.logger.Debugf("agent", "[AGENT] processMessage - Message reçu: Type=%s, ID=%s, AgentID=%s", msg.Type, msg.ID, msg.AgentID)
 	} else {
 		// Pour les heartbeats, log seulement si plus d'1 seconde s'est écoulée depuis le dernier log
 		c.logMutex.Lock()
@@ -296,12 +361,23 @@ func (c *Client) processMessage(msg *common.Message) error {
 		shouldLog := now.Sub(c.lastLogTime) >= time.Second
 		if shouldLog {
 			c.lastLogTime = now
-			log.Printf("DEBUG: Traitement du message de type: heartbeat, ID: %s", msg.ID)
-			log.Printf("DEBUG: Données du message: %v", msg.Data)
+			c.logger.Debugf("agent", "Traitement du message de type: heartbeat, ID: %s", msg.ID)
+			c.logger.Debugf("agent", "Données du message: %s", string(msg.Data))
 		}
 		c.logMutex.Unlock()
 	}
 
+	// Valider les données du message avant de le traiter
+	if err := msg.ValidatePayload(common.ToAgent); err != nil {
+		c.logger.Warnf("agent", "[AGENT] processMessage - Message %s rejeté: %v", msg.Type, err)
+		if msg.Type == common.MessageTypeError {
+			return nil
+		}
+		errorMsg := common.NewPayloadErrorMessage(msg, err)
+		errorMsg.AgentID = c.agentID
+		return c.sendMessage(errorMsg)
+	}
+
 	switch msg.Type {
 	case common.MessageTypeCommand:
 		return c.handleCommand(msg)
@@ -327,13 +403,33 @@ func (c *Client) processMessage(msg *common.Message) error {
 		return c.handleLogList(msg)
 	case common.MessageTypeLogContent:
 		return c.handleLogContent(msg)
+	case common.MessageTypeLogExport:
+		return c.handleLogExport(msg)
+	case common.MessageTypeProcessList:
+		return c.handleProcessList(msg)
+	case common.MessageTypeProcessSignal:
+		return c.handleProcessSignal(msg)
+	case common.MessageTypeNetworkDiagnostic:
+		return c.handleNetworkDiagnostic(msg)
+	case common.MessageTypePackageAction:
+		return c.handlePackageAction(msg)
+	case common.MessageTypePrinterAction:
+		return c.handlePrinterAction(msg)
+	case common.MessageTypePrintSubmit:
+		return c.handlePrintSubmit(msg)
+	case common.MessageTypePrinterDiscover:
+		return c.handlePrinterDiscover(msg)
+	case common.MessageTypePrinterDrivers:
+		return c.handlePrinterDrivers(msg)
+	case common.MessageTypePrinterQueue:
+		return c.handlePrinterQueue(msg)
 	case common.MessageTypeHeartbeat:
 		// Répondre au heartbeat (les logs sont déjà gérés dans processMessage avec limitation)
 		response := common.NewMessage(common.MessageTypeHeartbeat, nil)
 		response.AgentID = c.agentID
 		return c.sendMessage(response)
 	default:
-		log.Printf("[AGENT] processMessage - Type de message non géré: %s", msg.Type)
+		c.logger.Warnf("agent", "[AGENT] processMessage - Type de message non géré: %s", msg.Type)
 	}
 
 	return nil
@@ -341,51 +437,19 @@ func (c *Client) processMessage(msg *common.Message) error {
 
 // handleCommand traite une commande
 func (c *Client) handleCommand(msg *common.Message) error {
-	log.Printf("[Client] === handleCommand appelé === Message ID: %s", msg.ID)
-	var cmdData *common.CommandData
-
-	// Gérer les différents types de données
-	switch data := msg.Data.(type) {
-	case *common.CommandData:
-		cmdData = data
-		log.Printf("[Client] CommandData reçu directement: command=%q, workingDir=%q", cmdData.Command, cmdData.WorkingDir)
-	case map[string]interface{}:
-		// Convertir map en CommandData
-		cmdData = &common.CommandData{}
-		if cmd, exists := data["command"]; exists {
-			if cmdStr, ok := cmd.(string); ok {
-				cmdData.Command = cmdStr
-				log.Printf("[Client] Commande extraite du map: %q", cmdStr)
-			}
-		}
-		if workingDir, exists := data["working_dir"]; exists {
-			if dirStr, ok := workingDir.(string); ok {
-				cmdData.WorkingDir = dirStr
-				log.Printf("[Client] WorkingDir extrait du map: %q", dirStr)
-			}
-		}
-		if timeout, exists := data["timeout"]; exists {
-			if timeoutNum, ok := timeout.(float64); ok {
-				cmdData.Timeout = int(timeoutNum)
-			}
-		}
-		log.Printf("[Client] CommandData construit depuis map: command=%q, workingDir=%q, timeout=%d", 
-			cmdData.Command, cmdData.WorkingDir, cmdData.Timeout)
-	default:
-		log.Printf("[Client] ERREUR: Format de données invalide: %T", msg.Data)
-		return fmt.Errorf("format de données de commande invalide: %T", msg.Data)
-	}
-
-	if cmdData.Command == "" {
-		log.Printf("[Client] ERREUR: Commande manquante")
-		return fmt.Errorf("commande manquante")
+	c.logger.Debugf("client", "[Client] === handleCommand appelé === Message ID: %s", msg.ID)
+	cmdData, err := common.DecodePayload[common.CommandData](msg)
+	if err != nil {
+		c.logger.Errorf("client", "[Client] ERREUR: %v", err)
+		return err
 	}
+	c.logger.Debugf("client", "[Client] CommandData reçu: command=%q, workingDir=%q, timeout=%d", cmdData.Command, cmdData.WorkingDir, cmdData.Timeout)
 
-	log.Printf("[Client] Commande validée: %q, appel de ExecuteWithTimeout...", cmdData.Command)
+	c.logger.Debugf("client", "[Client] Commande validée: %q, appel de ExecuteWithTimeout...", cmdData.Command)
 
 	// Vérifier la sécurité de la commande
 	if !c.executor.IsCommandSafe(cmdData.Command) {
-		log.Printf("[Client] ERREUR: Commande non sécurisée: %q", cmdData.Command)
+		c.logger.Errorf("client", "[Client] ERREUR: Commande non sécurisée: %q", cmdData.Command)
 		errorMsg := common.NewMessageWithID(common.MessageTypeError, msg.ID, &common.ErrorData{
 			Code:    "UNSAFE_COMMAND",
 			Message: "Commande non autorisée pour des raisons de sécurité",
@@ -394,10 +458,10 @@ func (c *Client) handleCommand(msg *common.Message) error {
 		return c.sendMessage(errorMsg)
 	}
 
-	log.Printf("[Client] Commande sécurisée, exécution...")
+	c.logger.Debugf("client", "[Client] Commande sécurisée, exécution...")
 	// Exécuter la commande
 	output, err := c.executor.ExecuteWithTimeout(cmdData)
-	log.Printf("[Client] ExecuteWithTimeout terminé, erreur: %v", err)
+	c.logger.Debugf("client", "[Client] ExecuteWithTimeout terminé, erreur: %v", err)
 	if err != nil {
 		errorMsg := common.NewMessageWithID(common.MessageTypeError, msg.ID, &common.ErrorData{
 			Code:    "EXECUTION_ERROR",
@@ -415,152 +479,68 @@ func (c *Client) handleCommand(msg *common.Message) error {
 
 // handleFileUpload traite l'upload de fichier
 func (c *Client) handleFileUpload(msg *common.Message) error {
-	log.Printf("[AGENT] handleFileUpload - Début, ID: %s, Type de données: %T", msg.ID, msg.Data)
-	
-	var chunks []*common.FileChunk
-	var chunksOk bool
-
-	// Gérer les différents types de données (après sérialisation JSON)
-	if chunksData, ok := msg.Data.([]*common.FileChunk); ok {
-		log.Printf("[AGENT] handleFileUpload - Type []*common.FileChunk détecté, %d chunks", len(chunksData))
-		chunks = chunksData
-		chunksOk = true
-	} else if chunksInterface, ok := msg.Data.([]interface{}); ok {
-		log.Printf("[AGENT] handleFileUpload - Type []interface{} détecté, %d éléments", len(chunksInterface))
-		// Convertir []interface{} en []*common.FileChunk
-		chunks = make([]*common.FileChunk, 0, len(chunksInterface))
-		for i, item := range chunksInterface {
-			if chunkMap, ok := item.(map[string]interface{}); ok {
-				chunk := &common.FileChunk{}
-				if pathVal, exists := chunkMap["path"]; exists {
-					if pathStr, ok := pathVal.(string); ok {
-						chunk.Path = pathStr
-					}
-				}
-				if offsetVal, exists := chunkMap["offset"]; exists {
-					if offsetFloat, ok := offsetVal.(float64); ok {
-						chunk.Offset = int64(offsetFloat)
-					}
-				}
-				if dataVal, exists := chunkMap["data"]; exists {
-					// Les données binaires peuvent être encodées en base64 ou être un tableau de bytes
-					if dataStr, ok := dataVal.(string); ok {
-						// Essayer de décoder en base64
-						decoded, err := base64.StdEncoding.DecodeString(dataStr)
-						if err != nil {
-							log.Printf("[AGENT] handleFileUpload - ERREUR décodage base64 chunk %d: %v", i, err)
-							errorMsg := common.NewMessageWithID(common.MessageTypeFileError, msg.ID, &common.ErrorData{
-								Code:    "DECODE_ERROR",
-								Message: fmt.Sprintf("erreur de décodage base64 du chunk %d: %v", i, err),
-							})
-							errorMsg.AgentID = c.agentID
-							if sendErr := c.sendMessage(errorMsg); sendErr != nil {
-								log.Printf("[AGENT] handleFileUpload - ERREUR envoi message d'erreur: %v", sendErr)
-							}
-							return fmt.Errorf("erreur de décodage base64: %v", err)
-						}
-						chunk.Data = decoded
-					} else if dataArray, ok := dataVal.([]interface{}); ok {
-						// Tableau de nombres (bytes encodés en JSON)
-						chunk.Data = make([]byte, len(dataArray))
-						for j, v := range dataArray {
-							if byteVal, ok := v.(float64); ok {
-								chunk.Data[j] = byte(byteVal)
-							}
-						}
-					} else if dataBytes, ok := dataVal.([]byte); ok {
-						chunk.Data = dataBytes
-					} else {
-						log.Printf("[AGENT] handleFileUpload - Type de données inattendu pour chunk %d: %T", i, dataVal)
-					}
-				}
-				if isLastVal, exists := chunkMap["is_last"]; exists {
-					if isLastBool, ok := isLastVal.(bool); ok {
-						chunk.IsLast = isLastBool
-					}
-				}
-				if checksumVal, exists := chunkMap["checksum"]; exists {
-					if checksumStr, ok := checksumVal.(string); ok {
-						chunk.Checksum = checksumStr
-					}
-				}
-				chunks = append(chunks, chunk)
-			} else {
-				log.Printf("[AGENT] handleFileUpload - Élément %d n'est pas un map: %T", i, item)
-			}
-		}
-		chunksOk = true
-		log.Printf("[AGENT] handleFileUpload - Conversion terminée, %d chunks valides", len(chunks))
-	} else {
-		log.Printf("[AGENT] handleFileUpload - Type de données non géré: %T", msg.Data)
-	}
+	c.logger.Debugf("agent", "[AGENT] handleFileUpload - Début, ID: %s", msg.ID)
 
-	if !chunksOk || len(chunks) == 0 {
-		log.Printf("[AGENT] handleFileUpload - ERREUR: chunks invalides (chunksOk=%v, len=%d)", chunksOk, len(chunks))
+	decoded, err := common.DecodePayload[[]*common.FileChunk](msg)
+	if err != nil || len(*decoded) == 0 {
+		message := "aucun chunk reçu"
+		if err != nil {
+			message = err.Error()
+		}
+		c.logger.Errorf("agent", "[AGENT] handleFileUpload - ERREUR: chunks invalides: %s", message)
 		errorMsg := common.NewMessageWithID(common.MessageTypeFileError, msg.ID, &common.ErrorData{
 			Code:    "INVALID_DATA",
-			Message: fmt.Sprintf("données de chunks invalides (type: %T, chunksOk: %v, len: %d)", msg.Data, chunksOk, len(chunks)),
+			Message: fmt.Sprintf("données de chunks invalides: %s", message),
 		})
 		errorMsg.AgentID = c.agentID
 		if err := c.sendMessage(errorMsg); err != nil {
-			log.Printf("[AGENT] handleFileUpload - ERREUR envoi message d'erreur: %v", err)
+			c.logger.Errorf("agent", "[AGENT] handleFileUpload - ERREUR envoi message d'erreur: %v", err)
 			return err
 		}
 		return fmt.Errorf("données de chunks invalides")
 	}
+	chunks := *decoded
 
 	// Utiliser le chemin du premier chunk
 	path := chunks[0].Path
-	log.Printf("[AGENT] handleFileUpload - Upload de %d chunks vers %s", len(chunks), path)
+	c.logger.Debugf("agent", "[AGENT] handleFileUpload - Upload de %d chunks vers %s", len(chunks), path)
 
 	// Uploader le fichier
 	if err := c.fileManager.UploadFile(path, chunks); err != nil {
-		log.Printf("[AGENT] handleFileUpload - ERREUR lors de l'upload: %v", err)
+		c.logger.Errorf("agent", "[AGENT] handleFileUpload - ERREUR lors de l'upload: %v", err)
 		errorMsg := common.NewMessageWithID(common.MessageTypeFileError, msg.ID, &common.ErrorData{
 			Code:    "UPLOAD_ERROR",
 			Message: err.Error(),
 		})
 		errorMsg.AgentID = c.agentID
 		if sendErr := c.sendMessage(errorMsg); sendErr != nil {
-			log.Printf("[AGENT] handleFileUpload - ERREUR envoi message d'erreur: %v", sendErr)
+			c.logger.Errorf("agent", "[AGENT] handleFileUpload - ERREUR envoi message d'erreur: %v", sendErr)
 			return sendErr
 		}
 		return err
 	}
 
-	log.Printf("[AGENT] handleFileUpload - Upload réussi, envoi de confirmation")
+	c.logger.Debugf("agent", "[AGENT] handleFileUpload - Upload réussi, envoi de confirmation")
 	// Confirmer l'upload
 	completeMsg := common.NewMessageWithID(common.MessageTypeFileComplete, msg.ID, &common.FileData{
 		Path: path,
 	})
 	completeMsg.AgentID = c.agentID
 	if err := c.sendMessage(completeMsg); err != nil {
-		log.Printf("[AGENT] handleFileUpload - ERREUR envoi message de confirmation: %v", err)
+		c.logger.Errorf("agent", "[AGENT] handleFileUpload - ERREUR envoi message de confirmation: %v", err)
 		return err
 	}
-	log.Printf("[AGENT] handleFileUpload - Confirmation envoyée avec succès")
+	c.logger.Debugf("agent", "[AGENT] handleFileUpload - Confirmation envoyée avec succès")
 	return nil
 }
 
 // handleFileDownload traite le téléchargement de fichier
 func (c *Client) handleFileDownload(msg *common.Message) error {
-	var path string
-
-	// Gérer les différents types de données
-	switch data := msg.Data.(type) {
-	case *common.FileData:
-		path = data.Path
-	case map[string]interface{}:
-		if pathValue, exists := data["path"]; exists {
-			if pathStr, ok := pathValue.(string); ok {
-				path = pathStr
-			}
-		}
-	case string:
-		path = data
-	default:
-		return fmt.Errorf("format de données de fichier invalide: %T", msg.Data)
+	fileData, err := common.DecodePayload[common.FileData](msg)
+	if err != nil {
+		return err
 	}
+	path := fileData.Path
 
 	if path == "" {
 		return fmt.Errorf("chemin de fichier manquant")
@@ -596,128 +576,57 @@ func (c *Client) handleFileDownload(msg *common.Message) error {
 
 // handleFileList traite la demande de liste de fichiers
 func (c *Client) handleFileList(msg *common.Message) error {
-	log.Printf("[AGENT] handleFileList - Début du traitement, ID: %s", msg.ID)
-	log.Printf("[AGENT] handleFileList - Type de données: %T", msg.Data)
-	
-	var path string
-
-	// Gérer les différents types de données
-	switch data := msg.Data.(type) {
-	case *common.FileData:
-		path = data.Path
-	case map[string]interface{}:
-		if pathValue, exists := data["path"]; exists {
-			if pathStr, ok := pathValue.(string); ok {
-				path = pathStr
-			}
-		}
-	case string:
-		path = data
-	case []interface{}:
-		// Le serveur envoie parfois une liste de fichiers (réponse) mais pas de demande
-		// Si on reçoit []interface{} comme demande, c'est une erreur de format
-		log.Printf("[AGENT] handleFileList - Reçu []interface{} avec %d éléments (cas non attendu pour une demande)", len(data))
-		
-		// Si c'est une liste vide, traiter comme une demande pour la racine
-		if len(data) == 0 {
-			log.Printf("[AGENT] handleFileList - Liste vide, traitement comme demande de liste pour chemin racine")
-			path = "/"
-			goto listFiles
-		}
-		
-		// Sinon, c'est probablement une erreur de sérialisation
-		// Essayer d'extraire un chemin si possible depuis le premier élément
-		if len(data) > 0 {
-			if firstItem, ok := data[0].(map[string]interface{}); ok {
-				if pathValue, exists := firstItem["path"]; exists {
-					if pathStr, ok := pathValue.(string); ok {
-						// C'est peut-être une réponse mal formatée, mais on peut essayer
-						log.Printf("[AGENT] handleFileList - Élément trouvé avec path: %s, utilisation comme chemin parent", pathStr)
-						// Extraire le répertoire parent
-						if strings.HasPrefix(pathStr, "/") && pathStr != "/" {
-							lastSlash := strings.LastIndex(pathStr, "/")
-							if lastSlash > 0 {
-								path = pathStr[:lastSlash]
-							} else {
-								path = "/"
-							}
-						} else {
-							path = "/"
-						}
-						goto listFiles
-					}
-				}
-			}
-		}
-		
-		// Si on arrive ici, on ne peut pas traiter cette liste comme une demande
-		log.Printf("[AGENT] handleFileList - Format []interface{} non traitable comme demande, retour d'erreur")
-		return fmt.Errorf("format de données invalide pour une demande: []interface{} avec %d éléments", len(data))
-	default:
-		return fmt.Errorf("format de données de fichier invalide: %T", msg.Data)
+	c.logger.Debugf("agent", "[AGENT] handleFileList - Début du traitement, ID: %s", msg.ID)
+
+	fileData, err := common.DecodePayload[common.FileData](msg)
+	if err != nil {
+		return err
 	}
 
+	path := fileData.Path
 	if path == "" {
 		// Utiliser le répertoire racine par défaut
 		path = "/"
 	}
 
-listFiles:
-	log.Printf("[AGENT] handleFileList - Chemin final à lister: %s", path)
+	c.logger.Debugf("agent", "[AGENT] handleFileList - Chemin final à lister: %s", path)
 	
 	// Lister les fichiers
 	files, err := c.fileManager.ListFiles(path)
 	if err != nil {
-		log.Printf("[AGENT] handleFileList - ERREUR lors du listing: %v", err)
+		c.logger.Errorf("agent", "[AGENT] handleFileList - ERREUR lors du listing: %v", err)
 		errorMsg := common.NewMessageWithID(common.MessageTypeError, msg.ID, &common.ErrorData{
 			Code:    "LIST_ERROR",
 			Message: err.Error(),
 		})
 		errorMsg.AgentID = c.agentID
 		if sendErr := c.sendMessage(errorMsg); sendErr != nil {
-			log.Printf("[AGENT] handleFileList - ERREUR lors de l'envoi du message d'erreur: %v", sendErr)
+			c.logger.Errorf("agent", "[AGENT] handleFileList - ERREUR lors de l'envoi du message d'erreur: %v", sendErr)
 		}
 		return err
 	}
 
-	log.Printf("[AGENT] handleFileList - %d fichiers récupérés, envoi de la réponse", len(files))
+	c.logger.Debugf("agent", "[AGENT] handleFileList - %d fichiers récupérés, envoi de la réponse", len(files))
 	
 	// Envoyer la liste des fichiers
 	responseMsg := common.NewMessageWithID(common.MessageTypeFileList, msg.ID, files)
 	responseMsg.AgentID = c.agentID
 	if err := c.sendMessage(responseMsg); err != nil {
-		log.Printf("[AGENT] handleFileList - ERREUR lors de l'envoi de la réponse: %v", err)
+		c.logger.Errorf("agent", "[AGENT] handleFileList - ERREUR lors de l'envoi de la réponse: %v", err)
 		return err
 	}
 	
-	log.Printf("[AGENT] handleFileList - Réponse envoyée avec succès")
+	c.logger.Debugf("agent", "[AGENT] handleFileList - Réponse envoyée avec succès")
 	return nil
 }
 
 // handleFileDelete traite la suppression de fichier
 func (c *Client) handleFileDelete(msg *common.Message) error {
-	var path string
-
-	// Gérer les différents types de données
-	switch data := msg.Data.(type) {
-	case *common.FileData:
-		path = data.Path
-	case map[string]interface{}:
-		if pathValue, exists := data["path"]; exists {
-			if pathStr, ok := pathValue.(string); ok {
-				path = pathStr
-			}
-		}
-	case string:
-		path = data
-	default:
-		errorMsg := common.NewMessageWithID(common.MessageTypeFileError, msg.ID, &common.ErrorData{
-			Code:    "INVALID_DATA",
-			Message: fmt.Sprintf("format de données invalide: %T", msg.Data),
-		})
-		errorMsg.AgentID = c.agentID
-		return c.sendMessage(errorMsg)
+	fileData, err := common.DecodePayload[common.FileData](msg)
+	if err != nil {
+		return err
 	}
+	path := fileData.Path
 
 	if path == "" {
 		errorMsg := common.NewMessageWithID(common.MessageTypeFileError, msg.ID, &common.ErrorData{
@@ -748,28 +657,11 @@ func (c *Client) handleFileDelete(msg *common.Message) error {
 
 // handleFileCreateDir traite la création de répertoire
 func (c *Client) handleFileCreateDir(msg *common.Message) error {
-	var path string
-
-	// Gérer les différents types de données
-	switch data := msg.Data.(type) {
-	case *common.FileData:
-		path = data.Path
-	case map[string]interface{}:
-		if pathValue, exists := data["path"]; exists {
-			if pathStr, ok := pathValue.(string); ok {
-				path = pathStr
-			}
-		}
-	case string:
-		path = data
-	default:
-		errorMsg := common.NewMessageWithID(common.MessageTypeFileError, msg.ID, &common.ErrorData{
-			Code:    "INVALID_DATA",
-			Message: fmt.Sprintf("format de données invalide: %T", msg.Data),
-		})
-		errorMsg.AgentID = c.agentID
-		return c.sendMessage(errorMsg)
+	fileData, err := common.DecodePayload[common.FileData](msg)
+	if err != nil {
+		return err
 	}
+	path := fileData.Path
 
 	if path == "" {
 		errorMsg := common.NewMessageWithID(common.MessageTypeFileError, msg.ID, &common.ErrorData{
@@ -814,9 +706,31 @@ func (c *Client) sendMessage(msg *common.Message) error {
 		return fmt.Errorf("sérialisation du message échouée: %v", err)
 	}
 
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
 	return conn.WriteMessage(websocket.TextMessage, data)
 }
 
+// currentConn retourne la connexion WebSocket en cours (nil si déconnecté)
+func (c *Client) currentConn() *websocket.Conn {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.conn
+}
+
+// connectionReplaced indique si la connexion a changé depuis conn
+// Les goroutines d'envoi lancées à chaque connexion s'arrêtent alors: celles de la nouvelle connexion prennent le relais
+func (c *Client) connectionReplaced(conn *websocket.Conn) bool {
+	return c.currentConn() != conn
+}
+
+// sendLogBatch envoie un lot de logs expédiés au serveur
+func (c *Client) sendLogBatch(batch *common.LogShipBatch) error {
+	msg := common.NewMessage(common.MessageTypeLogShip, batch)
+	msg.AgentID = c.agentID
+	return c.sendMessage(msg)
+}
+
 // sendHeartbeat envoie des heartbeats périodiques
 func (c *Client) sendHeartbeat() {
 	ticker := time.NewTicker(c.config.HeartbeatInterval)
@@ -828,7 +742,7 @@ func (c *Client) sendHeartbeat() {
 			heartbeat := common.NewMessage(common.MessageTypeHeartbeat, nil)
 			heartbeat.AgentID = c.agentID
 			if err := c.sendMessage(heartbeat); err != nil {
-				log.Printf("Erreur d'envoi du heartbeat: %v", err)
+				c.logger.Errorf("agent", "Erreur d'envoi du heartbeat: %v", err)
 				c.disconnect()
 				// Signaler la déconnexion pour relancer la reconnexion
 				select {
@@ -843,24 +757,194 @@ func (c *Client) sendHeartbeat() {
 	}
 }
 
-// sendPrinterStatus envoie périodiquement le statut des imprimantes
+// sendPrinterStatus surveille l'état des imprimantes et envoie ses changements
+// L'état complet est envoyé à la connexion, puis seuls les changements sont transmis
 func (c *Client) sendPrinterStatus() {
-	ticker := time.NewTicker(60 * time.Second) // Toutes les minutes
+	conn := c.currentConn()
+	var previous []*common.PrinterInfo
+	synced := false
+	send := func() error {
+		printers, err := c.printerMonitor.GetPrinters()
+		if err != nil {
+			c.logger.Errorf("agent", "Erreur de récupération des imprimantes: %v", err)
+			return nil
+		}
+
+		var msg *common.Message
+		if !synced {
+			msg = common.NewMessage(common.MessageTypePrinterStatus, printers)
+		} else {
+			delta := diffPrinters(previous, printers)
+			if delta == nil {
+				return nil
+			}
+			msg = common.NewMessage(common.MessageTypePrinterEvents, delta)
+		}
+		msg.AgentID = c.agentID
+		if err := c.sendMessage(msg); err != nil {
+			return err
+		}
+		previous = printers
+		synced = true
+		return nil
+	}
+
+	if err := send(); err != nil {
+		c.logger.Errorf("agent", "Erreur d'envoi du statut des imprimantes: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(c.config.PrinterPollInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			printers, err := c.printerMonitor.GetPrinters()
-			if err != nil {
-				log.Printf("Erreur de récupération des imprimantes: %v", err)
-				continue
-			}
+		case <-c.printerRefresh:
+		case <-c.stopChan:
+			return
+		}
+		if c.connectionReplaced(conn) {
+			// Le signal de rafraîchissement revient à la goroutine de la nouvelle connexion
+			c.refreshPrinters()
+			return
+		}
+		if err := send(); err != nil {
+			// La connexion est perdue, l'état complet sera renvoyé à la reconnexion
+			c.logger.Errorf("agent", "Erreur d'envoi des changements d'imprimantes: %v", err)
+			return
+		}
+	}
+}
+
+// refreshPrinters demande une vérification immédiate de l'état des imprimantes
+func (c *Client) refreshPrinters() {
+	select {
+	case c.printerRefresh <- struct{}{}:
+	default:
+	}
+}
+
+// sendServiceStatus surveille l'état des services et envoie ses changements
+// La liste complète est envoyée à la connexion, puis seuls les changements sont transmis
+// Les services sont relevés périodiquement et à chaque événement de conteneur Docker
+func (c *Client) sendServiceStatus() {
+	conn := c.currentConn()
+
+	services, err := c.serviceManager.ListServices()
+	if err != nil {
+		c.logger.Errorf("agent", "Erreur de récupération des services: %v", err)
+		return
+	}
+	msg := common.NewMessage(common.MessageTypeServiceList, services)
+	msg.AgentID = c.agentID
+	if err := c.sendMessage(msg); err != nil {
+		c.logger.Errorf("agent", "Erreur d'envoi de la liste des services: %v", err)
+		return
+	}
+	previous := services
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.serviceManager.WatchDockerEvents(ctx, c.refreshServices)
+
+	ticker := time.NewTicker(c.config.ServicePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-c.serviceRefresh:
+		case <-c.stopChan:
+			return
+		}
+		// Après une reconnexion, la surveillance est reprise par la goroutine de la nouvelle connexion
+		// afin que les transitions ne soient pas envoyées deux fois
+		if c.connectionReplaced(conn) {
+			c.refreshServices()
+			return
+		}
+
+		current, unavailable := c.serviceManager.Snapshot()
+		current = keepUnavailableServices(previous, current, unavailable)
+		delta := diffServices(previous, current, time.Now())
+		if delta == nil {
+			continue
+		}
+
+		msg := common.NewMessage(common.MessageTypeServiceEvents, delta)
+		msg.AgentID = c.agentID
+		if err := c.sendMessage(msg); err != nil {
+			// La connexion est perdue, la liste complète sera renvoyée à la reconnexion
+			c.logger.Errorf("agent", "Erreur d'envoi des changements de services: %v", err)
+			return
+		}
+		previous = current
+	}
+}
+
+// refreshServices demande une vérification immédiate de l'état des services
+func (c *Client) refreshServices() {
+	select {
+	case c.serviceRefresh <- struct{}{}:
+	default:
+	}
+}
+
+// sendSystemInfo envoie les informations système à la connexion puis périodiquement
+func (c *Client) sendSystemInfo() {
+	interval := c.config.SystemInfoInterval
+	if interval <= 0 {
+		interval = 60 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	conn := c.currentConn()
+
+	for {
+		infoMsg := common.NewMessage(common.MessageTypeSystemInfo, CollectSystemInfo())
+		infoMsg.AgentID = c.agentID
+		if err := c.sendMessage(infoMsg); err != nil {
+			// La connexion est perdue, une nouvelle goroutine sera lancée à la reconnexion
+			c.logger.Errorf("agent", "Erreur d'envoi des informations système: %v", err)
+			return
+		}
 
-			statusMsg := common.NewMessage(common.MessageTypePrinterStatus, printers)
-			statusMsg.AgentID = c.agentID
-			if err := c.sendMessage(statusMsg); err != nil {
-				log.Printf("Erreur d'envoi du statut des imprimantes: %v", err)
+		select {
+		case <-ticker.C:
+		case <-c.stopChan:
+			return
+		}
+		if c.connectionReplaced(conn) {
+			return
+		}
+	}
+}
+
+// sendMetrics envoie périodiquement un échantillon de métriques
+func (c *Client) sendMetrics() {
+	if c.config.MetricsInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(c.config.MetricsInterval)
+	defer ticker.Stop()
+	conn := c.currentConn()
+
+	// Premier relevé pour initialiser les compteurs (CPU, réseau)
+	c.metricsCollector.Collect()
+
+	for {
+		select {
+		case <-ticker.C:
+			if c.connectionReplaced(conn) {
+				return
+			}
+			metricsMsg := common.NewMessage(common.MessageTypeMetrics, c.metricsCollector.Collect())
+			metricsMsg.AgentID = c.agentID
+			if err := c.sendMessage(metricsMsg); err != nil {
+				// La connexion est perdue, une nouvelle goroutine sera lancée à la reconnexion
+				c.logger.Errorf("agent", "Erreur d'envoi des métriques: %v", err)
+				return
 			}
 		case <-c.stopChan:
 			return
@@ -868,6 +952,66 @@ func (c *Client) sendPrinterStatus() {
 	}
 }
 
+// sendInventory envoie l'inventaire à la connexion puis à chaque changement détecté
+func (c *Client) sendInventory() {
+	conn := c.currentConn()
+	var lastHash string
+	send := func() error {
+		inventory := c.inventoryCollector.Collect()
+		if inventory.Hash == lastHash {
+			return nil
+		}
+		inventoryMsg := common.NewMessage(common.MessageTypeInventory, inventory)
+		inventoryMsg.AgentID = c.agentID
+		if err := c.sendMessage(inventoryMsg); err != nil {
+			return err
+		}
+		lastHash = inventory.Hash
+		c.logger.Infof("inventory", "[INVENTORY] Inventaire envoyé (%d paquets, empreinte %.12s)", len(inventory.Packages), inventory.Hash)
+		return nil
+	}
+
+	if err := send(); err != nil {
+		c.logger.Errorf("agent", "Erreur d'envoi de l'inventaire: %v", err)
+		return
+	}
+
+	// Sans intervalle, l'inventaire n'est vérifié qu'à la demande (après une opération sur les paquets)
+	var tick <-chan time.Time
+	if c.config.InventoryInterval > 0 {
+		ticker := time.NewTicker(c.config.InventoryInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-tick:
+		case <-c.inventoryRefresh:
+		case <-c.stopChan:
+			return
+		}
+		if c.connectionReplaced(conn) {
+			// Le signal de rafraîchissement revient à la goroutine de la nouvelle connexion
+			c.refreshInventory()
+			return
+		}
+		if err := send(); err != nil {
+			// La connexion est perdue, une nouvelle goroutine sera lancée à la reconnexion
+			c.logger.Errorf("agent", "Erreur d'envoi de l'inventaire: %v", err)
+			return
+		}
+	}
+}
+
+// refreshInventory demande une vérification immédiate de l'inventaire
+func (c *Client) refreshInventory() {
+	select {
+	case c.inventoryRefresh <- struct{}{}:
+	default:
+	}
+}
+
 // disconnect ferme la connexion
 func (c *Client) disconnect() {
 	c.mu.Lock()
@@ -879,16 +1023,16 @@ func (c *Client) disconnect() {
 	}
 	c.connected = false
 
-	log.Println("Déconnecté du serveur")
+	c.logger.Infof("agent", "Déconnecté du serveur")
 }
 
 // handleServiceList traite une demande de liste de services
 func (c *Client) handleServiceList(msg *common.Message) error {
-	log.Printf("[AGENT] handleServiceList - Demande reçue avec ID: %s", msg.ID)
+	c.logger.Debugf("agent", "[AGENT] handleServiceList - Demande reçue avec ID: %s", msg.ID)
 
 	services, err := c.serviceManager.ListServices()
 	if err != nil {
-		log.Printf("[AGENT] handleServiceList - ERREUR lors de la récupération des services: %v", err)
+		c.logger.Errorf("agent", "[AGENT] handleServiceList - ERREUR lors de la récupération des services: %v", err)
 		errorMsg := common.NewMessageWithID(common.MessageTypeError, msg.ID, &common.ErrorData{
 			Code:    "SERVICE_LIST_ERROR",
 			Message: err.Error(),
@@ -897,21 +1041,21 @@ func (c *Client) handleServiceList(msg *common.Message) error {
 		return c.sendMessage(errorMsg)
 	}
 
-	log.Printf("[AGENT] handleServiceList - %d services récupérés", len(services))
+	c.logger.Debugf("agent", "[AGENT] handleServiceList - %d services récupérés", len(services))
 	for i, svc := range services {
-		log.Printf("[AGENT] handleServiceList - Service %d: %s (%s) - %s", i, svc.Name, svc.Type, svc.State)
+		c.logger.Debugf("agent", "[AGENT] handleServiceList - Service %d: %s (%s) - %s", i, svc.Name, svc.Type, svc.State)
 	}
 
 	// Envoyer la liste des services
 	responseMsg := common.NewMessageWithID(common.MessageTypeServiceList, msg.ID, services)
 	responseMsg.AgentID = c.agentID
-	log.Printf("[AGENT] handleServiceList - Envoi de la réponse avec ID: %s", msg.ID)
+	c.logger.Debugf("agent", "[AGENT] handleServiceList - Envoi de la réponse avec ID: %s", msg.ID)
 
 	err = c.sendMessage(responseMsg)
 	if err != nil {
-		log.Printf("[AGENT] handleServiceList - ERREUR lors de l'envoi de la réponse: %v", err)
+		c.logger.Errorf("agent", "[AGENT] handleServiceList - ERREUR lors de l'envoi de la réponse: %v", err)
 	} else {
-		log.Printf("[AGENT] handleServiceList - Réponse envoyée avec succès")
+		c.logger.Debugf("agent", "[AGENT] handleServiceList - Réponse envoyée avec succès")
 	}
 
 	return err
@@ -919,26 +1063,9 @@ func (c *Client) handleServiceList(msg *common.Message) error {
 
 // handleServiceStatus traite une demande de statut de service
 func (c *Client) handleServiceStatus(msg *common.Message) error {
-	var serviceInfo *common.ServiceInfo
-
-	// Gérer les différents types de données
-	switch data := msg.Data.(type) {
-	case *common.ServiceInfo:
-		serviceInfo = data
-	case map[string]interface{}:
-		serviceInfo = &common.ServiceInfo{}
-		if name, exists := data["name"]; exists {
-			if nameStr, ok := name.(string); ok {
-				serviceInfo.Name = nameStr
-			}
-		}
-		if svcType, exists := data["type"]; exists {
-			if typeStr, ok := svcType.(string); ok {
-				serviceInfo.Type = typeStr
-			}
-		}
-	default:
-		return fmt.Errorf("format de données de service invalide: %T", msg.Data)
+	serviceInfo, err := common.DecodePayload[common.ServiceInfo](msg)
+	if err != nil {
+		return err
 	}
 
 	status, err := c.serviceManager.GetServiceStatus(serviceInfo.Name, serviceInfo.Type)
@@ -956,50 +1083,363 @@ func (c *Client) handleServiceStatus(msg *common.Message) error {
 	return c.sendMessage(responseMsg)
 }
 
+// handlePrinterAction traite une action sur une imprimante ou l'un de ses travaux
+// L'état des imprimantes est renvoyé après une action réussie pour mettre à jour le serveur sans attendre
+func (c *Client) handlePrinterAction(msg *common.Message) error {
+	req, err := common.DecodePayload[common.PrinterActionRequest](msg)
+	if err != nil {
+		return err
+	}
+
+	result := c.printerMonitor.ExecuteAction(req)
+	if result.Success {
+		c.logger.Infof("printer", "[PRINTER] %s", result.Message)
+	} else {
+		c.logger.Errorf("printer", "[PRINTER] Échec de l'action %s sur %s: %s", result.Action, result.Printer, result.Error)
+	}
+
+	responseMsg := common.NewMessageWithID(common.MessageTypePrinterResult, msg.ID, result)
+	responseMsg.AgentID = c.agentID
+	if err := c.sendMessage(responseMsg); err != nil {
+		return err
+	}
+
+	if result.Success {
+		c.refreshPrinters()
+	}
+	return nil
+}
+
+// handlePrintSubmit imprime un document transmis par le serveur
+func (c *Client) handlePrintSubmit(msg *common.Message) error {
+	req, err := common.DecodePayload[common.PrintSubmitRequest](msg)
+	if err != nil {
+		return err
+	}
+
+	result := c.printerMonitor.SubmitJob(req)
+	if result.Success {
+		c.logger.Infof("printer", "[PRINTER] %s", result.Message)
+	} else {
+		c.logger.Errorf("printer", "[PRINTER] Échec de l'impression sur %s: %s", result.Printer, result.Error)
+	}
+
+	responseMsg := common.NewMessageWithID(common.MessageTypePrinterResult, msg.ID, result)
+	responseMsg.AgentID = c.agentID
+	if err := c.sendMessage(responseMsg); err != nil {
+		return err
+	}
+
+	if result.Success {
+		c.refreshPrinters()
+	}
+	return nil
+}
+
+// handlePrinterDiscover recherche les imprimantes du réseau local
+// L'écoute dure plusieurs secondes, le résultat est envoyé depuis une goroutine
+func (c *Client) handlePrinterDiscover(msg *common.Message) error {
+	req, err := common.DecodePayload[common.PrinterDiscoveryRequest](msg)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		result := c.printerMonitor.Discover(req)
+		c.logger.Infof("printer", "[PRINTER] Découverte terminée: %d imprimante(s) en %.1fs", len(result.Printers), result.Duration)
+		for method, errMsg := range result.Errors {
+			c.logger.Errorf("printer", "[PRINTER] Découverte %s en échec: %s", method, errMsg)
+		}
+
+		responseMsg := common.NewMessageWithID(common.MessageTypePrinterDiscover, msg.ID, result)
+		responseMsg.AgentID = c.agentID
+		if err := c.sendMessage(responseMsg); err != nil {
+			c.logger.Errorf("printer", "[PRINTER] Erreur lors de l'envoi de la découverte: %v", err)
+		}
+	}()
+	return nil
+}
+
+// handlePrinterDrivers retourne les pilotes CUPS correspondant à une recherche
+func (c *Client) handlePrinterDrivers(msg *common.Message) error {
+	req, err := common.DecodePayload[common.PrinterDriverRequest](msg)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		var responseMsg *common.Message
+		list, err := c.printerMonitor.ListDrivers(req)
+		if err != nil {
+			c.logger.Warnf("printer", "[PRINTER] Liste des pilotes indisponible: %v", err)
+			responseMsg = common.NewMessageWithID(common.MessageTypeError, msg.ID, &common.ErrorData{
+				Code:    "DRIVER_LIST_ERROR",
+				Message: err.Error(),
+			})
+		} else {
+			responseMsg = common.NewMessageWithID(common.MessageTypePrinterDrivers, msg.ID, list)
+		}
+		responseMsg.AgentID = c.agentID
+		if err := c.sendMessage(responseMsg); err != nil {
+			c.logger.Errorf("printer", "[PRINTER] Erreur lors de l'envoi des pilotes: %v", err)
+		}
+	}()
+	return nil
+}
+
+// handlePrinterQueue crée, modifie ou supprime une file d'impression
+func (c *Client) handlePrinterQueue(msg *common.Message) error {
+	req, err := common.DecodePayload[common.PrinterQueueRequest](msg)
+	if err != nil {
+		return err
+	}
+
+	result := c.printerMonitor.ManageQueue(req)
+	if result.Success {
+		c.logger.Infof("printer", "[PRINTER] %s", result.Message)
+	} else {
+		c.logger.Errorf("printer", "[PRINTER] Échec de l'opération %s sur %s: %s", result.Action, result.Printer, result.Error)
+	}
+
+	responseMsg := common.NewMessageWithID(common.MessageTypePrinterResult, msg.ID, result)
+	responseMsg.AgentID = c.agentID
+	if err := c.sendMessage(responseMsg); err != nil {
+		return err
+	}
+
+	if result.Success {
+		c.refreshPrinters()
+	}
+	return nil
+}
+
 // handleServiceAction traite une action sur un service
+// L'action s'exécute en arrière-plan: un téléchargement d'image ou une recréation peut durer plusieurs minutes
 func (c *Client) handleServiceAction(msg *common.Message) error {
-	var action *common.ServiceAction
-
-	// Gérer les différents types de données
-	switch data := msg.Data.(type) {
-	case *common.ServiceAction:
-		action = data
-	case map[string]interface{}:
-		action = &common.ServiceAction{}
-		if name, exists := data["name"]; exists {
-			if nameStr, ok := name.(string); ok {
-				action.Name = nameStr
-			}
+	action, err := common.DecodePayload[common.ServiceAction](msg)
+	if err != nil {
+		return err
+	}
+
+	if action.Options != nil && (action.Options.Follow || action.Options.Cancel) {
+		return c.handleServiceLogFollow(msg, action)
+	}
+
+	go func() {
+		result, err := c.serviceManager.ExecuteAction(action)
+		// Même en échec, l'action a pu modifier l'état du service
+		c.refreshServices()
+		if err != nil {
+			errorMsg := common.NewMessageWithID(common.MessageTypeError, msg.ID, &common.ErrorData{
+				Code:    "SERVICE_ACTION_ERROR",
+				Message: err.Error(),
+			})
+			errorMsg.AgentID = c.agentID
+			c.sendMessage(errorMsg)
+			return
 		}
-		if svcType, exists := data["type"]; exists {
-			if typeStr, ok := svcType.(string); ok {
-				action.Type = typeStr
-			}
+
+		responseMsg := common.NewMessageWithID(common.MessageTypeServiceResult, msg.ID, result)
+		responseMsg.AgentID = c.agentID
+		c.sendMessage(responseMsg)
+	}()
+	return nil
+}
+
+// handleServiceLogFollow démarre ou annule le suivi des logs d'un conteneur
+// Les lignes sont envoyées en messages service_logs portant l'ID de la demande, puis un service_result termine le suivi
+func (c *Client) handleServiceLogFollow(msg *common.Message, action *common.ServiceAction) error {
+	c.serviceLogsMu.Lock()
+	defer c.serviceLogsMu.Unlock()
+
+	if action.Options.Cancel {
+		if cancel, exists := c.serviceLogs[msg.ID]; exists {
+			c.logger.Infof("agent", "[AGENT] handleServiceLogFollow - Suivi %s annulé", msg.ID)
+			cancel()
 		}
-		if act, exists := data["action"]; exists {
-			if actStr, ok := act.(string); ok {
-				action.Action = actStr
-			}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), maxServiceLogFollow)
+	c.serviceLogs[msg.ID] = cancel
+
+	go func() {
+		defer func() {
+			c.serviceLogsMu.Lock()
+			delete(c.serviceLogs, msg.ID)
+			c.serviceLogsMu.Unlock()
+			cancel()
+		}()
+
+		c.logger.Infof("agent", "[AGENT] handleServiceLogFollow - Suivi des logs de %s", action.Name)
+		err := c.serviceManager.FollowDockerLogs(ctx, action.Name, action.Options, func(lines []string) {
+			chunk := common.NewMessageWithID(common.MessageTypeServiceLogs, msg.ID, &common.ServiceLogChunk{Name: action.Name, Lines: lines})
+			chunk.AgentID = c.agentID
+			c.sendMessage(chunk)
+		})
+
+		// Pas de message final si le suivi a été annulé par le serveur
+		if errors.Is(ctx.Err(), context.Canceled) {
+			return
 		}
-	default:
-		return fmt.Errorf("format de données d'action invalide: %T", msg.Data)
+
+		result := &common.ServiceResult{
+			Name:    action.Name,
+			Type:    action.Type,
+			Action:  action.Action,
+			Success: err == nil || ctx.Err() != nil,
+			Message: "Suivi des logs terminé",
+		}
+		if err != nil && ctx.Err() == nil {
+			result.Message = err.Error()
+		}
+		resultMsg := common.NewMessageWithID(common.MessageTypeServiceResult, msg.ID, result)
+		resultMsg.AgentID = c.agentID
+		c.sendMessage(resultMsg)
+	}()
+
+	return nil
+}
+
+// handleProcessList traite une demande de liste des processus
+func (c *Client) handleProcessList(msg *common.Message) error {
+	req := &common.ProcessListRequest{}
+	if msg.Data != nil {
+		decoded, err := common.DecodePayload[common.ProcessListRequest](msg)
+		if err != nil {
+			return fmt.Errorf("demande de liste des processus invalide: %v", err)
+		}
+		req = decoded
 	}
 
-	result, err := c.serviceManager.ExecuteAction(action)
+	processes, err := c.processManager.ListProcesses(req)
 	if err != nil {
 		errorMsg := common.NewMessageWithID(common.MessageTypeError, msg.ID, &common.ErrorData{
-			Code:    "SERVICE_ACTION_ERROR",
+			Code:    "PROCESS_LIST_ERROR",
 			Message: err.Error(),
 		})
 		errorMsg.AgentID = c.agentID
 		return c.sendMessage(errorMsg)
 	}
 
-	responseMsg := common.NewMessageWithID(common.MessageTypeServiceResult, msg.ID, result)
+	responseMsg := common.NewMessageWithID(common.MessageTypeProcessList, msg.ID, processes)
 	responseMsg.AgentID = c.agentID
 	return c.sendMessage(responseMsg)
 }
 
+// handleProcessSignal traite une demande d'envoi de signal à un processus
+func (c *Client) handleProcessSignal(msg *common.Message) error {
+	req, err := common.DecodePayload[common.ProcessSignalRequest](msg)
+	if err != nil {
+		return fmt.Errorf("demande de signal invalide: %v", err)
+	}
+
+	result := c.processManager.SignalProcess(req)
+	if result.Success {
+		c.logger.Infof("process", "[PROCESS] Signal %s envoyé au processus %d (%s)", result.Signal, result.PID, result.Name)
+	} else {
+		c.logger.Errorf("process", "[PROCESS] Échec de l'envoi du signal %s au processus %d: %s", result.Signal, result.PID, result.Error)
+	}
+
+	responseMsg := common.NewMessageWithID(common.MessageTypeProcessSignal, msg.ID, result)
+	responseMsg.AgentID = c.agentID
+	return c.sendMessage(responseMsg)
+}
+
+// handleNetworkDiagnostic traite une demande de diagnostic réseau
+// Les sondes pouvant durer plusieurs secondes, le diagnostic est exécuté hors de la boucle de lecture
+func (c *Client) handleNetworkDiagnostic(msg *common.Message) error {
+	req, err := common.DecodePayload[common.NetworkDiagnosticRequest](msg)
+	if err != nil {
+		return fmt.Errorf("demande de diagnostic réseau invalide: %v", err)
+	}
+
+	go func() {
+		result := c.networkDiagnostics.Run(req)
+		if !result.Success {
+			c.logger.Errorf("network", "[NETWORK] Diagnostic %s en échec: %s", result.Action, result.Error)
+		}
+
+		responseMsg := common.NewMessageWithID(common.MessageTypeNetworkDiagnostic, msg.ID, result)
+		responseMsg.AgentID = c.agentID
+		if err := c.sendMessage(responseMsg); err != nil {
+			c.logger.Errorf("network", "[NETWORK] Erreur lors de l'envoi du diagnostic: %v", err)
+		}
+	}()
+	return nil
+}
+
+// handlePackageAction traite une demande d'opération sur les paquets
+// La sortie est transmise par lots pendant l'exécution, puis le résultat est envoyé avec le même ID
+func (c *Client) handlePackageAction(msg *common.Message) error {
+	req, err := common.DecodePayload[common.PackageActionRequest](msg)
+	if err != nil {
+		return fmt.Errorf("demande d'opération sur les paquets invalide: %v", err)
+	}
+
+	go func() {
+		c.logger.Infof("packages", "[PACKAGES] Opération %s demandée %v", req.Action, req.Packages)
+
+		var pendingMu sync.Mutex
+		var pending []string
+		flush := func() {
+			pendingMu.Lock()
+			lines := pending
+			pending = nil
+			pendingMu.Unlock()
+			if len(lines) == 0 {
+				return
+			}
+			outputMsg := common.NewMessageWithID(common.MessageTypePackageOutput, msg.ID, &common.PackageOutput{Lines: lines})
+			outputMsg.AgentID = c.agentID
+			if err := c.sendMessage(outputMsg); err != nil {
+				c.logger.Errorf("packages", "[PACKAGES] Erreur lors de l'envoi de la sortie: %v", err)
+			}
+		}
+
+		stop := make(chan struct{})
+		stopped := make(chan struct{})
+		go func() {
+			defer close(stopped)
+			ticker := time.NewTicker(packageOutputFlushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					flush()
+				case <-stop:
+					return
+				}
+			}
+		}()
+
+		result := c.packageManager.Run(req, func(line string) {
+			pendingMu.Lock()
+			pending = append(pending, line)
+			pendingMu.Unlock()
+		})
+		close(stop)
+		<-stopped
+		flush()
+
+		if result.Success {
+			c.logger.Infof("packages", "[PACKAGES] Opération %s terminée (%s)", result.Action, result.Manager)
+			if result.Action != common.PackageActionListUpgradable {
+				c.refreshInventory()
+			}
+		} else {
+			c.logger.Errorf("packages", "[PACKAGES] Opération %s en échec: %s", result.Action, result.Error)
+		}
+
+		responseMsg := common.NewMessageWithID(common.MessageTypePackageResult, msg.ID, result)
+		responseMsg.AgentID = c.agentID
+		if err := c.sendMessage(responseMsg); err != nil {
+			c.logger.Errorf("packages", "[PACKAGES] Erreur lors de l'envoi du résultat: %v", err)
+		}
+	}()
+	return nil
+}
+
 // handleLogList traite une demande de liste des sources de logs
 func (c *Client) handleLogList(msg *common.Message) error {
 	sources, err := c.logManager.ListLogSources()
@@ -1019,67 +1459,19 @@ func (c *Client) handleLogList(msg *common.Message) error {
 
 // handleLogContent traite une demande de contenu de logs
 func (c *Client) handleLogContent(msg *common.Message) error {
-	log.Printf("[AGENT] handleLogContent - Demande reçue avec ID: %s", msg.ID)
+	c.logger.Debugf("agent", "[AGENT] handleLogContent - Demande reçue avec ID: %s", msg.ID)
 	
-	var logReq *common.LogRequest
-
-	// Gérer les différents types de données
-	switch data := msg.Data.(type) {
-	case *common.LogRequest:
-		logReq = data
-		log.Printf("[AGENT] handleLogContent - Données LogRequest: Source=%s, Type=%s, Lines=%d", logReq.Source, logReq.Type, logReq.Lines)
-	case map[string]interface{}:
-		logReq = &common.LogRequest{}
-		if source, exists := data["source"]; exists {
-			if sourceStr, ok := source.(string); ok {
-				logReq.Source = sourceStr
-			}
-		}
-		if logType, exists := data["type"]; exists {
-			if typeStr, ok := logType.(string); ok {
-				logReq.Type = typeStr
-			}
-		}
-		if lines, exists := data["lines"]; exists {
-			if linesFloat, ok := lines.(float64); ok {
-				logReq.Lines = int(linesFloat)
-			}
-		}
-		if path, exists := data["path"]; exists {
-			if pathStr, ok := path.(string); ok {
-				logReq.Path = pathStr
-			}
-		}
-		if unit, exists := data["unit"]; exists {
-			if unitStr, ok := unit.(string); ok {
-				logReq.Unit = unitStr
-			}
-		}
-		if priority, exists := data["priority"]; exists {
-			if priorityStr, ok := priority.(string); ok {
-				logReq.Priority = priorityStr
-			}
-		}
-		if since, exists := data["since"]; exists {
-			if sinceStr, ok := since.(string); ok {
-				logReq.Since = sinceStr
-			}
-		}
-		if until, exists := data["until"]; exists {
-			if untilStr, ok := until.(string); ok {
-				logReq.Until = untilStr
-			}
-		}
-		log.Printf("[AGENT] handleLogContent - Données map: Source=%s, Type=%s, Lines=%d", logReq.Source, logReq.Type, logReq.Lines)
-	default:
-		log.Printf("[AGENT] handleLogContent - Format de données invalide: %T", msg.Data)
-		return fmt.Errorf("format de données de requête log invalide: %T", msg.Data)
+	logReq, err := common.DecodePayload[common.LogRequest](msg)
+	if err != nil {
+		c.logger.Errorf("agent", "[AGENT] handleLogContent - %v", err)
+		return err
 	}
+	c.logger.Debugf("agent", "[AGENT] handleLogContent - Requête: Source=%s, Type=%s, Lines=%d", logReq.Source, logReq.Type, logReq.Lines)
 
-	log.Printf("[AGENT] handleLogContent - Récupération des logs...")
+	c.logger.Debugf("agent", "[AGENT] handleLogContent - Récupération des logs...")
 	logs, err := c.logManager.GetLogs(logReq)
 	if err != nil {
-		log.Printf("[AGENT] handleLogContent - ERREUR lors de la récupération des logs: %v", err)
+		c.logger.Errorf("agent", "[AGENT] handleLogContent - ERREUR lors de la récupération des logs: %v", err)
 		errorMsg := common.NewMessageWithID(common.MessageTypeError, msg.ID, &common.ErrorData{
 			Code:    "LOG_CONTENT_ERROR",
 			Message: err.Error(),
@@ -1088,25 +1480,99 @@ func (c *Client) handleLogContent(msg *common.Message) error {
 		return c.sendMessage(errorMsg)
 	}
 
-	log.Printf("[AGENT] handleLogContent - %d logs récupérés", len(logs))
+	c.logger.Debugf("agent", "[AGENT] handleLogContent - %d logs récupérés", len(logs))
 	
-	// Encapsuler les logs dans un objet avec la clé "entries"
-	logData := map[string]interface{}{
-		"entries": logs,
-		"source":  logReq.Source,
-		"count":   len(logs),
+	// Encapsuler les logs avec leur source
+	logData := &common.LogContent{
+		Entries: logs,
+		Source:  logReq.Source,
+		Count:   len(logs),
 	}
 
 	responseMsg := common.NewMessageWithID(common.MessageTypeLogContent, msg.ID, logData)
 	responseMsg.AgentID = c.agentID
-	log.Printf("[AGENT] handleLogContent - Envoi de la réponse avec ID: %s", msg.ID)
+	c.logger.Debugf("agent", "[AGENT] handleLogContent - Envoi de la réponse avec ID: %s", msg.ID)
 	
 	err = c.sendMessage(responseMsg)
 	if err != nil {
-		log.Printf("[AGENT] handleLogContent - ERREUR lors de l'envoi de la réponse: %v", err)
+		c.logger.Errorf("agent", "[AGENT] handleLogContent - ERREUR lors de l'envoi de la réponse: %v", err)
 	} else {
-		log.Printf("[AGENT] handleLogContent - Réponse envoyée avec succès")
+		c.logger.Debugf("agent", "[AGENT] handleLogContent - Réponse envoyée avec succès")
 	}
 	
 	return err
 }
+
+// handleLogExport démarre ou annule un export de logs
+// L'export s'exécute en arrière-plan et envoie ses entrées en plusieurs messages portant l'ID de la demande
+func (c *Client) handleLogExport(msg *common.Message) error {
+	req, err := common.DecodePayload[common.LogExportRequest](msg)
+	if err != nil {
+		return fmt.Errorf("demande d'export invalide: %v", err)
+	}
+
+	c.exportsMu.Lock()
+	defer c.exportsMu.Unlock()
+
+	if req.Cancel {
+		if export, exists := c.exports[msg.ID]; exists {
+			c.logger.Infof("agent", "[AGENT] handleLogExport - Export %s annulé", msg.ID)
+			export.cancel()
+		}
+		return nil
+	}
+	if req.Ack > 0 {
+		if export, exists := c.exports[msg.ID]; exists {
+			export.ack(req.Ack)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	export := newLogExport(cancel, req.Window)
+	c.exports[msg.ID] = export
+
+	go func() {
+		defer func() {
+			c.exportsMu.Lock()
+			delete(c.exports, msg.ID)
+			c.exportsMu.Unlock()
+			cancel()
+		}()
+
+		c.logger.Infof("agent", "[AGENT] handleLogExport - Export de %s (%s) du %q au %q", req.Source, req.Type, req.From, req.To)
+		count, seq := 0, 0
+		err := c.logManager.ExportLogs(ctx, req, func(entries []*common.LogEntry) error {
+			count += len(entries)
+			seq++
+			if err := export.wait(ctx, seq); err != nil {
+				return err
+			}
+			data := &common.LogExportChunk{Entries: entries}
+			if export.window > 0 {
+				data.Seq = seq
+			}
+			chunk := common.NewMessageWithID(common.MessageTypeLogExport, msg.ID, data)
+			chunk.AgentID = c.agentID
+			return c.sendMessage(chunk)
+		})
+
+		// Pas de message final si l'export a été annulé par le serveur
+		if ctx.Err() != nil {
+			return
+		}
+
+		done := &common.LogExportChunk{Done: true}
+		if err != nil {
+			c.logger.Errorf("agent", "[AGENT] handleLogExport - ERREUR: %v", err)
+			done.Error = err.Error()
+		} else {
+			c.logger.Infof("agent", "[AGENT] handleLogExport - Export terminé: %d entrées", count)
+		}
+		doneMsg := common.NewMessageWithID(common.MessageTypeLogExport, msg.ID, done)
+		doneMsg.AgentID = c.agentID
+		c.sendMessage(doneMsg)
+	}()
+
+	return nil
+}
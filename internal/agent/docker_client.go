@@ -0,0 +1,516 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// dockerAPIVersion est la version d'API la plus récente utilisée, une version inférieure annoncée par le démon étant respectée
+const dockerAPIVersion = "1.43"
+
+// dockerRequestTimeout borne les requêtes courtes à l'API Docker
+const dockerRequestTimeout = 30 * time.Second
+
+// DockerClient interroge l'API Docker Engine sur son socket
+type DockerClient struct {
+	httpClient *http.Client
+	baseURL    string
+	version    string // Version d'API négociée lors du ping
+}
+
+// dockerContainer décrit un conteneur tel que retourné par la liste des conteneurs
+type dockerContainer struct {
+	ID      string   `json:"Id"`
+	Names   []string `json:"Names"`
+	Image   string   `json:"Image"`
+	Created int64    `json:"Created"`
+	State   string   `json:"State"`  // running, exited, paused, created, restarting, dead
+	Status  string   `json:"Status"` // Up 2 hours (healthy), Exited (0) 3 minutes ago...
+	Ports   []struct {
+		IP          string `json:"IP"`
+		PrivatePort int    `json:"PrivatePort"`
+		PublicPort  int    `json:"PublicPort"`
+		Type        string `json:"Type"`
+	} `json:"Ports"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// dockerContainerJSON décrit un conteneur tel que retourné par l'inspection
+// Config, HostConfig et les réseaux sont conservés bruts pour recréer le conteneur à l'identique
+type dockerContainerJSON struct {
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	State struct {
+		Status  string `json:"Status"`
+		Running bool   `json:"Running"`
+		Paused  bool   `json:"Paused"`
+		Health  *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+	Created         time.Time                  `json:"Created"`
+	Config          map[string]json.RawMessage `json:"Config"`
+	HostConfig      json.RawMessage            `json:"HostConfig"`
+	NetworkSettings struct {
+		Networks map[string]json.RawMessage `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// dockerCPUStats contient les compteurs CPU d'un échantillon de statistiques
+type dockerCPUStats struct {
+	CPUUsage struct {
+		TotalUsage uint64 `json:"total_usage"`
+	} `json:"cpu_usage"`
+	SystemUsage uint64 `json:"system_cpu_usage"`
+	OnlineCPUs  int    `json:"online_cpus"`
+}
+
+// dockerStats contient un échantillon de statistiques d'un conteneur
+type dockerStats struct {
+	CPUStats    dockerCPUStats `json:"cpu_stats"`
+	PreCPUStats dockerCPUStats `json:"precpu_stats"`
+	MemoryStats struct {
+		Usage uint64            `json:"usage"`
+		Limit uint64            `json:"limit"`
+		Stats map[string]uint64 `json:"stats"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IOServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+	PidsStats struct {
+		Current uint64 `json:"current"`
+	} `json:"pids_stats"`
+}
+
+// dockerLogOptions contient les paramètres de lecture des logs d'un conteneur
+type dockerLogOptions struct {
+	Tail       int
+	Since      int64
+	Follow     bool
+	Timestamps bool
+}
+
+// dockerEvent est un événement du flux /events (seuls les conteneurs sont suivis)
+type dockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// DockerError est une erreur retournée par l'API Docker
+type DockerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *DockerError) Error() string {
+	return e.Message
+}
+
+// NewDockerClient crée un client pour l'API Docker Engine
+// host est de la forme unix:///var/run/docker.sock ou tcp://hôte:port
+func NewDockerClient(host string) (*DockerClient, error) {
+	parsed, err := url.Parse(host)
+	if err != nil {
+		return nil, fmt.Errorf("adresse Docker invalide: %v", err)
+	}
+
+	var network, address string
+	switch parsed.Scheme {
+	case "unix":
+		network, address = "unix", parsed.Path
+	case "tcp":
+		network, address = "tcp", parsed.Host
+	default:
+		return nil, fmt.Errorf("schéma Docker non supporté: %s", parsed.Scheme)
+	}
+	if address == "" {
+		return nil, fmt.Errorf("adresse Docker invalide: %s", host)
+	}
+
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, address)
+		},
+		MaxIdleConns:    4,
+		IdleConnTimeout: 30 * time.Second,
+	}
+
+	// Les délais sont portés par le contexte de chaque requête, le suivi des logs n'en ayant pas
+	return &DockerClient{
+		httpClient: &http.Client{Transport: transport},
+		baseURL:    "http://docker",
+		version:    dockerAPIVersion,
+	}, nil
+}
+
+// Ping vérifie que le démon répond et négocie la version d'API
+func (d *DockerClient) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+"/_ping", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return dockerResponseError(resp)
+	}
+
+	if version := resp.Header.Get("Api-Version"); version != "" && compareAPIVersions(version, dockerAPIVersion) < 0 {
+		d.version = version
+	}
+	return nil
+}
+
+// ListContainers liste tous les conteneurs, arrêtés compris
+func (d *DockerClient) ListContainers() ([]dockerContainer, error) {
+	var containers []dockerContainer
+	err := d.getJSON("/containers/json?all=1", &containers)
+	return containers, err
+}
+
+// InspectContainer retourne la description complète d'un conteneur
+func (d *DockerClient) InspectContainer(name string) (*dockerContainerJSON, json.RawMessage, error) {
+	var raw json.RawMessage
+	if err := d.getJSON("/containers/"+url.PathEscape(name)+"/json", &raw); err != nil {
+		return nil, nil, err
+	}
+	var container dockerContainerJSON
+	if err := json.Unmarshal(raw, &container); err != nil {
+		return nil, nil, fmt.Errorf("réponse Docker invalide: %v", err)
+	}
+	return &container, raw, nil
+}
+
+// ContainerStats retourne un échantillon de statistiques sans attendre de second échantillon (one-shot)
+func (d *DockerClient) ContainerStats(id string) (*dockerStats, error) {
+	var stats dockerStats
+	err := d.getJSON("/containers/"+url.PathEscape(id)+"/stats?stream=false&one-shot=true", &stats)
+	return &stats, err
+}
+
+// ContainerAction exécute une action sans corps sur un conteneur (start, stop, restart, pause, unpause)
+// Un conteneur déjà dans l'état demandé (304) n'est pas une erreur
+func (d *DockerClient) ContainerAction(name, action string, query url.Values) error {
+	path := "/containers/" + url.PathEscape(name) + "/" + action
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return d.do(http.MethodPost, path, nil, nil)
+}
+
+// RemoveContainer supprime un conteneur
+func (d *DockerClient) RemoveContainer(name string, force, volumes bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "1")
+	}
+	if volumes {
+		query.Set("v", "1")
+	}
+	return d.do(http.MethodDelete, "/containers/"+url.PathEscape(name)+"?"+query.Encode(), nil, nil)
+}
+
+// RenameContainer renomme un conteneur
+func (d *DockerClient) RenameContainer(name, newName string) error {
+	return d.do(http.MethodPost, "/containers/"+url.PathEscape(name)+"/rename?name="+url.QueryEscape(newName), nil, nil)
+}
+
+// CreateContainer crée un conteneur et retourne son identifiant
+func (d *DockerClient) CreateContainer(name string, body interface{}) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := d.do(http.MethodPost, "/containers/create?name="+url.QueryEscape(name), body, &created)
+	return created.ID, err
+}
+
+// ConnectNetwork connecte un conteneur à un réseau supplémentaire
+func (d *DockerClient) ConnectNetwork(network, container string, endpoint json.RawMessage) error {
+	body := map[string]interface{}{"Container": container, "EndpointConfig": endpoint}
+	return d.do(http.MethodPost, "/networks/"+url.PathEscape(network)+"/connect", body, nil)
+}
+
+// PullImage télécharge une image et retourne les messages d'état du téléchargement
+// Seuls les registres publics, ou accessibles sans authentification, sont supportés
+func (d *DockerClient) PullImage(ctx context.Context, image string) ([]string, error) {
+	query := url.Values{"fromImage": {image}}
+	// Sans étiquette, Docker téléchargerait toutes les versions de l'image
+	if !imageHasTag(image) {
+		query.Set("tag", "latest")
+	}
+
+	resp, err := d.stream(ctx, http.MethodPost, "/images/create?"+query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// La progression est transmise en objets JSON successifs, une erreur pouvant survenir en cours de flux
+	var statuses []string
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Status string `json:"status"`
+			ID     string `json:"id"`
+			Error  string `json:"error"`
+		}
+		if err := decoder.Decode(&event); err == io.EOF {
+			break
+		} else if err != nil {
+			return statuses, fmt.Errorf("lecture de la progression impossible: %v", err)
+		}
+		if event.Error != "" {
+			return statuses, errors.New(event.Error)
+		}
+		// Les étapes par couche (Downloading, Extracting) ne sont pas conservées
+		if event.ID == "" || strings.HasPrefix(event.Status, "Pull complete") || strings.HasPrefix(event.Status, "Already exists") {
+			statuses = append(statuses, strings.TrimSpace(event.ID+" "+event.Status))
+		}
+	}
+	return statuses, nil
+}
+
+// Events suit le flux des événements des conteneurs jusqu'à l'annulation du contexte
+// onEvent est appelée pour chaque événement reçu
+func (d *DockerClient) Events(ctx context.Context, onEvent func(dockerEvent)) error {
+	filters, _ := json.Marshal(map[string][]string{"type": {"container"}})
+	resp, err := d.stream(ctx, http.MethodGet, "/events?"+url.Values{"filters": {string(filters)}}.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event dockerEvent
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err == io.EOF {
+				return fmt.Errorf("flux des événements interrompu")
+			}
+			return fmt.Errorf("lecture des événements impossible: %v", err)
+		}
+		onEvent(event)
+	}
+}
+
+// ContainerLogs ouvre le flux des logs d'un conteneur et le démultiplexe en lignes
+// onLines est appelée pour chaque lot de lignes lues; le suivi s'arrête à l'annulation du contexte
+func (d *DockerClient) ContainerLogs(ctx context.Context, name string, tty bool, options dockerLogOptions, onLines func([]string)) error {
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}, "tail": {strconv.Itoa(options.Tail)}}
+	if options.Since > 0 {
+		query.Set("since", strconv.FormatInt(options.Since, 10))
+	}
+	if options.Follow {
+		query.Set("follow", "1")
+	}
+	if options.Timestamps {
+		query.Set("timestamps", "1")
+	}
+
+	resp, err := d.stream(ctx, http.MethodGet, "/containers/"+url.PathEscape(name)+"/logs?"+query.Encode())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if !tty {
+		reader = &dockerLogDemuxer{source: resp.Body}
+	}
+
+	var pending []byte
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(buf)
+		if n > 0 {
+			pending = append(pending, buf[:n]...)
+			if end := bytes.LastIndexByte(pending, '\n'); end >= 0 {
+				onLines(strings.Split(string(pending[:end]), "\n"))
+				pending = append(pending[:0], pending[end+1:]...)
+			}
+		}
+		if err != nil {
+			if len(pending) > 0 {
+				onLines([]string{string(pending)})
+			}
+			if err == io.EOF || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// dockerLogDemuxer retire les en-têtes de 8 octets qui multiplexent stdout et stderr hors TTY
+type dockerLogDemuxer struct {
+	source    io.Reader
+	remaining int // Octets restants dans la trame en cours
+}
+
+func (m *dockerLogDemuxer) Read(p []byte) (int, error) {
+	for m.remaining == 0 {
+		var header [8]byte
+		if _, err := io.ReadFull(m.source, header[:]); err != nil {
+			if err == io.ErrUnexpectedEOF {
+				err = io.EOF
+			}
+			return 0, err
+		}
+		m.remaining = int(binary.BigEndian.Uint32(header[4:]))
+	}
+	if len(p) > m.remaining {
+		p = p[:m.remaining]
+	}
+	n, err := m.source.Read(p)
+	m.remaining -= n
+	return n, err
+}
+
+// getJSON exécute une requête GET et décode la réponse
+func (d *DockerClient) getJSON(path string, out interface{}) error {
+	return d.do(http.MethodGet, path, nil, out)
+}
+
+// do exécute une requête courte vers l'API et décode la réponse éventuelle
+func (d *DockerClient) do(method, path string, body, out interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dockerRequestTimeout)
+	defer cancel()
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, d.url(path), reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("API Docker injoignable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+	if resp.StatusCode >= 300 {
+		return dockerResponseError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("réponse Docker invalide: %v", err)
+	}
+	return nil
+}
+
+// stream exécute une requête dont la réponse est lue au fil de l'eau, sans autre délai que le contexte
+func (d *DockerClient) stream(ctx context.Context, method, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, d.url(path), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("API Docker injoignable: %v", err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		return nil, dockerResponseError(resp)
+	}
+	return resp, nil
+}
+
+// url construit l'URL versionnée d'un chemin de l'API
+func (d *DockerClient) url(path string) string {
+	return d.baseURL + "/v" + d.version + path
+}
+
+// dockerResponseError construit l'erreur correspondant à une réponse en échec ({"message": "..."})
+func dockerResponseError(resp *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if json.Unmarshal(data, &body) != nil || body.Message == "" {
+		body.Message = strings.TrimSpace(string(data))
+	}
+	if body.Message == "" {
+		body.Message = resp.Status
+	}
+	return &DockerError{StatusCode: resp.StatusCode, Message: body.Message}
+}
+
+// compareAPIVersions compare deux versions d'API de la forme 1.43
+func compareAPIVersions(a, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// imageHasTag indique si une référence d'image précise une étiquette ou un condensat
+func imageHasTag(image string) bool {
+	if strings.Contains(image, "@") {
+		return true
+	}
+	// Le port d'un registre (registry:5000/app) n'est pas une étiquette
+	name := image[strings.LastIndex(image, "/")+1:]
+	return strings.Contains(name, ":")
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// newDockerTestSocket retourne l'adresse d'un socket unix qui n'est pas encore en écoute
+func newDockerTestSocket(t *testing.T) (host, path string) {
+	t.Helper()
+	path = filepath.Join(t.TempDir(), "docker.sock")
+	return "unix://" + path, path
+}
+
+// startDockerTestDaemon simule l'API Docker Engine sur un socket unix
+// Le démon annonce la version d'API 1.41, les chemins versionnés sont transmis à handler sans leur préfixe
+func startDockerTestDaemon(t *testing.T, path string, handler http.HandlerFunc) {
+	t.Helper()
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("socket unix indisponible: %v", err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_ping" {
+			w.Header().Set("Api-Version", "1.41")
+			io.WriteString(w, "OK")
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/v1.41/") {
+			http.Error(w, `{"message":"version d'API non négociée"}`, http.StatusBadRequest)
+			return
+		}
+		r.URL.Path = strings.TrimPrefix(r.URL.Path, "/v1.41")
+		handler(w, r)
+	}))
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+}
+
+// dockerLogFrame encode une trame du flux multiplexé des logs (1 = stdout, 2 = stderr)
+func dockerLogFrame(stream byte, data string) []byte {
+	frame := make([]byte, 8, 8+len(data))
+	frame[0] = stream
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(data)))
+	return append(frame, data...)
+}
+
+func TestDockerLogDemuxer(t *testing.T) {
+	var stream bytes.Buffer
+	stream.Write(dockerLogFrame(1, "première ligne\ndébut "))
+	stream.Write(dockerLogFrame(2, ""))
+	stream.Write(dockerLogFrame(2, "de ligne sur stderr\n"))
+	stream.Write(dockerLogFrame(1, "dernière ligne\n"))
+
+	// Lecture octet par octet: les en-têtes et les trames sont coupés entre plusieurs lectures
+	demuxer := &dockerLogDemuxer{source: iotest.OneByteReader(bytes.NewReader(stream.Bytes()))}
+	data, err := io.ReadAll(demuxer)
+	if err != nil {
+		t.Fatalf("lecture: %v", err)
+	}
+	if want := "première ligne\ndébut de ligne sur stderr\ndernière ligne\n"; string(data) != want {
+		t.Errorf("logs démultiplexés = %q, attendu %q", data, want)
+	}
+
+	// Un en-tête tronqué termine le flux sans erreur
+	truncated := append(dockerLogFrame(1, "ligne\n"), 1, 0, 0)
+	data, err = io.ReadAll(&dockerLogDemuxer{source: bytes.NewReader(truncated)})
+	if err != nil || string(data) != "ligne\n" {
+		t.Errorf("flux tronqué: %q, %v", data, err)
+	}
+}
+
+func TestDockerClientContainerLogs(t *testing.T) {
+	host, path := newDockerTestSocket(t)
+	startDockerTestDaemon(t, path, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/web/logs" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.URL.Query().Get("tail"); got != "50" {
+			t.Errorf("tail = %q", got)
+		}
+		if r.URL.Query().Get("stdout") != "1" || r.URL.Query().Get("stderr") != "1" {
+			t.Errorf("stdout et stderr devraient être demandés: %s", r.URL.RawQuery)
+		}
+		w.Write(dockerLogFrame(1, "ligne 1\nli"))
+		w.Write(dockerLogFrame(2, "gne 2\n"))
+		w.Write(dockerLogFrame(1, "ligne 3"))
+	})
+
+	client, err := NewDockerClient(host)
+	if err != nil {
+		t.Fatalf("NewDockerClient: %v", err)
+	}
+	if err := client.Ping(); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	var lines []string
+	err = client.ContainerLogs(context.Background(), "web", false, dockerLogOptions{Tail: 50}, func(batch []string) {
+		lines = append(lines, batch...)
+	})
+	if err != nil {
+		t.Fatalf("ContainerLogs: %v", err)
+	}
+	if want := []string{"ligne 1", "ligne 2", "ligne 3"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("lignes = %q, attendu %q", lines, want)
+	}
+
+	if err := client.ContainerLogs(context.Background(), "absent", false, dockerLogOptions{Tail: 50}, func([]string) {}); err == nil {
+		t.Error("les logs d'un conteneur inconnu devraient être refusés")
+	}
+}
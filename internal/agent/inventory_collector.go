@@ -0,0 +1,78 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// InventoryCollector collecte l'inventaire matériel et logiciel de la machine
+type InventoryCollector struct{}
+
+// NewInventoryCollector crée un nouveau collecteur d'inventaire
+func NewInventoryCollector() *InventoryCollector {
+	return &InventoryCollector{}
+}
+
+// Collect collecte l'inventaire complet et calcule son empreinte
+func (ic *InventoryCollector) Collect() *common.Inventory {
+	inventory := &common.Inventory{
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+		CPUCores: runtime.NumCPU(),
+		NICs:     collectNICs(),
+	}
+	inventory.Hostname, _ = os.Hostname()
+
+	collectPlatformInventory(inventory)
+
+	sort.Slice(inventory.Packages, func(i, j int) bool {
+		if inventory.Packages[i].Name != inventory.Packages[j].Name {
+			return inventory.Packages[i].Name < inventory.Packages[j].Name
+		}
+		return inventory.Packages[i].Arch < inventory.Packages[j].Arch
+	})
+
+	inventory.Hash = inventoryHash(inventory)
+	inventory.CollectedAt = time.Now().UTC().Format(time.RFC3339)
+	return inventory
+}
+
+// inventoryHash calcule l'empreinte du contenu de l'inventaire
+func inventoryHash(inventory *common.Inventory) string {
+	content := *inventory
+	content.Hash = ""
+	content.CollectedAt = ""
+	data, err := json.Marshal(&content)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// collectNICs retourne les cartes réseau disposant d'une adresse MAC
+func collectNICs() []*common.InventoryNIC {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var nics []*common.InventoryNIC
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 || len(iface.HardwareAddr) == 0 {
+			continue
+		}
+		nic := &common.InventoryNIC{Name: iface.Name, MAC: iface.HardwareAddr.String()}
+		nicDetails(nic)
+		nics = append(nics, nic)
+	}
+	return nics
+}
@@ -0,0 +1,320 @@
+//go:build linux
+
+package agent
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// Bases de paquets lues directement, sans passer par les outils du gestionnaire
+const (
+	dpkgStatusFile   = "/var/lib/dpkg/status"
+	apkInstalledFile = "/lib/apk/db/installed"
+)
+
+// rpmQueryTimeout borne la durée de la requête rpm
+const rpmQueryTimeout = time.Minute
+
+// collectPlatformInventory complète l'inventaire depuis /proc, /sys et les bases de paquets
+func collectPlatformInventory(inventory *common.Inventory) {
+	inventory.OSRelease = readOSRelease()
+	inventory.Kernel = readSysFile("/proc/sys/kernel/osrelease")
+	inventory.CPUModel = readCPUModel()
+	inventory.MemoryTotal = readMemTotal()
+	inventory.DMI = readDMI()
+	inventory.Disks = readDisks()
+	inventory.PackageManager, inventory.Packages = readInstalledPackages()
+}
+
+// readSysFile lit un fichier d'une ligne de /proc ou /sys
+func readSysFile(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// readOSRelease lit /etc/os-release (ou /usr/lib/os-release)
+func readOSRelease() *common.OSRelease {
+	var file *os.File
+	var err error
+	for _, path := range []string{"/etc/os-release", "/usr/lib/os-release"} {
+		if file, err = os.Open(path); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	release := &common.OSRelease{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			release.ID = value
+		case "NAME":
+			release.Name = value
+		case "VERSION":
+			release.Version = value
+		case "VERSION_ID":
+			release.VersionID = value
+		case "PRETTY_NAME":
+			release.PrettyName = value
+		}
+	}
+	return release
+}
+
+// readCPUModel lit le modèle du processeur depuis /proc/cpuinfo
+func readCPUModel() string {
+	file, err := os.Open("/proc/cpuinfo")
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	// "model name" sur x86, "Model" ou "Hardware" sur ARM
+	var fallback string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		switch key {
+		case "model name":
+			return value
+		case "Model", "Hardware":
+			if fallback == "" {
+				fallback = value
+			}
+		}
+	}
+	return fallback
+}
+
+// readMemTotal lit la mémoire totale depuis /proc/meminfo
+func readMemTotal() int64 {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseInt(fields[1], 10, 64)
+			return kb * 1024
+		}
+	}
+	return 0
+}
+
+// readDMI lit l'identification matérielle depuis /sys/class/dmi/id
+// Le numéro de série n'est lisible qu'avec les droits root
+func readDMI() *common.DMIInfo {
+	const dir = "/sys/class/dmi/id"
+	if _, err := os.Stat(dir); err != nil {
+		return nil
+	}
+	return &common.DMIInfo{
+		Vendor:      readSysFile(filepath.Join(dir, "sys_vendor")),
+		Product:     readSysFile(filepath.Join(dir, "product_name")),
+		Serial:      readSysFile(filepath.Join(dir, "product_serial")),
+		BoardVendor: readSysFile(filepath.Join(dir, "board_vendor")),
+		BoardName:   readSysFile(filepath.Join(dir, "board_name")),
+		BIOSVendor:  readSysFile(filepath.Join(dir, "bios_vendor")),
+		BIOSVersion: readSysFile(filepath.Join(dir, "bios_version")),
+	}
+}
+
+// readDisks liste les disques physiques depuis /sys/block
+// Les périphériques virtuels (loop, ram, device-mapper) n'ont pas de lien device et sont ignorés
+func readDisks() []*common.InventoryDisk {
+	entries, err := os.ReadDir("/sys/block")
+	if err != nil {
+		return nil
+	}
+
+	var disks []*common.InventoryDisk
+	for _, entry := range entries {
+		dir := filepath.Join("/sys/block", entry.Name())
+		if _, err := os.Stat(filepath.Join(dir, "device")); err != nil {
+			continue
+		}
+
+		sectors, _ := strconv.ParseInt(readSysFile(filepath.Join(dir, "size")), 10, 64)
+		serial := readSysFile(filepath.Join(dir, "device", "serial"))
+		if serial == "" {
+			serial = readSysFile(filepath.Join(dir, "serial"))
+		}
+		disks = append(disks, &common.InventoryDisk{
+			Name:       entry.Name(),
+			Model:      readSysFile(filepath.Join(dir, "device", "model")),
+			Serial:     serial,
+			Size:       sectors * 512, // /sys/block/*/size est toujours exprimé en secteurs de 512 octets
+			Rotational: readSysFile(filepath.Join(dir, "queue", "rotational")) == "1",
+			Removable:  readSysFile(filepath.Join(dir, "removable")) == "1",
+		})
+	}
+	return disks
+}
+
+// nicDetails complète une carte réseau avec son pilote et sa vitesse de lien
+func nicDetails(nic *common.InventoryNIC) {
+	dir := filepath.Join("/sys/class/net", nic.Name)
+	if driver, err := os.Readlink(filepath.Join(dir, "device", "driver")); err == nil {
+		nic.Driver = filepath.Base(driver)
+	}
+	// speed vaut -1 ou n'est pas lisible lorsque le lien est absent
+	if speed, err := strconv.Atoi(readSysFile(filepath.Join(dir, "speed"))); err == nil && speed > 0 {
+		nic.Speed = speed
+	}
+}
+
+// readInstalledPackages retourne le gestionnaire de paquets détecté et les paquets installés
+func readInstalledPackages() (string, []*common.InventoryPackage) {
+	if _, err := os.Stat(dpkgStatusFile); err == nil {
+		return "dpkg", readDpkgPackages()
+	}
+	if _, err := os.Stat(apkInstalledFile); err == nil {
+		return "apk", readApkPackages()
+	}
+	if _, err := exec.LookPath("rpm"); err == nil {
+		return "rpm", readRpmPackages()
+	}
+	return "", nil
+}
+
+// readDpkgPackages lit les paquets installés depuis la base dpkg
+func readDpkgPackages() []*common.InventoryPackage {
+	file, err := os.Open(dpkgStatusFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var packages []*common.InventoryPackage
+	var current common.InventoryPackage
+	installed := false
+	flush := func() {
+		if installed && current.Name != "" {
+			pkg := current
+			packages = append(packages, &pkg)
+		}
+		current = common.InventoryPackage{}
+		installed = false
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		// Lignes de continuation (descriptions, fichiers de configuration)
+		if line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch key {
+		case "Package":
+			current.Name = value
+		case "Version":
+			current.Version = value
+		case "Architecture":
+			current.Arch = value
+		case "Status":
+			installed = strings.HasSuffix(value, " installed")
+		}
+	}
+	flush()
+	return packages
+}
+
+// readApkPackages lit les paquets installés depuis la base apk
+func readApkPackages() []*common.InventoryPackage {
+	file, err := os.Open(apkInstalledFile)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var packages []*common.InventoryPackage
+	current := &common.InventoryPackage{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if current.Name != "" {
+				packages = append(packages, current)
+			}
+			current = &common.InventoryPackage{}
+			continue
+		}
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		switch line[0] {
+		case 'P':
+			current.Name = line[2:]
+		case 'V':
+			current.Version = line[2:]
+		case 'A':
+			current.Arch = line[2:]
+		}
+	}
+	if current.Name != "" {
+		packages = append(packages, current)
+	}
+	return packages
+}
+
+// readRpmPackages interroge la base rpm, dont le format binaire n'est pas lisible directement
+func readRpmPackages() []*common.InventoryPackage {
+	ctx, cancel := context.WithTimeout(context.Background(), rpmQueryTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "rpm", "-qa", "--qf",
+		`%{NAME}\t%|EPOCH?{%{EPOCH}:}:{}|%{VERSION}-%{RELEASE}\t%{ARCH}\n`).Output()
+	if err != nil {
+		return nil
+	}
+
+	var packages []*common.InventoryPackage
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || fields[0] == "" || fields[0] == "gpg-pubkey" {
+			continue
+		}
+		packages = append(packages, &common.InventoryPackage{Name: fields[0], Version: fields[1], Arch: fields[2]})
+	}
+	return packages
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package agent
+
+import "remoteshell/internal/common"
+
+// collectPlatformInventory n'est pas implémenté hors Linux
+// Seules les informations portables (OS, architecture, cœurs, cartes réseau) sont collectées
+func collectPlatformInventory(inventory *common.Inventory) {}
+
+// nicDetails n'est pas disponible hors Linux
+func nicDetails(nic *common.InventoryNIC) {}
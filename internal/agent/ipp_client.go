@@ -0,0 +1,458 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Opérations IPP utilisées (RFC 8011 et extensions CUPS)
+const (
+	ippOpGetJobs              uint16 = 0x000A
+	ippOpGetPrinterAttributes uint16 = 0x000B
+	ippOpCUPSGetDefault       uint16 = 0x4001
+	ippOpCUPSGetPrinters      uint16 = 0x4002
+)
+
+// Balises de groupes et de valeurs IPP (RFC 8010)
+const (
+	ippTagOperation       byte = 0x01
+	ippTagJob             byte = 0x02
+	ippTagEnd             byte = 0x03
+	ippTagPrinter         byte = 0x04
+	ippTagInteger         byte = 0x21
+	ippTagBoolean         byte = 0x22
+	ippTagEnum            byte = 0x23
+	ippTagDateTime        byte = 0x31
+	ippTagBegCollection   byte = 0x34
+	ippTagTextWithLang    byte = 0x35
+	ippTagNameWithLang    byte = 0x36
+	ippTagEndCollection   byte = 0x37
+	ippTagText            byte = 0x41
+	ippTagName            byte = 0x42
+	ippTagKeyword         byte = 0x44
+	ippTagURI             byte = 0x45
+	ippTagCharset         byte = 0x47
+	ippTagNaturalLanguage byte = 0x48
+)
+
+// ippStatusNotFound est retourné par CUPS lorsqu'aucun objet ne correspond (pas d'imprimante par défaut, aucune file)
+const ippStatusNotFound uint16 = 0x0406
+
+// ippRequestID numérote les requêtes IPP émises par l'agent
+var ippRequestID uint32
+
+// ippAttribute est un attribut d'une requête IPP
+type ippAttribute struct {
+	tag    byte
+	name   string
+	values []string
+}
+
+// ippAttributes associe le nom d'un attribut d'une réponse IPP à ses valeurs
+// Les valeurs sont des string (textes, mots-clés, URI), des int (entiers, énumérations), des bool ou des time.Time
+type ippAttributes map[string][]interface{}
+
+// String retourne la première valeur textuelle d'un attribut
+func (a ippAttributes) String(name string) string {
+	for _, value := range a[name] {
+		if s, ok := value.(string); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// Strings retourne les valeurs textuelles d'un attribut
+func (a ippAttributes) Strings(name string) []string {
+	var values []string
+	for _, value := range a[name] {
+		if s, ok := value.(string); ok {
+			values = append(values, s)
+		}
+	}
+	return values
+}
+
+// Int retourne la première valeur entière d'un attribut
+func (a ippAttributes) Int(name string) (int, bool) {
+	for _, value := range a[name] {
+		if i, ok := value.(int); ok {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// Ints retourne les valeurs entières d'un attribut
+func (a ippAttributes) Ints(name string) []int {
+	var values []int
+	for _, value := range a[name] {
+		if i, ok := value.(int); ok {
+			values = append(values, i)
+		}
+	}
+	return values
+}
+
+// Bool retourne la valeur booléenne d'un attribut et sa présence
+func (a ippAttributes) Bool(name string) (bool, bool) {
+	for _, value := range a[name] {
+		if b, ok := value.(bool); ok {
+			return b, true
+		}
+	}
+	return false, false
+}
+
+// ippResponse est une réponse IPP décodée
+type ippResponse struct {
+	status   uint16
+	printers []ippAttributes
+	jobs     []ippAttributes
+}
+
+// IPPClient interroge CUPS ou une imprimante directement via le protocole IPP
+type IPPClient struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	userName   string
+}
+
+// NewIPPClient crée un client IPP pour le serveur donné (ex: http://localhost:631 ou ipp://printer.local)
+func NewIPPClient(serverURL string) (*IPPClient, error) {
+	parsed, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("URL IPP invalide: %v", err)
+	}
+
+	// Les schémas ipp et ipps sont transportés en HTTP(S), port 631 par défaut
+	switch parsed.Scheme {
+	case "ipp", "ipps":
+		if parsed.Port() == "" {
+			parsed.Host += ":631"
+		}
+		if parsed.Scheme == "ipp" {
+			parsed.Scheme = "http"
+		} else {
+			parsed.Scheme = "https"
+		}
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("schéma IPP non supporté: %s", parsed.Scheme)
+	}
+	parsed.Path = strings.TrimSuffix(parsed.Path, "/")
+
+	return &IPPClient{
+		baseURL:    parsed,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		userName:   "remoteshell",
+	}, nil
+}
+
+// GetPrinters liste les files d'impression du serveur CUPS (CUPS-Get-Printers)
+func (c *IPPClient) GetPrinters() ([]ippAttributes, error) {
+	resp, err := c.do("/", ippOpCUPSGetPrinters, []ippAttribute{
+		{tag: ippTagKeyword, name: "requested-attributes", values: []string{"printer-name", "printer-uri-supported"}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.printers, nil
+}
+
+// GetDefaultPrinter retourne le nom de l'imprimante par défaut, vide s'il n'y en a pas (CUPS-Get-Default)
+func (c *IPPClient) GetDefaultPrinter() (string, error) {
+	resp, err := c.do("/", ippOpCUPSGetDefault, []ippAttribute{
+		{tag: ippTagKeyword, name: "requested-attributes", values: []string{"printer-name"}},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.printers) == 0 {
+		return "", nil
+	}
+	return resp.printers[0].String("printer-name"), nil
+}
+
+// GetPrinterAttributes retourne l'état détaillé d'une imprimante (Get-Printer-Attributes)
+func (c *IPPClient) GetPrinterAttributes(name string) (ippAttributes, error) {
+	resp, err := c.do(c.printerPath(name), ippOpGetPrinterAttributes, []ippAttribute{
+		{tag: ippTagURI, name: "printer-uri", values: []string{c.printerURI(name)}},
+		{tag: ippTagKeyword, name: "requested-attributes", values: []string{
+			"printer-name", "printer-state", "printer-state-reasons", "printer-state-message",
+			"printer-info", "printer-location", "printer-make-and-model", "device-uri",
+			"printer-uri-supported", "printer-is-accepting-jobs", "queued-job-count",
+			"marker-names", "marker-types", "marker-colors", "marker-levels",
+			"marker-low-levels", "marker-high-levels",
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.printers) == 0 {
+		return nil, fmt.Errorf("aucun attribut retourné pour l'imprimante %s", name)
+	}
+	return resp.printers[0], nil
+}
+
+// ippJobAttributes liste les attributs demandés pour chaque travail
+var ippJobAttributes = []string{
+	"job-id", "job-name", "job-originating-user-name", "job-k-octets",
+	"job-state", "job-state-reasons", "job-priority", "time-at-creation",
+	"time-at-completed", "job-impressions-completed",
+}
+
+// GetJobs retourne les travaux non terminés d'une imprimante (Get-Jobs)
+func (c *IPPClient) GetJobs(name string) ([]ippAttributes, error) {
+	resp, err := c.do(c.printerPath(name), ippOpGetJobs, []ippAttribute{
+		{tag: ippTagURI, name: "printer-uri", values: []string{c.printerURI(name)}},
+		{tag: ippTagKeyword, name: "which-jobs", values: []string{"not-completed"}},
+		{tag: ippTagKeyword, name: "requested-attributes", values: ippJobAttributes},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.jobs, nil
+}
+
+// GetCompletedJobs retourne au plus limit travaux terminés d'une imprimante (Get-Jobs)
+// CUPS retourne l'historique du travail le plus récent au plus ancien
+func (c *IPPClient) GetCompletedJobs(name string, limit int) ([]ippAttributes, error) {
+	resp, err := c.do(c.printerPath(name), ippOpGetJobs, []ippAttribute{
+		{tag: ippTagURI, name: "printer-uri", values: []string{c.printerURI(name)}},
+		{tag: ippTagKeyword, name: "which-jobs", values: []string{"completed"}},
+		{tag: ippTagInteger, name: "limit", values: []string{ippInteger(limit)}},
+		{tag: ippTagKeyword, name: "requested-attributes", values: ippJobAttributes},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.jobs, nil
+}
+
+// printerPath retourne le chemin HTTP d'une file d'impression CUPS
+func (c *IPPClient) printerPath(name string) string {
+	return "/printers/" + url.PathEscape(name)
+}
+
+// printerURI retourne l'URI IPP d'une file d'impression, telle qu'attendue dans l'attribut printer-uri
+func (c *IPPClient) printerURI(name string) string {
+	return "ipp://" + c.baseURL.Host + c.baseURL.Path + c.printerPath(name)
+}
+
+// do envoie une requête IPP et décode sa réponse
+func (c *IPPClient) do(path string, operation uint16, attributes []ippAttribute) (*ippResponse, error) {
+	requestID := atomic.AddUint32(&ippRequestID, 1)
+	body := encodeIPPRequest(operation, requestID, append([]ippAttribute{
+		{tag: ippTagCharset, name: "attributes-charset", values: []string{"utf-8"}},
+		{tag: ippTagNaturalLanguage, name: "attributes-natural-language", values: []string{"en"}},
+		{tag: ippTagName, name: "requesting-user-name", values: []string{c.userName}},
+	}, attributes...))
+
+	// Le chemin d'une file est déjà échappé et ne doit pas l'être une seconde fois
+	target := *c.baseURL
+	target.RawPath = c.baseURL.EscapedPath() + path
+	target.Path, _ = url.PathUnescape(target.RawPath)
+	httpResp, err := c.httpClient.Post(target.String(), "application/ipp", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("requête IPP échouée: %v", err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("requête IPP refusée: HTTP %d", httpResp.StatusCode)
+	}
+
+	resp, err := decodeIPPResponse(bufio.NewReader(httpResp.Body))
+	if err != nil {
+		return nil, fmt.Errorf("réponse IPP invalide: %v", err)
+	}
+	// Les statuts 0x00xx indiquent un succès, éventuellement partiel
+	if resp.status >= 0x0100 && resp.status != ippStatusNotFound {
+		return nil, fmt.Errorf("erreur IPP 0x%04x", resp.status)
+	}
+	return resp, nil
+}
+
+// ippInteger encode un entier IPP (4 octets big-endian) comme valeur d'attribut de requête
+func ippInteger(v int) string {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], uint32(int32(v)))
+	return string(buf[:])
+}
+
+// encodeIPPRequest encode une requête IPP 2.0 dont tous les attributs appartiennent au groupe opération
+func encodeIPPRequest(operation uint16, requestID uint32, attributes []ippAttribute) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0x02, 0x00})
+	binary.Write(&buf, binary.BigEndian, operation)
+	binary.Write(&buf, binary.BigEndian, requestID)
+	buf.WriteByte(ippTagOperation)
+
+	for _, attribute := range attributes {
+		for i, value := range attribute.values {
+			name := attribute.name
+			// Les valeurs supplémentaires d'un attribut multivalué ont un nom vide
+			if i > 0 {
+				name = ""
+			}
+			buf.WriteByte(attribute.tag)
+			binary.Write(&buf, binary.BigEndian, uint16(len(name)))
+			buf.WriteString(name)
+			binary.Write(&buf, binary.BigEndian, uint16(len(value)))
+			buf.WriteString(value)
+		}
+	}
+
+	buf.WriteByte(ippTagEnd)
+	return buf.Bytes()
+}
+
+// decodeIPPResponse décode une réponse IPP en regroupant les attributs des imprimantes et des travaux
+// Les collections (media-col...) ne sont pas exploitées et sont ignorées
+func decodeIPPResponse(r *bufio.Reader) (*ippResponse, error) {
+	var header struct {
+		Version   uint16
+		Status    uint16
+		RequestID uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, err
+	}
+	resp := &ippResponse{status: header.Status}
+
+	var current ippAttributes
+	var lastName string
+	collectionDepth := 0
+
+	for {
+		tag, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+
+		// Balise de délimitation: début d'un nouveau groupe ou fin des attributs
+		if tag <= 0x0F {
+			switch tag {
+			case ippTagEnd:
+				return resp, nil
+			case ippTagPrinter:
+				current = make(ippAttributes)
+				resp.printers = append(resp.printers, current)
+			case ippTagJob:
+				current = make(ippAttributes)
+				resp.jobs = append(resp.jobs, current)
+			default:
+				current = make(ippAttributes)
+			}
+			lastName = ""
+			continue
+		}
+
+		name, err := readIPPField(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := readIPPField(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch tag {
+		case ippTagBegCollection:
+			collectionDepth++
+			continue
+		case ippTagEndCollection:
+			if collectionDepth > 0 {
+				collectionDepth--
+			}
+			continue
+		}
+		if collectionDepth > 0 || current == nil {
+			continue
+		}
+
+		if len(name) > 0 {
+			lastName = string(name)
+		}
+		if lastName == "" {
+			continue
+		}
+		if decoded, ok := decodeIPPValue(tag, value); ok {
+			current[lastName] = append(current[lastName], decoded)
+		}
+	}
+}
+
+// readIPPField lit un champ préfixé par sa longueur sur 2 octets
+func readIPPField(r *bufio.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	field := make([]byte, length)
+	if _, err := io.ReadFull(r, field); err != nil {
+		return nil, err
+	}
+	return field, nil
+}
+
+// decodeIPPValue convertit une valeur IPP en type Go, les types non exploités étant ignorés
+func decodeIPPValue(tag byte, value []byte) (interface{}, bool) {
+	switch tag {
+	case ippTagInteger, ippTagEnum:
+		if len(value) != 4 {
+			return nil, false
+		}
+		return int(int32(binary.BigEndian.Uint32(value))), true
+	case ippTagBoolean:
+		if len(value) != 1 {
+			return nil, false
+		}
+		return value[0] != 0, true
+	case ippTagDateTime:
+		return decodeIPPDateTime(value)
+	case ippTagTextWithLang, ippTagNameWithLang:
+		// Langue puis texte, chacun préfixé par sa longueur
+		if len(value) < 2 {
+			return nil, false
+		}
+		langLen := int(binary.BigEndian.Uint16(value))
+		if len(value) < 4+langLen {
+			return nil, false
+		}
+		textLen := int(binary.BigEndian.Uint16(value[2+langLen:]))
+		if len(value) < 4+langLen+textLen {
+			return nil, false
+		}
+		return string(value[4+langLen : 4+langLen+textLen]), true
+	}
+
+	// Chaînes: textes, noms, mots-clés, URI, types MIME...
+	if tag >= 0x40 && tag <= 0x5F {
+		return string(value), true
+	}
+	return nil, false
+}
+
+// decodeIPPDateTime décode une date IPP (RFC 2579, 11 octets)
+func decodeIPPDateTime(value []byte) (interface{}, bool) {
+	if len(value) != 11 {
+		return nil, false
+	}
+	offset := time.Duration(value[9])*time.Hour + time.Duration(value[10])*time.Minute
+	if value[8] == '-' {
+		offset = -offset
+	}
+	zone := time.FixedZone("", int(offset/time.Second))
+	return time.Date(int(binary.BigEndian.Uint16(value)), time.Month(value[2]), int(value[3]),
+		int(value[4]), int(value[5]), int(value[6]), int(value[7])*100*int(time.Millisecond), zone), true
+}
@@ -0,0 +1,351 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ippTagMemberName est la balise portant le nom d'un membre de collection (RFC 8010)
+const ippTagMemberName byte = 0x4A
+
+// ippTestMessage construit un message IPP encodé pour les tests
+type ippTestMessage struct {
+	bytes.Buffer
+}
+
+// newIPPTestResponse commence une réponse IPP 2.0 avec le groupe opération habituel
+func newIPPTestResponse(status uint16, requestID uint32) *ippTestMessage {
+	m := &ippTestMessage{}
+	m.Write([]byte{0x02, 0x00})
+	binary.Write(m, binary.BigEndian, status)
+	binary.Write(m, binary.BigEndian, requestID)
+	m.group(ippTagOperation)
+	m.attr(ippTagCharset, "attributes-charset", []byte("utf-8"))
+	m.attr(ippTagNaturalLanguage, "attributes-natural-language", []byte("en"))
+	return m
+}
+
+func (m *ippTestMessage) group(tag byte) {
+	m.WriteByte(tag)
+}
+
+// attr ajoute une valeur; un nom vide ajoute une valeur supplémentaire à l'attribut précédent
+func (m *ippTestMessage) attr(tag byte, name string, value []byte) {
+	m.WriteByte(tag)
+	binary.Write(m, binary.BigEndian, uint16(len(name)))
+	m.WriteString(name)
+	binary.Write(m, binary.BigEndian, uint16(len(value)))
+	m.Write(value)
+}
+
+func (m *ippTestMessage) end() []byte {
+	m.WriteByte(ippTagEnd)
+	return m.Bytes()
+}
+
+func ippTestInt(v int) []byte {
+	return []byte(ippInteger(v))
+}
+
+func ippTestTextWithLang(lang, text string) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, uint16(len(lang)))
+	buf.WriteString(lang)
+	binary.Write(&buf, binary.BigEndian, uint16(len(text)))
+	buf.WriteString(text)
+	return buf.Bytes()
+}
+
+// ippTestRequest est une requête IPP reçue par le serveur de test
+type ippTestRequest struct {
+	path       string
+	operation  uint16
+	attributes map[string][]string
+}
+
+// decodeIPPTestRequest décode une requête dont les attributs appartiennent au groupe opération
+func decodeIPPTestRequest(t *testing.T, r *http.Request) *ippTestRequest {
+	t.Helper()
+	reader := bufio.NewReader(r.Body)
+	var header struct {
+		Version   uint16
+		Operation uint16
+		RequestID uint32
+	}
+	if err := binary.Read(reader, binary.BigEndian, &header); err != nil {
+		t.Fatalf("en-tête de requête illisible: %v", err)
+	}
+
+	req := &ippTestRequest{path: r.URL.EscapedPath(), operation: header.Operation, attributes: make(map[string][]string)}
+	var lastName string
+	for {
+		tag, err := reader.ReadByte()
+		if err != nil {
+			t.Fatalf("requête tronquée: %v", err)
+		}
+		if tag == ippTagEnd {
+			return req
+		}
+		if tag <= 0x0F {
+			continue
+		}
+		name, err := readIPPField(reader)
+		if err != nil {
+			t.Fatalf("nom d'attribut illisible: %v", err)
+		}
+		value, err := readIPPField(reader)
+		if err != nil {
+			t.Fatalf("valeur d'attribut illisible: %v", err)
+		}
+		if len(name) > 0 {
+			lastName = string(name)
+		}
+		req.attributes[lastName] = append(req.attributes[lastName], string(value))
+	}
+}
+
+func newIPPTestServer(t *testing.T, handler func(req *ippTestRequest) []byte) (*httptest.Server, chan *ippTestRequest) {
+	t.Helper()
+	requests := make(chan *ippTestRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/ipp" {
+			http.Error(w, "requête IPP attendue", http.StatusBadRequest)
+			return
+		}
+		req := decodeIPPTestRequest(t, r)
+		requests <- req
+		w.Header().Set("Content-Type", "application/ipp")
+		w.Write(handler(req))
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestIPPClientGetPrinterAttributes(t *testing.T) {
+	server, requests := newIPPTestServer(t, func(req *ippTestRequest) []byte {
+		m := newIPPTestResponse(0x0000, 1)
+		m.group(ippTagPrinter)
+		m.attr(ippTagName, "printer-name", []byte("Hall RDC"))
+		m.attr(ippTagEnum, "printer-state", ippTestInt(4))
+		m.attr(ippTagKeyword, "printer-state-reasons", []byte("media-low-report"))
+		m.attr(ippTagKeyword, "", []byte("toner-low-warning"))
+		m.attr(ippTagTextWithLang, "printer-info", ippTestTextWithLang("fr-fr", "Imprimante du hall"))
+		// Collection imbriquée, ignorée par le décodeur
+		m.attr(ippTagBegCollection, "media-col-default", nil)
+		m.attr(ippTagMemberName, "", []byte("media-size"))
+		m.attr(ippTagBegCollection, "", nil)
+		m.attr(ippTagMemberName, "", []byte("x-dimension"))
+		m.attr(ippTagInteger, "", ippTestInt(21000))
+		m.attr(ippTagEndCollection, "", nil)
+		m.attr(ippTagMemberName, "", []byte("media-source"))
+		m.attr(ippTagKeyword, "", []byte("tray-1"))
+		m.attr(ippTagEndCollection, "", nil)
+		m.attr(ippTagInteger, "marker-levels", ippTestInt(80))
+		m.attr(ippTagInteger, "", ippTestInt(-3))
+		m.attr(ippTagBoolean, "printer-is-accepting-jobs", []byte{1})
+		m.attr(ippTagDateTime, "printer-state-change-date-time", []byte{0x07, 0xEA, 10, 18, 14, 30, 5, 3, '+', 2, 0})
+		// Valeur d'un type non exploité (octetString)
+		m.attr(0x30, "printer-firmware-version", []byte{0x01, 0x02})
+		return m.end()
+	})
+
+	client, err := NewIPPClient(server.URL + "/cups/")
+	if err != nil {
+		t.Fatalf("NewIPPClient: %v", err)
+	}
+	attrs, err := client.GetPrinterAttributes("Hall RDC")
+	if err != nil {
+		t.Fatalf("GetPrinterAttributes: %v", err)
+	}
+
+	req := <-requests
+	if req.operation != ippOpGetPrinterAttributes {
+		t.Errorf("opération = 0x%04x, attendu 0x%04x", req.operation, ippOpGetPrinterAttributes)
+	}
+	if want := "/cups/printers/Hall%20RDC"; req.path != want {
+		t.Errorf("chemin = %q, attendu %q", req.path, want)
+	}
+	wantURI := "ipp://" + strings.TrimPrefix(server.URL, "http://") + "/cups/printers/Hall%20RDC"
+	if got := req.attributes["printer-uri"]; !reflect.DeepEqual(got, []string{wantURI}) {
+		t.Errorf("printer-uri = %q, attendu %q", got, wantURI)
+	}
+	if got := req.attributes["requested-attributes"]; len(got) < 2 || got[0] != "printer-name" {
+		t.Errorf("requested-attributes multivalué mal encodé: %q", got)
+	}
+
+	if got := attrs.String("printer-name"); got != "Hall RDC" {
+		t.Errorf("printer-name = %q", got)
+	}
+	if got, ok := attrs.Int("printer-state"); !ok || got != 4 {
+		t.Errorf("printer-state = %d, %v", got, ok)
+	}
+	if got := attrs.Strings("printer-state-reasons"); !reflect.DeepEqual(got, []string{"media-low-report", "toner-low-warning"}) {
+		t.Errorf("printer-state-reasons = %q", got)
+	}
+	if got := attrs.String("printer-info"); got != "Imprimante du hall" {
+		t.Errorf("printer-info = %q", got)
+	}
+	if got := attrs.Ints("marker-levels"); !reflect.DeepEqual(got, []int{80, -3}) {
+		t.Errorf("marker-levels = %v", got)
+	}
+	if got, ok := attrs.Bool("printer-is-accepting-jobs"); !ok || !got {
+		t.Errorf("printer-is-accepting-jobs = %v, %v", got, ok)
+	}
+	wantDate := time.Date(2026, 10, 18, 14, 30, 5, 300*int(time.Millisecond), time.FixedZone("", 2*3600))
+	if values := attrs["printer-state-change-date-time"]; len(values) != 1 || !values[0].(time.Time).Equal(wantDate) {
+		t.Errorf("printer-state-change-date-time = %v, attendu %v", values, wantDate)
+	}
+
+	for _, name := range []string{"media-col-default", "media-size", "x-dimension", "media-source", "printer-firmware-version"} {
+		if _, ok := attrs[name]; ok {
+			t.Errorf("l'attribut %s aurait dû être ignoré", name)
+		}
+	}
+	// Les membres de la collection ne doivent pas être rattachés à l'attribut précédent
+	if got := attrs["printer-info"]; len(got) != 1 {
+		t.Errorf("printer-info a %d valeurs, attendu 1", len(got))
+	}
+}
+
+func TestIPPClientGetJobs(t *testing.T) {
+	server, requests := newIPPTestServer(t, func(req *ippTestRequest) []byte {
+		m := newIPPTestResponse(0x0000, 2)
+		m.group(ippTagJob)
+		m.attr(ippTagInteger, "job-id", ippTestInt(42))
+		m.attr(ippTagNameWithLang, "job-name", ippTestTextWithLang("fr", "Facture mars.pdf"))
+		m.attr(ippTagName, "job-originating-user-name", []byte("alice"))
+		m.attr(ippTagEnum, "job-state", ippTestInt(5))
+		m.attr(ippTagKeyword, "job-state-reasons", []byte("job-printing"))
+		m.attr(ippTagInteger, "time-at-creation", ippTestInt(1760790000))
+		m.group(ippTagJob)
+		m.attr(ippTagInteger, "job-id", ippTestInt(43))
+		m.attr(ippTagName, "job-name", []byte("Rapport"))
+		m.attr(ippTagEnum, "job-state", ippTestInt(3))
+		return m.end()
+	})
+
+	client, err := NewIPPClient(server.URL)
+	if err != nil {
+		t.Fatalf("NewIPPClient: %v", err)
+	}
+	jobs, err := client.GetJobs("Hall")
+	if err != nil {
+		t.Fatalf("GetJobs: %v", err)
+	}
+
+	req := <-requests
+	if req.operation != ippOpGetJobs {
+		t.Errorf("opération = 0x%04x, attendu 0x%04x", req.operation, ippOpGetJobs)
+	}
+	if req.path != "/printers/Hall" {
+		t.Errorf("chemin = %q", req.path)
+	}
+	if got := req.attributes["which-jobs"]; !reflect.DeepEqual(got, []string{"not-completed"}) {
+		t.Errorf("which-jobs = %q", got)
+	}
+	if got := req.attributes["requested-attributes"]; !reflect.DeepEqual(got, ippJobAttributes) {
+		t.Errorf("requested-attributes = %q", got)
+	}
+
+	if len(jobs) != 2 {
+		t.Fatalf("%d travaux décodés, attendu 2", len(jobs))
+	}
+	if id, _ := jobs[0].Int("job-id"); id != 42 {
+		t.Errorf("job-id = %d", id)
+	}
+	if got := jobs[0].String("job-name"); got != "Facture mars.pdf" {
+		t.Errorf("job-name = %q", got)
+	}
+	if got := jobs[0].String("job-originating-user-name"); got != "alice" {
+		t.Errorf("job-originating-user-name = %q", got)
+	}
+	if created, _ := jobs[0].Int("time-at-creation"); created != 1760790000 {
+		t.Errorf("time-at-creation = %d", created)
+	}
+	if id, _ := jobs[1].Int("job-id"); id != 43 {
+		t.Errorf("job-id du second travail = %d", id)
+	}
+	if state, _ := jobs[1].Int("job-state"); state != 3 {
+		t.Errorf("job-state du second travail = %d", state)
+	}
+}
+
+func TestIPPClientStatus(t *testing.T) {
+	status := uint16(ippStatusNotFound)
+	server, requests := newIPPTestServer(t, func(req *ippTestRequest) []byte {
+		return newIPPTestResponse(status, 3).end()
+	})
+
+	client, err := NewIPPClient(server.URL)
+	if err != nil {
+		t.Fatalf("NewIPPClient: %v", err)
+	}
+
+	// Aucune imprimante par défaut n'est pas une erreur
+	name, err := client.GetDefaultPrinter()
+	if err != nil || name != "" {
+		t.Errorf("GetDefaultPrinter = %q, %v", name, err)
+	}
+	if req := <-requests; req.operation != ippOpCUPSGetDefault || req.path != "/" {
+		t.Errorf("requête = 0x%04x %s", req.operation, req.path)
+	}
+
+	status = 0x0400
+	if _, err := client.GetPrinters(); err == nil || !strings.Contains(err.Error(), "0x0400") {
+		t.Errorf("GetPrinters devrait échouer avec le statut 0x0400, obtenu %v", err)
+	}
+	<-requests
+}
+
+func TestNewIPPClient(t *testing.T) {
+	tests := []struct {
+		serverURL string
+		base      string
+		uri       string
+	}{
+		{"http://localhost:631", "http://localhost:631", "ipp://localhost:631/printers/Hall"},
+		{"ipp://printer.local", "http://printer.local:631", "ipp://printer.local:631/printers/Hall"},
+		{"ipps://printer.local:8631/ipp/", "https://printer.local:8631/ipp", "ipp://printer.local:8631/ipp/printers/Hall"},
+	}
+	for _, tt := range tests {
+		client, err := NewIPPClient(tt.serverURL)
+		if err != nil {
+			t.Errorf("NewIPPClient(%q): %v", tt.serverURL, err)
+			continue
+		}
+		if got := client.baseURL.String(); got != tt.base {
+			t.Errorf("NewIPPClient(%q) base = %q, attendu %q", tt.serverURL, got, tt.base)
+		}
+		if got := client.printerURI("Hall"); got != tt.uri {
+			t.Errorf("NewIPPClient(%q) printerURI = %q, attendu %q", tt.serverURL, got, tt.uri)
+		}
+	}
+
+	if _, err := NewIPPClient("lpd://printer.local"); err == nil {
+		t.Error("le schéma lpd devrait être refusé")
+	}
+}
+
+func TestDecodeIPPResponseTruncated(t *testing.T) {
+	m := newIPPTestResponse(0x0000, 4)
+	m.group(ippTagPrinter)
+	m.attr(ippTagName, "printer-name", []byte("Hall"))
+	data := m.Bytes()
+
+	// Réponse sans balise de fin puis valeur coupée
+	for _, truncated := range [][]byte{data, data[:len(data)-2]} {
+		if _, err := decodeIPPResponse(bufio.NewReader(bytes.NewReader(truncated))); err == nil {
+			t.Errorf("une réponse tronquée de %d octets devrait être refusée", len(truncated))
+		} else if err != io.EOF && err != io.ErrUnexpectedEOF {
+			t.Errorf("erreur inattendue: %v", err)
+		}
+	}
+}
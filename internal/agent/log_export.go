@@ -0,0 +1,263 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// exportBatchSize est le nombre d'entrées envoyées par morceau d'export
+const exportBatchSize = 500
+
+// exportAckTimeout borne l'attente d'un acquittement du serveur lorsque la fenêtre d'envoi est pleine
+const exportAckTimeout = 60 * time.Second
+
+// logExport est un export en cours, annulable et régulé par les acquittements du serveur
+type logExport struct {
+	cancel context.CancelFunc
+	window int // 0 = pas de contrôle de flux (serveur ancien)
+
+	mu    sync.Mutex
+	acked int
+	acks  chan struct{} // Signalé à chaque acquittement
+}
+
+// newLogExport crée un export en cours
+func newLogExport(cancel context.CancelFunc, window int) *logExport {
+	return &logExport{
+		cancel: cancel,
+		window: window,
+		acks:   make(chan struct{}, 1),
+	}
+}
+
+// ack enregistre le dernier morceau écrit par le serveur
+func (e *logExport) ack(seq int) {
+	e.mu.Lock()
+	if seq > e.acked {
+		e.acked = seq
+	}
+	e.mu.Unlock()
+
+	select {
+	case e.acks <- struct{}{}:
+	default:
+	}
+}
+
+// wait attend que le morceau seq puisse être envoyé sans dépasser la fenêtre
+func (e *logExport) wait(ctx context.Context, seq int) error {
+	if e.window <= 0 {
+		return nil
+	}
+	timeout := time.NewTimer(exportAckTimeout)
+	defer timeout.Stop()
+
+	for {
+		e.mu.Lock()
+		ahead := seq - e.acked
+		e.mu.Unlock()
+		if ahead <= e.window {
+			return nil
+		}
+
+		select {
+		case <-e.acks:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("le serveur n'acquitte plus l'export")
+		}
+	}
+}
+
+// logExportRange est la plage de temps d'un export (bornes nulles = non bornée)
+type logExportRange struct {
+	from time.Time
+	to   time.Time
+}
+
+// contains indique si une entrée est dans la plage
+// Une entrée sans horodatage exploitable est conservée
+func (r *logExportRange) contains(entry *common.LogEntry) bool {
+	if r.from.IsZero() && r.to.IsZero() {
+		return true
+	}
+	t, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+	if err != nil {
+		return true
+	}
+	if !r.from.IsZero() && t.Before(r.from) {
+		return false
+	}
+	if !r.to.IsZero() && t.After(r.to) {
+		return false
+	}
+	return true
+}
+
+// exportBatcher regroupe les entrées exportées en morceaux
+type exportBatcher struct {
+	ctx     context.Context
+	rng     *logExportRange
+	emit    func(entries []*common.LogEntry) error
+	pending []*common.LogEntry
+}
+
+// add ajoute une entrée si elle est dans la plage et envoie le morceau s'il est complet
+func (b *exportBatcher) add(entry *common.LogEntry) error {
+	if entry == nil || !b.rng.contains(entry) {
+		return nil
+	}
+	b.pending = append(b.pending, entry)
+	if len(b.pending) >= exportBatchSize {
+		return b.flush()
+	}
+	return nil
+}
+
+// flush envoie les entrées en attente
+func (b *exportBatcher) flush() error {
+	if err := b.ctx.Err(); err != nil {
+		return err
+	}
+	if len(b.pending) == 0 {
+		return nil
+	}
+	entries := b.pending
+	b.pending = nil
+	return b.emit(entries)
+}
+
+// ExportLogs exporte l'intégralité des logs d'une source sur une plage de temps, sans limite de lignes
+// Les entrées sont transmises par morceaux à emit, dans l'ordre chronologique
+func (lm *LogManager) ExportLogs(ctx context.Context, req *common.LogExportRequest, emit func(entries []*common.LogEntry) error) error {
+	rng := &logExportRange{}
+	if req.From != "" {
+		t, err := time.Parse(time.RFC3339, req.From)
+		if err != nil {
+			return fmt.Errorf("date de début invalide: %v", err)
+		}
+		rng.from = t
+	}
+	if req.To != "" {
+		t, err := time.Parse(time.RFC3339, req.To)
+		if err != nil {
+			return fmt.Errorf("date de fin invalide: %v", err)
+		}
+		rng.to = t
+	}
+
+	batcher := &exportBatcher{ctx: ctx, rng: rng, emit: emit}
+
+	var err error
+	switch req.Type {
+	case "agent":
+		for _, entry := range lm.GetAgentLogBuffer() {
+			if err = batcher.add(entry); err != nil {
+				break
+			}
+		}
+	case "systemd":
+		err = lm.exportSystemdLogs(ctx, req, rng, batcher)
+	case "file":
+		if !lm.isAllowedPath(req.Path) {
+			return fmt.Errorf("accès non autorisé au fichier")
+		}
+		err = exportFile(req.Path, filepath.Base(req.Path), lm.definitionForPath(req.Path), batcher)
+	case "custom":
+		def := lm.SourceDefinition(req.Source)
+		if def == nil {
+			return fmt.Errorf("source de logs inconnue: %s", req.Source)
+		}
+		for _, path := range def.Files() {
+			if err = exportFile(path, def.Name, def, batcher); err != nil {
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("type de log non supporté: %s", req.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	return batcher.flush()
+}
+
+// exportSystemdLogs exporte les logs journalctl de la plage demandée
+func (lm *LogManager) exportSystemdLogs(ctx context.Context, req *common.LogExportRequest, rng *logExportRange, batcher *exportBatcher) error {
+	if !checkSystemd() {
+		return fmt.Errorf("systemd n'est pas disponible")
+	}
+
+	args := []string{"--no-pager", "--output=json"}
+	if req.Unit != "" {
+		args = append(args, "-u", req.Unit)
+	}
+	if req.Priority != "" {
+		args = append(args, "-p", req.Priority)
+	}
+	if !rng.from.IsZero() {
+		args = append(args, "--since", rng.from.Local().Format("2006-01-02 15:04:05"))
+	}
+	if !rng.to.IsZero() {
+		args = append(args, "--until", rng.to.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("échec de journalctl: %v", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+	for scanner.Scan() {
+		if err := batcher.add(parseJournalEntry(scanner.Text())); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return err
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("échec de journalctl: %v", err)
+	}
+	return scanner.Err()
+}
+
+// exportFile exporte un fichier de logs complet, compressé ou non
+func exportFile(path, source string, def *LogSourceDefinition, batcher *exportBatcher) error {
+	reader, err := openLogFile(path)
+	if err != nil {
+		return fmt.Errorf("échec de la lecture du fichier: %v", err)
+	}
+	defer reader.Close()
+
+	assembler := newEntryAssembler(def, source)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+	for scanner.Scan() {
+		if err := batcher.add(assembler.Add(scanner.Text())); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("erreur de lecture de %s: %v", path, err)
+	}
+
+	return batcher.add(assembler.Flush())
+}
@@ -1,14 +1,15 @@
 package agent
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,9 +19,12 @@ import (
 
 // LogManager gère les logs de l'agent et du système
 type LogManager struct {
-	agentLogBuffer []string
+	agentLogBuffer []*common.LogEntry
 	bufferMutex    sync.RWMutex
 	maxBufferSize  int
+	subscribers    map[int]chan *common.LogEntry // Abonnés aux nouveaux logs de l'agent
+	nextSubscriber int
+	definitions    []*LogSourceDefinition // Sources de logs configurées
 }
 
 // NewLogManager crée un nouveau gestionnaire de logs
@@ -30,20 +34,53 @@ func NewLogManager(maxBufferSize int) *LogManager {
 	}
 
 	return &LogManager{
-		agentLogBuffer: make([]string, 0, maxBufferSize),
+		agentLogBuffer: make([]*common.LogEntry, 0, maxBufferSize),
 		maxBufferSize:  maxBufferSize,
+		subscribers:    make(map[int]chan *common.LogEntry),
 	}
 }
 
-// AddAgentLog ajoute une entrée au buffer de logs de l'agent
+// AddAgentLog ajoute un message au buffer de logs de l'agent
+// Le niveau et le composant sont déduits du message
 func (lm *LogManager) AddAgentLog(message string) {
+	message = strings.TrimRight(message, "\n")
+	component, _ := splitLogComponent(message)
+	lm.AddAgentEntry(&common.LogEntry{
+		Timestamp: time.Now().Format(time.RFC3339Nano),
+		Level:     detectLogLevel(message),
+		Source:    "agent",
+		Component: component,
+		Message:   message,
+	})
+}
+
+// AddAgentEntry ajoute une entrée structurée au buffer de logs de l'agent
+func (lm *LogManager) AddAgentEntry(entry *common.LogEntry) {
 	lm.bufferMutex.Lock()
 	defer lm.bufferMutex.Unlock()
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	entry := fmt.Sprintf("[%s] %s", timestamp, message)
+	lm.appendAgentEntries(entry)
+
+	// Notifier les abonnés sans bloquer (une entrée est perdue si l'abonné est saturé)
+	for _, ch := range lm.subscribers {
+		select {
+		case ch <- entry:
+		default:
+		}
+	}
+}
 
-	lm.agentLogBuffer = append(lm.agentLogBuffer, entry)
+// LoadAgentEntries recharge des entrées existantes (historique du fichier de log) sans notifier les abonnés
+func (lm *LogManager) LoadAgentEntries(entries []*common.LogEntry) {
+	lm.bufferMutex.Lock()
+	defer lm.bufferMutex.Unlock()
+
+	lm.appendAgentEntries(entries...)
+}
+
+// appendAgentEntries ajoute des entrées en limitant la taille du buffer (le verrou doit être détenu)
+func (lm *LogManager) appendAgentEntries(entries ...*common.LogEntry) {
+	lm.agentLogBuffer = append(lm.agentLogBuffer, entries...)
 
 	// Limiter la taille du buffer
 	if len(lm.agentLogBuffer) > lm.maxBufferSize {
@@ -51,6 +88,73 @@ func (lm *LogManager) AddAgentLog(message string) {
 	}
 }
 
+// SetSourceDefinitions définit les sources de logs configurées sur l'agent
+func (lm *LogManager) SetSourceDefinitions(definitions []*LogSourceDefinition) {
+	lm.bufferMutex.Lock()
+	defer lm.bufferMutex.Unlock()
+	lm.definitions = definitions
+}
+
+// SourceDefinition retourne la définition de source portant ce nom
+func (lm *LogManager) SourceDefinition(name string) *LogSourceDefinition {
+	lm.bufferMutex.RLock()
+	defer lm.bufferMutex.RUnlock()
+	for _, def := range lm.definitions {
+		if def.Name == name {
+			return def
+		}
+	}
+	return nil
+}
+
+// definitionForPath retourne la définition de source couvrant un fichier
+func (lm *LogManager) definitionForPath(path string) *LogSourceDefinition {
+	lm.bufferMutex.RLock()
+	defer lm.bufferMutex.RUnlock()
+	for _, def := range lm.definitions {
+		if def.MatchPath(path) {
+			return def
+		}
+	}
+	return nil
+}
+
+// isAllowedPath vérifie qu'un fichier peut être lu par l'agent
+// Sont autorisés /var/log, les fichiers .log (et leurs rotations) et les sources configurées
+func (lm *LogManager) isAllowedPath(path string) bool {
+	if !filepath.IsAbs(path) || filepath.Clean(path) != path {
+		return false
+	}
+	if strings.HasPrefix(path, "/var/log/") || strings.HasSuffix(path, ".log") {
+		return true
+	}
+	if matchRotated("*.log", filepath.Base(path)) {
+		return true
+	}
+	return lm.definitionForPath(path) != nil
+}
+
+// SubscribeAgentLogs s'abonne aux nouvelles entrées du buffer de l'agent
+// La fonction retournée doit être appelée pour se désabonner
+func (lm *LogManager) SubscribeAgentLogs() (<-chan *common.LogEntry, func()) {
+	lm.bufferMutex.Lock()
+	defer lm.bufferMutex.Unlock()
+
+	id := lm.nextSubscriber
+	lm.nextSubscriber++
+	ch := make(chan *common.LogEntry, 256)
+	lm.subscribers[id] = ch
+
+	return ch, func() {
+		lm.bufferMutex.Lock()
+		defer lm.bufferMutex.Unlock()
+		if _, exists := lm.subscribers[id]; exists {
+			delete(lm.subscribers, id)
+			close(ch)
+		}
+	}
+}
+
 // ListLogSources liste les sources de logs disponibles
 func (lm *LogManager) ListLogSources() ([]*common.LogSource, error) {
 	sources := []*common.LogSource{
@@ -92,6 +196,25 @@ func (lm *LogManager) ListLogSources() ([]*common.LogSource, error) {
 		}
 	}
 
+	// Ajouter les sources configurées
+	lm.bufferMutex.RLock()
+	definitions := lm.definitions
+	lm.bufferMutex.RUnlock()
+
+	for _, def := range definitions {
+		description := def.Description
+		if description == "" {
+			description = fmt.Sprintf("Source configurée: %s", strings.Join(def.Paths, ", "))
+		}
+		sources = append(sources, &common.LogSource{
+			Name:        def.Name,
+			Type:        "custom",
+			Format:      def.Format,
+			Paths:       def.Files(),
+			Description: description,
+		})
+	}
+
 	return sources, nil
 }
 
@@ -104,6 +227,8 @@ func (lm *LogManager) GetLogs(req *common.LogRequest) ([]*common.LogEntry, error
 		return lm.getSystemdLogs(req)
 	case "file":
 		return lm.getFileLogs(req)
+	case "custom":
+		return lm.getCustomLogs(req)
 	default:
 		return nil, fmt.Errorf("type de log non supporté: %s", req.Type)
 	}
@@ -114,23 +239,28 @@ func (lm *LogManager) getAgentLogs(req *common.LogRequest) ([]*common.LogEntry,
 	lm.bufferMutex.RLock()
 	defer lm.bufferMutex.RUnlock()
 
-	lines := req.Lines
-	if lines <= 0 || lines > len(lm.agentLogBuffer) {
-		lines = len(lm.agentLogBuffer)
+	// Filtres optionnels: niveau minimal (priority) et composant
+	minLevel := 0
+	if req.Priority != "" {
+		minLevel = logLevels[normalizeLogLevel(req.Priority)]
 	}
+	component := strings.ToLower(req.Filters["component"])
 
-	// Prendre les dernières lignes
-	startIdx := len(lm.agentLogBuffer) - lines
-	if startIdx < 0 {
-		startIdx = 0
+	var entries []*common.LogEntry
+	for _, entry := range lm.agentLogBuffer {
+		if logLevels[entry.Level] < minLevel {
+			continue
+		}
+		if component != "" && entry.Component != component {
+			continue
+		}
+		copied := *entry
+		entries = append(entries, &copied)
 	}
 
-	var entries []*common.LogEntry
-	for _, line := range lm.agentLogBuffer[startIdx:] {
-		entries = append(entries, &common.LogEntry{
-			Source:  "agent",
-			Message: line,
-		})
+	// Prendre les dernières lignes
+	if req.Lines > 0 {
+		entries = lastEntries(entries, req.Lines)
 	}
 
 	return entries, nil
@@ -235,8 +365,8 @@ func (lm *LogManager) getFileLogs(req *common.LogRequest) ([]*common.LogEntry, e
 		return nil, fmt.Errorf("le chemin est un répertoire, pas un fichier")
 	}
 
-	// Sécurité: vérifier que le fichier est dans /var/log ou est un fichier log connu
-	if !strings.HasPrefix(req.Path, "/var/log/") && !strings.HasSuffix(req.Path, ".log") {
+	// Sécurité: vérifier que le fichier est dans /var/log, est un fichier log connu ou une source configurée
+	if !lm.isAllowedPath(req.Path) {
 		return nil, fmt.Errorf("accès non autorisé au fichier")
 	}
 
@@ -245,52 +375,91 @@ func (lm *LogManager) getFileLogs(req *common.LogRequest) ([]*common.LogEntry, e
 		lines = 100
 	}
 
-	// Utiliser tail pour lire les dernières lignes
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "tail", "-n", fmt.Sprintf("%d", lines), req.Path)
-	output, err := cmd.Output()
+	def := lm.definitionForPath(req.Path)
+	rawLines, err := readLastLines(req.Path, rawLineBudget(def, lines))
 	if err != nil {
 		return nil, fmt.Errorf("échec de la lecture du fichier: %v", err)
 	}
 
-	var entries []*common.LogEntry
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
+	return lastEntries(assembleEntries(def, filepath.Base(req.Path), rawLines), lines), nil
+}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		entries = append(entries, &common.LogEntry{
-			Source:  filepath.Base(req.Path),
-			Message: line,
-		})
+// getCustomLogs récupère les logs d'une source configurée, fichiers tournés compris
+func (lm *LogManager) getCustomLogs(req *common.LogRequest) ([]*common.LogEntry, error) {
+	def := lm.SourceDefinition(req.Source)
+	if def == nil {
+		return nil, fmt.Errorf("source de logs inconnue: %s", req.Source)
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("erreur de lecture: %v", err)
+	lines := req.Lines
+	if lines <= 0 {
+		lines = 100
 	}
 
-	return entries, nil
+	files := def.Files()
+	if len(files) == 0 {
+		return nil, fmt.Errorf("aucun fichier ne correspond à la source %s", def.Name)
+	}
+
+	// Parcourir les fichiers du plus récent au plus ancien jusqu'à obtenir assez de lignes
+	budget := rawLineBudget(def, lines)
+	var rawLines []string
+	for i := len(files) - 1; i >= 0 && len(rawLines) < budget; i-- {
+		fileLines, err := readLastLines(files[i], budget-len(rawLines))
+		if err != nil {
+			log.Printf("[LogManager] Lecture de %s impossible: %v", files[i], err)
+			continue
+		}
+		rawLines = append(fileLines, rawLines...)
+	}
+
+	return lastEntries(assembleEntries(def, def.Name, rawLines), lines), nil
+}
+
+// rawLineBudget estime le nombre de lignes brutes à lire pour obtenir n entrées
+func rawLineBudget(def *LogSourceDefinition, n int) int {
+	if def == nil || def.multiline == nil {
+		return n
+	}
+	// Les entrées multi-lignes (traces de pile) occupent plusieurs lignes
+	budget := n * 10
+	if budget > 50000 {
+		budget = 50000
+	}
+	return budget
+}
+
+// lastEntries conserve les n dernières entrées
+func lastEntries(entries []*common.LogEntry, n int) []*common.LogEntry {
+	if len(entries) > n {
+		return entries[len(entries)-n:]
+	}
+	return entries
 }
 
 // StreamLogs stream les logs en temps réel (pour implémentation future)
 func (lm *LogManager) StreamLogs(req *common.LogRequest, writer io.Writer) error {
+	return lm.StreamLogsContext(context.Background(), req, writer)
+}
+
+// StreamLogsContext stream les logs en temps réel jusqu'à l'annulation du contexte
+func (lm *LogManager) StreamLogsContext(ctx context.Context, req *common.LogRequest, writer io.Writer) error {
 	if !req.Follow {
 		return fmt.Errorf("le streaming nécessite follow=true")
 	}
 
 	switch req.Type {
 	case "systemd":
-		return lm.streamSystemdLogs(req, writer)
+		return lm.streamSystemdLogs(ctx, req, writer)
 	case "file":
-		return lm.streamFileLogs(req, writer)
+		return lm.streamFileLogs(ctx, req, writer)
 	default:
 		return fmt.Errorf("streaming non supporté pour le type: %s", req.Type)
 	}
 }
 
 // streamSystemdLogs stream les logs systemd en temps réel
-func (lm *LogManager) streamSystemdLogs(req *common.LogRequest, writer io.Writer) error {
+func (lm *LogManager) streamSystemdLogs(ctx context.Context, req *common.LogRequest, writer io.Writer) error {
 	if !checkSystemd() {
 		return fmt.Errorf("systemd n'est pas disponible")
 	}
@@ -305,7 +474,12 @@ func (lm *LogManager) streamSystemdLogs(req *common.LogRequest, writer io.Writer
 		args = append(args, "-p", req.Priority)
 	}
 
-	cmd := exec.Command(args[0], args[1:]...)
+	// Sortie JSON pour conserver le niveau et l'horodatage de chaque entrée
+	if req.Filters["output"] == "json" {
+		args = append(args, "--output=json", "-n", "0")
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
 	cmd.Stdout = writer
 	cmd.Stderr = writer
 
@@ -313,30 +487,122 @@ func (lm *LogManager) streamSystemdLogs(req *common.LogRequest, writer io.Writer
 }
 
 // streamFileLogs stream les logs d'un fichier en temps réel
-func (lm *LogManager) streamFileLogs(req *common.LogRequest, writer io.Writer) error {
+func (lm *LogManager) streamFileLogs(ctx context.Context, req *common.LogRequest, writer io.Writer) error {
 	if req.Path == "" {
 		return fmt.Errorf("chemin du fichier manquant")
 	}
 
 	// Sécurité
-	if !strings.HasPrefix(req.Path, "/var/log/") && !strings.HasSuffix(req.Path, ".log") {
+	if !lm.isAllowedPath(req.Path) {
 		return fmt.Errorf("accès non autorisé au fichier")
 	}
+	if isCompressedLog(req.Path) {
+		return fmt.Errorf("le suivi en temps réel d'un fichier compressé est impossible")
+	}
 
-	cmd := exec.Command("tail", "-f", req.Path)
+	// -F suit le fichier à travers les rotations, -n 0 ignore l'historique
+	cmd := exec.CommandContext(ctx, "tail", "-F", "-n", "0", req.Path)
 	cmd.Stdout = writer
 	cmd.Stderr = writer
 
 	return cmd.Run()
 }
 
+// parseJournalEntry convertit une ligne JSON de journalctl en entrée de log
+func parseJournalEntry(line string) *common.LogEntry {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return &common.LogEntry{
+			Timestamp: time.Now().Format(time.RFC3339Nano),
+			Level:     detectLogLevel(line),
+			Source:    "systemd",
+			Message:   line,
+		}
+	}
+
+	entry := &common.LogEntry{
+		Source:  "systemd",
+		Message: journalString(fields["MESSAGE"]),
+		Unit:    journalString(fields["_SYSTEMD_UNIT"]),
+	}
+
+	// __REALTIME_TIMESTAMP est exprimé en microsecondes depuis l'epoch
+	if usec, err := strconv.ParseInt(journalString(fields["__REALTIME_TIMESTAMP"]), 10, 64); err == nil {
+		entry.Timestamp = time.UnixMicro(usec).Format(time.RFC3339Nano)
+	} else {
+		entry.Timestamp = time.Now().Format(time.RFC3339Nano)
+	}
+
+	if priority, err := strconv.Atoi(journalString(fields["PRIORITY"])); err == nil {
+		entry.Level = journalPriorityLevel(priority)
+	} else {
+		entry.Level = detectLogLevel(entry.Message)
+	}
+
+	return entry
+}
+
+// journalString convertit un champ du journal en chaîne
+// journalctl encode les messages non UTF-8 sous forme de tableau d'octets
+func journalString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []interface{}:
+		buf := make([]byte, 0, len(v))
+		for _, b := range v {
+			if f, ok := b.(float64); ok {
+				buf = append(buf, byte(f))
+			}
+		}
+		return string(buf)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
+// journalPriorityLevel convertit une priorité syslog (0-7) en niveau de log
+func journalPriorityLevel(priority int) string {
+	switch {
+	case priority <= 2:
+		return "critical"
+	case priority == 3:
+		return "error"
+	case priority == 4:
+		return "warning"
+	case priority == 7:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+// detectLogLevel devine le niveau d'une ligne de log texte
+func detectLogLevel(line string) string {
+	lower := strings.ToLower(line)
+	switch {
+	case strings.Contains(lower, "panic") || strings.Contains(lower, "fatal") || strings.Contains(lower, "crit"):
+		return "critical"
+	case strings.Contains(lower, "error") || strings.Contains(lower, "erreur") || strings.Contains(lower, "fail"):
+		return "error"
+	case strings.Contains(lower, "warn") || strings.Contains(lower, "attention"):
+		return "warning"
+	case strings.Contains(lower, "debug"):
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
 // GetAgentLogBuffer retourne le buffer complet des logs de l'agent
-func (lm *LogManager) GetAgentLogBuffer() []string {
+func (lm *LogManager) GetAgentLogBuffer() []*common.LogEntry {
 	lm.bufferMutex.RLock()
 	defer lm.bufferMutex.RUnlock()
 
 	// Faire une copie pour éviter les modifications concurrentes
-	buffer := make([]string, len(lm.agentLogBuffer))
+	buffer := make([]*common.LogEntry, len(lm.agentLogBuffer))
 	copy(buffer, lm.agentLogBuffer)
 
 	return buffer
@@ -347,26 +613,5 @@ func (lm *LogManager) ClearAgentLogBuffer() {
 	lm.bufferMutex.Lock()
 	defer lm.bufferMutex.Unlock()
 
-	lm.agentLogBuffer = make([]string, 0, lm.maxBufferSize)
-}
-
-// LogWriter implémente io.Writer pour capturer les logs
-type LogWriter struct {
-	manager *LogManager
-}
-
-// NewLogWriter crée un nouveau LogWriter
-func NewLogWriter(manager *LogManager) *LogWriter {
-	return &LogWriter{manager: manager}
-}
-
-// Write implémente io.Writer
-func (lw *LogWriter) Write(p []byte) (n int, err error) {
-	message := string(p)
-	lw.manager.AddAgentLog(message)
-
-	// Écrire aussi sur la sortie standard
-	log.Print(message)
-
-	return len(p), nil
+	lm.agentLogBuffer = make([]*common.LogEntry, 0, lm.maxBufferSize)
 }
@@ -0,0 +1,397 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// maxPendingShipEntries limite le nombre d'entrées conservées pendant une déconnexion
+const maxPendingShipEntries = 10000
+
+// shipRescanInterval est l'intervalle de recherche des nouveaux fichiers d'une source configurée
+const shipRescanInterval = 30 * time.Second
+
+// shipSource décrit une source de logs expédiée vers le serveur
+type shipSource struct {
+	Name string
+	Type string // "agent", "systemd", "file" ou "custom"
+	Path string
+	Unit string
+}
+
+// LogShipper expédie en continu des sources de logs sélectionnées vers le serveur
+type LogShipper struct {
+	logManager *LogManager
+	logger     *Logger
+	sources    []*shipSource
+	interval   time.Duration
+	send       func(batch *common.LogShipBatch) error
+	pending    map[string][]*common.LogEntry // Entrées en attente par source
+	order      []string                      // Ordre d'arrivée des sources en attente
+	count      int
+	mu         sync.Mutex
+}
+
+// NewLogShipper crée un expéditeur de logs à partir de la liste des sources
+// Format: "agent", "systemd", "systemd:<unit>", un chemin de fichier absolu ou le nom d'une source configurée
+func NewLogShipper(logManager *LogManager, logger *Logger, spec string, interval time.Duration, send func(batch *common.LogShipBatch) error) *LogShipper {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+
+	return &LogShipper{
+		logManager: logManager,
+		logger:     logger,
+		sources:    parseShipSources(logManager, logger, spec),
+		interval:   interval,
+		send:       send,
+		pending:    make(map[string][]*common.LogEntry),
+	}
+}
+
+// parseShipSources analyse la liste des sources séparées par des virgules
+func parseShipSources(logManager *LogManager, logger *Logger, spec string) []*shipSource {
+	var sources []*shipSource
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+			continue
+		case item == "agent":
+			sources = append(sources, &shipSource{Name: "agent", Type: "agent"})
+		case item == "systemd":
+			sources = append(sources, &shipSource{Name: "systemd", Type: "systemd"})
+		case strings.HasPrefix(item, "systemd:"):
+			unit := strings.TrimPrefix(item, "systemd:")
+			sources = append(sources, &shipSource{Name: unit, Type: "systemd", Unit: unit})
+		case strings.HasPrefix(item, "/"):
+			sources = append(sources, &shipSource{Name: filepath.Base(item), Type: "file", Path: item})
+		case logManager.SourceDefinition(item) != nil:
+			sources = append(sources, &shipSource{Name: item, Type: "custom"})
+		default:
+			logger.Warnf("logshipper", "[LogShipper] Source de logs ignorée (format inconnu): %s", item)
+		}
+	}
+	return sources
+}
+
+// Run démarre le suivi des sources et l'envoi périodique jusqu'à la fermeture de stopChan
+func (ls *LogShipper) Run(stopChan <-chan struct{}) {
+	if len(ls.sources) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, source := range ls.sources {
+		ls.logger.Infof("logshipper", "[LogShipper] Expédition de la source %s (%s)", source.Name, source.Type)
+		go ls.follow(ctx, source)
+	}
+
+	ticker := time.NewTicker(ls.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ls.flush()
+		case <-stopChan:
+			ls.flush()
+			return
+		}
+	}
+}
+
+// follow suit une source et relance le suivi en cas d'arrêt inattendu
+func (ls *LogShipper) follow(ctx context.Context, source *shipSource) {
+	for {
+		var err error
+		switch source.Type {
+		case "agent":
+			err = ls.followAgent(ctx, source)
+		case "custom":
+			err = ls.followCustom(ctx, source)
+		case "file":
+			err = ls.followFile(ctx, source, source.Path, ls.logManager.definitionForPath(source.Path))
+		default:
+			err = ls.followStream(ctx, source)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(10 * time.Second):
+			if err != nil {
+				ls.logger.Warnf("logshipper", "[LogShipper] Suivi de %s interrompu: %v, nouvelle tentative", source.Name, err)
+			}
+		}
+	}
+}
+
+// followAgent suit le buffer de logs de l'agent
+func (ls *LogShipper) followAgent(ctx context.Context, source *shipSource) error {
+	entries, unsubscribe := ls.logManager.SubscribeAgentLogs()
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case entry, ok := <-entries:
+			if !ok {
+				return nil
+			}
+			copied := *entry
+			copied.Source = source.Name
+			ls.add(source, &copied)
+		}
+	}
+}
+
+// followStream suit une source journalctl via StreamLogsContext
+func (ls *LogShipper) followStream(ctx context.Context, source *shipSource) error {
+	req := &common.LogRequest{
+		Source:  source.Name,
+		Type:    source.Type,
+		Follow:  true,
+		Unit:    source.Unit,
+		Filters: map[string]string{"output": "json"},
+	}
+
+	writer := newLineWriter(func(line string) {
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+		entry := parseJournalEntry(line)
+		entry.Source = source.Name
+		ls.add(source, entry)
+	})
+
+	return ls.logManager.StreamLogsContext(ctx, req, writer)
+}
+
+// followCustom suit tous les fichiers courants d'une source configurée
+// Les fichiers sont recherchés à nouveau toutes les shipRescanInterval: un fichier apparu (nouveau fichier daté,
+// rotation) est suivi dès sa découverte et le suivi d'un fichier qui ne correspond plus à la source est arrêté
+func (ls *LogShipper) followCustom(ctx context.Context, source *shipSource) error {
+	def := ls.logManager.SourceDefinition(source.Name)
+	if def == nil {
+		return fmt.Errorf("source de logs inconnue: %s", source.Name)
+	}
+
+	type follower struct {
+		cancel context.CancelFunc
+		done   chan struct{}
+	}
+	followers := make(map[string]*follower)
+
+	rescan := func() {
+		active := make(map[string]bool)
+		for _, path := range def.ActiveFiles() {
+			active[path] = true
+		}
+
+		for path, f := range followers {
+			select {
+			case <-f.done:
+				// Suivi interrompu: relancé ci-dessous si le fichier est toujours courant
+				delete(followers, path)
+			default:
+				if !active[path] {
+					f.cancel()
+					delete(followers, path)
+				}
+			}
+		}
+
+		for path := range active {
+			if _, exists := followers[path]; exists {
+				continue
+			}
+			fileCtx, cancel := context.WithCancel(ctx)
+			f := &follower{cancel: cancel, done: make(chan struct{})}
+			followers[path] = f
+			go func(path string) {
+				defer close(f.done)
+				if err := ls.followFile(fileCtx, source, path, def); err != nil && fileCtx.Err() == nil {
+					ls.logger.Warnf("logshipper", "[LogShipper] Suivi de %s (%s) interrompu: %v", path, source.Name, err)
+				}
+			}(path)
+		}
+	}
+
+	rescan()
+	if len(followers) == 0 {
+		ls.logger.Warnf("logshipper", "[LogShipper] Aucun fichier ne correspond pour l'instant à la source %s", source.Name)
+	}
+
+	ticker := time.NewTicker(shipRescanInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			rescan()
+		}
+	}
+}
+
+// followFile suit un fichier et regroupe les lignes selon la définition de sa source
+func (ls *LogShipper) followFile(ctx context.Context, source *shipSource, path string, def *LogSourceDefinition) error {
+	assembler := newEntryAssembler(def, source.Name)
+	emit := func(entry *common.LogEntry) {
+		if entry == nil {
+			return
+		}
+		if entry.Timestamp == "" {
+			entry.Timestamp = time.Now().Format(time.RFC3339Nano)
+		}
+		entry.Source = source.Name
+		ls.add(source, entry)
+	}
+
+	writer := newLineWriter(func(line string) {
+		if strings.TrimSpace(line) == "" {
+			return
+		}
+		emit(assembler.Add(line))
+	})
+
+	// Envoyer l'entrée multi-lignes en cours si le fichier reste silencieux
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				emit(assembler.FlushIdle(2 * time.Second))
+			}
+		}
+	}()
+
+	err := ls.logManager.StreamLogsContext(ctx, &common.LogRequest{
+		Source: source.Name,
+		Type:   "file",
+		Follow: true,
+		Path:   path,
+	}, writer)
+
+	close(done)
+	emit(assembler.Flush())
+	return err
+}
+
+// add ajoute une entrée en attente d'envoi
+func (ls *LogShipper) add(source *shipSource, entry *common.LogEntry) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	key := source.Type + "|" + source.Name
+	if _, exists := ls.pending[key]; !exists {
+		ls.order = append(ls.order, key)
+	}
+	ls.pending[key] = append(ls.pending[key], entry)
+	ls.count++
+
+	// Abandonner les entrées les plus anciennes si le serveur est injoignable trop longtemps
+	for ls.count > maxPendingShipEntries && len(ls.order) > 0 {
+		oldest := ls.order[0]
+		ls.pending[oldest] = ls.pending[oldest][1:]
+		ls.count--
+		if len(ls.pending[oldest]) == 0 {
+			delete(ls.pending, oldest)
+			ls.order = ls.order[1:]
+		}
+	}
+}
+
+// flush envoie les entrées en attente, source par source
+func (ls *LogShipper) flush() {
+	ls.mu.Lock()
+	pending := ls.pending
+	order := ls.order
+	ls.pending = make(map[string][]*common.LogEntry)
+	ls.order = nil
+	ls.count = 0
+	ls.mu.Unlock()
+
+	for i, key := range order {
+		parts := strings.SplitN(key, "|", 2)
+		batch := &common.LogShipBatch{
+			Type:    parts[0],
+			Source:  parts[1],
+			Entries: pending[key],
+		}
+		if err := ls.send(batch); err != nil {
+			// Remettre en attente ce lot et les suivants pour le prochain envoi
+			ls.requeue(order[i:], pending)
+			return
+		}
+	}
+}
+
+// requeue remet en tête de file des entrées dont l'envoi a échoué
+func (ls *LogShipper) requeue(order []string, entries map[string][]*common.LogEntry) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	newer := ls.pending
+	newerOrder := ls.order
+	ls.pending = make(map[string][]*common.LogEntry)
+	ls.order = nil
+	ls.count = 0
+
+	for _, key := range order {
+		ls.pending[key] = entries[key]
+		ls.order = append(ls.order, key)
+		ls.count += len(entries[key])
+	}
+	for _, key := range newerOrder {
+		if _, exists := ls.pending[key]; !exists {
+			ls.order = append(ls.order, key)
+		}
+		ls.pending[key] = append(ls.pending[key], newer[key]...)
+		ls.count += len(newer[key])
+	}
+}
+
+// lineWriter implémente io.Writer et appelle une fonction pour chaque ligne complète
+type lineWriter struct {
+	buf    bytes.Buffer
+	onLine func(line string)
+	mu     sync.Mutex
+}
+
+// newLineWriter crée un nouveau lineWriter
+func newLineWriter(onLine func(line string)) *lineWriter {
+	return &lineWriter{onLine: onLine}
+}
+
+// Write implémente io.Writer
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.buf.Write(p)
+	for {
+		idx := bytes.IndexByte(lw.buf.Bytes(), '\n')
+		if idx < 0 {
+			break
+		}
+		line := string(lw.buf.Next(idx + 1))
+		lw.onLine(strings.TrimRight(line, "\r\n"))
+	}
+	return len(p), nil
+}
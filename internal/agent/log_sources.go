@@ -0,0 +1,568 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// maxLogLineSize limite la taille d'une ligne lue dans un fichier de logs
+const maxLogLineSize = 1024 * 1024
+
+// LogSourceDefinition décrit une source de logs configurée sur l'agent
+type LogSourceDefinition struct {
+	Name             string   `json:"name"`
+	Description      string   `json:"description,omitempty"`
+	Paths            []string `json:"paths"`                       // Motifs glob des fichiers (ex: /opt/app/logs/*.out)
+	Format           string   `json:"format,omitempty"`            // "plain" (défaut), "json" ou "syslog"
+	TimestampRegex   string   `json:"timestamp_regex,omitempty"`   // Extraction de l'horodatage (premier groupe ou correspondance complète)
+	TimestampLayout  string   `json:"timestamp_layout,omitempty"`  // Format Go de l'horodatage extrait
+	MultilinePattern string   `json:"multiline_pattern,omitempty"` // Début d'une nouvelle entrée, les autres lignes sont rattachées à la précédente
+	IncludeRotated   bool     `json:"include_rotated,omitempty"`   // Inclure les fichiers tournés (.1, .2.gz, ...)
+
+	timestampRegex *regexp.Regexp
+	multiline      *regexp.Regexp
+}
+
+// LoadLogSourceDefinitions charge les définitions de sources depuis un fichier JSON
+// Le fichier contient un tableau de définitions ou un objet {"sources": [...]}
+func LoadLogSourceDefinitions(path string) ([]*LogSourceDefinition, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("lecture du fichier de sources impossible: %v", err)
+	}
+
+	var definitions []*LogSourceDefinition
+	if err := json.Unmarshal(data, &definitions); err != nil {
+		var wrapper struct {
+			Sources []*LogSourceDefinition `json:"sources"`
+		}
+		if err2 := json.Unmarshal(data, &wrapper); err2 != nil {
+			return nil, fmt.Errorf("fichier de sources invalide: %v", err)
+		}
+		definitions = wrapper.Sources
+	}
+
+	for _, def := range definitions {
+		if err := def.compile(); err != nil {
+			return nil, fmt.Errorf("source %q: %v", def.Name, err)
+		}
+	}
+	return definitions, nil
+}
+
+// compile valide la définition et compile ses expressions régulières
+func (def *LogSourceDefinition) compile() error {
+	if def.Name == "" {
+		return fmt.Errorf("nom manquant")
+	}
+	if len(def.Paths) == 0 {
+		return fmt.Errorf("aucun chemin défini")
+	}
+	for _, pattern := range def.Paths {
+		if !filepath.IsAbs(pattern) {
+			return fmt.Errorf("le chemin doit être absolu: %s", pattern)
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("motif invalide %s: %v", pattern, err)
+		}
+	}
+
+	switch def.Format {
+	case "":
+		def.Format = "plain"
+	case "plain", "json", "syslog":
+	default:
+		return fmt.Errorf("format non supporté: %s", def.Format)
+	}
+
+	if def.TimestampRegex != "" {
+		re, err := regexp.Compile(def.TimestampRegex)
+		if err != nil {
+			return fmt.Errorf("timestamp_regex invalide: %v", err)
+		}
+		def.timestampRegex = re
+	}
+	if def.MultilinePattern != "" {
+		re, err := regexp.Compile(def.MultilinePattern)
+		if err != nil {
+			return fmt.Errorf("multiline_pattern invalide: %v", err)
+		}
+		def.multiline = re
+	}
+	return nil
+}
+
+// MatchPath indique si un fichier correspond à l'un des motifs de la définition
+func (def *LogSourceDefinition) MatchPath(path string) bool {
+	for _, pattern := range def.Paths {
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+		if def.IncludeRotated && matchRotated(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// Files retourne les fichiers correspondant à la définition, du plus ancien au plus récent
+// Les fichiers tournés précèdent toujours les fichiers courants
+func (def *LogSourceDefinition) Files() []string {
+	seen := make(map[string]bool)
+	rotated := make(map[string]bool)
+	var files []string
+
+	add := func(matches []string, isRotated bool) {
+		for _, match := range matches {
+			if seen[match] {
+				continue
+			}
+			if info, err := os.Stat(match); err != nil || info.IsDir() {
+				continue
+			}
+			seen[match] = true
+			rotated[match] = isRotated
+			files = append(files, match)
+		}
+	}
+
+	for _, pattern := range def.Paths {
+		matches, _ := filepath.Glob(pattern)
+		add(matches, false)
+		if def.IncludeRotated {
+			candidates, _ := filepath.Glob(pattern + ".*")
+			var rotatedMatches []string
+			for _, candidate := range candidates {
+				if matchRotated(pattern, candidate) {
+					rotatedMatches = append(rotatedMatches, candidate)
+				}
+			}
+			add(rotatedMatches, true)
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		if rotated[files[i]] != rotated[files[j]] {
+			return rotated[files[i]]
+		}
+		return fileModTime(files[i]).Before(fileModTime(files[j]))
+	})
+	return files
+}
+
+// ActiveFiles retourne les fichiers courants (hors fichiers tournés) à suivre en continu
+func (def *LogSourceDefinition) ActiveFiles() []string {
+	var files []string
+	for _, pattern := range def.Paths {
+		matches, _ := filepath.Glob(pattern)
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && !info.IsDir() && !isCompressedLog(match) {
+				files = append(files, match)
+			}
+		}
+	}
+	return files
+}
+
+// rotatedSuffix reconnaît les suffixes de rotation usuels (.1, .2.gz, -20240101, -20240101.gz)
+var rotatedSuffix = regexp.MustCompile(`^[.-](\d+)(\.gz)?$|^\.gz$`)
+
+// matchRotated indique si path est une version tournée d'un fichier correspondant à pattern
+func matchRotated(pattern, path string) bool {
+	dir, base := filepath.Split(path)
+	for i := len(base) - 1; i > 0; i-- {
+		if base[i] != '.' && base[i] != '-' {
+			continue
+		}
+		if !rotatedSuffix.MatchString(base[i:]) {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, dir+base[:i]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// fileModTime retourne la date de modification d'un fichier
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// isCompressedLog indique si un fichier de logs est compressé en gzip
+func isCompressedLog(path string) bool {
+	return strings.HasSuffix(path, ".gz")
+}
+
+// openLogFile ouvre un fichier de logs en décompressant les fichiers .gz
+func openLogFile(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !isCompressedLog(path) {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("archive gzip invalide: %v", err)
+	}
+	return &gzipLogReader{Reader: gz, file: file}, nil
+}
+
+// gzipLogReader ferme à la fois le flux gzip et le fichier sous-jacent
+type gzipLogReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// Close implémente io.Closer
+func (r *gzipLogReader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+// readLastLines lit au plus n dernières lignes d'un fichier, compressé ou non
+func readLastLines(path string, n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	if !isCompressedLog(path) {
+		return readLastLinesSeek(path, n)
+	}
+
+	reader, err := openLogFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	// Un flux gzip ne permet pas de partir de la fin: conserver les n dernières lignes au fil de la lecture
+	ring := make([]string, 0, n)
+	start := 0
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLogLineSize)
+	for scanner.Scan() {
+		if len(ring) < n {
+			ring = append(ring, scanner.Text())
+		} else {
+			ring[start] = scanner.Text()
+			start = (start + 1) % n
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("erreur de lecture: %v", err)
+	}
+
+	return append(ring[start:], ring[:start]...), nil
+}
+
+// readLastLinesSeek lit les n dernières lignes d'un fichier non compressé en partant de la fin
+func readLastLinesSeek(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	const blockSize = 64 * 1024
+	offset := info.Size()
+	var data []byte
+
+	for offset > 0 && bytes.Count(data, []byte{'\n'}) <= n {
+		size := int64(blockSize)
+		if offset < size {
+			size = offset
+		}
+		offset -= size
+
+		block := make([]byte, size)
+		if _, err := file.ReadAt(block, offset); err != nil && err != io.EOF {
+			return nil, fmt.Errorf("erreur de lecture: %v", err)
+		}
+		data = append(block, data...)
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil, nil
+	}
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r")
+	}
+	return lines, nil
+}
+
+// entryAssembler regroupe les lignes d'une entrée multi-lignes (traces de pile, etc.)
+type entryAssembler struct {
+	def      *LogSourceDefinition
+	source   string
+	current  []string
+	lastLine time.Time
+	mu       sync.Mutex
+}
+
+// newEntryAssembler crée un assembleur pour une source
+// def peut être nil: chaque ligne produit alors une entrée
+func newEntryAssembler(def *LogSourceDefinition, source string) *entryAssembler {
+	return &entryAssembler{def: def, source: source}
+}
+
+// Add ajoute une ligne et retourne l'entrée précédente si elle est terminée
+func (a *entryAssembler) Add(line string) *common.LogEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.lastLine = time.Now()
+
+	if a.def == nil || a.def.multiline == nil {
+		return parseLogLine(a.def, a.source, line)
+	}
+
+	// Une ligne qui ne marque pas le début d'une entrée est rattachée à la précédente
+	if len(a.current) > 0 && !a.def.multiline.MatchString(line) {
+		a.current = append(a.current, line)
+		return nil
+	}
+
+	completed := a.flushLocked()
+	a.current = append(a.current, line)
+	return completed
+}
+
+// Flush retourne l'entrée en cours de construction
+func (a *entryAssembler) Flush() *common.LogEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.flushLocked()
+}
+
+// FlushIdle retourne l'entrée en cours si aucune ligne n'a été reçue depuis idle
+func (a *entryAssembler) FlushIdle(idle time.Duration) *common.LogEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.current) == 0 || time.Since(a.lastLine) < idle {
+		return nil
+	}
+	return a.flushLocked()
+}
+
+// flushLocked construit l'entrée en cours (le verrou doit être détenu)
+func (a *entryAssembler) flushLocked() *common.LogEntry {
+	if len(a.current) == 0 {
+		return nil
+	}
+	entry := parseLogLine(a.def, a.source, strings.Join(a.current, "\n"))
+	a.current = nil
+	return entry
+}
+
+// assembleEntries convertit des lignes brutes en entrées de logs
+func assembleEntries(def *LogSourceDefinition, source string, lines []string) []*common.LogEntry {
+	assembler := newEntryAssembler(def, source)
+	var entries []*common.LogEntry
+	for _, line := range lines {
+		if entry := assembler.Add(line); entry != nil {
+			entries = append(entries, entry)
+		}
+	}
+	if entry := assembler.Flush(); entry != nil {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// parseLogLine convertit une entrée brute selon le format de la source
+func parseLogLine(def *LogSourceDefinition, source, raw string) *common.LogEntry {
+	entry := &common.LogEntry{
+		Source:  source,
+		Message: raw,
+	}
+
+	format := "plain"
+	if def != nil {
+		format = def.Format
+	}
+
+	switch format {
+	case "json":
+		parseJSONLogLine(entry, raw)
+	case "syslog":
+		parseSyslogLine(entry, raw)
+	}
+
+	if def != nil && def.timestampRegex != nil {
+		if match := def.timestampRegex.FindStringSubmatch(raw); match != nil {
+			value := match[0]
+			if len(match) > 1 {
+				value = match[1]
+			}
+			if t, ok := parseLogTimestamp(value, def.TimestampLayout); ok {
+				entry.Timestamp = t.Format(time.RFC3339Nano)
+			}
+		}
+	}
+
+	if entry.Level == "" {
+		entry.Level = detectLogLevel(firstLine(entry.Message))
+	}
+	return entry
+}
+
+// parseJSONLogLine extrait les champs usuels d'une ligne de log JSON
+func parseJSONLogLine(entry *common.LogEntry, raw string) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(firstLine(raw)), &fields); err != nil {
+		return
+	}
+
+	for _, key := range []string{"message", "msg", "log", "MESSAGE"} {
+		if value, ok := fields[key].(string); ok {
+			entry.Message = value
+			// Conserver les lignes rattachées (trace de pile après la ligne JSON)
+			if idx := strings.IndexByte(raw, '\n'); idx >= 0 {
+				entry.Message += raw[idx:]
+			}
+			break
+		}
+	}
+	for _, key := range []string{"level", "severity", "lvl", "loglevel"} {
+		if value, ok := fields[key].(string); ok {
+			entry.Level = normalizeLogLevel(value)
+			break
+		}
+	}
+	for _, key := range []string{"timestamp", "time", "ts", "@timestamp"} {
+		switch value := fields[key].(type) {
+		case string:
+			if t, ok := parseLogTimestamp(value, ""); ok {
+				entry.Timestamp = t.Format(time.RFC3339Nano)
+			}
+		case float64:
+			// Horodatage Unix en secondes (éventuellement fractionnaires)
+			sec := int64(value)
+			entry.Timestamp = time.Unix(sec, int64((value-float64(sec))*1e9)).Format(time.RFC3339Nano)
+		}
+		if entry.Timestamp != "" {
+			break
+		}
+	}
+	if unit, ok := fields["logger"].(string); ok {
+		entry.Unit = unit
+	}
+}
+
+// syslogPattern reconnaît les lignes syslog classiques (RFC 3164) et à horodatage ISO (rsyslog)
+var syslogPattern = regexp.MustCompile(`^(?:<(\d{1,3})>)?([A-Z][a-z]{2}\s+\d{1,2} \d{2}:\d{2}:\d{2}|\d{4}-\d{2}-\d{2}T\S+) (\S+) ([^:\[\s]+)(?:\[\d+\])?: ?(.*)$`)
+
+// parseSyslogLine extrait l'horodatage, le programme et la priorité d'une ligne syslog
+func parseSyslogLine(entry *common.LogEntry, raw string) {
+	match := syslogPattern.FindStringSubmatch(firstLine(raw))
+	if match == nil {
+		return
+	}
+
+	if match[1] != "" {
+		if pri, err := strconv.Atoi(match[1]); err == nil {
+			entry.Level = journalPriorityLevel(pri % 8)
+		}
+	}
+	if t, ok := parseLogTimestamp(match[2], ""); ok {
+		entry.Timestamp = t.Format(time.RFC3339Nano)
+	}
+	entry.Unit = match[4]
+	entry.Message = match[5]
+	if idx := strings.IndexByte(raw, '\n'); idx >= 0 {
+		entry.Message += raw[idx:]
+	}
+}
+
+// logTimestampLayouts liste les formats d'horodatage essayés par défaut
+var logTimestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05,999",
+	"2006/01/02 15:04:05",
+	"02/Jan/2006:15:04:05 -0700",
+	time.Stamp,
+	time.StampMicro,
+}
+
+// parseLogTimestamp analyse un horodatage avec le format donné ou les formats usuels
+func parseLogTimestamp(value, layout string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	layouts := logTimestampLayouts
+	if layout != "" {
+		layouts = []string{layout}
+	}
+
+	for _, l := range layouts {
+		t, err := time.ParseInLocation(l, value, time.Local)
+		if err != nil {
+			continue
+		}
+		// Les formats syslog n'incluent pas l'année
+		if t.Year() == 0 {
+			now := time.Now()
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// normalizeLogLevel ramène un niveau de log quelconque aux niveaux de l'agent
+func normalizeLogLevel(level string) string {
+	switch strings.ToLower(level) {
+	case "fatal", "panic", "critical", "crit", "alert", "emerg", "emergency":
+		return "critical"
+	case "error", "err":
+		return "error"
+	case "warning", "warn":
+		return "warning"
+	case "debug", "trace":
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+// firstLine retourne la première ligne d'un texte
+func firstLine(text string) string {
+	if idx := strings.IndexByte(text, '\n'); idx >= 0 {
+		return text[:idx]
+	}
+	return text
+}
@@ -0,0 +1,261 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// Niveaux de log de l'agent, du plus verbeux au plus grave
+var logLevels = map[string]int{
+	"debug":    0,
+	"info":     1,
+	"warning":  2,
+	"error":    3,
+	"critical": 4,
+}
+
+// loggerTimeLayout est le format d'horodatage des lignes écrites par le logger
+const loggerTimeLayout = "2006-01-02 15:04:05.000"
+
+// Logger est le logger à niveaux de l'agent
+// Il alimente le buffer du LogManager, la sortie d'erreur et, si configuré, un fichier avec rotation
+type Logger struct {
+	level   int
+	manager *LogManager
+	file    *rotatingFile
+	mu      sync.Mutex
+}
+
+// NewLogger crée le logger de l'agent à partir de la configuration
+// Les dernières entrées du fichier de log sont rechargées dans le buffer de l'agent
+func NewLogger(config *common.Config, manager *LogManager) (*Logger, error) {
+	level, ok := logLevels[normalizeLogLevel(config.LogLevel)]
+	if !ok {
+		level = logLevels["info"]
+	}
+
+	logger := &Logger{
+		level:   level,
+		manager: manager,
+	}
+
+	if config.LogFile == "" {
+		return logger, nil
+	}
+
+	// Recharger l'historique avant d'ouvrir le fichier en écriture
+	if lines, err := readLastLines(config.LogFile, manager.maxBufferSize); err == nil {
+		manager.LoadAgentEntries(parseLoggerLines(lines))
+	}
+
+	file, err := newRotatingFile(config.LogFile, int64(config.LogMaxSizeMB)*1024*1024, config.LogMaxBackups)
+	if err != nil {
+		return logger, err
+	}
+	logger.file = file
+	return logger, nil
+}
+
+// Debugf écrit un message de niveau debug
+func (l *Logger) Debugf(component, format string, args ...interface{}) {
+	l.Log("debug", component, fmt.Sprintf(format, args...))
+}
+
+// Infof écrit un message de niveau info
+func (l *Logger) Infof(component, format string, args ...interface{}) {
+	l.Log("info", component, fmt.Sprintf(format, args...))
+}
+
+// Warnf écrit un message de niveau warning
+func (l *Logger) Warnf(component, format string, args ...interface{}) {
+	l.Log("warning", component, fmt.Sprintf(format, args...))
+}
+
+// Errorf écrit un message de niveau error
+func (l *Logger) Errorf(component, format string, args ...interface{}) {
+	l.Log("error", component, fmt.Sprintf(format, args...))
+}
+
+// Log écrit un message si son niveau atteint le niveau configuré
+func (l *Logger) Log(level, component, message string) {
+	if logLevels[level] < l.level {
+		return
+	}
+
+	now := time.Now()
+	if component == "" {
+		component = "agent"
+	}
+
+	l.manager.AddAgentEntry(&common.LogEntry{
+		Timestamp: now.Format(time.RFC3339Nano),
+		Level:     level,
+		Source:    "agent",
+		Component: component,
+		Message:   message,
+	})
+
+	// Préfixer le composant s'il n'apparaît pas dans le message, pour le retrouver au rechargement
+	text := message
+	if prefixed, _ := splitLogComponent(message); prefixed != component {
+		text = "[" + component + "] " + message
+	}
+	line := fmt.Sprintf("%s %s %s\n", now.Format(loggerTimeLayout), strings.ToUpper(level), text)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	os.Stderr.WriteString(line)
+	if l.file != nil {
+		if _, err := l.file.Write([]byte(line)); err != nil {
+			fmt.Fprintf(os.Stderr, "Erreur d'écriture du fichier de log: %v\n", err)
+		}
+	}
+}
+
+// Write implémente io.Writer pour rediriger le package log standard vers le logger
+// Réservé aux messages qui ne passent pas par Debugf, Infof, Warnf ou Errorf (bibliothèques, composants non migrés):
+// le niveau et le composant sont alors déduits du message (préfixe "[AGENT]", mots-clés "erreur", "debug", ...)
+func (l *Logger) Write(p []byte) (int, error) {
+	message := strings.TrimRight(string(p), "\n")
+	component, _ := splitLogComponent(message)
+	l.Log(detectLogLevel(message), component, message)
+	return len(p), nil
+}
+
+// Close ferme le fichier de log
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// logComponentPattern reconnaît le préfixe de composant des messages ("[AGENT] ...")
+var logComponentPattern = regexp.MustCompile(`^\[([A-Za-z][\w-]*)\]\s*`)
+
+// splitLogComponent extrait le composant d'un message préfixé
+func splitLogComponent(message string) (string, string) {
+	match := logComponentPattern.FindStringSubmatch(message)
+	if match == nil {
+		return "agent", message
+	}
+	return strings.ToLower(match[1]), message[len(match[0]):]
+}
+
+// loggerLinePattern reconnaît les lignes écrites par le logger dans le fichier de log
+var loggerLinePattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}\.\d{3}) (DEBUG|INFO|WARNING|ERROR|CRITICAL) (.*)$`)
+
+// parseLoggerLines reconstruit les entrées à partir des lignes du fichier de log
+// Les lignes qui ne commencent pas par un horodatage sont rattachées à l'entrée précédente
+func parseLoggerLines(lines []string) []*common.LogEntry {
+	var entries []*common.LogEntry
+	for _, line := range lines {
+		match := loggerLinePattern.FindStringSubmatch(line)
+		if match == nil {
+			if len(entries) > 0 {
+				entries[len(entries)-1].Message += "\n" + line
+			}
+			continue
+		}
+
+		timestamp, err := time.ParseInLocation(loggerTimeLayout, match[1], time.Local)
+		if err != nil {
+			continue
+		}
+		component, _ := splitLogComponent(match[3])
+		entries = append(entries, &common.LogEntry{
+			Timestamp: timestamp.Format(time.RFC3339Nano),
+			Level:     strings.ToLower(match[2]),
+			Source:    "agent",
+			Component: component,
+			Message:   match[3],
+		})
+	}
+	return entries
+}
+
+// rotatingFile est un fichier de log tourné lorsqu'il dépasse une taille maximale
+// Les anciennes versions sont conservées sous les noms <fichier>.1, <fichier>.2, ...
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// newRotatingFile ouvre un fichier de log en ajout
+func newRotatingFile(path string, maxSize int64, maxBackups int) (*rotatingFile, error) {
+	rf := &rotatingFile{
+		path:       path,
+		maxSize:    maxSize,
+		maxBackups: maxBackups,
+	}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open ouvre le fichier courant
+func (rf *rotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("ouverture du fichier de log impossible: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// Write écrit dans le fichier en le faisant tourner si nécessaire
+func (rf *rotatingFile) Write(p []byte) (int, error) {
+	if rf.maxSize > 0 && rf.size+int64(len(p)) > rf.maxSize && rf.size > 0 {
+		if err := rf.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate décale les anciennes versions et ouvre un nouveau fichier
+func (rf *rotatingFile) rotate() error {
+	rf.file.Close()
+
+	if rf.maxBackups <= 0 {
+		os.Remove(rf.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.maxBackups))
+		for i := rf.maxBackups - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+		}
+		if err := os.Rename(rf.path, rf.path+".1"); err != nil {
+			return fmt.Errorf("rotation du fichier de log impossible: %v", err)
+		}
+	}
+
+	return rf.open()
+}
+
+// Close ferme le fichier courant
+func (rf *rotatingFile) Close() error {
+	return rf.file.Close()
+}
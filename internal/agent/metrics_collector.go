@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// cpuTimes contient les compteurs cumulés d'un CPU (en ticks)
+type cpuTimes struct {
+	busy  uint64
+	total uint64
+}
+
+// netCounters contient les compteurs cumulés d'une interface réseau
+type netCounters struct {
+	rx uint64
+	tx uint64
+}
+
+// MetricsCollector collecte des échantillons de métriques
+// Les taux (CPU, réseau) sont calculés par différence avec l'échantillon précédent
+type MetricsCollector struct {
+	mu       sync.Mutex // Un seul relevé à la fois: chacun remplace l'échantillon précédent
+	prevCPU  []cpuTimes // Index 0: total, puis un élément par cœur
+	prevNet  map[string]netCounters
+	prevTime time.Time
+}
+
+// NewMetricsCollector crée un nouveau collecteur de métriques
+func NewMetricsCollector() *MetricsCollector {
+	return &MetricsCollector{
+		prevNet: make(map[string]netCounters),
+	}
+}
+
+// Collect collecte un échantillon de métriques
+// Le premier échantillon ne contient pas de taux faute de point de comparaison
+func (mc *MetricsCollector) Collect() *common.MetricsSample {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+
+	now := time.Now()
+	sample := &common.MetricsSample{
+		Timestamp: now.Format(time.RFC3339Nano),
+	}
+
+	mc.collectPlatform(sample, now)
+	mc.prevTime = now
+	return sample
+}
+
+// cpuPercent calcule l'utilisation entre deux relevés de compteurs
+func cpuPercent(prev, cur cpuTimes) float64 {
+	if cur.total <= prev.total || cur.busy < prev.busy {
+		return 0
+	}
+	return float64(cur.busy-prev.busy) / float64(cur.total-prev.total) * 100
+}
@@ -0,0 +1,201 @@
+//go:build linux
+
+package agent
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// ignoredFSTypes liste les systèmes de fichiers virtuels exclus de l'occupation disque
+var ignoredFSTypes = map[string]bool{
+	"proc": true, "sysfs": true, "devtmpfs": true, "devpts": true, "tmpfs": true,
+	"cgroup": true, "cgroup2": true, "pstore": true, "securityfs": true, "debugfs": true,
+	"tracefs": true, "configfs": true, "fusectl": true, "mqueue": true, "hugetlbfs": true,
+	"autofs": true, "binfmt_misc": true, "bpf": true, "squashfs": true, "overlay": true,
+	"nsfs": true, "rpc_pipefs": true, "efivarfs": true, "ramfs": true,
+}
+
+// collectPlatform complète l'échantillon depuis /proc et statfs
+func (mc *MetricsCollector) collectPlatform(sample *common.MetricsSample, now time.Time) {
+	mc.collectCPU(sample)
+
+	if meminfo, err := readMeminfo(); err == nil {
+		sample.MemoryTotal = meminfo["MemTotal"]
+		if available, ok := meminfo["MemAvailable"]; ok {
+			sample.MemoryUsed = meminfo["MemTotal"] - available
+		} else {
+			sample.MemoryUsed = meminfo["MemTotal"] - meminfo["MemFree"] - meminfo["Buffers"] - meminfo["Cached"]
+		}
+		sample.SwapTotal = meminfo["SwapTotal"]
+		sample.SwapUsed = meminfo["SwapTotal"] - meminfo["SwapFree"]
+	}
+
+	sample.Disks = collectDiskUsage()
+	mc.collectNetwork(sample, now)
+	sample.ProcessCount = countProcesses()
+}
+
+// collectCPU calcule l'utilisation globale et par cœur depuis /proc/stat
+func (mc *MetricsCollector) collectCPU(sample *common.MetricsSample) {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var current []cpuTimes
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		// user nice system idle iowait irq softirq steal (guest est déjà inclus dans user)
+		var times cpuTimes
+		for i, field := range fields[1:] {
+			if i >= 8 {
+				break
+			}
+			value, _ := strconv.ParseUint(field, 10, 64)
+			times.total += value
+			if i != 3 && i != 4 { // idle et iowait
+				times.busy += value
+			}
+		}
+		current = append(current, times)
+	}
+
+	if len(mc.prevCPU) == len(current) && len(current) > 0 {
+		sample.CPUPercent = cpuPercent(mc.prevCPU[0], current[0])
+		for i := 1; i < len(current); i++ {
+			sample.CPUCores = append(sample.CPUCores, cpuPercent(mc.prevCPU[i], current[i]))
+		}
+	}
+	mc.prevCPU = current
+}
+
+// collectDiskUsage retourne l'occupation des systèmes de fichiers montés
+func collectDiskUsage() []*common.DiskUsage {
+	file, err := os.Open("/proc/mounts")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	var disks []*common.DiskUsage
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Format: device mount fstype options dump pass
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || ignoredFSTypes[fields[2]] {
+			continue
+		}
+		device, mount := fields[0], unescapeMountPath(fields[1])
+		// Un même périphérique peut être monté plusieurs fois (bind mounts)
+		if seen[device] {
+			continue
+		}
+
+		var stat syscall.Statfs_t
+		if err := syscall.Statfs(mount, &stat); err != nil || stat.Blocks == 0 {
+			continue
+		}
+		seen[device] = true
+
+		blockSize := int64(stat.Bsize)
+		disks = append(disks, &common.DiskUsage{
+			Mount:  mount,
+			Device: device,
+			FSType: fields[2],
+			Total:  int64(stat.Blocks) * blockSize,
+			Used:   (int64(stat.Blocks) - int64(stat.Bfree)) * blockSize,
+		})
+	}
+	return disks
+}
+
+// unescapeMountPath décode les caractères échappés en octal dans /proc/mounts (ex: \040 pour un espace)
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+3 < len(path) {
+			if value, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(value))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// collectNetwork calcule le débit des interfaces depuis /proc/net/dev
+func (mc *MetricsCollector) collectNetwork(sample *common.MetricsSample, now time.Time) {
+	file, err := os.Open("/proc/net/dev")
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	elapsed := now.Sub(mc.prevTime).Seconds()
+	current := make(map[string]netCounters)
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, rest, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		fields := strings.Fields(rest)
+		if name == "lo" || len(fields) < 9 {
+			continue
+		}
+
+		rx, _ := strconv.ParseUint(fields[0], 10, 64)
+		tx, _ := strconv.ParseUint(fields[8], 10, 64)
+		current[name] = netCounters{rx: rx, tx: tx}
+
+		prev, exists := mc.prevNet[name]
+		if !exists || mc.prevTime.IsZero() || elapsed <= 0 || rx < prev.rx || tx < prev.tx {
+			continue
+		}
+		sample.Network = append(sample.Network, &common.NetworkUsage{
+			Interface:     name,
+			RxBytesPerSec: float64(rx-prev.rx) / elapsed,
+			TxBytesPerSec: float64(tx-prev.tx) / elapsed,
+		})
+	}
+	mc.prevNet = current
+}
+
+// countProcesses compte les processus présents dans /proc
+func countProcesses() int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := strconv.Atoi(entry.Name()); err == nil {
+			count++
+		}
+	}
+	return count
+}
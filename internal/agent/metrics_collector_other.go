@@ -0,0 +1,12 @@
+//go:build !linux
+
+package agent
+
+import (
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// collectPlatform n'est pas implémenté hors Linux: l'échantillon reste vide
+func (mc *MetricsCollector) collectPlatform(sample *common.MetricsSample, now time.Time) {}
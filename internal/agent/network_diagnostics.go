@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// Bornes du délai d'attente des sondes réseau
+const (
+	defaultNetworkProbeTimeout = 5 * time.Second
+	maxNetworkProbeTimeout     = 30 * time.Second
+)
+
+// maxHTTPProbeBody est la taille maximale du corps lu par la sonde HTTP
+const maxHTTPProbeBody = 1 << 20
+
+// NetworkDiagnostics exécute les diagnostics réseau sans passer par le shell
+type NetworkDiagnostics struct{}
+
+// NewNetworkDiagnostics crée un nouvel outil de diagnostic réseau
+func NewNetworkDiagnostics() *NetworkDiagnostics {
+	return &NetworkDiagnostics{}
+}
+
+// Run exécute le diagnostic demandé et mesure sa durée
+func (nd *NetworkDiagnostics) Run(req *common.NetworkDiagnosticRequest) *common.NetworkDiagnosticResult {
+	result := &common.NetworkDiagnosticResult{Action: req.Action}
+	timeout := probeTimeout(req.Timeout)
+	start := time.Now()
+
+	var err error
+	switch req.Action {
+	case common.NetworkDiagInterfaces:
+		result.Interfaces, err = listNetworkInterfaces()
+	case common.NetworkDiagRoutes:
+		result.Routes, err = listNetworkRoutes()
+	case common.NetworkDiagSockets:
+		result.Sockets, err = listNetworkSockets(strings.ToLower(req.State))
+	case common.NetworkDiagDNS:
+		result.DNS, err = probeDNS(req.Host, req.Server, timeout)
+	case common.NetworkDiagTCP:
+		result.TCP, err = probeTCP(req.Host, req.Port, timeout)
+	case common.NetworkDiagHTTP:
+		result.HTTP, err = probeHTTP(req.URL, req.Method, timeout)
+	default:
+		err = fmt.Errorf("action de diagnostic inconnue: %s", req.Action)
+	}
+
+	result.DurationMs = durationMs(time.Since(start))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+// probeTimeout retourne le délai d'attente borné d'une sonde
+func probeTimeout(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultNetworkProbeTimeout
+	}
+	timeout := time.Duration(seconds) * time.Second
+	if timeout > maxNetworkProbeTimeout {
+		return maxNetworkProbeTimeout
+	}
+	return timeout
+}
+
+// durationMs convertit une durée en millisecondes arrondies au centième
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()/10) / 100
+}
+
+// listNetworkInterfaces retourne les interfaces réseau et leurs adresses
+func listNetworkInterfaces() ([]*common.NetworkInterface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("impossible de lister les interfaces: %v", err)
+	}
+
+	result := make([]*common.NetworkInterface, 0, len(ifaces))
+	for _, iface := range ifaces {
+		info := &common.NetworkInterface{
+			Name:      iface.Name,
+			MAC:       iface.HardwareAddr.String(),
+			MTU:       iface.MTU,
+			Up:        iface.Flags&net.FlagUp != 0,
+			Loopback:  iface.Flags&net.FlagLoopback != 0,
+			Flags:     iface.Flags.String(),
+			Addresses: []string{},
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, addr := range addrs {
+				info.Addresses = append(info.Addresses, addr.String())
+			}
+		}
+		result = append(result, info)
+	}
+	return result, nil
+}
+
+// probeDNS résout un nom d'hôte, éventuellement auprès d'un serveur DNS donné
+func probeDNS(host, server string, timeout time.Duration) (*common.DNSProbeResult, error) {
+	if host == "" {
+		return nil, fmt.Errorf("nom d'hôte manquant")
+	}
+
+	resolver := net.DefaultResolver
+	if server != "" {
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		dialer := &net.Dialer{Timeout: timeout}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result := &common.DNSProbeResult{Host: host, Server: server}
+	addresses, err := resolver.LookupHost(ctx, host)
+	if err != nil {
+		return result, fmt.Errorf("résolution de %s impossible: %v", host, err)
+	}
+	result.Addresses = addresses
+
+	if cname, err := resolver.LookupCNAME(ctx, host); err == nil && strings.TrimSuffix(cname, ".") != strings.TrimSuffix(host, ".") {
+		result.CNAME = strings.TrimSuffix(cname, ".")
+	}
+	return result, nil
+}
+
+// probeTCP teste l'ouverture d'une connexion TCP et mesure sa latence
+func probeTCP(host string, port int, timeout time.Duration) (*common.TCPProbeResult, error) {
+	if host == "" {
+		return nil, fmt.Errorf("hôte manquant")
+	}
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("port invalide: %d", port)
+	}
+
+	result := &common.TCPProbeResult{Host: host, Port: port}
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	result.LatencyMs = durationMs(time.Since(start))
+	if err != nil {
+		return result, fmt.Errorf("connexion à %s:%d impossible: %v", host, port, err)
+	}
+	defer conn.Close()
+
+	result.Connected = true
+	result.RemoteAddress = conn.RemoteAddr().String()
+	return result, nil
+}
+
+// probeHTTP interroge une URL et relève le statut, la latence et le certificat TLS
+func probeHTTP(rawURL, method string, timeout time.Duration) (*common.HTTPProbeResult, error) {
+	if rawURL == "" {
+		return nil, fmt.Errorf("URL manquante")
+	}
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		rawURL = "http://" + rawURL
+	}
+
+	method = strings.ToUpper(method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	if method != http.MethodGet && method != http.MethodHead {
+		return nil, fmt.Errorf("méthode non autorisée: %s", method)
+	}
+
+	req, err := http.NewRequest(method, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("URL invalide: %v", err)
+	}
+	req.Header.Set("User-Agent", "RemoteShell-Agent/diagnostic")
+
+	result := &common.HTTPProbeResult{URL: rawURL}
+	client := &http.Client{Timeout: timeout}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		result.LatencyMs = durationMs(time.Since(start))
+		return result, fmt.Errorf("requête vers %s impossible: %v", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	n, _ := io.Copy(io.Discard, io.LimitReader(resp.Body, maxHTTPProbeBody))
+	result.LatencyMs = durationMs(time.Since(start))
+	result.StatusCode = resp.StatusCode
+	result.Status = resp.Status
+	result.ContentLength = resp.ContentLength
+	if result.ContentLength < 0 {
+		result.ContentLength = n
+	}
+	if resp.Request != nil && resp.Request.URL.String() != rawURL {
+		result.FinalURL = resp.Request.URL.String()
+	}
+
+	if resp.TLS != nil {
+		result.TLSVersion = tls.VersionName(resp.TLS.Version)
+		if len(resp.TLS.PeerCertificates) > 0 {
+			cert := resp.TLS.PeerCertificates[0]
+			result.CertExpiry = cert.NotAfter.UTC().Format(time.RFC3339)
+			result.CertSubject = cert.Subject.CommonName
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,309 @@
+//go:build linux
+
+package agent
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"remoteshell/internal/common"
+)
+
+// tcpStates associe les codes d'état de /proc/net/tcp à leur nom
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// routeFlagGateway indique une route passant par une passerelle (RTF_GATEWAY)
+const routeFlagGateway = 0x2
+
+// listNetworkRoutes lit les tables de routage IPv4 et IPv6 depuis /proc/net
+func listNetworkRoutes() ([]*common.NetworkRoute, error) {
+	routes, err := readIPv4Routes()
+	if err != nil {
+		return nil, err
+	}
+	// La table IPv6 est absente lorsque IPv6 est désactivé
+	if routes6, err := readIPv6Routes(); err == nil {
+		routes = append(routes, routes6...)
+	}
+	return routes, nil
+}
+
+// readIPv4Routes lit /proc/net/route
+func readIPv4Routes() ([]*common.NetworkRoute, error) {
+	file, err := os.Open("/proc/net/route")
+	if err != nil {
+		return nil, fmt.Errorf("impossible de lire la table de routage: %v", err)
+	}
+	defer file.Close()
+
+	var routes []*common.NetworkRoute
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // En-tête
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 {
+			continue
+		}
+		destination, err1 := parseHexIPv4(fields[1])
+		gateway, err2 := parseHexIPv4(fields[2])
+		mask, err3 := parseHexIPv4(fields[7])
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		flags, _ := strconv.ParseUint(fields[3], 16, 32)
+		metric, _ := strconv.Atoi(fields[6])
+		ones, _ := net.IPMask(mask.To4()).Size()
+
+		route := &common.NetworkRoute{
+			Destination: fmt.Sprintf("%s/%d", destination, ones),
+			Interface:   fields[0],
+			Metric:      metric,
+			Default:     ones == 0,
+		}
+		if flags&routeFlagGateway != 0 {
+			route.Gateway = gateway.String()
+		}
+		routes = append(routes, route)
+	}
+	return routes, scanner.Err()
+}
+
+// readIPv6Routes lit /proc/net/ipv6_route en ignorant les routes locales et multicast du noyau
+func readIPv6Routes() ([]*common.NetworkRoute, error) {
+	file, err := os.Open("/proc/net/ipv6_route")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var routes []*common.NetworkRoute
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 || fields[9] == "lo" {
+			continue
+		}
+		destination, err1 := hex.DecodeString(fields[0])
+		gateway, err2 := hex.DecodeString(fields[4])
+		prefix, err3 := strconv.ParseUint(fields[1], 16, 8)
+		if err1 != nil || err2 != nil || err3 != nil {
+			continue
+		}
+		ip := net.IP(destination)
+		if ip.IsMulticast() {
+			continue
+		}
+		metric, _ := strconv.ParseUint(fields[5], 16, 32)
+
+		route := &common.NetworkRoute{
+			Destination: fmt.Sprintf("%s/%d", ip, prefix),
+			Interface:   fields[9],
+			Metric:      int(metric),
+			Default:     prefix == 0,
+		}
+		if gw := net.IP(gateway); !gw.IsUnspecified() {
+			route.Gateway = gw.String()
+		}
+		routes = append(routes, route)
+	}
+	return routes, scanner.Err()
+}
+
+// listNetworkSockets lit les sockets TCP et UDP depuis /proc/net
+// state filtre les sockets en écoute (listen) ou les connexions établies (established)
+func listNetworkSockets(state string) ([]*common.NetworkSocket, error) {
+	if state != "" && state != "listen" && state != "established" {
+		return nil, fmt.Errorf("filtre d'état inconnu: %s", state)
+	}
+
+	owners := socketOwners()
+	var sockets []*common.NetworkSocket
+	read := false
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		entries, err := readProcNetSockets(protocol, owners)
+		if err != nil {
+			continue
+		}
+		read = true
+		for _, socket := range entries {
+			if matchSocketState(socket, state) {
+				sockets = append(sockets, socket)
+			}
+		}
+	}
+	if !read {
+		return nil, fmt.Errorf("impossible de lire les sockets depuis /proc/net")
+	}
+	return sockets, nil
+}
+
+// matchSocketState vérifie si un socket correspond au filtre d'état
+func matchSocketState(socket *common.NetworkSocket, state string) bool {
+	switch state {
+	case "listen":
+		return socket.State == "LISTEN" || socket.State == "UNCONN"
+	case "established":
+		return socket.State == "ESTABLISHED"
+	}
+	return true
+}
+
+// socketOwner identifie le processus propriétaire d'un socket
+type socketOwner struct {
+	pid  int
+	name string
+}
+
+// readProcNetSockets lit un fichier /proc/net/{tcp,tcp6,udp,udp6}
+func readProcNetSockets(protocol string, owners map[string]socketOwner) ([]*common.NetworkSocket, error) {
+	file, err := os.Open(filepath.Join("/proc/net", protocol))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var sockets []*common.NetworkSocket
+	scanner := bufio.NewScanner(file)
+	scanner.Scan() // En-tête
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		local, err1 := parseHexEndpoint(fields[1])
+		remote, err2 := parseHexEndpoint(fields[2])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+
+		state := tcpStates[fields[3]]
+		if strings.HasPrefix(protocol, "udp") {
+			// Un socket UDP non connecté est rapporté dans l'état CLOSE
+			if fields[3] == "07" {
+				state = "UNCONN"
+			} else if fields[3] == "01" {
+				state = "ESTABLISHED"
+			}
+		}
+
+		socket := &common.NetworkSocket{
+			Protocol:     protocol,
+			LocalAddress: local,
+			State:        state,
+		}
+		if !strings.HasSuffix(remote, ":0") {
+			socket.RemoteAddress = remote
+		}
+		if owner, ok := owners[fields[9]]; ok {
+			socket.PID = owner.pid
+			socket.Process = owner.name
+		}
+		sockets = append(sockets, socket)
+	}
+	return sockets, scanner.Err()
+}
+
+// socketOwners associe les inodes de sockets aux processus qui les détiennent
+// Les processus inaccessibles (droits insuffisants) sont ignorés
+func socketOwners() map[string]socketOwner {
+	owners := make(map[string]socketOwner)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return owners
+	}
+
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		fdDir := filepath.Join("/proc", entry.Name(), "fd")
+		fds, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+
+		var name string
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") {
+				continue
+			}
+			inode := strings.TrimSuffix(strings.TrimPrefix(link, "socket:["), "]")
+			if _, known := owners[inode]; known {
+				continue
+			}
+			if name == "" {
+				name = processName(pid)
+			}
+			owners[inode] = socketOwner{pid: pid, name: name}
+		}
+	}
+	return owners
+}
+
+// parseHexEndpoint décode une adresse "IP:PORT" hexadécimale de /proc/net
+func parseHexEndpoint(value string) (string, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return "", fmt.Errorf("adresse invalide: %s", value)
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return "", err
+	}
+
+	var ip net.IP
+	if len(parts[0]) == 8 {
+		ip, err = parseHexIPv4(parts[0])
+	} else {
+		ip, err = parseHexIPv6(parts[0])
+	}
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port))), nil
+}
+
+// parseHexIPv4 décode une adresse IPv4 hexadécimale en ordre d'octets de l'hôte (little-endian)
+func parseHexIPv4(value string) (net.IP, error) {
+	raw, err := hex.DecodeString(value)
+	if err != nil || len(raw) != 4 {
+		return nil, fmt.Errorf("adresse IPv4 invalide: %s", value)
+	}
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, binary.LittleEndian.Uint32(raw))
+	return ip, nil
+}
+
+// parseHexIPv6 décode une adresse IPv6 hexadécimale de /proc/net/tcp6 (quatre mots little-endian)
+func parseHexIPv6(value string) (net.IP, error) {
+	raw, err := hex.DecodeString(value)
+	if err != nil || len(raw) != 16 {
+		return nil, fmt.Errorf("adresse IPv6 invalide: %s", value)
+	}
+	ip := make(net.IP, 16)
+	for i := 0; i < 16; i += 4 {
+		binary.BigEndian.PutUint32(ip[i:], binary.LittleEndian.Uint32(raw[i:]))
+	}
+	return ip, nil
+}
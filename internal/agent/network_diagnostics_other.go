@@ -0,0 +1,20 @@
+//go:build !linux
+
+package agent
+
+import (
+	"fmt"
+	"runtime"
+
+	"remoteshell/internal/common"
+)
+
+// listNetworkRoutes n'est pas implémenté hors Linux
+func listNetworkRoutes() ([]*common.NetworkRoute, error) {
+	return nil, fmt.Errorf("table de routage non supportée sur %s", runtime.GOOS)
+}
+
+// listNetworkSockets n'est pas implémenté hors Linux
+func listNetworkSockets(state string) ([]*common.NetworkSocket, error) {
+	return nil, fmt.Errorf("liste des sockets non supportée sur %s", runtime.GOOS)
+}
@@ -0,0 +1,435 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// Bornes de la durée d'une opération sur les paquets
+const (
+	defaultPackageTimeout = 10 * time.Minute
+	maxPackageTimeout     = time.Hour
+)
+
+// packageOutputFlushInterval est l'intervalle d'envoi de la sortie d'une opération en cours
+const packageOutputFlushInterval = 500 * time.Millisecond
+
+// packageOutputTail est le nombre de lignes de sortie conservées dans le résultat
+const packageOutputTail = 200
+
+// packageNamePattern valide un nom de paquet (éventuellement suivi d'une version: nom=1.2)
+// Un nom ne peut pas commencer par "-" pour ne pas être interprété comme une option
+var packageNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9+._:=~@-]*$`)
+
+// aptOptions conserve les fichiers de configuration locaux sans poser de question
+var aptOptions = []string{"-y", "-q", "-o", "Dpkg::Options::=--force-confdef", "-o", "Dpkg::Options::=--force-confold"}
+
+// packageBackend décrit les commandes d'un gestionnaire de paquets
+type packageBackend struct {
+	name           string
+	binary         string
+	env            []string
+	refresh        []string     // Mise à jour des métadonnées des dépôts (nil si inutile)
+	upgradable     []string     // Liste des mises à jour disponibles
+	upgradableCode map[int]bool // Codes de sortie signalant un succès pour la liste des mises à jour
+	parse          func(lines []string) []*common.UpgradablePackage
+	install        func(packages []string) []string
+	upgrade        func(packages []string) []string
+	remove         func(packages []string) []string
+}
+
+// packageBackends liste les gestionnaires supportés par ordre de détection
+var packageBackends = []*packageBackend{
+	{
+		name:       "apt",
+		binary:     "apt-get",
+		env:        []string{"DEBIAN_FRONTEND=noninteractive", "APT_LISTCHANGES_FRONTEND=none", "NEEDRESTART_MODE=a"},
+		refresh:    []string{"update", "-q"},
+		upgradable: []string{"-s", "-q", "upgrade"},
+		parse:      parseAptUpgradable,
+		install: func(packages []string) []string {
+			return append(append([]string{"install"}, aptOptions...), packages...)
+		},
+		upgrade: func(packages []string) []string {
+			if len(packages) == 0 {
+				return append([]string{"upgrade"}, aptOptions...)
+			}
+			return append(append([]string{"install", "--only-upgrade"}, aptOptions...), packages...)
+		},
+		remove: func(packages []string) []string {
+			return append([]string{"remove", "-y", "-q"}, packages...)
+		},
+	},
+	newDnfBackend("dnf"),
+	newDnfBackend("yum"),
+	{
+		name:       "zypper",
+		binary:     "zypper",
+		refresh:    []string{"--non-interactive", "refresh"},
+		upgradable: []string{"--non-interactive", "--quiet", "list-updates"},
+		parse:      parseZypperUpgradable,
+		install: func(packages []string) []string {
+			return append([]string{"--non-interactive", "install"}, packages...)
+		},
+		upgrade: func(packages []string) []string {
+			return append([]string{"--non-interactive", "update"}, packages...)
+		},
+		remove: func(packages []string) []string {
+			return append([]string{"--non-interactive", "remove"}, packages...)
+		},
+	},
+	{
+		name:       "apk",
+		binary:     "apk",
+		refresh:    []string{"update", "-q"},
+		upgradable: []string{"version", "-l", "<"},
+		parse:      parseApkUpgradable,
+		install: func(packages []string) []string {
+			return append([]string{"add", "--no-progress"}, packages...)
+		},
+		upgrade: func(packages []string) []string {
+			return append([]string{"upgrade", "--no-progress"}, packages...)
+		},
+		remove: func(packages []string) []string {
+			return append([]string{"del", "--no-progress"}, packages...)
+		},
+	},
+}
+
+// newDnfBackend crée la description de dnf ou yum, qui partagent la même syntaxe
+// check-update rafraîchit les métadonnées et sort avec le code 100 si des mises à jour sont disponibles
+func newDnfBackend(binary string) *packageBackend {
+	return &packageBackend{
+		name:           binary,
+		binary:         binary,
+		upgradable:     []string{"check-update", "-q"},
+		upgradableCode: map[int]bool{0: true, 100: true},
+		parse:          parseDnfUpgradable,
+		install: func(packages []string) []string {
+			return append([]string{"install", "-y"}, packages...)
+		},
+		upgrade: func(packages []string) []string {
+			return append([]string{"upgrade", "-y"}, packages...)
+		},
+		remove: func(packages []string) []string {
+			return append([]string{"remove", "-y"}, packages...)
+		},
+	}
+}
+
+// PackageManager exécute les opérations sur les paquets avec le gestionnaire détecté
+// Une seule opération peut être en cours à la fois
+type PackageManager struct {
+	running sync.Mutex
+}
+
+// NewPackageManager crée un nouveau gestionnaire de paquets
+func NewPackageManager() *PackageManager {
+	return &PackageManager{}
+}
+
+// detectPackageBackend retourne le premier gestionnaire de paquets disponible
+func detectPackageBackend() *packageBackend {
+	for _, backend := range packageBackends {
+		if _, err := exec.LookPath(backend.binary); err == nil {
+			return backend
+		}
+	}
+	return nil
+}
+
+// Run exécute une opération sur les paquets
+// onOutput reçoit chaque ligne de sortie au fil de l'exécution
+func (pm *PackageManager) Run(req *common.PackageActionRequest, onOutput func(line string)) *common.PackageActionResult {
+	result := &common.PackageActionResult{Action: req.Action, Packages: req.Packages, ExitCode: -1}
+	start := time.Now()
+	defer func() {
+		result.DurationMs = durationMs(time.Since(start))
+	}()
+
+	backend := detectPackageBackend()
+	if backend == nil {
+		result.Error = "aucun gestionnaire de paquets supporté (apt, dnf, yum, zypper, apk)"
+		return result
+	}
+	result.Manager = backend.name
+
+	if err := validatePackageRequest(req); err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	if !pm.running.TryLock() {
+		result.Error = "une opération sur les paquets est déjà en cours"
+		return result
+	}
+	defer pm.running.Unlock()
+
+	timeout := defaultPackageTimeout
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+		if timeout > maxPackageTimeout {
+			timeout = maxPackageTimeout
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	run := &packageRun{ctx: ctx, backend: backend, onOutput: onOutput}
+
+	// Les métadonnées des dépôts sont rafraîchies avant toute opération sauf une suppression
+	if req.Action != common.PackageActionRemove && backend.refresh != nil {
+		if code, err := run.command(backend.refresh, false); err != nil {
+			result.ExitCode = code
+			result.Error = fmt.Sprintf("échec de la mise à jour des dépôts: %v", err)
+			result.Output = run.tail
+			return result
+		}
+	}
+
+	var args []string
+	switch req.Action {
+	case common.PackageActionListUpgradable:
+		args = backend.upgradable
+	case common.PackageActionInstall:
+		args = backend.install(req.Packages)
+	case common.PackageActionUpgrade:
+		args = backend.upgrade(req.Packages)
+	case common.PackageActionRemove:
+		args = backend.remove(req.Packages)
+	}
+
+	capture := req.Action == common.PackageActionListUpgradable
+	code, err := run.command(args, capture)
+	result.ExitCode = code
+	result.Output = run.tail
+	if err != nil && !(capture && backend.upgradableCode[code]) {
+		result.Error = err.Error()
+		return result
+	}
+
+	if capture {
+		result.Upgradable = backend.parse(run.captured)
+		// La liste peut être longue: elle est déjà structurée, la sortie brute est inutile
+		result.Output = nil
+	}
+	result.Success = true
+	return result
+}
+
+// validatePackageRequest vérifie l'action et les noms de paquets d'une demande
+func validatePackageRequest(req *common.PackageActionRequest) error {
+	switch req.Action {
+	case common.PackageActionListUpgradable, common.PackageActionUpgrade:
+	case common.PackageActionInstall, common.PackageActionRemove:
+		if len(req.Packages) == 0 {
+			return fmt.Errorf("aucun paquet précisé pour l'action %s", req.Action)
+		}
+	default:
+		return fmt.Errorf("action inconnue: %s", req.Action)
+	}
+
+	for _, name := range req.Packages {
+		if !packageNamePattern.MatchString(name) {
+			return fmt.Errorf("nom de paquet invalide: %q", name)
+		}
+	}
+	return nil
+}
+
+// packageRun exécute les commandes d'une opération et conserve leur sortie
+type packageRun struct {
+	ctx      context.Context
+	backend  *packageBackend
+	onOutput func(line string)
+	tail     []string // Dernières lignes de sortie de toutes les commandes
+	captured []string // Sortie complète de la dernière commande capturée
+}
+
+// command exécute le gestionnaire de paquets avec les arguments donnés
+// stdout et stderr sont fusionnés; retourne le code de sortie
+func (r *packageRun) command(args []string, capture bool) (int, error) {
+	cmd := exec.CommandContext(r.ctx, r.backend.binary, args...)
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	cmd.Env = append(cmd.Env, r.backend.env...)
+
+	reader, writer := io.Pipe()
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	r.emit(fmt.Sprintf("$ %s %s", r.backend.binary, strings.Join(args, " ")))
+	if err := cmd.Start(); err != nil {
+		return -1, fmt.Errorf("impossible de lancer %s: %v", r.backend.binary, err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		err := cmd.Wait()
+		writer.Close()
+		done <- err
+	}()
+
+	r.captured = nil
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if capture {
+			r.captured = append(r.captured, line)
+		} else {
+			r.emit(line)
+		}
+	}
+	// Vider le tube si la lecture s'est arrêtée sur une ligne trop longue
+	io.Copy(io.Discard, reader)
+
+	err := <-done
+	if r.ctx.Err() == context.DeadlineExceeded {
+		return -1, fmt.Errorf("délai d'exécution dépassé")
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode(), fmt.Errorf("%s a échoué (code %d)", r.backend.binary, exitErr.ExitCode())
+		}
+		return -1, err
+	}
+	return 0, nil
+}
+
+// emit transmet une ligne de sortie et la conserve dans la fin de sortie
+func (r *packageRun) emit(line string) {
+	r.tail = append(r.tail, line)
+	if len(r.tail) > packageOutputTail {
+		r.tail = r.tail[len(r.tail)-packageOutputTail:]
+	}
+	if r.onOutput != nil {
+		r.onOutput(line)
+	}
+}
+
+// parseAptUpgradable analyse la simulation "apt-get -s upgrade"
+// Format: "Inst nom [ancienne] (nouvelle dépôt [arch])"
+func parseAptUpgradable(lines []string) []*common.UpgradablePackage {
+	var packages []*common.UpgradablePackage
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "Inst ") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "Inst "))
+		if len(fields) < 2 {
+			continue
+		}
+		pkg := &common.UpgradablePackage{Name: fields[0]}
+		rest := fields[1:]
+		if strings.HasPrefix(rest[0], "[") {
+			pkg.CurrentVersion = strings.Trim(rest[0], "[]")
+			rest = rest[1:]
+		}
+		if len(rest) > 0 {
+			pkg.AvailableVersion = strings.TrimPrefix(rest[0], "(")
+		}
+		if len(rest) > 1 {
+			pkg.Repository = strings.TrimRight(rest[1], ",)")
+		}
+		if len(rest) > 2 {
+			pkg.Arch = strings.Trim(rest[len(rest)-1], "[])")
+		}
+		packages = append(packages, pkg)
+	}
+	return packages
+}
+
+// parseDnfUpgradable analyse la sortie de "dnf check-update"
+// Format: "nom.arch version dépôt"; la section des paquets obsolètes est ignorée
+func parseDnfUpgradable(lines []string) []*common.UpgradablePackage {
+	var packages []*common.UpgradablePackage
+	for _, line := range lines {
+		if strings.HasPrefix(line, "Obsoleting") {
+			break
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || strings.HasPrefix(line, " ") {
+			continue
+		}
+		dot := strings.LastIndexByte(fields[0], '.')
+		if dot <= 0 {
+			continue
+		}
+		packages = append(packages, &common.UpgradablePackage{
+			Name:             fields[0][:dot],
+			Arch:             fields[0][dot+1:],
+			AvailableVersion: fields[1],
+			Repository:       fields[2],
+		})
+	}
+	return packages
+}
+
+// parseZypperUpgradable analyse le tableau de "zypper list-updates"
+// Colonnes: S | Dépôt | Nom | Version actuelle | Version disponible | Arch
+func parseZypperUpgradable(lines []string) []*common.UpgradablePackage {
+	var packages []*common.UpgradablePackage
+	for _, line := range lines {
+		columns := strings.Split(line, "|")
+		if len(columns) < 6 {
+			continue
+		}
+		for i := range columns {
+			columns[i] = strings.TrimSpace(columns[i])
+		}
+		if columns[2] == "" || columns[2] == "Name" {
+			continue
+		}
+		packages = append(packages, &common.UpgradablePackage{
+			Name:             columns[2],
+			Repository:       columns[1],
+			CurrentVersion:   columns[3],
+			AvailableVersion: columns[4],
+			Arch:             columns[5],
+		})
+	}
+	return packages
+}
+
+// parseApkUpgradable analyse la sortie de "apk version -l <"
+// Format: "nom-version-rN < nouvelle-version"
+func parseApkUpgradable(lines []string) []*common.UpgradablePackage {
+	var packages []*common.UpgradablePackage
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[1] != "<" {
+			continue
+		}
+		name, version := splitApkPackage(fields[0])
+		packages = append(packages, &common.UpgradablePackage{
+			Name:             name,
+			CurrentVersion:   version,
+			AvailableVersion: fields[2],
+		})
+	}
+	return packages
+}
+
+// splitApkPackage sépare le nom et la version d'un identifiant apk "nom-version-rN"
+// La version commence au premier segment débutant par un chiffre
+func splitApkPackage(value string) (string, string) {
+	parts := strings.Split(value, "-")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" && parts[i][0] >= '0' && parts[i][0] <= '9' {
+			return strings.Join(parts[:i], "-"), strings.Join(parts[i:], "-")
+		}
+	}
+	return value, ""
+}
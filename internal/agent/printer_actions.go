@@ -0,0 +1,225 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"remoteshell/internal/common"
+)
+
+// printerActionTimeout borne la durée d'une commande d'administration des imprimantes
+const printerActionTimeout = 30 * time.Second
+
+// printerNamePattern valide les noms d'imprimantes CUPS transmis aux commandes
+// Un nom ne peut pas commencer par un tiret pour ne pas être interprété comme une option
+var printerNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.@+-]*$`)
+
+// psSingleQuotes liste les caractères que PowerShell reconnaît comme apostrophes délimitant une chaîne
+const psSingleQuotes = "'\u2018\u2019\u201A\u201B"
+
+// lpRequestIDPattern extrait l'identifiant du travail créé par lp ("request id is PRN-42 (1 file(s))")
+var lpRequestIDPattern = regexp.MustCompile(`request id is \S+-(\d+)`)
+
+// cupsTestPages liste les pages de test fournies par CUPS, par ordre de préférence
+var cupsTestPages = []string{
+	"/usr/share/cups/data/testprint",
+	"/usr/share/cups/data/testprint.ps",
+}
+
+// printerActionMessages décrit le résultat de chaque action réussie
+var printerActionMessages = map[string]string{
+	common.PrinterActionCancelJob:  "travail %[2]d annulé",
+	common.PrinterActionCancelAll:  "tous les travaux de %[1]s ont été annulés",
+	common.PrinterActionHoldJob:    "travail %[2]d mis en attente",
+	common.PrinterActionReleaseJob: "travail %[2]d relâché",
+	common.PrinterActionMoveJob:    "travail %[2]d déplacé vers %[3]s",
+	common.PrinterActionEnable:     "imprimante %[1]s activée",
+	common.PrinterActionDisable:    "imprimante %[1]s désactivée",
+	common.PrinterActionAccept:     "la file %[1]s accepte les travaux",
+	common.PrinterActionReject:     "la file %[1]s refuse les travaux",
+	common.PrinterActionSetDefault: "%[1]s est l'imprimante par défaut",
+	common.PrinterActionTestPage:   "page de test envoyée à %[1]s",
+}
+
+// ExecuteAction exécute une action sur une imprimante ou l'un de ses travaux
+func (pm *PrinterMonitor) ExecuteAction(req *common.PrinterActionRequest) *common.PrinterActionResult {
+	result := &common.PrinterActionResult{
+		Printer: req.Printer,
+		Action:  req.Action,
+		JobID:   req.JobID,
+		Target:  req.Target,
+	}
+
+	var output string
+	var err error
+	if runtime.GOOS == "windows" {
+		output, err = pm.executeWindowsAction(req)
+	} else {
+		output, err = pm.executeCUPSAction(req)
+	}
+	result.Output = strings.TrimSpace(output)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	// Une page de test crée un travail dont l'identifiant est retourné
+	if req.Action == common.PrinterActionTestPage {
+		if matches := lpRequestIDPattern.FindStringSubmatch(output); matches != nil {
+			result.JobID, _ = strconv.Atoi(matches[1])
+		}
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf(printerActionMessages[req.Action], req.Printer, req.JobID, req.Target)
+	return result
+}
+
+// executeCUPSAction exécute une action via les commandes d'administration CUPS
+func (pm *PrinterMonitor) executeCUPSAction(req *common.PrinterActionRequest) (string, error) {
+	if !printerNamePattern.MatchString(req.Printer) {
+		return "", fmt.Errorf("nom d'imprimante invalide: %s", req.Printer)
+	}
+
+	// CUPS désigne un travail par "<imprimante>-<id>"
+	job := fmt.Sprintf("%s-%d", req.Printer, req.JobID)
+
+	switch req.Action {
+	case common.PrinterActionCancelJob:
+		return runPrinterCommand(nil, "cancel", job)
+	case common.PrinterActionCancelAll:
+		return runPrinterCommand(nil, "cancel", "-a", req.Printer)
+	case common.PrinterActionHoldJob:
+		return runPrinterCommand(nil, "lp", "-i", job, "-H", "hold")
+	case common.PrinterActionReleaseJob:
+		return runPrinterCommand(nil, "lp", "-i", job, "-H", "resume")
+	case common.PrinterActionMoveJob:
+		if !printerNamePattern.MatchString(req.Target) {
+			return "", fmt.Errorf("nom d'imprimante de destination invalide: %s", req.Target)
+		}
+		return runPrinterCommand(nil, "lpmove", job, req.Target)
+	case common.PrinterActionEnable:
+		return runPrinterCommand(nil, "cupsenable", req.Printer)
+	case common.PrinterActionDisable:
+		return runPrinterCommand(nil, "cupsdisable", withReason(req.Reason, req.Printer)...)
+	case common.PrinterActionAccept:
+		return runPrinterCommand(nil, "cupsaccept", req.Printer)
+	case common.PrinterActionReject:
+		return runPrinterCommand(nil, "cupsreject", withReason(req.Reason, req.Printer)...)
+	case common.PrinterActionSetDefault:
+		return runPrinterCommand(nil, "lpadmin", "-d", req.Printer)
+	case common.PrinterActionTestPage:
+		args := []string{"-d", req.Printer, "-t", "Page de test RemoteShell"}
+		for _, page := range cupsTestPages {
+			if _, err := os.Stat(page); err == nil {
+				return runPrinterCommand(nil, "lp", append(args, page)...)
+			}
+		}
+		// Sans page de test CUPS, imprimer une page texte décrivant l'agent
+		return runPrinterCommand(strings.NewReader(testPageText(req.Printer)), "lp", args...)
+	}
+
+	return "", fmt.Errorf("action inconnue: %s", req.Action)
+}
+
+// executeWindowsAction exécute une action via les cmdlets PowerShell de gestion d'impression
+func (pm *PrinterMonitor) executeWindowsAction(req *common.PrinterActionRequest) (string, error) {
+	if err := validateWindowsPrinterName(req.Printer); err != nil {
+		return "", err
+	}
+	printer := psQuote(req.Printer)
+
+	var script string
+	switch req.Action {
+	case common.PrinterActionCancelJob:
+		script = fmt.Sprintf("Remove-PrintJob -PrinterName %s -ID %d", printer, req.JobID)
+	case common.PrinterActionCancelAll:
+		script = fmt.Sprintf("Get-PrintJob -PrinterName %s | Remove-PrintJob", printer)
+	case common.PrinterActionHoldJob:
+		script = fmt.Sprintf("Suspend-PrintJob -PrinterName %s -ID %d", printer, req.JobID)
+	case common.PrinterActionReleaseJob:
+		script = fmt.Sprintf("Resume-PrintJob -PrinterName %s -ID %d", printer, req.JobID)
+	case common.PrinterActionSetDefault:
+		script = fmt.Sprintf("(New-Object -ComObject WScript.Network).SetDefaultPrinter(%s)", printer)
+	case common.PrinterActionTestPage:
+		script = fmt.Sprintf("Get-CimInstance Win32_Printer | Where-Object { $_.Name -eq %s } | Invoke-CimMethod -MethodName PrintTestPage", printer)
+	default:
+		return "", fmt.Errorf("action %s non supportée sous Windows", req.Action)
+	}
+
+	return runPrinterCommand(nil, "powershell", "-NoProfile", "-Command", "$ErrorActionPreference = 'Stop'; "+script)
+}
+
+// runPrinterCommand exécute une commande d'administration et retourne sa sortie
+func runPrinterCommand(stdin io.Reader, name string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), printerActionTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = stdin
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", fmt.Errorf("commande %s introuvable", name)
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			return string(output), fmt.Errorf("%s: délai d'exécution dépassé", name)
+		}
+		// Les outils CUPS préfixent déjà leurs messages d'erreur par leur nom
+		if message := strings.TrimSpace(string(output)); message != "" {
+			return string(output), errors.New(message)
+		}
+		return string(output), fmt.Errorf("%s: %v", name, err)
+	}
+	return string(output), nil
+}
+
+// withReason ajoute le motif facultatif d'une désactivation ou d'un refus avant le nom de l'imprimante
+func withReason(reason, printer string) []string {
+	if reason == "" {
+		return []string{printer}
+	}
+	return []string{"-r", reason, printer}
+}
+
+// validateWindowsPrinterName refuse les noms d'imprimante Windows vides, mal encodés ou contenant des caractères de contrôle
+// Les noms Windows admettent espaces et apostrophes (« Imprimante de l'accueil »), échappées par psQuote
+func validateWindowsPrinterName(name string) error {
+	if name == "" || !utf8.ValidString(name) || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return fmt.Errorf("nom d'imprimante invalide: %q", name)
+	}
+	return nil
+}
+
+// psQuote encadre une valeur entre apostrophes pour PowerShell
+// Toutes les apostrophes reconnues par PowerShell, typographiques comprises, sont doublées
+func psQuote(value string) string {
+	var quoted strings.Builder
+	quoted.WriteByte('\'')
+	for _, r := range value {
+		if strings.ContainsRune(psSingleQuotes, r) {
+			quoted.WriteRune(r)
+		}
+		quoted.WriteRune(r)
+	}
+	quoted.WriteByte('\'')
+	return quoted.String()
+}
+
+// testPageText construit une page de test texte identifiant l'agent et l'imprimante
+func testPageText(printer string) string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("Page de test RemoteShell\n\nImprimante : %s\nAgent      : %s\nDate       : %s\n",
+		printer, hostname, time.Now().Format("02/01/2006 15:04:05"))
+}
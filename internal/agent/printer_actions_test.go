@@ -0,0 +1,34 @@
+package agent
+
+import "testing"
+
+func TestPSQuote(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"Hall", "'Hall'"},
+		{"Imprimante de l'accueil", "'Imprimante de l''accueil'"},
+		// PowerShell termine aussi une chaîne sur les apostrophes typographiques
+		{"x\u2019; Remove-Item C:\\ #", "'x\u2019\u2019; Remove-Item C:\\ #'"},
+		{"\u2018\u201A\u201B", "'\u2018\u2018\u201A\u201A\u201B\u201B'"},
+		{`Bureau "RDC"`, `'Bureau "RDC"'`},
+	}
+	for _, tt := range tests {
+		if got := psQuote(tt.value); got != tt.want {
+			t.Errorf("psQuote(%q) = %q, attendu %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidateWindowsPrinterName(t *testing.T) {
+	for _, name := range []string{"Hall", "Imprimante de l\u2019accueil", `\\srv-print\Compta (2e étage)`} {
+		if err := validateWindowsPrinterName(name); err != nil {
+			t.Errorf("%q devrait être accepté: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "Hall\r\nRemove-Item C:\\", "Hall\x00", "Hall\xff"} {
+		if validateWindowsPrinterName(name) == nil {
+			t.Errorf("%q devrait être refusé", name)
+		}
+	}
+}
@@ -0,0 +1,576 @@
+package agent
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+	"golang.org/x/net/ipv4"
+
+	"remoteshell/internal/common"
+)
+
+// defaultDiscoveryTimeout est la durée d'écoute par défaut d'une découverte d'imprimantes
+const defaultDiscoveryTimeout = 5 * time.Second
+
+// mdnsGroup est l'adresse multicast mDNS
+// Les requêtes émises depuis un port autre que 5353 reçoivent des réponses unicast (RFC 6762, 6.7)
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// mdnsPrinterServices liste les services DNS-SD annoncés par les imprimantes, par ordre de préférence
+var mdnsPrinterServices = []string{"_ipp._tcp.local.", "_ipps._tcp.local.", "_pdl-datastream._tcp.local."}
+
+// OID SNMP interrogés lors de la découverte (Host Resources MIB et MIB-II)
+const (
+	oidHrDeviceType  = "1.3.6.1.2.1.25.3.2.1.2.1"
+	oidHrDeviceDescr = "1.3.6.1.2.1.25.3.2.1.3.1"
+	oidSysName       = "1.3.6.1.2.1.1.5.0"
+	oidSysLocation   = "1.3.6.1.2.1.1.6.0"
+	hrDevicePrinter  = "1.3.6.1.2.1.25.3.1.5"
+)
+
+// Identifiants des requêtes SNMP de découverte
+const (
+	snmpDiscoveryRequestID = 1
+	snmpDetailsRequestID   = 2
+)
+
+// driverlessFormats liste les formats qui permettent de créer une file sans pilote
+var driverlessFormats = map[string]bool{
+	"image/pwg-raster": true,
+	"image/urf":        true,
+}
+
+// mdnsService contient les enregistrements collectés pour une instance DNS-SD
+type mdnsService struct {
+	instance string // Nom complet de l'instance ("HP LaserJet._ipp._tcp.local.")
+	service  string // Type de service ("_ipp._tcp.local.")
+	host     string
+	port     int
+	txt      map[string]string
+}
+
+// Discover recherche les imprimantes présentes sur les réseaux locaux de l'agent
+// Les méthodes sont exécutées en parallèle et leurs résultats regroupés par appareil
+func (pm *PrinterMonitor) Discover(req *common.PrinterDiscoveryRequest) *common.PrinterDiscoveryResult {
+	start := time.Now()
+	timeout := defaultDiscoveryTimeout
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+	}
+	methods := req.Methods
+	if len(methods) == 0 {
+		methods = []string{common.PrinterDiscoveryMDNS, common.PrinterDiscoverySNMP}
+	}
+	community := req.Community
+	if community == "" {
+		community = "public"
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var found []*common.DiscoveredPrinter
+	errs := make(map[string]string)
+	for _, method := range methods {
+		wg.Add(1)
+		go func(method string) {
+			defer wg.Done()
+
+			var printers []*common.DiscoveredPrinter
+			var err error
+			switch method {
+			case common.PrinterDiscoveryMDNS:
+				printers, err = discoverMDNS(timeout)
+			case common.PrinterDiscoverySNMP:
+				printers, err = discoverSNMP(community, timeout)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs[method] = err.Error()
+			}
+			found = append(found, printers...)
+		}(method)
+	}
+	wg.Wait()
+
+	result := &common.PrinterDiscoveryResult{
+		Printers: mergeDiscoveredPrinters(found),
+		Duration: time.Since(start).Seconds(),
+	}
+	if len(errs) > 0 {
+		result.Errors = errs
+	}
+
+	pm.mu.Lock()
+	for _, printer := range result.Printers {
+		printer.Queue = pm.queueForDevice(printer)
+	}
+	pm.mu.Unlock()
+	return result
+}
+
+// queueForDevice retourne la file CUPS connue qui utilise déjà un appareil découvert
+// Doit être appelée avec pm.mu verrouillé
+func (pm *PrinterMonitor) queueForDevice(device *common.DiscoveredPrinter) string {
+	names := make([]string, 0, len(pm.cache))
+	for name := range pm.cache {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		u, err := url.Parse(pm.cache[name].URI)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if u.Scheme == "dnssd" {
+			// dnssd://<instance>._ipp._tcp.local/
+			if strings.HasPrefix(strings.ToLower(u.Host), strings.ToLower(device.Name)+"._") {
+				return name
+			}
+			continue
+		}
+		host := strings.ToLower(u.Hostname())
+		if host == device.Address || (device.Host != "" && host == strings.ToLower(device.Host)) {
+			return name
+		}
+	}
+	return ""
+}
+
+// discoverMDNS interroge les services d'impression DNS-SD sur chaque interface multicast
+func discoverMDNS(timeout time.Duration) ([]*common.DiscoveredPrinter, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("ouverture du socket mDNS impossible: %v", err)
+	}
+	defer conn.Close()
+
+	var questions []dnsmessage.Question
+	for _, service := range mdnsPrinterServices {
+		questions = append(questions, mdnsQuestion(service, dnsmessage.TypePTR))
+	}
+	if err := sendMDNSQuery(conn, questions); err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]*mdnsService)
+	addresses := make(map[string]string)
+	deadline := time.Now().Add(timeout)
+	followUp := time.Now().Add(timeout / 2)
+	buf := make([]byte, 9000)
+	for {
+		// Les instances annoncées sans SRV, TXT ou adresse sont interrogées à mi-parcours
+		if !followUp.IsZero() && time.Now().After(followUp) {
+			followUp = time.Time{}
+			if questions := mdnsMissingRecords(services, addresses); len(questions) > 0 {
+				sendMDNSQuery(conn, questions)
+			}
+		}
+
+		wait := deadline
+		if !followUp.IsZero() {
+			wait = followUp
+		}
+		conn.SetReadDeadline(wait)
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				if time.Now().Before(deadline) {
+					continue
+				}
+				break
+			}
+			return nil, fmt.Errorf("lecture des réponses mDNS impossible: %v", err)
+		}
+		parseMDNSResponse(buf[:n], services, addresses)
+	}
+
+	var printers []*common.DiscoveredPrinter
+	for _, service := range services {
+		if service.service == "" || service.host == "" || service.port == 0 {
+			continue
+		}
+		printers = append(printers, printerFromMDNS(service, addresses[strings.ToLower(service.host)]))
+	}
+	return printers, nil
+}
+
+// mdnsQuestion construit une question DNS pour un nom et un type d'enregistrement
+func mdnsQuestion(name string, recordType dnsmessage.Type) dnsmessage.Question {
+	return dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  recordType,
+		Class: dnsmessage.ClassINET,
+	}
+}
+
+// sendMDNSQuery envoie une requête mDNS sur chaque interface IPv4 multicast active
+// En l'absence d'interface utilisable, la requête suit la route par défaut
+func sendMDNSQuery(conn *net.UDPConn, questions []dnsmessage.Question) error {
+	message := dnsmessage.Message{Questions: questions}
+	query, err := message.Pack()
+	if err != nil {
+		return fmt.Errorf("construction de la requête mDNS impossible: %v", err)
+	}
+
+	packetConn := ipv4.NewPacketConn(conn)
+	sent := false
+	for _, iface := range discoveryInterfaces(net.FlagMulticast) {
+		iface := iface
+		if packetConn.SetMulticastInterface(&iface) != nil {
+			continue
+		}
+		if _, err := conn.WriteToUDP(query, mdnsGroup); err == nil {
+			sent = true
+		}
+	}
+	if !sent {
+		if _, err := conn.WriteToUDP(query, mdnsGroup); err != nil {
+			return fmt.Errorf("envoi de la requête mDNS impossible: %v", err)
+		}
+	}
+	return nil
+}
+
+// parseMDNSResponse enregistre les PTR, SRV, TXT et A d'une réponse mDNS
+// Les enregistrements peuvent figurer dans les réponses comme dans les données additionnelles
+func parseMDNSResponse(packet []byte, services map[string]*mdnsService, addresses map[string]string) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(packet)
+	if err != nil || !header.Response {
+		return
+	}
+	if parser.SkipAllQuestions() != nil {
+		return
+	}
+	answers, err := parser.AllAnswers()
+	if err != nil {
+		return
+	}
+	if parser.SkipAllAuthorities() == nil {
+		additionals, _ := parser.AllAdditionals()
+		answers = append(answers, additionals...)
+	}
+
+	service := func(instance string) *mdnsService {
+		key := strings.ToLower(instance)
+		if services[key] == nil {
+			services[key] = &mdnsService{instance: instance}
+		}
+		return services[key]
+	}
+
+	for _, record := range answers {
+		name := record.Header.Name.String()
+		switch body := record.Body.(type) {
+		case *dnsmessage.PTRResource:
+			for _, known := range mdnsPrinterServices {
+				if strings.EqualFold(name, known) {
+					service(body.PTR.String()).service = known
+				}
+			}
+		case *dnsmessage.SRVResource:
+			entry := service(name)
+			entry.host = body.Target.String()
+			entry.port = int(body.Port)
+		case *dnsmessage.TXTResource:
+			entry := service(name)
+			entry.txt = make(map[string]string)
+			for _, pair := range body.TXT {
+				key, value, _ := strings.Cut(pair, "=")
+				entry.txt[strings.ToLower(key)] = value
+			}
+		case *dnsmessage.AResource:
+			addresses[strings.ToLower(name)] = net.IP(body.A[:]).String()
+		}
+	}
+}
+
+// mdnsMissingRecords construit les questions des enregistrements manquants pour les instances connues
+func mdnsMissingRecords(services map[string]*mdnsService, addresses map[string]string) []dnsmessage.Question {
+	var questions []dnsmessage.Question
+	hosts := make(map[string]bool)
+	for _, service := range services {
+		if service.service == "" {
+			continue
+		}
+		host := strings.ToLower(service.host)
+		if service.host == "" {
+			questions = append(questions, mdnsQuestion(service.instance, dnsmessage.TypeSRV))
+		} else if addresses[host] == "" && !hosts[host] {
+			hosts[host] = true
+			questions = append(questions, mdnsQuestion(service.host, dnsmessage.TypeA))
+		}
+		if service.txt == nil {
+			questions = append(questions, mdnsQuestion(service.instance, dnsmessage.TypeTXT))
+		}
+	}
+	return questions
+}
+
+// printerFromMDNS construit la description d'une imprimante à partir d'une instance DNS-SD
+func printerFromMDNS(service *mdnsService, address string) *common.DiscoveredPrinter {
+	name := strings.TrimSuffix(service.instance, "."+service.service)
+	host := strings.TrimSuffix(service.host, ".")
+	printer := &common.DiscoveredPrinter{
+		Name:      name,
+		Host:      host,
+		Address:   address,
+		Methods:   []string{common.PrinterDiscoveryMDNS},
+		MakeModel: service.txt["ty"],
+		Location:  service.txt["note"],
+		UUID:      strings.ToLower(service.txt["uuid"]),
+	}
+	if pdl := service.txt["pdl"]; pdl != "" {
+		printer.Formats = strings.Split(pdl, ",")
+	}
+
+	target := host
+	if address != "" {
+		target = address
+	}
+	switch service.service {
+	case "_ipp._tcp.local.", "_ipps._tcp.local.":
+		scheme := strings.TrimPrefix(strings.SplitN(service.service, ".", 2)[0], "_")
+		printer.URI = fmt.Sprintf("%s://%s/%s", scheme, net.JoinHostPort(target, strconv.Itoa(service.port)), service.txt["rp"])
+
+		// CUPS résout l'URI dnssd:// à chaque impression, ce qui résiste aux changements d'adresse
+		printer.DNSSDURI = "dnssd://" + url.PathEscape(name) + "." + strings.TrimSuffix(service.service, ".") + "/"
+		if printer.UUID != "" {
+			printer.DNSSDURI += "?uuid=" + printer.UUID
+		}
+
+		_, airPrint := service.txt["urf"]
+		printer.Driverless = airPrint
+		for _, format := range printer.Formats {
+			printer.Driverless = printer.Driverless || driverlessFormats[format]
+		}
+	default:
+		printer.URI = fmt.Sprintf("socket://%s", net.JoinHostPort(target, strconv.Itoa(service.port)))
+	}
+	printer.URIs = []string{printer.URI}
+	return printer
+}
+
+// discoverSNMP diffuse une requête hrDeviceType sur chaque réseau local puis interroge les imprimantes qui répondent
+func discoverSNMP(community string, timeout time.Duration) ([]*common.DiscoveredPrinter, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("ouverture du socket SNMP impossible: %v", err)
+	}
+	defer conn.Close()
+
+	query, err := encodeSNMPGet(community, snmpDiscoveryRequestID, []string{oidHrDeviceType})
+	if err != nil {
+		return nil, err
+	}
+	details, err := encodeSNMPGet(community, snmpDetailsRequestID, []string{oidHrDeviceDescr, oidSysName, oidSysLocation})
+	if err != nil {
+		return nil, err
+	}
+
+	sent := false
+	for _, broadcast := range discoveryBroadcasts() {
+		if _, err := conn.WriteToUDP(query, &net.UDPAddr{IP: broadcast, Port: 161}); err == nil {
+			sent = true
+		}
+	}
+	if !sent {
+		return nil, fmt.Errorf("aucun réseau local joignable en diffusion")
+	}
+
+	printers := make(map[string]*common.DiscoveredPrinter)
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("lecture des réponses SNMP impossible: %v", err)
+		}
+		response, err := decodeSNMPResponse(buf[:n])
+		if err != nil || response.ErrorStatus != 0 || len(response.VarBinds) == 0 {
+			continue
+		}
+
+		address := from.IP.String()
+		switch response.RequestID {
+		case snmpDiscoveryRequestID:
+			if response.VarBinds[0].Value != hrDevicePrinter || printers[address] != nil {
+				continue
+			}
+			printers[address] = &common.DiscoveredPrinter{
+				Name:    address,
+				URI:     "socket://" + address,
+				URIs:    []string{"socket://" + address},
+				Address: address,
+				Methods: []string{common.PrinterDiscoverySNMP},
+			}
+			conn.WriteToUDP(details, from)
+		case snmpDetailsRequestID:
+			printer := printers[address]
+			if printer == nil {
+				continue
+			}
+			for _, bind := range response.VarBinds {
+				switch bind.OID {
+				case oidHrDeviceDescr:
+					printer.MakeModel = bind.Value
+				case oidSysName:
+					if bind.Value != "" {
+						printer.Name = bind.Value
+					}
+				case oidSysLocation:
+					printer.Location = bind.Value
+				}
+			}
+		}
+	}
+
+	result := make([]*common.DiscoveredPrinter, 0, len(printers))
+	for _, printer := range printers {
+		result = append(result, printer)
+	}
+	return result, nil
+}
+
+// discoveryInterfaces retourne les interfaces actives, hors boucle locale, disposant des drapeaux demandés
+func discoveryInterfaces(flags net.Flags) []net.Interface {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		log.Printf("[PRINTER] Liste des interfaces réseau indisponible: %v", err)
+		return nil
+	}
+	var result []net.Interface
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagLoopback == 0 && iface.Flags&flags == flags {
+			result = append(result, iface)
+		}
+	}
+	return result
+}
+
+// discoveryBroadcasts retourne l'adresse de diffusion de chaque réseau IPv4 local
+func discoveryBroadcasts() []net.IP {
+	var broadcasts []net.IP
+	for _, iface := range discoveryInterfaces(net.FlagBroadcast) {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			network, ok := addr.(*net.IPNet)
+			if !ok || network.IP.To4() == nil {
+				continue
+			}
+			ip, mask := network.IP.To4(), net.IP(network.Mask).To4()
+			if mask == nil {
+				continue
+			}
+			broadcast := make(net.IP, net.IPv4len)
+			for i := range broadcast {
+				broadcast[i] = ip[i] | ^mask[i]
+			}
+			broadcasts = append(broadcasts, broadcast)
+		}
+	}
+	return broadcasts
+}
+
+// mergeDiscoveredPrinters regroupe les annonces d'un même appareil, identifié par son UUID ou son adresse
+// L'URI retenue est la plus adaptée à une file sans pilote: ipp, puis ipps, puis socket
+func mergeDiscoveredPrinters(found []*common.DiscoveredPrinter) []*common.DiscoveredPrinter {
+	// Les annonces mDNS passent en premier pour donner leur nom à l'appareil
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].Methods[0] == common.PrinterDiscoveryMDNS && found[j].Methods[0] != common.PrinterDiscoveryMDNS
+	})
+
+	devices := []*common.DiscoveredPrinter{}
+	for _, printer := range found {
+		var device *common.DiscoveredPrinter
+		for _, candidate := range devices {
+			if (printer.UUID != "" && candidate.UUID == printer.UUID) ||
+				(printer.Address != "" && candidate.Address == printer.Address) {
+				device = candidate
+				break
+			}
+		}
+		if device == nil {
+			devices = append(devices, printer)
+			continue
+		}
+
+		for _, uri := range printer.URIs {
+			if !containsString(device.URIs, uri) {
+				device.URIs = append(device.URIs, uri)
+			}
+		}
+		for _, method := range printer.Methods {
+			if !containsString(device.Methods, method) {
+				device.Methods = append(device.Methods, method)
+			}
+		}
+		if discoveryURIRank(printer.URI) < discoveryURIRank(device.URI) {
+			device.URI = printer.URI
+		}
+		if printer.DNSSDURI != "" && (device.DNSSDURI == "" || strings.Contains(printer.DNSSDURI, "._ipp._tcp")) {
+			device.DNSSDURI = printer.DNSSDURI
+		}
+		device.Driverless = device.Driverless || printer.Driverless
+		for _, format := range printer.Formats {
+			if !containsString(device.Formats, format) {
+				device.Formats = append(device.Formats, format)
+			}
+		}
+		fillEmpty(&device.Host, printer.Host)
+		fillEmpty(&device.Address, printer.Address)
+		fillEmpty(&device.MakeModel, printer.MakeModel)
+		fillEmpty(&device.Location, printer.Location)
+		fillEmpty(&device.UUID, printer.UUID)
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return strings.ToLower(devices[i].Name) < strings.ToLower(devices[j].Name)
+	})
+	return devices
+}
+
+// discoveryURIRank classe les URI d'un appareil par ordre de préférence
+func discoveryURIRank(uri string) int {
+	switch {
+	case strings.HasPrefix(uri, "ipp://"):
+		return 0
+	case strings.HasPrefix(uri, "ipps://"):
+		return 1
+	}
+	return 2
+}
+
+// containsString indique si une liste contient une valeur
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// fillEmpty renseigne un champ vide
+func fillEmpty(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
@@ -0,0 +1,149 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// diffPrinters compare deux relevés de l'état des imprimantes
+// Retourne nil si aucune imprimante n'a changé
+func diffPrinters(previous, current []*common.PrinterInfo) *common.PrinterDelta {
+	delta := &common.PrinterDelta{}
+
+	before := make(map[string]*common.PrinterInfo, len(previous))
+	for _, printer := range previous {
+		before[printer.Name] = printer
+	}
+
+	seen := make(map[string]bool, len(current))
+	for _, printer := range current {
+		seen[printer.Name] = true
+
+		old, existed := before[printer.Name]
+		if !existed {
+			delta.Updated = append(delta.Updated, printer)
+			delta.Events = append(delta.Events, &common.PrinterEvent{
+				Type:    common.PrinterEventAdded,
+				Printer: printer.Name,
+				Status:  printer.Status,
+			})
+			continue
+		}
+		keepJobCreation(old, printer)
+		if samePrinterState(old, printer) {
+			continue
+		}
+
+		delta.Updated = append(delta.Updated, printer)
+		if old.Status != printer.Status {
+			delta.Events = append(delta.Events, &common.PrinterEvent{
+				Type:           common.PrinterEventStatusChanged,
+				Printer:        printer.Name,
+				Status:         printer.Status,
+				PreviousStatus: old.Status,
+			})
+		}
+		delta.Events = append(delta.Events, diffPrintJobs(old, printer)...)
+	}
+
+	for _, printer := range previous {
+		if seen[printer.Name] {
+			continue
+		}
+		delta.Removed = append(delta.Removed, printer.Name)
+		delta.Events = append(delta.Events, &common.PrinterEvent{
+			Type:           common.PrinterEventRemoved,
+			Printer:        printer.Name,
+			PreviousStatus: printer.Status,
+		})
+	}
+
+	if len(delta.Updated) == 0 && len(delta.Removed) == 0 {
+		return nil
+	}
+	return delta
+}
+
+// diffPrintJobs retourne les travaux ajoutés, modifiés et terminés entre deux relevés d'une imprimante
+func diffPrintJobs(old, printer *common.PrinterInfo) []*common.PrinterEvent {
+	var events []*common.PrinterEvent
+
+	before := make(map[int]common.PrintJob, len(old.Jobs))
+	for _, job := range old.Jobs {
+		before[job.ID] = job
+	}
+	queued := make(map[int]bool, len(printer.Jobs))
+	for i := range printer.Jobs {
+		job := &printer.Jobs[i]
+		queued[job.ID] = true
+
+		previous, existed := before[job.ID]
+		switch {
+		case !existed:
+			events = append(events, &common.PrinterEvent{
+				Type:    common.PrinterEventJobAdded,
+				Printer: printer.Name,
+				Status:  job.Status,
+				Job:     job,
+			})
+		case previous.Status != job.Status:
+			events = append(events, &common.PrinterEvent{
+				Type:           common.PrinterEventJobUpdated,
+				Printer:        printer.Name,
+				Status:         job.Status,
+				PreviousStatus: previous.Status,
+				Job:            job,
+			})
+		}
+	}
+
+	// L'état final d'un travail sorti de la file provient de l'historique IPP lorsqu'il est disponible
+	completed := make(map[int]*common.PrintJob, len(printer.CompletedJobs))
+	for i := range printer.CompletedJobs {
+		completed[printer.CompletedJobs[i].ID] = &printer.CompletedJobs[i]
+	}
+	for _, job := range old.Jobs {
+		if queued[job.ID] {
+			continue
+		}
+		// Sans historique, le statut final reste vide et le travail est décrit par son dernier état connu
+		event := &common.PrinterEvent{
+			Type:           common.PrinterEventJobFinished,
+			Printer:        printer.Name,
+			PreviousStatus: job.Status,
+		}
+		if finished := completed[job.ID]; finished != nil {
+			event.Status = finished.Status
+			event.Job = finished
+		} else {
+			job := job
+			event.Job = &job
+		}
+		events = append(events, event)
+	}
+	return events
+}
+
+// keepJobCreation reprend la date de création des travaux déjà connus
+// Sans IPP (lpstat, Windows), la date est approchée par l'heure du relevé et changerait à chaque interrogation
+func keepJobCreation(old, printer *common.PrinterInfo) {
+	created := make(map[int]time.Time, len(old.Jobs))
+	for _, job := range old.Jobs {
+		created[job.ID] = job.Created
+	}
+	for i := range printer.Jobs {
+		if at, known := created[printer.Jobs[i].ID]; known {
+			printer.Jobs[i].Created = at
+		}
+	}
+}
+
+// samePrinterState indique si deux relevés d'une imprimante sont identiques
+func samePrinterState(a, b *common.PrinterInfo) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(encodedA, encodedB)
+}
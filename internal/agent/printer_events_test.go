@@ -0,0 +1,53 @@
+package agent
+
+import (
+	"testing"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// lpstatTestPrinter simule un relevé lpstat dont la date des travaux est l'heure du relevé
+func lpstatTestPrinter(status string, polledAt time.Time, jobs ...common.PrintJob) *common.PrinterInfo {
+	for i := range jobs {
+		jobs[i].Created = polledAt
+	}
+	return &common.PrinterInfo{Name: "Hall", Status: status, Jobs: jobs}
+}
+
+func TestDiffPrintersApproximateJobCreation(t *testing.T) {
+	first := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	job := common.PrintJob{ID: 12, Name: "Facture", User: "alice", Status: "pending"}
+
+	previous := []*common.PrinterInfo{lpstatTestPrinter("idle", first, job)}
+	current := []*common.PrinterInfo{lpstatTestPrinter("idle", first.Add(10*time.Second), job)}
+	if delta := diffPrinters(previous, current); delta != nil {
+		t.Fatalf("un travail inchangé ne devrait pas produire de delta: %+v", delta)
+	}
+	if created := current[0].Jobs[0].Created; !created.Equal(first) {
+		t.Errorf("date de création = %v, attendu la date du premier relevé %v", created, first)
+	}
+
+	// Un travail ajouté et un changement d'état restent signalés
+	added := common.PrintJob{ID: 13, Name: "Rapport", User: "bob", Status: "pending"}
+	job.Status = "processing"
+	next := []*common.PrinterInfo{lpstatTestPrinter("processing", first.Add(20*time.Second), job, added)}
+	delta := diffPrinters(current, next)
+	if delta == nil || len(delta.Updated) != 1 {
+		t.Fatalf("delta = %+v, attendu la mise à jour de l'imprimante", delta)
+	}
+
+	types := make(map[string]int)
+	for _, event := range delta.Events {
+		types[event.Type]++
+	}
+	if types[common.PrinterEventStatusChanged] != 1 || types[common.PrinterEventJobUpdated] != 1 || types[common.PrinterEventJobAdded] != 1 {
+		t.Errorf("événements = %v", types)
+	}
+	if created := next[0].Jobs[0].Created; !created.Equal(first) {
+		t.Errorf("date de création du travail connu = %v, attendu %v", created, first)
+	}
+	if created := next[0].Jobs[1].Created; !created.Equal(first.Add(20 * time.Second)) {
+		t.Errorf("date de création du nouveau travail = %v", created)
+	}
+}
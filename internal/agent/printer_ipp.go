@@ -0,0 +1,221 @@
+package agent
+
+import (
+	"strings"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// ippPrinterStates traduit l'énumération printer-state
+var ippPrinterStates = map[int]string{
+	3: "idle",
+	4: "processing",
+	5: "stopped",
+}
+
+// ippJobStates traduit l'énumération job-state
+var ippJobStates = map[int]string{
+	3: "pending",
+	4: "held",
+	5: "processing",
+	6: "stopped",
+	7: "canceled",
+	8: "aborted",
+	9: "completed",
+}
+
+// ippCompletedJobsLimit borne le nombre de travaux terminés remontés à chaque collecte
+// Le serveur ignore ceux qu'il a déjà enregistrés
+const ippCompletedJobsLimit = 20
+
+// blockingStateReasons liste les conditions qui empêchent l'impression, quelle que soit leur gravité déclarée
+var blockingStateReasons = map[string]bool{
+	"media-empty":         true,
+	"media-jam":           true,
+	"toner-empty":         true,
+	"marker-supply-empty": true,
+	"door-open":           true,
+	"cover-open":          true,
+	"input-tray-missing":  true,
+	"output-area-full":    true,
+}
+
+// getIPPPrinters récupère les imprimantes, leur état détaillé et leurs travaux en interrogeant CUPS via IPP
+func (pm *PrinterMonitor) getIPPPrinters() ([]*common.PrinterInfo, error) {
+	entries, err := pm.ipp.GetPrinters()
+	if err != nil {
+		return nil, err
+	}
+
+	// L'absence d'imprimante par défaut n'empêche pas la collecte
+	defaultName, _ := pm.ipp.GetDefaultPrinter()
+
+	printers := make([]*common.PrinterInfo, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.String("printer-name")
+		if name == "" {
+			continue
+		}
+
+		var printer *common.PrinterInfo
+		if attrs, err := pm.ipp.GetPrinterAttributes(name); err == nil {
+			printer = printerFromIPP(name, attrs)
+		} else {
+			printer = &common.PrinterInfo{Name: name, Status: "unknown", Jobs: []common.PrintJob{}}
+		}
+		printer.IsDefault = name == defaultName
+
+		if jobs, err := pm.ipp.GetJobs(name); err == nil {
+			for _, job := range jobs {
+				printer.Jobs = append(printer.Jobs, printJobFromIPP(job))
+			}
+		}
+		if jobs, err := pm.ipp.GetCompletedJobs(name, ippCompletedJobsLimit); err == nil {
+			for _, job := range jobs {
+				printer.CompletedJobs = append(printer.CompletedJobs, printJobFromIPP(job))
+			}
+		}
+
+		pm.cache[name] = printer
+		printers = append(printers, printer)
+	}
+
+	pm.lastUpdate = time.Now()
+	return printers, nil
+}
+
+// printerFromIPP construit l'état d'une imprimante à partir de ses attributs IPP
+func printerFromIPP(name string, attrs ippAttributes) *common.PrinterInfo {
+	printer := &common.PrinterInfo{
+		Name:         name,
+		Description:  attrs.String("printer-info"),
+		Location:     attrs.String("printer-location"),
+		URI:          attrs.String("device-uri"),
+		MakeModel:    attrs.String("printer-make-and-model"),
+		StateMessage: attrs.String("printer-state-message"),
+		Jobs:         []common.PrintJob{},
+	}
+	if printer.URI == "" {
+		printer.URI = attrs.String("printer-uri-supported")
+	}
+	if state, ok := attrs.Int("printer-state"); ok {
+		printer.State = ippPrinterStates[state]
+	}
+	if accepting, ok := attrs.Bool("printer-is-accepting-jobs"); ok {
+		printer.AcceptingJobs = &accepting
+	}
+	printer.QueuedJobs, _ = attrs.Int("queued-job-count")
+
+	for _, reason := range attrs.Strings("printer-state-reasons") {
+		if reason == "none" {
+			continue
+		}
+		printer.StateReasons = append(printer.StateReasons, reason)
+
+		switch stateReasonBase(reason) {
+		case "media-empty", "media-needed":
+			printer.MediaEmpty = true
+		case "media-jam":
+			printer.MediaJam = true
+		case "toner-low", "marker-supply-low":
+			printer.MarkerLow = true
+		case "toner-empty", "marker-supply-empty":
+			printer.MarkerEmpty = true
+		}
+	}
+
+	printer.Markers = markersFromIPP(attrs)
+	printer.Status = printerStatus(printer)
+	return printer
+}
+
+// markersFromIPP associe les attributs marker-* alignés par indice en une liste de consommables
+func markersFromIPP(attrs ippAttributes) []common.PrinterMarker {
+	names := attrs.Strings("marker-names")
+	types := attrs.Strings("marker-types")
+	colors := attrs.Strings("marker-colors")
+	levels := attrs.Ints("marker-levels")
+	lowLevels := attrs.Ints("marker-low-levels")
+	highLevels := attrs.Ints("marker-high-levels")
+
+	markers := make([]common.PrinterMarker, 0, len(names))
+	for i, name := range names {
+		marker := common.PrinterMarker{Name: name, Level: -1}
+		if i < len(types) {
+			marker.Type = types[i]
+		}
+		if i < len(colors) {
+			marker.Color = colors[i]
+		}
+		if i < len(levels) {
+			marker.Level = levels[i]
+		}
+		if i < len(lowLevels) {
+			marker.LowLevel = lowLevels[i]
+		}
+		if i < len(highLevels) {
+			marker.HighLevel = highLevels[i]
+		}
+		markers = append(markers, marker)
+	}
+	return markers
+}
+
+// printJobFromIPP construit un travail d'impression à partir de ses attributs IPP
+func printJobFromIPP(attrs ippAttributes) common.PrintJob {
+	job := common.PrintJob{
+		Name: attrs.String("job-name"),
+		User: attrs.String("job-originating-user-name"),
+	}
+	job.ID, _ = attrs.Int("job-id")
+	job.Priority, _ = attrs.Int("job-priority")
+	if kOctets, ok := attrs.Int("job-k-octets"); ok {
+		job.Size = int64(kOctets) * 1024
+	}
+	if state, ok := attrs.Int("job-state"); ok {
+		job.Status = ippJobStates[state]
+	}
+	if created, ok := attrs.Int("time-at-creation"); ok && created > 0 {
+		job.Created = time.Unix(int64(created), 0)
+	}
+	if completed, ok := attrs.Int("time-at-completed"); ok && completed > 0 {
+		t := time.Unix(int64(completed), 0)
+		job.Completed = &t
+	}
+	job.Pages, _ = attrs.Int("job-impressions-completed")
+	for _, reason := range attrs.Strings("job-state-reasons") {
+		if reason != "none" {
+			job.StateReasons = append(job.StateReasons, reason)
+		}
+	}
+	return job
+}
+
+// stateReasonBase retire le suffixe de gravité d'une raison d'état (-error, -warning, -report)
+func stateReasonBase(reason string) string {
+	for _, suffix := range []string{"-error", "-warning", "-report"} {
+		if strings.HasSuffix(reason, suffix) {
+			return strings.TrimSuffix(reason, suffix)
+		}
+	}
+	return reason
+}
+
+// printerStatus résume l'état d'une imprimante, une condition bloquante l'emportant sur l'état IPP
+func printerStatus(printer *common.PrinterInfo) string {
+	for _, reason := range printer.StateReasons {
+		if strings.HasSuffix(reason, "-error") || blockingStateReasons[stateReasonBase(reason)] {
+			return "error"
+		}
+	}
+	for _, reason := range printer.StateReasons {
+		if stateReasonBase(reason) == "offline" {
+			return "offline"
+		}
+	}
+	if printer.State == "" {
+		return "unknown"
+	}
+	return printer.State
+}
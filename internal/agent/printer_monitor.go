@@ -4,11 +4,13 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os/exec"
 	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"remoteshell/internal/common"
@@ -16,19 +18,35 @@ import (
 
 // PrinterMonitor gère le monitoring des imprimantes
 type PrinterMonitor struct {
+	mu         sync.Mutex
 	lastUpdate time.Time
 	cache      map[string]*common.PrinterInfo
+	ipp        *IPPClient // Client IPP vers CUPS, nil si désactivé
+	ippFailed  bool       // CUPS injoignable lors de la dernière collecte
 }
 
 // NewPrinterMonitor crée un nouveau moniteur d'imprimantes
-func NewPrinterMonitor() *PrinterMonitor {
-	return &PrinterMonitor{
+// cupsURL désigne le serveur CUPS interrogé en IPP (vide = lecture de lpstat uniquement)
+func NewPrinterMonitor(cupsURL string) *PrinterMonitor {
+	pm := &PrinterMonitor{
 		cache: make(map[string]*common.PrinterInfo),
 	}
+	if cupsURL != "" && runtime.GOOS != "windows" {
+		client, err := NewIPPClient(cupsURL)
+		if err != nil {
+			log.Printf("[PRINTER] %v, lecture de lpstat uniquement", err)
+		} else {
+			pm.ipp = client
+		}
+	}
+	return pm
 }
 
 // GetPrinters retourne la liste des imprimantes
 func (pm *PrinterMonitor) GetPrinters() ([]*common.PrinterInfo, error) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
 	if runtime.GOOS == "windows" {
 		return pm.getWindowsPrinters()
 	}
@@ -37,6 +55,19 @@ func (pm *PrinterMonitor) GetPrinters() ([]*common.PrinterInfo, error) {
 
 // getLinuxPrinters récupère les imprimantes via CUPS
 func (pm *PrinterMonitor) getLinuxPrinters() ([]*common.PrinterInfo, error) {
+	// Interroger CUPS en IPP, la sortie texte de lpstat ne servant que de repli
+	if pm.ipp != nil {
+		printers, err := pm.getIPPPrinters()
+		if err == nil {
+			pm.ippFailed = false
+			return printers, nil
+		}
+		if !pm.ippFailed {
+			log.Printf("[PRINTER] CUPS injoignable en IPP, repli sur lpstat: %v", err)
+			pm.ippFailed = true
+		}
+	}
+
 	var printers []*common.PrinterInfo
 
 	// Utiliser lpstat pour lister les imprimantes
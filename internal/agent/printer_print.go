@@ -0,0 +1,142 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"remoteshell/internal/common"
+)
+
+// printDuplexSides associe les modes recto verso à l'option sides de CUPS
+var printDuplexSides = map[string]string{
+	common.PrintDuplexNone:  "one-sided",
+	common.PrintDuplexLong:  "two-sided-long-edge",
+	common.PrintDuplexShort: "two-sided-short-edge",
+}
+
+// SubmitJob assemble le document reçu et l'envoie à l'imprimante
+// Le travail créé est retourné dans JobID lorsque le spouleur le fournit
+func (pm *PrinterMonitor) SubmitJob(req *common.PrintSubmitRequest) *common.PrinterActionResult {
+	result := &common.PrinterActionResult{
+		Printer: req.Printer,
+		Action:  common.PrinterActionPrint,
+	}
+
+	path, size, err := assemblePrintDocument(req.Chunks)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer os.Remove(path)
+
+	var output string
+	if runtime.GOOS == "windows" {
+		output, err = pm.submitWindowsJob(req, path)
+	} else {
+		output, err = pm.submitCUPSJob(req, path)
+	}
+	result.Output = strings.TrimSpace(output)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	if matches := lpRequestIDPattern.FindStringSubmatch(output); matches != nil {
+		result.JobID, _ = strconv.Atoi(matches[1])
+		result.Message = fmt.Sprintf("travail %d créé sur %s (%d octets)", result.JobID, req.Printer, size)
+	} else {
+		result.Message = fmt.Sprintf("document envoyé à %s (%d octets)", req.Printer, size)
+	}
+	return result
+}
+
+// submitCUPSJob soumet le document avec lp en traduisant les options en options CUPS
+func (pm *PrinterMonitor) submitCUPSJob(req *common.PrintSubmitRequest, path string) (string, error) {
+	if !printerNamePattern.MatchString(req.Printer) {
+		return "", fmt.Errorf("nom d'imprimante invalide: %s", req.Printer)
+	}
+
+	args := []string{"-d", req.Printer}
+	if req.Title != "" {
+		args = append(args, "-t", req.Title)
+	}
+	if req.Options.Copies > 1 {
+		args = append(args, "-n", strconv.Itoa(req.Options.Copies))
+	}
+	if sides, ok := printDuplexSides[req.Options.Duplex]; ok {
+		args = append(args, "-o", "sides="+sides)
+	}
+	if req.Options.Media != "" {
+		args = append(args, "-o", "media="+req.Options.Media)
+	}
+	if req.Options.PageRanges != "" {
+		args = append(args, "-P", req.Options.PageRanges)
+	}
+	if req.Format == common.PrintFormatRaw {
+		args = append(args, "-o", "raw")
+	}
+	// "--" empêche un chemin commençant par un tiret d'être lu comme une option
+	args = append(args, "--", path)
+
+	return runPrinterCommand(nil, "lp", args...)
+}
+
+// submitWindowsJob imprime un document texte avec Out-Printer
+// Windows ne dispose pas d'interpréteur PDF ou PostScript intégré, ni d'options d'impression en ligne de commande
+func (pm *PrinterMonitor) submitWindowsJob(req *common.PrintSubmitRequest, path string) (string, error) {
+	if req.Format != common.PrintFormatText {
+		return "", fmt.Errorf("format %s non supporté sous Windows (texte uniquement)", req.Format)
+	}
+	if req.Options.Duplex != "" || req.Options.Media != "" || req.Options.PageRanges != "" {
+		return "", errors.New("options recto verso, papier et pages non supportées sous Windows")
+	}
+
+	if err := validateWindowsPrinterName(req.Printer); err != nil {
+		return "", err
+	}
+
+	copies := req.Options.Copies
+	if copies < 1 {
+		copies = 1
+	}
+	script := fmt.Sprintf("$content = Get-Content -LiteralPath %s; 1..%d | ForEach-Object { $content | Out-Printer -Name %s }",
+		psQuote(path), copies, psQuote(req.Printer))
+	return runPrinterCommand(nil, "powershell", "-NoProfile", "-Command", "$ErrorActionPreference = 'Stop'; "+script)
+}
+
+// assemblePrintDocument écrit les chunks reçus dans un fichier temporaire et retourne son chemin et sa taille
+// Les chunks doivent être contigus et ordonnés
+func assemblePrintDocument(chunks []*common.FileChunk) (string, int64, error) {
+	file, err := os.CreateTemp("", "remoteshell-print-*")
+	if err != nil {
+		return "", 0, fmt.Errorf("erreur de création du fichier temporaire: %v", err)
+	}
+
+	var size int64
+	for _, chunk := range chunks {
+		if chunk == nil || chunk.Offset != size {
+			err = errors.New("chunks du document incomplets ou désordonnés")
+			break
+		}
+		if _, err = file.Write(chunk.Data); err != nil {
+			break
+		}
+		size += int64(len(chunk.Data))
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && size == 0 {
+		err = errors.New("document vide")
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", 0, err
+	}
+	return file.Name(), size, nil
+}
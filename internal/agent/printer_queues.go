@@ -0,0 +1,154 @@
+package agent
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+
+	"remoteshell/internal/common"
+)
+
+// defaultDriverLimit borne le nombre de pilotes retournés par une recherche
+const defaultDriverLimit = 200
+
+// printerQueueMessages décrit le résultat de chaque opération réussie sur une file
+var printerQueueMessages = map[string]string{
+	common.PrinterQueueCreate: "file %s créée",
+	common.PrinterQueueModify: "file %s modifiée",
+	common.PrinterQueueDelete: "file %s supprimée",
+}
+
+// ManageQueue crée, modifie ou supprime une file d'impression CUPS
+func (pm *PrinterMonitor) ManageQueue(req *common.PrinterQueueRequest) *common.PrinterActionResult {
+	result := &common.PrinterActionResult{
+		Printer: req.Name,
+		Action:  req.Operation,
+		Target:  req.URI,
+	}
+
+	if runtime.GOOS == "windows" {
+		result.Error = "gestion des files d'impression non supportée sous Windows"
+		return result
+	}
+
+	output, err := pm.manageCUPSQueue(req)
+	result.Output = strings.TrimSpace(output)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Success = true
+	result.Message = fmt.Sprintf(printerQueueMessages[req.Operation], req.Name)
+	return result
+}
+
+// manageCUPSQueue exécute lpadmin pour l'opération demandée
+func (pm *PrinterMonitor) manageCUPSQueue(req *common.PrinterQueueRequest) (string, error) {
+	if !printerNamePattern.MatchString(req.Name) {
+		return "", fmt.Errorf("nom de file invalide: %s", req.Name)
+	}
+
+	// lpstat échoue si la file n'existe pas
+	_, err := runPrinterCommand(nil, "lpstat", "-p", req.Name)
+	exists := err == nil
+	switch {
+	case req.Operation == common.PrinterQueueCreate && exists:
+		return "", fmt.Errorf("la file %s existe déjà", req.Name)
+	case req.Operation != common.PrinterQueueCreate && !exists:
+		return "", fmt.Errorf("file %s inexistante", req.Name)
+	}
+
+	if req.Operation == common.PrinterQueueDelete {
+		return runPrinterCommand(nil, "lpadmin", "-x", req.Name)
+	}
+
+	args := []string{"-p", req.Name}
+	if req.Operation == common.PrinterQueueCreate {
+		// -E après -p active la file et lui fait accepter les travaux
+		args = append(args, "-E")
+	}
+	if req.URI != "" {
+		args = append(args, "-v", req.URI)
+	}
+
+	driver := req.Driver
+	if driver == "" && req.Operation == common.PrinterQueueCreate {
+		driver = common.PrinterDriverEverywhere
+	}
+	if len(req.PPD) > 0 {
+		path, _, err := assemblePrintDocument(req.PPD)
+		if err != nil {
+			return "", fmt.Errorf("fichier PPD invalide: %v", err)
+		}
+		defer os.Remove(path)
+		args = append(args, "-P", path)
+	} else if driver != "" {
+		args = append(args, "-m", driver)
+	}
+
+	if req.Description != "" {
+		args = append(args, "-D", req.Description)
+	}
+	if req.Location != "" {
+		args = append(args, "-L", req.Location)
+	}
+	if req.Shared != nil {
+		args = append(args, "-o", fmt.Sprintf("printer-is-shared=%t", *req.Shared))
+	}
+	names := make([]string, 0, len(req.Options))
+	for name := range req.Options {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "-o", name+"="+req.Options[name])
+	}
+
+	output, err := runPrinterCommand(nil, "lpadmin", args...)
+	if err != nil || !req.Default {
+		return output, err
+	}
+
+	defaultOutput, err := runPrinterCommand(nil, "lpadmin", "-d", req.Name)
+	return output + defaultOutput, err
+}
+
+// ListDrivers recherche parmi les pilotes CUPS installés
+func (pm *PrinterMonitor) ListDrivers(req *common.PrinterDriverRequest) (*common.PrinterDriverList, error) {
+	if runtime.GOOS == "windows" {
+		return nil, errors.New("liste des pilotes non supportée sous Windows")
+	}
+
+	output, err := runPrinterCommand(nil, "lpinfo", "-m")
+	if err != nil {
+		return nil, err
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultDriverLimit
+	}
+	search := strings.ToLower(req.Search)
+
+	list := &common.PrinterDriverList{Drivers: []*common.PrinterDriver{}}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		// Format: "<pilote> <marque et modèle>"
+		line := strings.TrimSpace(scanner.Text())
+		name, makeModel, _ := strings.Cut(line, " ")
+		if name == "" || (search != "" && !strings.Contains(strings.ToLower(line), search)) {
+			continue
+		}
+		if len(list.Drivers) == limit {
+			list.Truncated = true
+			break
+		}
+		list.Drivers = append(list.Drivers, &common.PrinterDriver{Name: name, MakeModel: strings.TrimSpace(makeModel)})
+	}
+	return list, nil
+}
@@ -0,0 +1,111 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// processSignals liste les signaux qu'il est possible d'envoyer à un processus
+var processSignals = map[string]bool{
+	"TERM": true,
+	"KILL": true,
+	"HUP":  true,
+}
+
+// cpuSampleWindow est la durée de mesure de l'utilisation CPU lorsque le relevé précédent est trop ancien
+const cpuSampleWindow = 500 * time.Millisecond
+
+// ProcessManager inspecte et contrôle les processus de la machine
+type ProcessManager struct {
+	prevTicks map[int]uint64 // Temps CPU cumulé par PID lors du relevé précédent
+	prevTime  time.Time
+	users     map[string]string // Cache UID -> nom d'utilisateur
+	mu        sync.Mutex
+}
+
+// NewProcessManager crée un nouveau gestionnaire de processus
+func NewProcessManager() *ProcessManager {
+	return &ProcessManager{
+		prevTicks: make(map[int]uint64),
+		users:     make(map[string]string),
+	}
+}
+
+// ListProcesses retourne les processus filtrés, triés et limités selon la demande
+func (pm *ProcessManager) ListProcesses(req *common.ProcessListRequest) (*common.ProcessList, error) {
+	pm.mu.Lock()
+	processes, err := pm.snapshot()
+	pm.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &common.ProcessList{Total: len(processes)}
+	query := strings.ToLower(req.Query)
+	for _, process := range processes {
+		if req.User != "" && process.User != req.User {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(process.Name), query) &&
+			!strings.Contains(strings.ToLower(process.CmdLine), query) {
+			continue
+		}
+		result.Processes = append(result.Processes, process)
+	}
+
+	sortProcesses(result.Processes, req.Sort)
+	if req.Limit > 0 && len(result.Processes) > req.Limit {
+		result.Processes = result.Processes[:req.Limit]
+	}
+	return result, nil
+}
+
+// sortProcesses trie les processus selon le critère demandé
+func sortProcesses(processes []*common.ProcessInfo, by string) {
+	sort.SliceStable(processes, func(i, j int) bool {
+		a, b := processes[i], processes[j]
+		switch by {
+		case "pid":
+			return a.PID < b.PID
+		case "name":
+			return a.Name < b.Name
+		case "rss", "mem", "memory":
+			return a.RSS > b.RSS
+		default:
+			if a.CPUPercent != b.CPUPercent {
+				return a.CPUPercent > b.CPUPercent
+			}
+			return a.RSS > b.RSS
+		}
+	})
+}
+
+// SignalProcess envoie un signal à un processus
+// Le processus init et l'agent lui-même sont protégés
+func (pm *ProcessManager) SignalProcess(req *common.ProcessSignalRequest) *common.ProcessSignalResult {
+	signal := strings.TrimPrefix(strings.ToUpper(req.Signal), "SIG")
+	result := &common.ProcessSignalResult{PID: req.PID, Signal: signal}
+
+	switch {
+	case !processSignals[signal]:
+		result.Error = fmt.Sprintf("signal non autorisé: %s", req.Signal)
+	case req.PID <= 1:
+		result.Error = fmt.Sprintf("PID invalide: %d", req.PID)
+	case req.PID == os.Getpid():
+		result.Error = "impossible d'envoyer un signal à l'agent lui-même"
+	default:
+		result.Name = processName(req.PID)
+		if err := sendProcessSignal(req.PID, signal); err != nil {
+			result.Error = err.Error()
+		} else {
+			result.Success = true
+		}
+	}
+	return result
+}
@@ -0,0 +1,226 @@
+//go:build linux
+
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// clockTicks est le nombre de ticks d'horloge par seconde utilisé par /proc (USER_HZ)
+const clockTicks = 100
+
+// linuxSignals associe les noms de signaux autorisés à leur valeur
+var linuxSignals = map[string]syscall.Signal{
+	"TERM": syscall.SIGTERM,
+	"KILL": syscall.SIGKILL,
+	"HUP":  syscall.SIGHUP,
+}
+
+// procStat contient les champs utiles de /proc/<pid>/stat
+type procStat struct {
+	name      string
+	state     string
+	ppid      int
+	ticks     uint64 // utime + stime
+	threads   int
+	startTime uint64 // En ticks depuis le démarrage
+	rssPages  int64
+}
+
+// snapshot lit l'ensemble des processus dans /proc
+// L'utilisation CPU est calculée par rapport au relevé précédent, ou sur une courte fenêtre s'il est trop ancien
+func (pm *ProcessManager) snapshot() ([]*common.ProcessInfo, error) {
+	if pm.prevTime.IsZero() || time.Since(pm.prevTime) > 10*time.Second {
+		pm.prevTicks = readAllProcessTicks()
+		pm.prevTime = time.Now()
+		time.Sleep(cpuSampleWindow)
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, fmt.Errorf("lecture de /proc impossible: %v", err)
+	}
+
+	bootTime := readBootTime()
+	pageSize := int64(os.Getpagesize())
+	now := time.Now()
+	elapsed := now.Sub(pm.prevTime).Seconds()
+
+	var processes []*common.ProcessInfo
+	ticks := make(map[int]uint64)
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		stat, err := readProcStat(pid)
+		if err != nil {
+			continue // Processus terminé entre-temps
+		}
+		ticks[pid] = stat.ticks
+
+		process := &common.ProcessInfo{
+			PID:     pid,
+			PPID:    stat.ppid,
+			Name:    stat.name,
+			State:   stat.state,
+			RSS:     stat.rssPages * pageSize,
+			Threads: stat.threads,
+			User:    pm.processUser(pid),
+			CmdLine: readCmdLine(pid),
+		}
+		if process.CmdLine == "" {
+			process.CmdLine = "[" + stat.name + "]"
+		}
+		if !bootTime.IsZero() {
+			started := bootTime.Add(time.Duration(stat.startTime) * time.Second / clockTicks)
+			process.StartTime = started.Format(time.RFC3339)
+		}
+		if prev, ok := pm.prevTicks[pid]; ok && elapsed > 0 && stat.ticks >= prev {
+			process.CPUPercent = float64(stat.ticks-prev) / clockTicks / elapsed * 100
+		}
+		processes = append(processes, process)
+	}
+
+	pm.prevTicks = ticks
+	pm.prevTime = now
+	return processes, nil
+}
+
+// readProcStat lit /proc/<pid>/stat
+func readProcStat(pid int) (*procStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+
+	// Le nom est entre parenthèses et peut contenir des espaces
+	content := string(data)
+	start, end := strings.IndexByte(content, '('), strings.LastIndexByte(content, ')')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("format inattendu")
+	}
+	fields := strings.Fields(content[end+1:])
+	// fields[0] = state (champ 3), fields[i] = champ i+3
+	if len(fields) < 22 {
+		return nil, fmt.Errorf("format inattendu")
+	}
+
+	stat := &procStat{name: content[start+1 : end], state: fields[0]}
+	stat.ppid, _ = strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseUint(fields[11], 10, 64)
+	stime, _ := strconv.ParseUint(fields[12], 10, 64)
+	stat.ticks = utime + stime
+	stat.threads, _ = strconv.Atoi(fields[17])
+	stat.startTime, _ = strconv.ParseUint(fields[19], 10, 64)
+	stat.rssPages, _ = strconv.ParseInt(fields[21], 10, 64)
+	return stat, nil
+}
+
+// readAllProcessTicks relève le temps CPU cumulé de tous les processus
+func readAllProcessTicks() map[int]uint64 {
+	ticks := make(map[int]uint64)
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return ticks
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		if stat, err := readProcStat(pid); err == nil {
+			ticks[pid] = stat.ticks
+		}
+	}
+	return ticks
+}
+
+// readCmdLine lit la ligne de commande d'un processus
+func readCmdLine(pid int) string {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.ReplaceAll(string(data), "\x00", " "))
+}
+
+// readBootTime lit l'heure de démarrage de la machine dans /proc/stat
+func readBootTime() time.Time {
+	file, err := os.Open("/proc/stat")
+	if err != nil {
+		return time.Time{}
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if value, found := strings.CutPrefix(scanner.Text(), "btime "); found {
+			if seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+				return time.Unix(seconds, 0)
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// processUser retourne le nom de l'utilisateur réel d'un processus
+func (pm *ProcessManager) processUser(pid int) string {
+	file, err := os.Open(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "Uid:")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			return ""
+		}
+		uid := fields[0]
+		if name, cached := pm.users[uid]; cached {
+			return name
+		}
+		name := uid
+		if u, err := user.LookupId(uid); err == nil {
+			name = u.Username
+		}
+		pm.users[uid] = name
+		return name
+	}
+	return ""
+}
+
+// processName retourne le nom d'un processus
+func processName(pid int) string {
+	if stat, err := readProcStat(pid); err == nil {
+		return stat.name
+	}
+	return ""
+}
+
+// sendProcessSignal envoie un signal à un processus
+func sendProcessSignal(pid int, signal string) error {
+	sig, ok := linuxSignals[signal]
+	if !ok {
+		return fmt.Errorf("signal non supporté: %s", signal)
+	}
+	if err := syscall.Kill(pid, sig); err != nil {
+		return fmt.Errorf("envoi du signal %s au processus %d impossible: %v", signal, pid, err)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+
+package agent
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+
+	"remoteshell/internal/common"
+)
+
+// snapshot n'est pas implémenté hors Linux
+func (pm *ProcessManager) snapshot() ([]*common.ProcessInfo, error) {
+	return nil, fmt.Errorf("liste des processus non supportée sur %s", runtime.GOOS)
+}
+
+// processName n'est pas disponible hors Linux
+func processName(pid int) string {
+	return ""
+}
+
+// sendProcessSignal envoie un signal à un processus
+// Seul KILL est supporté de façon portable
+func sendProcessSignal(pid int, signal string) error {
+	if signal != "KILL" {
+		return fmt.Errorf("signal %s non supporté sur %s", signal, runtime.GOOS)
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
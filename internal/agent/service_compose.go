@@ -0,0 +1,354 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// Labels posés par Docker Compose sur les conteneurs d'un projet
+const (
+	composeProjectLabel     = "com.docker.compose.project"
+	composeWorkingDirLabel  = "com.docker.compose.project.working_dir"
+	composeConfigFilesLabel = "com.docker.compose.project.config_files"
+)
+
+// composeCommandTimeout borne une commande docker compose (up et pull téléchargent des images)
+const composeCommandTimeout = 10 * time.Minute
+
+// maxComposeConfigSize borne la taille des fichiers Compose retournés
+const maxComposeConfigSize = 1024 * 1024
+
+// composeProject décrit l'emplacement d'un projet Compose
+// Il est conservé après la suppression des conteneurs (down) pour pouvoir relancer le projet (up)
+type composeProject struct {
+	WorkingDir  string
+	ConfigFiles []string
+}
+
+// composeServices regroupe les conteneurs par projet Compose
+// Les projets connus sans conteneur (après un down) sont listés comme inactifs
+func (sm *ServiceManager) composeServices(containers []*common.ServiceInfo) []*common.ServiceInfo {
+	members := make(map[string][]*common.ServiceInfo)
+	for _, container := range containers {
+		if container.Project != "" {
+			members[container.Project] = append(members[container.Project], container)
+		}
+	}
+
+	sm.composeMu.Lock()
+	for name, projectContainers := range members {
+		if project, ok := projectFromLabels(projectContainers); ok {
+			sm.composeProjects[name] = project
+		}
+	}
+	names := make([]string, 0, len(sm.composeProjects))
+	for name := range sm.composeProjects {
+		names = append(names, name)
+	}
+	sm.composeMu.Unlock()
+
+	for name := range members {
+		if !containsString(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	services := make([]*common.ServiceInfo, 0, len(names))
+	for _, name := range names {
+		services = append(services, sm.composeProjectInfo(name, members[name]))
+	}
+	return services
+}
+
+// composeProjectInfo construit l'état d'un projet à partir de ses conteneurs
+func (sm *ServiceManager) composeProjectInfo(name string, containers []*common.ServiceInfo) *common.ServiceInfo {
+	project, _ := sm.lookupComposeProject(name, containers)
+
+	active, failed := 0, 0
+	info := &common.ServiceInfo{
+		Name:        name,
+		Type:        "compose",
+		Description: fmt.Sprintf("Projet Compose: %s", project.WorkingDir),
+		WorkingDir:  project.WorkingDir,
+		ConfigFiles: project.ConfigFiles,
+		Containers:  []string{},
+	}
+	for _, container := range containers {
+		info.Containers = append(info.Containers, container.Name)
+		info.Ports = append(info.Ports, container.Ports...)
+		switch container.State {
+		case "active":
+			active++
+		case "failed":
+			failed++
+		}
+		if info.Created == nil || (container.Created != nil && container.Created.Before(*info.Created)) {
+			info.Created = container.Created
+		}
+		info.Health = worseHealth(info.Health, container.Health)
+	}
+	sort.Strings(info.Containers)
+
+	// Comme docker compose ls: actif si tous les conteneurs tournent, dégradé si une partie seulement
+	switch {
+	case len(containers) > 0 && active == len(containers):
+		info.State = "active"
+	case active > 0:
+		info.State = "degraded"
+	case failed > 0:
+		info.State = "failed"
+	default:
+		info.State = "inactive"
+	}
+	info.Status = fmt.Sprintf("%d/%d conteneurs actifs", active, len(containers))
+	return info
+}
+
+// getComposeStatus obtient l'état d'un projet Compose
+func (sm *ServiceManager) getComposeStatus(name string) (*common.ServiceInfo, error) {
+	containers, err := sm.composeContainers(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := sm.lookupComposeProject(name, containers); err != nil {
+		return nil, err
+	}
+	return sm.composeProjectInfo(name, containers), nil
+}
+
+// composeContainers liste les conteneurs d'un projet, triés par date de création
+func (sm *ServiceManager) composeContainers(name string) ([]*common.ServiceInfo, error) {
+	containers, err := sm.docker.ListContainers()
+	if err != nil {
+		return nil, fmt.Errorf("échec de la liste des conteneurs: %v", err)
+	}
+
+	var members []*common.ServiceInfo
+	for _, container := range containers {
+		if container.Labels[composeProjectLabel] == name {
+			members = append(members, serviceFromContainer(container))
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Created.Before(*members[j].Created) })
+	return members, nil
+}
+
+// executeComposeAction exécute une action sur un projet Compose
+// Les conteneurs existants sont pilotés par l'API Docker; up, down, pull et recreate ont besoin des fichiers
+// du projet et passent par docker compose
+func (sm *ServiceManager) executeComposeAction(action *common.ServiceAction, result *common.ServiceResult) error {
+	options := action.Options
+	if options == nil {
+		options = &common.ServiceActionOptions{}
+	}
+
+	containers, err := sm.composeContainers(action.Name)
+	if err != nil {
+		return err
+	}
+	project, err := sm.lookupComposeProject(action.Name, containers)
+	if err != nil {
+		return err
+	}
+
+	timeout := strconv.Itoa(dockerStopTimeout(options))
+	switch action.Action {
+	case "start":
+		return sm.composeContainerAction(containers, action.Action, nil, false)
+	case "restart":
+		return sm.composeContainerAction(containers, action.Action, url.Values{"t": {timeout}}, false)
+	case "stop":
+		return sm.composeContainerAction(containers, action.Action, url.Values{"t": {timeout}}, true)
+	case "config":
+		output, err := readComposeConfig(project)
+		result.Output = output
+		return err
+	case "up":
+		return sm.runCompose(action.Name, project, result, "up", "-d")
+	case "down":
+		args := []string{"down", "-t", timeout}
+		if options.Volumes {
+			args = append(args, "-v")
+		}
+		return sm.runCompose(action.Name, project, result, args...)
+	case "pull":
+		return sm.runCompose(action.Name, project, result, "pull")
+	case "recreate":
+		if options.Pull {
+			if err := sm.runCompose(action.Name, project, result, "pull"); err != nil {
+				return err
+			}
+		}
+		return sm.runCompose(action.Name, project, result, "up", "-d", "--force-recreate", "-t", timeout)
+	}
+	return fmt.Errorf("action non supportée pour Compose: %s", action.Action)
+}
+
+// composeContainerAction applique une action à chaque conteneur du projet, dans l'ordre de création
+// ou dans l'ordre inverse pour un arrêt
+func (sm *ServiceManager) composeContainerAction(containers []*common.ServiceInfo, action string, query url.Values, reverse bool) error {
+	if len(containers) == 0 {
+		return fmt.Errorf("aucun conteneur dans le projet, utilisez l'action up")
+	}
+
+	for i := range containers {
+		container := containers[i]
+		if reverse {
+			container = containers[len(containers)-1-i]
+		}
+		if err := sm.docker.ContainerAction(container.ContainerID, action, query); err != nil {
+			return fmt.Errorf("%s: %v", container.Name, err)
+		}
+	}
+	return nil
+}
+
+// lookupComposeProject retrouve l'emplacement d'un projet depuis ses conteneurs ou les projets déjà vus
+func (sm *ServiceManager) lookupComposeProject(name string, containers []*common.ServiceInfo) (composeProject, error) {
+	sm.composeMu.Lock()
+	defer sm.composeMu.Unlock()
+
+	if project, ok := projectFromLabels(containers); ok {
+		sm.composeProjects[name] = project
+		return project, nil
+	}
+	if project, ok := sm.composeProjects[name]; ok {
+		return project, nil
+	}
+	// Conteneurs créés sans les labels d'emplacement: seules les actions sur les conteneurs sont possibles
+	if len(containers) > 0 {
+		return composeProject{}, nil
+	}
+	return composeProject{}, fmt.Errorf("projet Compose inconnu: %s", name)
+}
+
+// projectFromLabels lit l'emplacement du projet dans les labels de ses conteneurs
+func projectFromLabels(containers []*common.ServiceInfo) (composeProject, bool) {
+	for _, container := range containers {
+		workingDir := container.Labels[composeWorkingDirLabel]
+		if workingDir == "" {
+			continue
+		}
+		project := composeProject{WorkingDir: workingDir}
+		for _, file := range strings.Split(container.Labels[composeConfigFilesLabel], ",") {
+			if file = strings.TrimSpace(file); file != "" {
+				project.ConfigFiles = append(project.ConfigFiles, file)
+			}
+		}
+		return project, true
+	}
+	return composeProject{}, false
+}
+
+// readComposeConfig retourne le contenu des fichiers Compose du projet
+func readComposeConfig(project composeProject) (string, error) {
+	if len(project.ConfigFiles) == 0 {
+		return "", fmt.Errorf("fichiers Compose du projet inconnus")
+	}
+
+	var output strings.Builder
+	found := false
+	for _, file := range project.ConfigFiles {
+		// Comme pour docker compose, un fichier disparu est ignoré
+		info, err := os.Stat(file)
+		if err != nil {
+			fmt.Fprintf(&output, "# %s: %v\n", file, err)
+			continue
+		}
+		if int64(output.Len())+info.Size() > maxComposeConfigSize {
+			return output.String(), fmt.Errorf("fichier Compose trop volumineux: %s", file)
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return output.String(), fmt.Errorf("lecture de %s impossible: %v", file, err)
+		}
+		fmt.Fprintf(&output, "# %s\n", file)
+		output.Write(content)
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			output.WriteByte('\n')
+		}
+		found = true
+	}
+	if !found {
+		return output.String(), fmt.Errorf("aucun fichier Compose accessible")
+	}
+	return output.String(), nil
+}
+
+// runCompose exécute docker compose sur le projet et ajoute sa sortie au résultat
+func (sm *ServiceManager) runCompose(name string, project composeProject, result *common.ServiceResult, args ...string) error {
+	command := sm.composeCommand()
+	if command == nil {
+		return fmt.Errorf("docker compose non disponible sur cet hôte")
+	}
+
+	fullArgs := append([]string{}, command[1:]...)
+	fullArgs = append(fullArgs, "--ansi", "never", "-p", name)
+	if _, err := os.Stat(project.WorkingDir); err == nil {
+		fullArgs = append(fullArgs, "--project-directory", project.WorkingDir)
+	}
+	for _, file := range project.ConfigFiles {
+		// Un fichier disparu empêcherait même down; docker compose se contente alors du nom du projet
+		if _, err := os.Stat(file); err == nil {
+			fullArgs = append(fullArgs, "-f", file)
+		}
+	}
+	fullArgs = append(fullArgs, args...)
+
+	ctx, cancel := context.WithTimeout(context.Background(), composeCommandTimeout)
+	defer cancel()
+
+	log.Printf("[COMPOSE] %s %s", command[0], strings.Join(fullArgs, " "))
+	cmd := exec.CommandContext(ctx, command[0], fullArgs...)
+	cmd.Env = os.Environ()
+	if sm.dockerHost != "" {
+		cmd.Env = append(cmd.Env, "DOCKER_HOST="+sm.dockerHost)
+	}
+	output, err := cmd.CombinedOutput()
+
+	if text := strings.TrimSpace(string(output)); text != "" {
+		if result.Output != "" {
+			result.Output += "\n"
+		}
+		result.Output += text
+	}
+	if err != nil {
+		return fmt.Errorf("échec de docker compose %s: %v", args[0], err)
+	}
+	return nil
+}
+
+// composeCommand retourne la commande docker compose disponible (plugin ou binaire autonome), nil sinon
+func (sm *ServiceManager) composeCommand() []string {
+	sm.composeOnce.Do(func() {
+		for _, candidate := range [][]string{{"docker", "compose"}, {"docker-compose"}} {
+			args := append(append([]string{}, candidate[1:]...), "version")
+			if exec.Command(candidate[0], args...).Run() == nil {
+				sm.composeCmd = candidate
+				return
+			}
+		}
+		log.Printf("[COMPOSE] docker compose non disponible")
+	})
+	return sm.composeCmd
+}
+
+// worseHealth retourne le plus mauvais des deux états de santé
+func worseHealth(a, b string) string {
+	rank := map[string]int{"": 0, "healthy": 1, "starting": 2, "unhealthy": 3}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,576 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// defaultDockerStopTimeout est le délai par défaut avant l'arrêt forcé d'un conteneur, en secondes
+const defaultDockerStopTimeout = 10
+
+// defaultDockerLogTail est le nombre de lignes de logs retournées par défaut
+const defaultDockerLogTail = 100
+
+// maxDockerLogOutput borne la taille des logs retournés sans suivi
+const maxDockerLogOutput = 1024 * 1024
+
+// dockerPullTimeout borne le téléchargement d'une image
+const dockerPullTimeout = 10 * time.Minute
+
+// dockerLogFlushInterval regroupe les lignes suivies avant leur envoi
+const dockerLogFlushInterval = 250 * time.Millisecond
+
+// maxServiceLogFollow borne la durée d'un suivi de logs oublié par le serveur
+const maxServiceLogFollow = time.Hour
+
+// dockerStatsConcurrency limite le nombre de conteneurs interrogés simultanément pour leurs statistiques
+const dockerStatsConcurrency = 8
+
+// dockerEndpointSettings contient la configuration d'un conteneur sur un réseau reprise lors de sa recréation
+// Les données d'exécution (adresse, passerelle, identifiants) sont attribuées à nouveau par Docker
+type dockerEndpointSettings struct {
+	IPAMConfig json.RawMessage   `json:"IPAMConfig,omitempty"`
+	Links      []string          `json:"Links,omitempty"`
+	Aliases    []string          `json:"Aliases,omitempty"`
+	DriverOpts map[string]string `json:"DriverOpts,omitempty"`
+}
+
+// listDockerContainers liste les conteneurs Docker avec leurs ports, labels, santé et, si withStats, leur consommation
+func (sm *ServiceManager) listDockerContainers(withStats bool) ([]*common.ServiceInfo, error) {
+	containers, err := sm.docker.ListContainers()
+	if err != nil {
+		return nil, fmt.Errorf("échec de la liste des conteneurs: %v", err)
+	}
+
+	services := make([]*common.ServiceInfo, 0, len(containers))
+	for _, container := range containers {
+		services = append(services, serviceFromContainer(container))
+	}
+	if withStats {
+		sm.collectDockerStats(services)
+	}
+	return services, nil
+}
+
+// serviceFromContainer construit la description d'un conteneur listé
+func serviceFromContainer(container dockerContainer) *common.ServiceInfo {
+	name := shortContainerID(container.ID)
+	if len(container.Names) > 0 {
+		name = strings.TrimPrefix(container.Names[0], "/")
+	}
+	created := time.Unix(container.Created, 0)
+
+	service := &common.ServiceInfo{
+		Name:        name,
+		Type:        "docker",
+		Status:      container.Status,
+		State:       dockerServiceState(container.State),
+		Description: fmt.Sprintf("Container: %s", container.Image),
+		ContainerID: shortContainerID(container.ID),
+		Image:       container.Image,
+		Created:     &created,
+		Labels:      container.Labels,
+		Health:      dockerHealthFromStatus(container.Status),
+		Project:     container.Labels[composeProjectLabel],
+	}
+	for _, port := range container.Ports {
+		service.Ports = append(service.Ports, common.ContainerPort{
+			IP:          port.IP,
+			PrivatePort: port.PrivatePort,
+			PublicPort:  port.PublicPort,
+			Type:        port.Type,
+		})
+	}
+	return service
+}
+
+// collectDockerStats renseigne la consommation des conteneurs en cours d'exécution
+func (sm *ServiceManager) collectDockerStats(services []*common.ServiceInfo) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, dockerStatsConcurrency)
+	seen := make(map[string]bool)
+	for _, service := range services {
+		if service.State != "active" {
+			continue
+		}
+		seen[service.ContainerID] = true
+
+		wg.Add(1)
+		go func(service *common.ServiceInfo) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			sample, err := sm.docker.ContainerStats(service.ContainerID)
+			if err != nil {
+				return
+			}
+			service.Stats = sm.containerStats(service.ContainerID, sample)
+		}(service)
+	}
+	wg.Wait()
+
+	// Oublier les échantillons des conteneurs arrêtés ou supprimés
+	sm.statsMu.Lock()
+	for id := range sm.cpuSamples {
+		if !seen[id] {
+			delete(sm.cpuSamples, id)
+		}
+	}
+	sm.statsMu.Unlock()
+}
+
+// containerStats calcule la consommation d'un conteneur à partir d'un échantillon
+// Un échantillon one-shot ne contient pas de mesure précédente: l'usage CPU est alors calculé
+// depuis l'échantillon conservé lors de la collecte précédente
+func (sm *ServiceManager) containerStats(id string, sample *dockerStats) *common.ContainerStats {
+	sm.statsMu.Lock()
+	previous, known := sm.cpuSamples[id]
+	sm.cpuSamples[id] = sample.CPUStats
+	sm.statsMu.Unlock()
+
+	if sample.PreCPUStats.SystemUsage > 0 {
+		previous, known = sample.PreCPUStats, true
+	}
+
+	stats := &common.ContainerStats{
+		MemoryLimit: sample.MemoryStats.Limit,
+		PIDs:        sample.PidsStats.Current,
+	}
+	if known && sample.CPUStats.SystemUsage > previous.SystemUsage && sample.CPUStats.CPUUsage.TotalUsage >= previous.CPUUsage.TotalUsage {
+		cpuDelta := float64(sample.CPUStats.CPUUsage.TotalUsage - previous.CPUUsage.TotalUsage)
+		systemDelta := float64(sample.CPUStats.SystemUsage - previous.SystemUsage)
+		cpus := sample.CPUStats.OnlineCPUs
+		if cpus == 0 {
+			cpus = 1
+		}
+		stats.CPUPercent = cpuDelta / systemDelta * float64(cpus) * 100
+	}
+
+	// Comme docker stats, le cache de pages inactif n'est pas compté (cgroup v2, puis v1)
+	stats.MemoryUsage = sample.MemoryStats.Usage
+	for _, key := range []string{"inactive_file", "total_inactive_file"} {
+		if inactive, ok := sample.MemoryStats.Stats[key]; ok && inactive < stats.MemoryUsage {
+			stats.MemoryUsage -= inactive
+			break
+		}
+	}
+	if stats.MemoryLimit > 0 {
+		stats.MemoryPercent = float64(stats.MemoryUsage) / float64(stats.MemoryLimit) * 100
+	}
+
+	for _, network := range sample.Networks {
+		stats.NetworkRx += network.RxBytes
+		stats.NetworkTx += network.TxBytes
+	}
+	for _, entry := range sample.BlkioStats.IOServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.BlockRead += entry.Value
+		case "write":
+			stats.BlockWrite += entry.Value
+		}
+	}
+	return stats
+}
+
+// getDockerStatus obtient le statut d'un conteneur Docker
+func (sm *ServiceManager) getDockerStatus(containerName string) (*common.ServiceInfo, error) {
+	container, _, err := sm.docker.InspectContainer(containerName)
+	if err != nil {
+		return nil, fmt.Errorf("échec de récupération du statut: %v", err)
+	}
+
+	image := configString(container.Config, "Image")
+	created := container.Created
+	info := &common.ServiceInfo{
+		Name:        strings.TrimPrefix(container.Name, "/"),
+		Type:        "docker",
+		Status:      container.State.Status,
+		State:       dockerServiceState(container.State.Status),
+		Description: fmt.Sprintf("Container: %s", image),
+		ContainerID: shortContainerID(container.ID),
+		Image:       image,
+		Created:     &created,
+	}
+	if container.State.Health != nil {
+		info.Health = container.State.Health.Status
+	}
+	if labels, ok := container.Config["Labels"]; ok {
+		json.Unmarshal(labels, &info.Labels)
+		info.Project = info.Labels[composeProjectLabel]
+	}
+	if container.State.Running {
+		if sample, err := sm.docker.ContainerStats(container.ID); err == nil {
+			info.Stats = sm.containerStats(shortContainerID(container.ID), sample)
+		}
+	}
+	return info, nil
+}
+
+// executeDockerAction exécute une action Docker et complète le résultat (logs, inspection, nouveau conteneur)
+func (sm *ServiceManager) executeDockerAction(action *common.ServiceAction, result *common.ServiceResult) error {
+	options := action.Options
+	if options == nil {
+		options = &common.ServiceActionOptions{}
+	}
+	stopTimeout := url.Values{"t": {strconv.Itoa(dockerStopTimeout(options))}}
+
+	switch action.Action {
+	case "start", "pause", "unpause":
+		return sm.docker.ContainerAction(action.Name, action.Action, nil)
+	case "stop", "restart":
+		return sm.docker.ContainerAction(action.Name, action.Action, stopTimeout)
+	case "remove":
+		return sm.docker.RemoveContainer(action.Name, options.Force, options.Volumes)
+	case "inspect":
+		_, raw, err := sm.docker.InspectContainer(action.Name)
+		result.Details = raw
+		return err
+	case "logs":
+		output, err := sm.dockerLogs(action.Name, options)
+		result.Output = output
+		return err
+	case "pull":
+		image := options.Image
+		if image == "" {
+			container, _, err := sm.docker.InspectContainer(action.Name)
+			if err != nil {
+				return err
+			}
+			image = configString(container.Config, "Image")
+		}
+		statuses, err := sm.pullImage(image)
+		result.Output = strings.Join(statuses, "\n")
+		return err
+	case "recreate":
+		return sm.recreateContainer(action.Name, options, result)
+	}
+	return fmt.Errorf("action non supportée pour Docker: %s", action.Action)
+}
+
+// dockerLogs retourne les dernières lignes de logs d'un conteneur
+func (sm *ServiceManager) dockerLogs(name string, options *common.ServiceActionOptions) (string, error) {
+	container, _, err := sm.docker.InspectContainer(name)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dockerRequestTimeout)
+	defer cancel()
+
+	var output strings.Builder
+	truncated := false
+	err = sm.docker.ContainerLogs(ctx, name, configBool(container.Config, "Tty"), dockerLogOptionsFrom(options, false), func(lines []string) {
+		for _, line := range lines {
+			if output.Len()+len(line) > maxDockerLogOutput {
+				truncated = true
+				cancel()
+				return
+			}
+			output.WriteString(line)
+			output.WriteByte('\n')
+		}
+	})
+	if truncated {
+		output.WriteString("[...] logs tronqués\n")
+	}
+	return output.String(), err
+}
+
+// FollowDockerLogs diffuse les logs d'un conteneur jusqu'à l'annulation du contexte
+// Les lignes sont regroupées avant d'être transmises à onLines
+func (sm *ServiceManager) FollowDockerLogs(ctx context.Context, name string, options *common.ServiceActionOptions, onLines func([]string)) error {
+	if sm.dockerClient() == nil {
+		return errors.New("Docker non disponible")
+	}
+	container, _, err := sm.docker.InspectContainer(name)
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var pending []string
+	done := make(chan error, 1)
+	go func() {
+		done <- sm.docker.ContainerLogs(ctx, name, configBool(container.Config, "Tty"), dockerLogOptionsFrom(options, true), func(lines []string) {
+			mu.Lock()
+			pending = append(pending, lines...)
+			mu.Unlock()
+		})
+	}()
+
+	flush := func() {
+		mu.Lock()
+		lines := pending
+		pending = nil
+		mu.Unlock()
+		if len(lines) > 0 {
+			onLines(lines)
+		}
+	}
+
+	ticker := time.NewTicker(dockerLogFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			flush()
+			return err
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// pullImage télécharge une image et retourne les étapes du téléchargement
+func (sm *ServiceManager) pullImage(image string) ([]string, error) {
+	if image == "" || strings.HasPrefix(image, "sha256:") {
+		return nil, fmt.Errorf("le conteneur ne référence pas une image téléchargeable: %q", image)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), dockerPullTimeout)
+	defer cancel()
+
+	log.Printf("[DOCKER] Téléchargement de l'image %s", image)
+	return sm.docker.PullImage(ctx, image)
+}
+
+// recreateContainer recrée un conteneur avec sa configuration, éventuellement sur une nouvelle image
+// L'ancien conteneur est arrêté et renommé, puis supprimé une fois le nouveau démarré; il est restauré en cas d'échec
+func (sm *ServiceManager) recreateContainer(name string, options *common.ServiceActionOptions, result *common.ServiceResult) error {
+	old, _, err := sm.docker.InspectContainer(name)
+	if err != nil {
+		return err
+	}
+	containerName := strings.TrimPrefix(old.Name, "/")
+	wasRunning := old.State.Running
+
+	image := options.Image
+	if image == "" {
+		image = configString(old.Config, "Image")
+	}
+
+	var steps []string
+	defer func() { result.Output = strings.Join(steps, "\n") }()
+
+	if options.Pull {
+		statuses, err := sm.pullImage(image)
+		steps = append(steps, statuses...)
+		if err != nil {
+			return fmt.Errorf("échec du téléchargement de %s: %v", image, err)
+		}
+	}
+
+	body, extraNetworks, err := recreateBody(old, image)
+	if err != nil {
+		return err
+	}
+
+	stopTimeout := url.Values{"t": {strconv.Itoa(dockerStopTimeout(options))}}
+	if wasRunning {
+		if err := sm.docker.ContainerAction(old.ID, "stop", stopTimeout); err != nil {
+			return fmt.Errorf("arrêt de l'ancien conteneur impossible: %v", err)
+		}
+		steps = append(steps, "ancien conteneur arrêté")
+	}
+
+	backupName := fmt.Sprintf("%s-remoteshell-%d", containerName, time.Now().Unix())
+	if err := sm.docker.RenameContainer(old.ID, backupName); err != nil {
+		sm.restoreContainer(old.ID, "", wasRunning)
+		return fmt.Errorf("renommage de l'ancien conteneur impossible: %v", err)
+	}
+
+	// En cas d'échec, le nouveau conteneur est supprimé et l'ancien reprend son nom et son état
+	newID, err := sm.docker.CreateContainer(containerName, body)
+	if err != nil {
+		sm.restoreContainer(old.ID, containerName, wasRunning)
+		return fmt.Errorf("création du nouveau conteneur impossible: %v", err)
+	}
+	steps = append(steps, "nouveau conteneur créé: "+shortContainerID(newID))
+
+	for network, endpoint := range extraNetworks {
+		if err := sm.docker.ConnectNetwork(network, newID, endpoint); err != nil {
+			sm.docker.RemoveContainer(newID, true, false)
+			sm.restoreContainer(old.ID, containerName, wasRunning)
+			return fmt.Errorf("connexion au réseau %s impossible: %v", network, err)
+		}
+	}
+
+	if wasRunning {
+		if err := sm.docker.ContainerAction(newID, "start", nil); err != nil {
+			sm.docker.RemoveContainer(newID, true, false)
+			sm.restoreContainer(old.ID, containerName, wasRunning)
+			return fmt.Errorf("démarrage du nouveau conteneur impossible: %v", err)
+		}
+		steps = append(steps, "nouveau conteneur démarré")
+	}
+
+	result.ContainerID = shortContainerID(newID)
+	if err := sm.docker.RemoveContainer(old.ID, false, false); err != nil {
+		steps = append(steps, fmt.Sprintf("ancien conteneur %s conservé: %v", backupName, err))
+	} else {
+		steps = append(steps, "ancien conteneur supprimé")
+	}
+	return nil
+}
+
+// restoreContainer rend son nom et son état à un conteneur après l'échec d'une recréation
+func (sm *ServiceManager) restoreContainer(id, name string, start bool) {
+	if name != "" {
+		if err := sm.docker.RenameContainer(id, name); err != nil {
+			log.Printf("[DOCKER] Restauration du nom %s impossible: %v", name, err)
+		}
+	}
+	if start {
+		if err := sm.docker.ContainerAction(id, "start", nil); err != nil {
+			log.Printf("[DOCKER] Redémarrage de l'ancien conteneur %s impossible: %v", shortContainerID(id), err)
+		}
+	}
+}
+
+// recreateBody construit la demande de création d'un conteneur identique à old sur l'image donnée
+// Retourne aussi les réseaux supplémentaires à connecter après la création
+func recreateBody(old *dockerContainerJSON, image string) (map[string]interface{}, map[string]json.RawMessage, error) {
+	body := make(map[string]interface{}, len(old.Config)+2)
+	for key, value := range old.Config {
+		body[key] = value
+	}
+	body["Image"] = image
+	// Un nom d'hôte égal à l'identifiant a été attribué par Docker et ne doit pas être repris
+	if hostname := configString(old.Config, "Hostname"); hostname == shortContainerID(old.ID) {
+		delete(body, "Hostname")
+	}
+	body["HostConfig"] = old.HostConfig
+
+	var hostConfig struct {
+		NetworkMode string `json:"NetworkMode"`
+	}
+	if len(old.HostConfig) > 0 {
+		if err := json.Unmarshal(old.HostConfig, &hostConfig); err != nil {
+			return nil, nil, fmt.Errorf("configuration du conteneur illisible: %v", err)
+		}
+	}
+	primary := hostConfig.NetworkMode
+	if primary == "" || primary == "default" {
+		primary = "bridge"
+	}
+	// Réseaux de l'hôte, aucun réseau, ou réseau d'un autre conteneur: rien à connecter
+	if primary == "host" || primary == "none" || strings.HasPrefix(primary, "container:") {
+		return body, nil, nil
+	}
+
+	endpoints := make(map[string]json.RawMessage)
+	extra := make(map[string]json.RawMessage)
+	for network, raw := range old.NetworkSettings.Networks {
+		var settings dockerEndpointSettings
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return nil, nil, fmt.Errorf("configuration réseau illisible: %v", err)
+		}
+		// Docker ajoute l'identifiant court du conteneur aux alias
+		aliases := settings.Aliases[:0]
+		for _, alias := range settings.Aliases {
+			if alias != shortContainerID(old.ID) {
+				aliases = append(aliases, alias)
+			}
+		}
+		settings.Aliases = aliases
+
+		encoded, err := json.Marshal(settings)
+		if err != nil {
+			return nil, nil, err
+		}
+		if network == primary {
+			endpoints[network] = encoded
+		} else {
+			extra[network] = encoded
+		}
+	}
+	body["NetworkingConfig"] = map[string]interface{}{"EndpointsConfig": endpoints}
+	return body, extra, nil
+}
+
+// dockerLogOptionsFrom traduit les options d'une action en paramètres de lecture des logs
+func dockerLogOptionsFrom(options *common.ServiceActionOptions, follow bool) dockerLogOptions {
+	logOptions := dockerLogOptions{Tail: defaultDockerLogTail, Follow: follow}
+	if options != nil {
+		if options.Tail > 0 {
+			logOptions.Tail = options.Tail
+		}
+		logOptions.Since = options.Since
+		logOptions.Timestamps = options.Timestamps
+	}
+	return logOptions
+}
+
+// dockerStopTimeout retourne le délai d'arrêt demandé ou le délai par défaut
+func dockerStopTimeout(options *common.ServiceActionOptions) int {
+	if options != nil && options.Timeout > 0 {
+		return options.Timeout
+	}
+	return defaultDockerStopTimeout
+}
+
+// dockerServiceState traduit l'état d'un conteneur dans le vocabulaire des services
+func dockerServiceState(state string) string {
+	switch state {
+	case "running":
+		return "active"
+	case "restarting":
+		return "activating"
+	case "paused":
+		return "paused"
+	case "dead":
+		return "failed"
+	}
+	return "inactive"
+}
+
+// dockerHealthFromStatus extrait l'état de santé du statut d'un conteneur ("Up 2 hours (healthy)")
+func dockerHealthFromStatus(status string) string {
+	switch {
+	case strings.HasSuffix(status, "(healthy)"):
+		return "healthy"
+	case strings.HasSuffix(status, "(unhealthy)"):
+		return "unhealthy"
+	case strings.HasSuffix(status, "(health: starting)"):
+		return "starting"
+	}
+	return ""
+}
+
+// shortContainerID retourne l'identifiant court d'un conteneur, tel qu'affiché par docker ps
+func shortContainerID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// configString lit un champ texte de la configuration brute d'un conteneur
+func configString(config map[string]json.RawMessage, key string) string {
+	var value string
+	if raw, ok := config[key]; ok {
+		json.Unmarshal(raw, &value)
+	}
+	return value
+}
+
+// configBool lit un champ booléen de la configuration brute d'un conteneur
+func configBool(config map[string]json.RawMessage, key string) bool {
+	var value bool
+	if raw, ok := config[key]; ok {
+		json.Unmarshal(raw, &value)
+	}
+	return value
+}
@@ -0,0 +1,205 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestServiceManagerDockerStartedLate(t *testing.T) {
+	host, path := newDockerTestSocket(t)
+
+	// Le démon n'est pas encore démarré à la création du gestionnaire
+	sm := NewServiceManager(host)
+	sm.hasSystemd = false
+	if sm.dockerClient() != nil {
+		t.Fatal("l'API Docker ne devrait pas être joignable")
+	}
+	services, err := sm.ListServices()
+	if err != nil || len(services) != 0 {
+		t.Fatalf("ListServices sans démon = %d services, %v", len(services), err)
+	}
+
+	startDockerTestDaemon(t, path, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" || r.URL.Query().Get("all") != "1" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[
+			{"Id": "4f2a8c1e9b7d6a5f3e2d1c0b", "Names": ["/web"], "Image": "nginx:1.27", "Created": 1760790000,
+			 "State": "running", "Status": "Up 2 hours (healthy)",
+			 "Ports": [{"IP": "0.0.0.0", "PrivatePort": 80, "PublicPort": 8080, "Type": "tcp"}],
+			 "Labels": {"maintainer": "ops"}},
+			{"Id": "9e8d7c6b5a4f3e2d1c0b9a8f", "Names": ["/batch"], "Image": "alpine", "Created": 1760780000,
+			 "State": "exited", "Status": "Exited (0) 3 minutes ago"}
+		]`))
+	})
+
+	// La tentative suivante n'a lieu qu'après le délai de reconnexion
+	if sm.dockerClient() != nil {
+		t.Fatal("la connexion ne devrait pas être retentée avant dockerRetryDelay")
+	}
+	sm.dockerMu.Lock()
+	sm.dockerChecked = time.Now().Add(-dockerRetryDelay)
+	sm.dockerMu.Unlock()
+
+	services, err = sm.ListServices()
+	if err != nil {
+		t.Fatalf("ListServices: %v", err)
+	}
+	if len(services) != 2 {
+		t.Fatalf("%d services listés, attendu 2", len(services))
+	}
+
+	web := services[0]
+	if web.Name != "web" || web.Type != "docker" || web.State != "active" || web.Health != "healthy" {
+		t.Errorf("conteneur web = %s/%s %s %s", web.Type, web.Name, web.State, web.Health)
+	}
+	if web.ContainerID != "4f2a8c1e9b7d" {
+		t.Errorf("identifiant court = %q", web.ContainerID)
+	}
+	if len(web.Ports) != 1 || web.Ports[0].PublicPort != 8080 || web.Ports[0].PrivatePort != 80 {
+		t.Errorf("ports = %+v", web.Ports)
+	}
+	if web.Created == nil || web.Created.Unix() != 1760790000 {
+		t.Errorf("date de création = %v", web.Created)
+	}
+	if batch := services[1]; batch.Name != "batch" || batch.State != "inactive" || batch.Health != "" {
+		t.Errorf("conteneur batch = %s %s %q", batch.Name, batch.State, batch.Health)
+	}
+}
+
+// dockerTestContainer décode l'inspection d'un conteneur telle que retournée par l'API
+func dockerTestContainer(t *testing.T, raw string) *dockerContainerJSON {
+	t.Helper()
+	var container dockerContainerJSON
+	if err := json.Unmarshal([]byte(raw), &container); err != nil {
+		t.Fatalf("inspection invalide: %v", err)
+	}
+	return &container
+}
+
+// sameJSON indique si deux documents JSON ont le même contenu, à la mise en forme près
+func sameJSON(a, b []byte) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func TestRecreateBody(t *testing.T) {
+	old := dockerTestContainer(t, `{
+		"Id": "4f2a8c1e9b7d6a5f3e2d1c0b",
+		"Name": "/web",
+		"Config": {"Hostname": "4f2a8c1e9b7d", "Image": "nginx:1.26", "Env": ["TZ=Europe/Paris"], "Labels": {"maintainer": "ops"}},
+		"HostConfig": {"NetworkMode": "front", "RestartPolicy": {"Name": "always"}},
+		"NetworkSettings": {"Networks": {
+			"front": {"Aliases": ["4f2a8c1e9b7d", "web"], "IPAddress": "172.18.0.4", "NetworkID": "abc", "DriverOpts": {"mtu": "1400"}},
+			"back": {"Aliases": ["web-back"], "IPAddress": "172.19.0.2", "Links": ["db:db"]}
+		}}
+	}`)
+
+	body, extra, err := recreateBody(old, "nginx:1.27")
+	if err != nil {
+		t.Fatalf("recreateBody: %v", err)
+	}
+
+	if body["Image"] != "nginx:1.27" {
+		t.Errorf("Image = %v", body["Image"])
+	}
+	if _, ok := body["Hostname"]; ok {
+		t.Error("le nom d'hôte attribué par Docker ne devrait pas être repris")
+	}
+	if env, _ := json.Marshal(body["Env"]); string(env) != `["TZ=Europe/Paris"]` {
+		t.Errorf("Env = %s", env)
+	}
+	if hostConfig, _ := json.Marshal(body["HostConfig"]); !sameJSON(hostConfig, old.HostConfig) {
+		t.Errorf("HostConfig = %s", hostConfig)
+	}
+
+	// Seul le réseau principal est configuré à la création, sans les données d'exécution
+	encoded, _ := json.Marshal(body["NetworkingConfig"])
+	var networking struct {
+		EndpointsConfig map[string]map[string]interface{}
+	}
+	if err := json.Unmarshal(encoded, &networking); err != nil {
+		t.Fatalf("NetworkingConfig illisible: %v", err)
+	}
+	front, ok := networking.EndpointsConfig["front"]
+	if !ok || len(networking.EndpointsConfig) != 1 {
+		t.Fatalf("EndpointsConfig = %s", encoded)
+	}
+	if !reflect.DeepEqual(front["Aliases"], []interface{}{"web"}) {
+		t.Errorf("alias du réseau principal = %v", front["Aliases"])
+	}
+	if _, ok := front["IPAddress"]; ok {
+		t.Error("l'adresse attribuée par Docker ne devrait pas être reprise")
+	}
+	if !reflect.DeepEqual(front["DriverOpts"], map[string]interface{}{"mtu": "1400"}) {
+		t.Errorf("DriverOpts = %v", front["DriverOpts"])
+	}
+
+	if len(extra) != 1 {
+		t.Fatalf("%d réseaux supplémentaires, attendu 1", len(extra))
+	}
+	var back dockerEndpointSettings
+	if err := json.Unmarshal(extra["back"], &back); err != nil {
+		t.Fatalf("réseau back illisible: %v", err)
+	}
+	if !reflect.DeepEqual(back.Aliases, []string{"web-back"}) || !reflect.DeepEqual(back.Links, []string{"db:db"}) {
+		t.Errorf("réseau back = %+v", back)
+	}
+}
+
+func TestRecreateBodyNetworkModes(t *testing.T) {
+	tests := []struct {
+		networkMode string
+		endpoints   []string // nil: aucune configuration réseau
+	}{
+		{"", []string{"bridge"}},
+		{"default", []string{"bridge"}},
+		{"host", nil},
+		{"none", nil},
+		{"container:4f2a8c1e9b7d", nil},
+	}
+	for _, tt := range tests {
+		old := dockerTestContainer(t, `{
+			"Id": "9e8d7c6b5a4f3e2d1c0b9a8f",
+			"Config": {"Hostname": "cache", "Image": "redis"},
+			"HostConfig": {"NetworkMode": "`+tt.networkMode+`"},
+			"NetworkSettings": {"Networks": {"bridge": {"Aliases": null}}}
+		}`)
+
+		body, extra, err := recreateBody(old, "redis:7")
+		if err != nil {
+			t.Errorf("NetworkMode %q: %v", tt.networkMode, err)
+			continue
+		}
+		if body["Hostname"] == nil {
+			t.Errorf("NetworkMode %q: un nom d'hôte choisi devrait être conservé", tt.networkMode)
+		}
+		if len(extra) != 0 {
+			t.Errorf("NetworkMode %q: réseaux supplémentaires inattendus %v", tt.networkMode, extra)
+		}
+
+		networking, ok := body["NetworkingConfig"].(map[string]interface{})
+		if tt.endpoints == nil {
+			if ok {
+				t.Errorf("NetworkMode %q: configuration réseau inattendue %v", tt.networkMode, networking)
+			}
+			continue
+		}
+		endpoints, _ := networking["EndpointsConfig"].(map[string]json.RawMessage)
+		var names []string
+		for name := range endpoints {
+			names = append(names, name)
+		}
+		if !reflect.DeepEqual(names, tt.endpoints) {
+			t.Errorf("NetworkMode %q: réseaux = %v, attendu %v", tt.networkMode, names, tt.endpoints)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package agent
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// dockerEventRetryDelay est le délai avant de rouvrir le flux des événements Docker interrompu
+const dockerEventRetryDelay = 5 * time.Second
+
+// dockerStateActions sont les événements de conteneur qui modifient son état ou sa santé
+// Les événements exec_* déclenchés par chaque healthcheck sont ignorés
+var dockerStateActions = map[string]bool{
+	"create": true, "start": true, "restart": true, "stop": true, "die": true, "kill": true,
+	"oom": true, "pause": true, "unpause": true, "destroy": true, "rename": true,
+}
+
+// serviceKey identifie un service par son type et son nom (un conteneur et un projet peuvent porter le même nom)
+func serviceKey(service *common.ServiceInfo) string {
+	return service.Type + "/" + service.Name
+}
+
+// diffServices compare deux relevés de l'état des services
+// Retourne nil si aucun service n'a changé
+func diffServices(previous, current []*common.ServiceInfo, now time.Time) *common.ServiceDelta {
+	delta := &common.ServiceDelta{}
+
+	before := make(map[string]*common.ServiceInfo, len(previous))
+	for _, service := range previous {
+		before[serviceKey(service)] = service
+	}
+
+	seen := make(map[string]bool, len(current))
+	for _, service := range current {
+		seen[serviceKey(service)] = true
+
+		old, existed := before[serviceKey(service)]
+		if !existed {
+			delta.Updated = append(delta.Updated, service)
+			delta.Events = append(delta.Events, &common.ServiceEvent{
+				Type:        common.ServiceEventAdded,
+				Name:        service.Name,
+				ServiceType: service.Type,
+				State:       service.State,
+				Status:      service.Status,
+				Time:        now,
+			})
+			continue
+		}
+		if sameServiceState(old, service) {
+			continue
+		}
+
+		delta.Updated = append(delta.Updated, service)
+		// Un changement de santé seul met à jour l'état connu sans constituer une transition
+		if old.State != service.State || (service.Type != "docker" && old.Status != service.Status) {
+			delta.Events = append(delta.Events, &common.ServiceEvent{
+				Type:           common.ServiceEventStateChanged,
+				Name:           service.Name,
+				ServiceType:    service.Type,
+				State:          service.State,
+				PreviousState:  old.State,
+				Status:         service.Status,
+				PreviousStatus: old.Status,
+				Time:           now,
+			})
+		}
+	}
+
+	for _, service := range previous {
+		if seen[serviceKey(service)] {
+			continue
+		}
+		delta.Removed = append(delta.Removed, common.ServiceRef{Name: service.Name, Type: service.Type})
+		delta.Events = append(delta.Events, &common.ServiceEvent{
+			Type:           common.ServiceEventRemoved,
+			Name:           service.Name,
+			ServiceType:    service.Type,
+			PreviousState:  service.State,
+			PreviousStatus: service.Status,
+			Time:           now,
+		})
+	}
+
+	if len(delta.Updated) == 0 && len(delta.Removed) == 0 {
+		return nil
+	}
+	return delta
+}
+
+// sameServiceState indique si l'état d'un service est inchangé entre deux relevés
+// Le statut d'un conteneur (« Up 3 minutes ») évolue en permanence et n'est pas comparé
+func sameServiceState(old, service *common.ServiceInfo) bool {
+	if old.State != service.State || old.Health != service.Health {
+		return false
+	}
+	return service.Type == "docker" || old.Status == service.Status
+}
+
+// keepUnavailableServices reprend l'état précédent des services dont la source n'a pu être lue
+// afin qu'une erreur passagère de systemctl ou de l'API Docker ne les fasse pas passer pour supprimés
+func keepUnavailableServices(previous, current []*common.ServiceInfo, unavailable map[string]bool) []*common.ServiceInfo {
+	if len(unavailable) == 0 {
+		return current
+	}
+	for _, service := range previous {
+		if unavailable[service.Type] {
+			current = append(current, service)
+		}
+	}
+	return current
+}
+
+// WatchDockerEvents suit les événements des conteneurs et appelle onChange à chaque changement d'état
+// Le flux est rouvert après une interruption, jusqu'à l'annulation du contexte
+// Si le démon n'est pas encore joignable, le suivi commence dès qu'il répond
+func (sm *ServiceManager) WatchDockerEvents(ctx context.Context, onChange func()) {
+	if sm.dockerHost == "" {
+		return
+	}
+
+	waited := false
+	for {
+		docker := sm.dockerClient()
+		if docker == nil {
+			waited = true
+			select {
+			case <-time.After(dockerRetryDelay):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if waited {
+			// Les conteneurs du démon qui vient de répondre sont listés sans attendre le prochain relevé
+			waited = false
+			onChange()
+		}
+
+		err := docker.Events(ctx, func(event dockerEvent) {
+			if dockerStateActions[event.Action] || strings.HasPrefix(event.Action, "health_status") {
+				onChange()
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[SERVICE] Suivi des événements Docker interrompu: %v", err)
+
+		select {
+		case <-time.After(dockerEventRetryDelay):
+			// Des changements ont pu être manqués pendant l'interruption
+			onChange()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
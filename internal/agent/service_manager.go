@@ -1,31 +1,52 @@
 package agent
 
 import (
-	"bytes"
 	"context"
 	"fmt"
 	"log"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 
 	"remoteshell/internal/common"
 )
 
-// ServiceManager gère les services systemd et Docker
+// dockerRetryDelay est le délai minimal entre deux tentatives de connexion à une API Docker injoignable
+const dockerRetryDelay = 30 * time.Second
+
+// ServiceManager gère les services systemd, les conteneurs Docker et les projets Compose
 type ServiceManager struct {
 	hasSystemd bool
-	hasDocker  bool
+	dockerHost string
+
+	// docker reste nil tant que l'API n'a pas répondu; une fois affecté sous dockerMu, il ne change plus
+	// et peut être lu sans verrou après un appel à dockerClient
+	dockerMu      sync.Mutex
+	docker        *DockerClient
+	dockerChecked time.Time // Dernière tentative de connexion
+
+	statsMu    sync.Mutex
+	cpuSamples map[string]dockerCPUStats // dernier échantillon CPU par conteneur
+
+	composeMu       sync.Mutex
+	composeProjects map[string]composeProject // Projets Compose déjà vus, par nom
+	composeOnce     sync.Once
+	composeCmd      []string
 }
 
 // NewServiceManager crée un nouveau gestionnaire de services
-func NewServiceManager() *ServiceManager {
+// dockerHost désigne le socket de l'API Docker Engine (vide = Docker désactivé)
+func NewServiceManager(dockerHost string) *ServiceManager {
 	sm := &ServiceManager{
 		hasSystemd: checkSystemd(),
-		hasDocker:  checkDocker(),
+		dockerHost: dockerHost,
+		cpuSamples: make(map[string]dockerCPUStats),
+
+		composeProjects: make(map[string]composeProject),
 	}
 
-	log.Printf("ServiceManager initialisé - systemd: %v, docker: %v", sm.hasSystemd, sm.hasDocker)
+	log.Printf("ServiceManager initialisé - systemd: %v, docker: %v", sm.hasSystemd, sm.dockerClient() != nil)
 	return sm
 }
 
@@ -36,11 +57,46 @@ func checkSystemd() bool {
 	return err == nil
 }
 
-// checkDocker vérifie si Docker est disponible
-func checkDocker() bool {
-	cmd := exec.Command("docker", "--version")
-	err := cmd.Run()
-	return err == nil
+// connectDocker se connecte à l'API Docker Engine et négocie sa version
+func connectDocker(host string) (*DockerClient, error) {
+	client, err := NewDockerClient(host)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Ping(); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// dockerClient retourne le client de l'API Docker, nil si Docker est désactivé ou injoignable
+// Un démon démarré après l'agent est pris en compte à la tentative suivante, au plus toutes les dockerRetryDelay
+func (sm *ServiceManager) dockerClient() *DockerClient {
+	if sm.dockerHost == "" {
+		return nil
+	}
+
+	sm.dockerMu.Lock()
+	defer sm.dockerMu.Unlock()
+	if sm.docker != nil || time.Since(sm.dockerChecked) < dockerRetryDelay {
+		return sm.docker
+	}
+
+	// Seul le premier échec est journalisé, l'absence de Docker étant un cas normal
+	first := sm.dockerChecked.IsZero()
+	sm.dockerChecked = time.Now()
+	client, err := connectDocker(sm.dockerHost)
+	if err != nil {
+		if first {
+			log.Printf("API Docker non disponible sur %s: %v", sm.dockerHost, err)
+		}
+		return nil
+	}
+	if !first {
+		log.Printf("[DOCKER] API Docker disponible sur %s", sm.dockerHost)
+	}
+	sm.docker = client
+	return client
 }
 
 // ListServices liste tous les services disponibles
@@ -49,7 +105,7 @@ func (sm *ServiceManager) ListServices() ([]*common.ServiceInfo, error) {
 
 	// Lister les services systemd
 	if sm.hasSystemd {
-		systemdServices, err := sm.listSystemdServices()
+		systemdServices, err := sm.listSystemdServices(true)
 		if err != nil {
 			log.Printf("Erreur lors de la liste des services systemd: %v", err)
 		} else {
@@ -57,21 +113,53 @@ func (sm *ServiceManager) ListServices() ([]*common.ServiceInfo, error) {
 		}
 	}
 
-	// Lister les conteneurs Docker
-	if sm.hasDocker {
-		dockerServices, err := sm.listDockerContainers()
+	// Lister les conteneurs Docker, puis les projets Compose qu'ils composent
+	if sm.dockerClient() != nil {
+		dockerServices, err := sm.listDockerContainers(true)
 		if err != nil {
 			log.Printf("Erreur lors de la liste des conteneurs Docker: %v", err)
 		} else {
 			services = append(services, dockerServices...)
+			services = append(services, sm.composeServices(dockerServices)...)
 		}
 	}
 
 	return services, nil
 }
 
+// Snapshot liste l'état courant des services sans les informations coûteuses (activation, consommation)
+// unavailable contient les types de services dont la source n'a pu être lue
+func (sm *ServiceManager) Snapshot() (services []*common.ServiceInfo, unavailable map[string]bool) {
+	unavailable = make(map[string]bool)
+
+	if sm.hasSystemd {
+		systemdServices, err := sm.listSystemdServices(false)
+		if err != nil {
+			log.Printf("Erreur lors de la liste des services systemd: %v", err)
+			unavailable["systemd"] = true
+		} else {
+			services = append(services, systemdServices...)
+		}
+	}
+
+	if sm.dockerClient() != nil {
+		dockerServices, err := sm.listDockerContainers(false)
+		if err != nil {
+			log.Printf("Erreur lors de la liste des conteneurs Docker: %v", err)
+			unavailable["docker"] = true
+			unavailable["compose"] = true
+		} else {
+			services = append(services, dockerServices...)
+			services = append(services, sm.composeServices(dockerServices)...)
+		}
+	}
+
+	return services, unavailable
+}
+
 // listSystemdServices liste les services systemd
-func (sm *ServiceManager) listSystemdServices() ([]*common.ServiceInfo, error) {
+// withEnabled indique s'il faut vérifier l'activation de chaque service (une commande par service)
+func (sm *ServiceManager) listSystemdServices(withEnabled bool) ([]*common.ServiceInfo, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -107,7 +195,7 @@ func (sm *ServiceManager) listSystemdServices() ([]*common.ServiceInfo, error) {
 		}
 
 		// Vérifier si le service est activé
-		enabled := sm.isServiceEnabled(serviceName)
+		enabled := withEnabled && sm.isServiceEnabled(serviceName)
 
 		service := &common.ServiceInfo{
 			Name:        serviceName,
@@ -135,151 +223,19 @@ func (sm *ServiceManager) isServiceEnabled(serviceName string) bool {
 	return status == "enabled"
 }
 
-// listDockerContainers liste les conteneurs Docker
-func (sm *ServiceManager) listDockerContainers() ([]*common.ServiceInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	// Lister tous les conteneurs (running et stopped)
-	cmd := exec.CommandContext(ctx, "docker", "ps", "-a", "--format", "{{.ID}}|{{.Names}}|{{.Status}}|{{.Image}}")
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("échec de la commande docker: %v", err)
-	}
-
-	var services []*common.ServiceInfo
-	lines := strings.Split(string(output), "\n")
-
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-
-		parts := strings.Split(line, "|")
-		if len(parts) < 4 {
-			continue
-		}
-
-		containerID := parts[0]
-		name := parts[1]
-		status := parts[2]
-		image := parts[3]
-
-		// Déterminer l'état
-		state := "inactive"
-		if strings.HasPrefix(status, "Up") {
-			state = "active"
-		} else if strings.HasPrefix(status, "Exited") {
-			state = "inactive"
-		}
-
-		service := &common.ServiceInfo{
-			Name:        name,
-			Type:        "docker",
-			Status:      status,
-			State:       state,
-			Description: fmt.Sprintf("Container: %s", image),
-			ContainerID: containerID,
-			Image:       image,
-		}
-
-		services = append(services, service)
-	}
-
-	return services, nil
-}
-
 // GetServiceStatus obtient le statut d'un service spécifique
 func (sm *ServiceManager) GetServiceStatus(name, serviceType string) (*common.ServiceInfo, error) {
 	if serviceType == "systemd" && sm.hasSystemd {
 		return sm.getSystemdStatus(name)
-	} else if serviceType == "docker" && sm.hasDocker {
+	} else if serviceType == "docker" && sm.dockerClient() != nil {
 		return sm.getDockerStatus(name)
+	} else if serviceType == "compose" && sm.dockerClient() != nil {
+		return sm.getComposeStatus(name)
 	}
 
 	return nil, fmt.Errorf("type de service non supporté ou non disponible: %s", serviceType)
 }
 
-// getSystemdStatus obtient le statut d'un service systemd
-func (sm *ServiceManager) getSystemdStatus(serviceName string) (*common.ServiceInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "systemctl", "show", serviceName, "--no-pager")
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("échec de récupération du statut: %v", err)
-	}
-
-	info := &common.ServiceInfo{
-		Name: serviceName,
-		Type: "systemd",
-	}
-
-	lines := strings.Split(string(output), "\n")
-	for _, line := range lines {
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			continue
-		}
-
-		key := parts[0]
-		value := parts[1]
-
-		switch key {
-		case "ActiveState":
-			info.State = value
-		case "SubState":
-			info.Status = value
-		case "Description":
-			info.Description = value
-		case "UnitFileState":
-			info.Enabled = (value == "enabled")
-		}
-	}
-
-	return info, nil
-}
-
-// getDockerStatus obtient le statut d'un conteneur Docker
-func (sm *ServiceManager) getDockerStatus(containerName string) (*common.ServiceInfo, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	cmd := exec.CommandContext(ctx, "docker", "inspect", "--format", "{{.Id}}|{{.Name}}|{{.State.Status}}|{{.Config.Image}}", containerName)
-	output, err := cmd.Output()
-	if err != nil {
-		return nil, fmt.Errorf("échec de récupération du statut: %v", err)
-	}
-
-	line := strings.TrimSpace(string(output))
-	parts := strings.Split(line, "|")
-	if len(parts) < 4 {
-		return nil, fmt.Errorf("format de sortie invalide")
-	}
-
-	containerID := parts[0]
-	name := strings.TrimPrefix(parts[1], "/")
-	status := parts[2]
-	image := parts[3]
-
-	state := "inactive"
-	if status == "running" {
-		state = "active"
-	}
-
-	return &common.ServiceInfo{
-		Name:        name,
-		Type:        "docker",
-		Status:      status,
-		State:       state,
-		Description: fmt.Sprintf("Container: %s", image),
-		ContainerID: containerID,
-		Image:       image,
-	}, nil
-}
-
 // ExecuteAction exécute une action sur un service
 func (sm *ServiceManager) ExecuteAction(action *common.ServiceAction) (*common.ServiceResult, error) {
 	result := &common.ServiceResult{
@@ -289,7 +245,16 @@ func (sm *ServiceManager) ExecuteAction(action *common.ServiceAction) (*common.S
 	}
 
 	if action.Type == "systemd" && sm.hasSystemd {
-		err := sm.executeSystemdAction(action)
+		err := sm.executeSystemdAction(action, result)
+		if err != nil {
+			result.Success = false
+			result.Message = err.Error()
+		} else {
+			result.Success = true
+			result.Message = fmt.Sprintf("Action '%s' exécutée avec succès", action.Action)
+		}
+	} else if action.Type == "docker" && sm.dockerClient() != nil {
+		err := sm.executeDockerAction(action, result)
 		if err != nil {
 			result.Success = false
 			result.Message = err.Error()
@@ -297,8 +262,8 @@ func (sm *ServiceManager) ExecuteAction(action *common.ServiceAction) (*common.S
 			result.Success = true
 			result.Message = fmt.Sprintf("Action '%s' exécutée avec succès", action.Action)
 		}
-	} else if action.Type == "docker" && sm.hasDocker {
-		err := sm.executeDockerAction(action)
+	} else if action.Type == "compose" && sm.dockerClient() != nil {
+		err := sm.executeComposeAction(action, result)
 		if err != nil {
 			result.Success = false
 			result.Message = err.Error()
@@ -313,63 +278,3 @@ func (sm *ServiceManager) ExecuteAction(action *common.ServiceAction) (*common.S
 
 	return result, nil
 }
-
-// executeSystemdAction exécute une action systemd
-func (sm *ServiceManager) executeSystemdAction(action *common.ServiceAction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	var cmd *exec.Cmd
-
-	switch action.Action {
-	case "start":
-		cmd = exec.CommandContext(ctx, "systemctl", "start", action.Name)
-	case "stop":
-		cmd = exec.CommandContext(ctx, "systemctl", "stop", action.Name)
-	case "restart":
-		cmd = exec.CommandContext(ctx, "systemctl", "restart", action.Name)
-	case "enable":
-		cmd = exec.CommandContext(ctx, "systemctl", "enable", action.Name)
-	case "disable":
-		cmd = exec.CommandContext(ctx, "systemctl", "disable", action.Name)
-	default:
-		return fmt.Errorf("action non supportée: %s", action.Action)
-	}
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("échec de l'action: %v - %s", err, stderr.String())
-	}
-
-	return nil
-}
-
-// executeDockerAction exécute une action Docker
-func (sm *ServiceManager) executeDockerAction(action *common.ServiceAction) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	var cmd *exec.Cmd
-
-	switch action.Action {
-	case "start":
-		cmd = exec.CommandContext(ctx, "docker", "start", action.Name)
-	case "stop":
-		cmd = exec.CommandContext(ctx, "docker", "stop", action.Name)
-	case "restart":
-		cmd = exec.CommandContext(ctx, "docker", "restart", action.Name)
-	default:
-		return fmt.Errorf("action non supportée pour Docker: %s", action.Action)
-	}
-
-	var stderr bytes.Buffer
-	cmd.Stderr = &stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("échec de l'action: %v - %s", err, stderr.String())
-	}
-
-	return nil
-}
@@ -0,0 +1,255 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// systemdAdminDir contient les unités et surcharges créées par l'administrateur
+const systemdAdminDir = "/etc/systemd/system"
+
+// defaultSystemdDropIn est le fichier de surcharge utilisé par défaut, comme systemctl edit
+const defaultSystemdDropIn = "override.conf"
+
+// systemdTimestampLayout est le format des horodatages de systemctl show ("Tue 2024-01-02 03:04:05 CET")
+const systemdTimestampLayout = "Mon 2006-01-02 15:04:05 MST"
+
+// systemdUnitProperties liste les propriétés lues par la demande de statut
+var systemdUnitProperties = []string{
+	"Id", "Description", "LoadState", "ActiveState", "SubState", "UnitFileState", "FragmentPath", "DropInPaths",
+	"MainPID", "TasksCurrent", "MemoryCurrent", "CPUUsageNSec", "NRestarts", "Result",
+	"ExecMainCode", "ExecMainStatus", "ExecMainStartTimestamp", "ExecMainExitTimestamp",
+	"ActiveEnterTimestamp", "ActiveExitTimestamp", "InactiveEnterTimestamp", "StateChangeTimestamp",
+	"Requires", "Wants", "RequiredBy", "WantedBy", "After", "Before", "Conflicts",
+}
+
+// systemdExitCodes traduit ExecMainCode (codes CLD_* de waitid)
+var systemdExitCodes = map[string]string{"1": "exited", "2": "killed", "3": "dumped"}
+
+// getSystemdStatus obtient l'état détaillé d'un service systemd
+func (sm *ServiceManager) getSystemdStatus(serviceName string) (*common.ServiceInfo, error) {
+	properties, err := systemdShow(serviceName, systemdUnitProperties...)
+	if err != nil {
+		return nil, fmt.Errorf("échec de récupération du statut: %v", err)
+	}
+	if properties["LoadState"] == "not-found" {
+		return nil, fmt.Errorf("unité introuvable: %s", serviceName)
+	}
+
+	unit := &common.SystemdUnitDetails{
+		LoadState:     properties["LoadState"],
+		UnitFileState: properties["UnitFileState"],
+		FragmentPath:  properties["FragmentPath"],
+		DropInPaths:   strings.Fields(properties["DropInPaths"]),
+		Tasks:         systemdCounter(properties["TasksCurrent"]),
+		MemoryCurrent: systemdCounter(properties["MemoryCurrent"]),
+		CPUUsage:      systemdCounter(properties["CPUUsageNSec"]),
+		Result:        properties["Result"],
+		ExitCode:      systemdExitCodes[properties["ExecMainCode"]],
+
+		StartedAt:       systemdTimestamp(properties["ExecMainStartTimestamp"]),
+		ExitedAt:        systemdTimestamp(properties["ExecMainExitTimestamp"]),
+		ActiveEnterAt:   systemdTimestamp(properties["ActiveEnterTimestamp"]),
+		ActiveExitAt:    systemdTimestamp(properties["ActiveExitTimestamp"]),
+		InactiveEnterAt: systemdTimestamp(properties["InactiveEnterTimestamp"]),
+		StateChangeAt:   systemdTimestamp(properties["StateChangeTimestamp"]),
+
+		Requires:   strings.Fields(properties["Requires"]),
+		Wants:      strings.Fields(properties["Wants"]),
+		RequiredBy: strings.Fields(properties["RequiredBy"]),
+		WantedBy:   strings.Fields(properties["WantedBy"]),
+		After:      strings.Fields(properties["After"]),
+		Before:     strings.Fields(properties["Before"]),
+		Conflicts:  strings.Fields(properties["Conflicts"]),
+	}
+	unit.MainPID, _ = strconv.Atoi(properties["MainPID"])
+	unit.Restarts, _ = strconv.Atoi(properties["NRestarts"])
+	unit.ExitStatus, _ = strconv.Atoi(properties["ExecMainStatus"])
+
+	name := properties["Id"]
+	if name == "" {
+		name = serviceName
+	}
+	return &common.ServiceInfo{
+		Name:        name,
+		Type:        "systemd",
+		State:       properties["ActiveState"],
+		Status:      properties["SubState"],
+		Description: properties["Description"],
+		Enabled:     properties["UnitFileState"] == "enabled",
+		Unit:        unit,
+	}, nil
+}
+
+// executeSystemdAction exécute une action systemd et complète le résultat (contenu de l'unité, surcharge écrite)
+func (sm *ServiceManager) executeSystemdAction(action *common.ServiceAction, result *common.ServiceResult) error {
+	switch action.Action {
+	case "start", "stop", "restart", "reload", "enable", "disable", "mask", "unmask", "reset-failed":
+		_, err := runSystemctl(30*time.Second, action.Action, action.Name)
+		return err
+	case "cat":
+		output, err := runSystemctl(10*time.Second, "cat", "--no-pager", action.Name)
+		result.Output = output
+		return err
+	case "edit":
+		path, err := editSystemdDropIn(action.Name, action.Options)
+		result.Output = path
+		return err
+	}
+	return fmt.Errorf("action non supportée: %s", action.Action)
+}
+
+// editSystemdDropIn écrit ou supprime une surcharge de l'unité puis recharge systemd
+// La surcharge précédente est restaurée si systemd ne peut plus charger l'unité
+func editSystemdDropIn(serviceName string, options *common.ServiceActionOptions) (string, error) {
+	if options == nil {
+		options = &common.ServiceActionOptions{}
+	}
+	dropIn := options.DropIn
+	if dropIn == "" {
+		dropIn = defaultSystemdDropIn
+	}
+
+	// Le nom complet de l'unité (avec son suffixe) détermine le répertoire des surcharges
+	properties, err := systemdShow(serviceName, "Id", "LoadState")
+	if err != nil {
+		return "", err
+	}
+	switch properties["LoadState"] {
+	case "not-found":
+		return "", fmt.Errorf("unité introuvable: %s", serviceName)
+	case "masked":
+		return "", fmt.Errorf("unité masquée: %s", serviceName)
+	}
+
+	dir := filepath.Join(systemdAdminDir, properties["Id"]+".d")
+	path := filepath.Join(dir, dropIn)
+	previous, readErr := os.ReadFile(path)
+	existed := readErr == nil
+
+	if options.Content == "" {
+		if !existed {
+			return path, fmt.Errorf("aucune surcharge %s", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return path, err
+		}
+		// Le répertoire n'est supprimé que s'il est vide
+		os.Remove(dir)
+	} else {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return path, err
+		}
+		content := options.Content
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if err := writeFileAtomic(path, []byte(content), 0644); err != nil {
+			return path, err
+		}
+	}
+
+	if _, err := runSystemctl(30*time.Second, "daemon-reload"); err != nil {
+		return path, err
+	}
+
+	properties, err = systemdShow(serviceName, "LoadState", "LoadError")
+	if err != nil || (properties["LoadState"] != "bad-setting" && properties["LoadState"] != "error") {
+		return path, err
+	}
+
+	// Restaurer l'état précédent pour ne pas laisser une unité inutilisable
+	log.Printf("[SYSTEMD] Surcharge %s refusée (%s), restauration", path, properties["LoadError"])
+	if existed {
+		writeFileAtomic(path, previous, 0644)
+	} else {
+		os.Remove(path)
+		os.Remove(dir)
+	}
+	runSystemctl(30*time.Second, "daemon-reload")
+	return path, fmt.Errorf("surcharge refusée par systemd (%s): %s", properties["LoadState"], properties["LoadError"])
+}
+
+// systemdShow lit des propriétés d'une unité avec systemctl show
+func systemdShow(serviceName string, properties ...string) (map[string]string, error) {
+	output, err := runSystemctl(10*time.Second, "show", serviceName, "--no-pager", "--property="+strings.Join(properties, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(properties))
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, ok := strings.Cut(line, "="); ok {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// runSystemctl exécute systemctl et retourne sa sortie standard
+func runSystemctl(timeout time.Duration, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "systemctl", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return stdout.String(), fmt.Errorf("échec de l'action: %v - %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), nil
+}
+
+// writeFileAtomic écrit un fichier via un fichier temporaire renommé, pour ne jamais laisser de surcharge tronquée
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// systemdCounter lit un compteur systemd ("[not set]" ou UINT64_MAX sans comptabilité)
+func systemdCounter(value string) uint64 {
+	counter, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || counter == ^uint64(0) {
+		return 0
+	}
+	return counter
+}
+
+// systemdTimestamp lit un horodatage de systemctl show, exprimé dans le fuseau de l'hôte
+func systemdTimestamp(value string) *time.Time {
+	if value == "" || value == "n/a" {
+		return nil
+	}
+	t, err := time.ParseInLocation(systemdTimestampLayout, value, time.Local)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
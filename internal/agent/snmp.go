@@ -0,0 +1,230 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Étiquettes BER utilisées par SNMPv1
+const (
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berNull        = 0x05
+	berOID         = 0x06
+	berSequence    = 0x30
+	snmpGetRequest = 0xa0
+	snmpGetResp    = 0xa2
+)
+
+// snmpVarBind contient une variable retournée par un agent SNMP
+// Les chaînes et les OID sont retournés sous forme de texte, les entiers en décimal
+type snmpVarBind struct {
+	OID   string
+	Value string
+}
+
+// snmpResponse contient une réponse SNMPv1 décodée
+type snmpResponse struct {
+	RequestID   int
+	ErrorStatus int
+	VarBinds    []snmpVarBind
+}
+
+// encodeSNMPGet encode une requête SNMPv1 GetRequest portant sur les OID donnés
+func encodeSNMPGet(community string, requestID int, oids []string) ([]byte, error) {
+	var varBinds []byte
+	for _, oid := range oids {
+		encoded, err := berEncodeOID(oid)
+		if err != nil {
+			return nil, err
+		}
+		varBinds = append(varBinds, berTLV(berSequence, append(berTLV(berOID, encoded), berNull, 0))...)
+	}
+
+	pdu := berTLV(berInteger, berEncodeInt(requestID))
+	pdu = append(pdu, berTLV(berInteger, berEncodeInt(0))...) // error-status
+	pdu = append(pdu, berTLV(berInteger, berEncodeInt(0))...) // error-index
+	pdu = append(pdu, berTLV(berSequence, varBinds)...)
+
+	message := berTLV(berInteger, berEncodeInt(0)) // version 1
+	message = append(message, berTLV(berOctetString, []byte(community))...)
+	message = append(message, berTLV(snmpGetRequest, pdu)...)
+	return berTLV(berSequence, message), nil
+}
+
+// decodeSNMPResponse décode une réponse SNMPv1 GetResponse
+func decodeSNMPResponse(data []byte) (*snmpResponse, error) {
+	tag, message, _, err := berRead(data)
+	if err != nil || tag != berSequence {
+		return nil, errors.New("message SNMP invalide")
+	}
+
+	// Version et communauté
+	for i := 0; i < 2; i++ {
+		if _, _, message, err = berRead(message); err != nil {
+			return nil, err
+		}
+	}
+
+	tag, pdu, _, err := berRead(message)
+	if err != nil {
+		return nil, err
+	}
+	if tag != snmpGetResp {
+		return nil, fmt.Errorf("PDU SNMP inattendue: 0x%02x", tag)
+	}
+
+	var fields [3]int
+	for i := range fields {
+		var content []byte
+		if tag, content, pdu, err = berRead(pdu); err != nil {
+			return nil, err
+		}
+		if tag != berInteger {
+			return nil, errors.New("en-tête de PDU SNMP invalide")
+		}
+		fields[i] = berDecodeInt(content)
+	}
+	response := &snmpResponse{RequestID: fields[0], ErrorStatus: fields[1]}
+
+	tag, list, _, err := berRead(pdu)
+	if err != nil || tag != berSequence {
+		return nil, errors.New("liste de variables SNMP invalide")
+	}
+	for len(list) > 0 {
+		var varBind []byte
+		if _, varBind, list, err = berRead(list); err != nil {
+			return nil, err
+		}
+		_, name, rest, err := berRead(varBind)
+		if err != nil {
+			return nil, err
+		}
+		valueTag, value, _, err := berRead(rest)
+		if err != nil {
+			return nil, err
+		}
+
+		bind := snmpVarBind{OID: berDecodeOID(name)}
+		switch valueTag {
+		case berOctetString:
+			bind.Value = strings.TrimRight(string(value), "\x00")
+		case berOID:
+			bind.Value = berDecodeOID(value)
+		case berInteger:
+			bind.Value = strconv.Itoa(berDecodeInt(value))
+		}
+		response.VarBinds = append(response.VarBinds, bind)
+	}
+	return response, nil
+}
+
+// berTLV encode un élément BER (étiquette, longueur, contenu)
+func berTLV(tag byte, content []byte) []byte {
+	length := len(content)
+	encoded := []byte{tag}
+	switch {
+	case length < 0x80:
+		encoded = append(encoded, byte(length))
+	case length <= 0xff:
+		encoded = append(encoded, 0x81, byte(length))
+	default:
+		encoded = append(encoded, 0x82, byte(length>>8), byte(length))
+	}
+	return append(encoded, content...)
+}
+
+// berRead lit un élément BER et retourne son étiquette, son contenu et les données restantes
+func berRead(data []byte) (byte, []byte, []byte, error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("élément BER tronqué")
+	}
+	tag, length, offset := data[0], int(data[1]), 2
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 3 || len(data) < 2+size {
+			return 0, nil, nil, errors.New("longueur BER invalide")
+		}
+		length = 0
+		for _, b := range data[2 : 2+size] {
+			length = length<<8 | int(b)
+		}
+		offset += size
+	}
+	if len(data) < offset+length {
+		return 0, nil, nil, errors.New("élément BER tronqué")
+	}
+	return tag, data[offset : offset+length], data[offset+length:], nil
+}
+
+// berEncodeInt encode un entier en complément à deux sur le nombre minimal d'octets
+func berEncodeInt(value int) []byte {
+	encoded := []byte{byte(value)}
+	for value > 0x7f || value < -0x80 {
+		value >>= 8
+		encoded = append([]byte{byte(value)}, encoded...)
+	}
+	return encoded
+}
+
+// berDecodeInt décode un entier en complément à deux
+func berDecodeInt(content []byte) int {
+	value := 0
+	for i, b := range content {
+		if i == 0 && b&0x80 != 0 {
+			value = -1
+		}
+		value = value<<8 | int(b)
+	}
+	return value
+}
+
+// berEncodeOID encode un OID en notation pointée
+func berEncodeOID(oid string) ([]byte, error) {
+	parts := strings.Split(oid, ".")
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("OID invalide: %s", oid)
+	}
+	arcs := make([]int, len(parts))
+	for i, part := range parts {
+		arc, err := strconv.Atoi(part)
+		if err != nil || arc < 0 {
+			return nil, fmt.Errorf("OID invalide: %s", oid)
+		}
+		arcs[i] = arc
+	}
+
+	encoded := []byte{byte(arcs[0]*40 + arcs[1])}
+	for _, arc := range arcs[2:] {
+		chunk := []byte{byte(arc & 0x7f)}
+		for arc >>= 7; arc > 0; arc >>= 7 {
+			chunk = append([]byte{byte(arc&0x7f) | 0x80}, chunk...)
+		}
+		encoded = append(encoded, chunk...)
+	}
+	return encoded, nil
+}
+
+// berDecodeOID décode un OID en notation pointée
+func berDecodeOID(content []byte) string {
+	if len(content) == 0 {
+		return ""
+	}
+	first := int(content[0])
+	arcs := []string{strconv.Itoa(first / 40), strconv.Itoa(first % 40)}
+	if first >= 80 {
+		arcs = []string{"2", strconv.Itoa(first - 80)}
+	}
+
+	arc := 0
+	for _, b := range content[1:] {
+		arc = arc<<7 | int(b&0x7f)
+		if b&0x80 == 0 {
+			arcs = append(arcs, strconv.Itoa(arc))
+			arc = 0
+		}
+	}
+	return strings.Join(arcs, ".")
+}
@@ -0,0 +1,23 @@
+package agent
+
+import (
+	"os"
+	"runtime"
+
+	"remoteshell/internal/common"
+)
+
+// CollectSystemInfo collecte les informations système de la machine
+// Les valeurs indisponibles sur la plateforme restent à zéro
+func CollectSystemInfo() *common.SystemInfo {
+	hostname, _ := os.Hostname()
+
+	info := &common.SystemInfo{
+		Hostname: hostname,
+		OS:       runtime.GOOS,
+		Arch:     runtime.GOARCH,
+	}
+
+	collectPlatformSystemInfo(info)
+	return info
+}
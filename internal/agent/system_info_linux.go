@@ -0,0 +1,85 @@
+//go:build linux
+
+package agent
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"remoteshell/internal/common"
+)
+
+// collectPlatformSystemInfo complète les informations système depuis /proc et statfs
+func collectPlatformSystemInfo(info *common.SystemInfo) {
+	// Uptime en secondes (premier champ de /proc/uptime)
+	if data, err := os.ReadFile("/proc/uptime"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 0 {
+			if uptime, err := strconv.ParseFloat(fields[0], 64); err == nil {
+				info.Uptime = int64(uptime)
+			}
+		}
+	}
+
+	// Charge moyenne sur 1, 5 et 15 minutes
+	if data, err := os.ReadFile("/proc/loadavg"); err == nil {
+		fields := strings.Fields(string(data))
+		for i := 0; i < 3 && i < len(fields); i++ {
+			if load, err := strconv.ParseFloat(fields[i], 64); err == nil {
+				info.LoadAvg = append(info.LoadAvg, load)
+			}
+		}
+	}
+
+	// Mémoire: la mémoire utilisée exclut les caches récupérables (MemAvailable)
+	if meminfo, err := readMeminfo(); err == nil {
+		info.MemoryTotal = meminfo["MemTotal"]
+		if available, ok := meminfo["MemAvailable"]; ok {
+			info.MemoryUsed = meminfo["MemTotal"] - available
+		} else {
+			info.MemoryUsed = meminfo["MemTotal"] - meminfo["MemFree"] - meminfo["Buffers"] - meminfo["Cached"]
+		}
+	}
+
+	// Disque de la partition racine
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs("/", &stat); err == nil {
+		blockSize := int64(stat.Bsize)
+		info.DiskTotal = int64(stat.Blocks) * blockSize
+		info.DiskUsed = (int64(stat.Blocks) - int64(stat.Bfree)) * blockSize
+	}
+}
+
+// readMeminfo lit /proc/meminfo et retourne les valeurs en octets
+func readMeminfo() (map[string]int64, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	values := make(map[string]int64)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// Format: "MemTotal:       16318480 kB"
+		name, rest, found := strings.Cut(scanner.Text(), ":")
+		if !found {
+			continue
+		}
+		fields := strings.Fields(rest)
+		if len(fields) == 0 {
+			continue
+		}
+		value, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			value *= 1024
+		}
+		values[name] = value
+	}
+	return values, scanner.Err()
+}
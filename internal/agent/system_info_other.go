@@ -0,0 +1,8 @@
+//go:build !linux
+
+package agent
+
+import "remoteshell/internal/common"
+
+// collectPlatformSystemInfo ne collecte que les informations de base hors Linux
+func collectPlatformSystemInfo(info *common.SystemInfo) {}
@@ -20,6 +20,13 @@ type Config struct {
 	AgentName     string
 	ReconnectDelay time.Duration
 	HeartbeatInterval time.Duration
+	SystemInfoInterval  time.Duration // Intervalle d'envoi des informations système
+	MetricsInterval     time.Duration // Intervalle d'échantillonnage des métriques (0 = désactivé)
+	InventoryInterval   time.Duration // Intervalle de vérification des changements d'inventaire (0 = envoi à la connexion uniquement)
+	PrinterPollInterval time.Duration // Intervalle de vérification de l'état des imprimantes, seuls les changements sont envoyés
+	CUPSURL             string        // Serveur CUPS interrogé en IPP pour l'état des imprimantes (vide = lpstat uniquement)
+	DockerHost          string        // Socket de l'API Docker Engine (unix:///chemin ou tcp://hôte:port, vide = Docker désactivé)
+	ServicePollInterval time.Duration // Intervalle de vérification de l'état des services, seuls les changements sont envoyés
 
 	// Configuration authentification
 	AuthToken string
@@ -46,8 +53,20 @@ type Config struct {
 	MySQLEnabled  bool
 
 	// Configuration logs
-	LogLevel string
-	LogFile  string
+	LogLevel      string
+	LogFile       string
+	LogMaxSizeMB  int // Taille maximale du fichier de log avant rotation
+	LogMaxBackups int // Nombre d'anciens fichiers de log conservés
+
+	// Configuration de l'expédition centralisée des logs
+	LogShipSources   string        // Sources expédiées, séparées par des virgules (ex: agent,systemd:nginx.service,/var/log/syslog)
+	LogShipInterval  time.Duration // Intervalle d'envoi des lots
+	LogRetentionDays int           // Durée de rétention des logs centralisés côté serveur
+	LogSourcesFile   string        // Fichier JSON des sources de logs configurées sur l'agent
+
+	// Configuration de l'exposition Prometheus
+	MetricsToken  string // Jeton Bearer exigé sur /metrics (vide = exposition désactivée, sauf MetricsPublic)
+	MetricsPublic bool   // Expose /metrics sans jeton (à réserver à un réseau de supervision isolé)
 
 	// Configuration fichiers
 	MaxFileSize int64
@@ -62,8 +81,19 @@ func DefaultConfig() *Config {
 		ServerTLS:         false,
 		ReconnectDelay:    5 * time.Second,
 		HeartbeatInterval: 30 * time.Second,
+		SystemInfoInterval:  60 * time.Second,
+		MetricsInterval:     15 * time.Second,
+		InventoryInterval:   time.Hour,
+		PrinterPollInterval: 10 * time.Second,
+		CUPSURL:             "http://localhost:631",
+		DockerHost:          "unix:///var/run/docker.sock",
+		ServicePollInterval: 15 * time.Second,
 		DatabasePath:      "remoteshell.db",
 		LogLevel:          "info",
+		LogMaxSizeMB:      10,
+		LogMaxBackups:     5,
+		LogShipInterval:   10 * time.Second,
+		LogRetentionDays:  30,
 		MaxFileSize:       100 * 1024 * 1024, // 100MB
 		ChunkSize:         64 * 1024,         // 64KB
 		AuthToken:         "default-secret-key-change-in-production-12345", // Clé par défaut
@@ -131,6 +161,38 @@ func (c *Config) LoadFromEnv() {
 	if logFile := os.Getenv("REMOTESHELL_LOG_FILE"); logFile != "" {
 		c.LogFile = logFile
 	}
+	if maxSize := os.Getenv("REMOTESHELL_LOG_MAX_SIZE_MB"); maxSize != "" {
+		if size, err := strconv.Atoi(maxSize); err == nil {
+			c.LogMaxSizeMB = size
+		}
+	}
+	if maxBackups := os.Getenv("REMOTESHELL_LOG_MAX_BACKUPS"); maxBackups != "" {
+		if backups, err := strconv.Atoi(maxBackups); err == nil {
+			c.LogMaxBackups = backups
+		}
+	}
+	if shipSources := os.Getenv("REMOTESHELL_LOG_SHIP_SOURCES"); shipSources != "" {
+		c.LogShipSources = shipSources
+	}
+	if shipInterval := os.Getenv("REMOTESHELL_LOG_SHIP_INTERVAL"); shipInterval != "" {
+		if d, err := time.ParseDuration(shipInterval); err == nil {
+			c.LogShipInterval = d
+		}
+	}
+	if retention := os.Getenv("REMOTESHELL_LOG_RETENTION_DAYS"); retention != "" {
+		if days, err := strconv.Atoi(retention); err == nil {
+			c.LogRetentionDays = days
+		}
+	}
+	if sourcesFile := os.Getenv("REMOTESHELL_LOG_SOURCES_FILE"); sourcesFile != "" {
+		c.LogSourcesFile = sourcesFile
+	}
+	if metricsToken := os.Getenv("REMOTESHELL_METRICS_TOKEN"); metricsToken != "" {
+		c.MetricsToken = metricsToken
+	}
+	if public := os.Getenv("REMOTESHELL_METRICS_PUBLIC"); public == "true" {
+		c.MetricsPublic = true
+	}
 	if reconnectDelay := os.Getenv("REMOTESHELL_RECONNECT_DELAY"); reconnectDelay != "" {
 		if d, err := time.ParseDuration(reconnectDelay); err == nil {
 			c.ReconnectDelay = d
@@ -141,6 +203,37 @@ func (c *Config) LoadFromEnv() {
 			c.HeartbeatInterval = d
 		}
 	}
+	if systemInfoInterval := os.Getenv("REMOTESHELL_SYSTEM_INFO_INTERVAL"); systemInfoInterval != "" {
+		if d, err := time.ParseDuration(systemInfoInterval); err == nil {
+			c.SystemInfoInterval = d
+		}
+	}
+	if metricsInterval := os.Getenv("REMOTESHELL_METRICS_INTERVAL"); metricsInterval != "" {
+		if d, err := time.ParseDuration(metricsInterval); err == nil {
+			c.MetricsInterval = d
+		}
+	}
+	if inventoryInterval := os.Getenv("REMOTESHELL_INVENTORY_INTERVAL"); inventoryInterval != "" {
+		if d, err := time.ParseDuration(inventoryInterval); err == nil {
+			c.InventoryInterval = d
+		}
+	}
+	if printerPollInterval := os.Getenv("REMOTESHELL_PRINTER_POLL_INTERVAL"); printerPollInterval != "" {
+		if d, err := time.ParseDuration(printerPollInterval); err == nil && d > 0 {
+			c.PrinterPollInterval = d
+		}
+	}
+	if cupsURL, ok := os.LookupEnv("REMOTESHELL_CUPS_URL"); ok {
+		c.CUPSURL = cupsURL
+	}
+	if dockerHost, ok := os.LookupEnv("REMOTESHELL_DOCKER_HOST"); ok {
+		c.DockerHost = dockerHost
+	}
+	if servicePollInterval := os.Getenv("REMOTESHELL_SERVICE_POLL_INTERVAL"); servicePollInterval != "" {
+		if d, err := time.ParseDuration(servicePollInterval); err == nil && d > 0 {
+			c.ServicePollInterval = d
+		}
+	}
 	if maxFileSize := os.Getenv("REMOTESHELL_MAX_FILE_SIZE"); maxFileSize != "" {
 		if size, err := strconv.ParseInt(maxFileSize, 10, 64); err == nil {
 			c.MaxFileSize = size
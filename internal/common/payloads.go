@@ -0,0 +1,482 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// PayloadDirection indique le sens de circulation d'un message
+// Un même type de message transporte une demande dans un sens et une réponse dans l'autre
+type PayloadDirection int
+
+const (
+	ToAgent  PayloadDirection = iota // Messages reçus par l'agent
+	ToServer                         // Messages reçus par le serveur (agents et clients web)
+)
+
+// ErrorCodeInvalidPayload est le code d'erreur renvoyé à l'émetteur de données invalides
+const ErrorCodeInvalidPayload = "INVALID_PAYLOAD"
+
+// PayloadValidator est implémenté par les données capables de vérifier leur cohérence
+type PayloadValidator interface {
+	Validate() error
+}
+
+// PayloadError signale des données de message illisibles ou invalides
+type PayloadError struct {
+	Type MessageType
+	Err  error
+}
+
+func (e *PayloadError) Error() string {
+	return fmt.Sprintf("données invalides pour le message %s: %v", e.Type, e.Err)
+}
+
+func (e *PayloadError) Unwrap() error {
+	return e.Err
+}
+
+// printMediaPattern valide le nom d'un format de papier (A4, Letter, iso_a4_210x297mm...)
+var printMediaPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// printPageRangesPattern valide une liste de pages à imprimer (1-3,5)
+var printPageRangesPattern = regexp.MustCompile(`^[1-9][0-9]*(-[1-9][0-9]*)?(,[1-9][0-9]*(-[1-9][0-9]*)?)*$`)
+
+// maxPrintCopies borne le nombre d'exemplaires d'une impression à distance
+const maxPrintCopies = 100
+
+// maxServiceLogTail borne le nombre de lignes de logs d'un conteneur retournées en une fois
+const maxServiceLogTail = 10000
+
+// containerImagePattern valide une référence d'image Docker (nginx, registry:5000/app:1.2, app@sha256:...)
+var containerImagePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/:@-]*$`)
+
+// systemdUnitPattern valide un nom d'unité systemd (les caractères spéciaux sont échappés en \xNN)
+var systemdUnitPattern = regexp.MustCompile(`^[A-Za-z0-9:_.@\\][A-Za-z0-9:_.@\\-]*$`)
+
+// systemdDropInPattern valide le nom d'un fichier de surcharge d'une unité
+var systemdDropInPattern = regexp.MustCompile(`^[A-Za-z0-9_@-][A-Za-z0-9_.@-]*\.conf$`)
+
+// maxSystemdDropInSize borne la taille d'un fichier de surcharge
+const maxSystemdDropInSize = 64 * 1024
+
+// composeProjectPattern valide un nom de projet Docker Compose
+var composeProjectPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// maxPrinterDiscoveryTimeout borne la durée d'écoute d'une découverte d'imprimantes, en secondes
+const maxPrinterDiscoveryTimeout = 30
+
+// printerQueueNamePattern valide le nom d'une file CUPS (127 caractères au plus, sans espace, / ni #)
+var printerQueueNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.@+-]{0,126}$`)
+
+// printerDeviceURIPattern valide l'URI d'un périphérique d'impression (ipp://..., socket://..., usb://...)
+var printerDeviceURIPattern = regexp.MustCompile(`^[a-z][a-z0-9+.-]*:[^\s]+$`)
+
+// printerDriverPattern valide le nom d'un pilote tel que listé par lpinfo -m
+var printerDriverPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/+@=%-]*$`)
+
+// printerOptionPattern valide le nom d'une option de file (media-default, PageSize...)
+var printerOptionPattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// payloadOf retourne le type reflect de T
+func payloadOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// payloadTypes associe chaque type de message au type de ses données, selon le sens de circulation
+// Une entrée nil indique un message sans données
+var payloadTypes = map[PayloadDirection]map[MessageType]reflect.Type{
+	ToAgent: {
+		MessageTypeAuthSuccess:       nil,
+		MessageTypeAuthError:         payloadOf[ErrorData](),
+		MessageTypeCommand:           payloadOf[CommandData](),
+		MessageTypeCommandExec:       payloadOf[CommandData](),
+		MessageTypeFileUpload:        payloadOf[[]*FileChunk](),
+		MessageTypeFileDownload:      payloadOf[FileData](),
+		MessageTypeFileList:          payloadOf[FileData](),
+		MessageTypeFileDelete:        payloadOf[FileData](),
+		MessageTypeFileCreateDir:     payloadOf[FileData](),
+		MessageTypeServiceList:       nil,
+		MessageTypeServiceStatus:     payloadOf[ServiceInfo](),
+		MessageTypeServiceAction:     payloadOf[ServiceAction](),
+		MessageTypeLogList:           nil,
+		MessageTypeLogContent:        payloadOf[LogRequest](),
+		MessageTypeLogExport:         payloadOf[LogExportRequest](),
+		MessageTypeProcessList:       payloadOf[ProcessListRequest](),
+		MessageTypeProcessSignal:     payloadOf[ProcessSignalRequest](),
+		MessageTypeNetworkDiagnostic: payloadOf[NetworkDiagnosticRequest](),
+		MessageTypePackageAction:     payloadOf[PackageActionRequest](),
+		MessageTypePrinterAction:     payloadOf[PrinterActionRequest](),
+		MessageTypePrintSubmit:       payloadOf[PrintSubmitRequest](),
+		MessageTypePrinterDiscover:   payloadOf[PrinterDiscoveryRequest](),
+		MessageTypePrinterDrivers:    payloadOf[PrinterDriverRequest](),
+		MessageTypePrinterQueue:      payloadOf[PrinterQueueRequest](),
+		MessageTypeHeartbeat:         nil,
+		MessageTypeError:             payloadOf[ErrorData](),
+	},
+	ToServer: {
+		MessageTypeAuth:              payloadOf[AuthData](),
+		MessageTypeCommand:           payloadOf[CommandData](),
+		MessageTypeCommandDone:       payloadOf[CommandOutput](),
+		MessageTypeFileList:          payloadOf[[]*FileData](),
+		MessageTypeFileChunk:         payloadOf[FileChunk](),
+		MessageTypeFileComplete:      payloadOf[FileData](),
+		MessageTypeFileError:         payloadOf[ErrorData](),
+		MessageTypePrinterStatus:     payloadOf[[]*PrinterInfo](),
+		MessageTypePrinterEvents:     payloadOf[PrinterDelta](),
+		MessageTypePrinterResult:     payloadOf[PrinterActionResult](),
+		MessageTypePrinterDiscover:   payloadOf[PrinterDiscoveryResult](),
+		MessageTypePrinterDrivers:    payloadOf[PrinterDriverList](),
+		MessageTypeSystemInfo:        payloadOf[SystemInfo](),
+		MessageTypeMetrics:           payloadOf[MetricsSample](),
+		MessageTypeInventory:         payloadOf[Inventory](),
+		MessageTypeHeartbeat:         nil,
+		MessageTypeServiceList:       payloadOf[[]*ServiceInfo](),
+		MessageTypeServiceStatus:     payloadOf[ServiceInfo](),
+		MessageTypeServiceResult:     payloadOf[ServiceResult](),
+		MessageTypeServiceLogs:       payloadOf[ServiceLogChunk](),
+		MessageTypeServiceEvents:     payloadOf[ServiceDelta](),
+		MessageTypeLogList:           payloadOf[[]*LogSource](),
+		MessageTypeLogContent:        payloadOf[LogContent](),
+		MessageTypeLogShip:           payloadOf[LogShipBatch](),
+		MessageTypeLogExport:         payloadOf[LogExportChunk](),
+		MessageTypeProcessList:       payloadOf[ProcessList](),
+		MessageTypeProcessSignal:     payloadOf[ProcessSignalResult](),
+		MessageTypeNetworkDiagnostic: payloadOf[NetworkDiagnosticResult](),
+		MessageTypePackageOutput:     payloadOf[PackageOutput](),
+		MessageTypePackageResult:     payloadOf[PackageActionResult](),
+		MessageTypeError:             payloadOf[ErrorData](),
+	},
+}
+
+// RegisterPayload associe un type de message au type de ses données pour un sens de circulation
+// sample est une valeur du type attendu, nil pour un message sans données
+func RegisterPayload(msgType MessageType, direction PayloadDirection, sample interface{}) {
+	if payloadTypes[direction] == nil {
+		payloadTypes[direction] = make(map[MessageType]reflect.Type)
+	}
+	if sample == nil {
+		payloadTypes[direction][msgType] = nil
+		return
+	}
+	payloadTypes[direction][msgType] = reflect.TypeOf(sample)
+}
+
+// PayloadType retourne le type des données attendu pour un message et un sens de circulation
+// Le type retourné est nil pour un message sans données, ok est faux pour un message non enregistré
+func PayloadType(msgType MessageType, direction PayloadDirection) (payloadType reflect.Type, ok bool) {
+	payloadType, ok = payloadTypes[direction][msgType]
+	return payloadType, ok
+}
+
+// ValidatePayload décode et valide les données du message selon le type enregistré pour ce sens
+// Les messages non enregistrés ou sans données sont acceptés tels quels
+// Les données décodées sont conservées et réutilisées par DecodeData et DecodePayload
+func (m *Message) ValidatePayload(direction PayloadDirection) error {
+	payloadType, ok := PayloadType(m.Type, direction)
+	if !ok || payloadType == nil {
+		return nil
+	}
+
+	v := reflect.New(payloadType).Interface()
+	if err := m.decodePayload(v); err != nil {
+		return err
+	}
+	m.payload = v
+	return nil
+}
+
+// DecodePayload retourne les données du message décodées dans le type T et validées
+func DecodePayload[T any](m *Message) (*T, error) {
+	if cached, ok := m.payload.(*T); ok {
+		return cached, nil
+	}
+
+	v := new(T)
+	if err := m.decodePayload(v); err != nil {
+		return nil, err
+	}
+	m.payload = v
+	return v, nil
+}
+
+// decodePayload décode les données brutes du message dans v puis les valide
+func (m *Message) decodePayload(v interface{}) error {
+	if len(m.Data) == 0 || bytes.Equal(m.Data, []byte("null")) {
+		// Une liste vide est sérialisée en null
+		if reflect.TypeOf(v).Elem().Kind() == reflect.Slice {
+			return nil
+		}
+		return &PayloadError{Type: m.Type, Err: errors.New("données manquantes")}
+	}
+	if err := json.Unmarshal(m.Data, v); err != nil {
+		return &PayloadError{Type: m.Type, Err: err}
+	}
+	if validator, ok := v.(PayloadValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return &PayloadError{Type: m.Type, Err: err}
+		}
+	}
+	return nil
+}
+
+// NewPayloadErrorMessage construit la réponse signalant à l'émetteur que les données de son message sont invalides
+func NewPayloadErrorMessage(msg *Message, err error) *Message {
+	return NewMessageWithID(MessageTypeError, msg.ID, &ErrorData{
+		Code:    ErrorCodeInvalidPayload,
+		Message: err.Error(),
+		Details: string(msg.Type),
+	})
+}
+
+// Validate vérifie la présence du token
+func (a *AuthData) Validate() error {
+	if a.Token == "" {
+		return errors.New("token manquant")
+	}
+	return nil
+}
+
+// Validate vérifie la présence de la commande
+func (c *CommandData) Validate() error {
+	if c.Command == "" {
+		return errors.New("commande manquante")
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout négatif")
+	}
+	return nil
+}
+
+// Validate vérifie la présence du nom du service
+func (s *ServiceInfo) Validate() error {
+	if s.Name == "" {
+		return errors.New("nom de service manquant")
+	}
+	return nil
+}
+
+// Validate vérifie la présence du service et de l'action
+func (a *ServiceAction) Validate() error {
+	if a.Name == "" {
+		return errors.New("nom de service manquant")
+	}
+	if a.Action == "" {
+		return errors.New("action manquante")
+	}
+	if a.Type == "compose" && !composeProjectPattern.MatchString(a.Name) {
+		return fmt.Errorf("nom de projet Compose invalide: %s", a.Name)
+	}
+	if a.Type == "systemd" && !systemdUnitPattern.MatchString(a.Name) {
+		return fmt.Errorf("nom d'unité invalide: %s", a.Name)
+	}
+	if options := a.Options; options != nil {
+		if options.Timeout < 0 {
+			return errors.New("délai d'arrêt négatif")
+		}
+		if options.Tail < 0 || options.Tail > maxServiceLogTail {
+			return fmt.Errorf("nombre de lignes invalide (1 à %d)", maxServiceLogTail)
+		}
+		if options.Since < 0 {
+			return errors.New("horodatage de début invalide")
+		}
+		if options.Image != "" && !containerImagePattern.MatchString(options.Image) {
+			return fmt.Errorf("image invalide: %s", options.Image)
+		}
+		if options.Follow && (a.Type != "docker" || a.Action != "logs") {
+			return errors.New("le suivi n'est possible que pour les logs d'un conteneur")
+		}
+		if options.DropIn != "" && !systemdDropInPattern.MatchString(options.DropIn) {
+			return fmt.Errorf("nom de surcharge invalide: %s (extension .conf attendue)", options.DropIn)
+		}
+		if len(options.Content) > maxSystemdDropInSize {
+			return fmt.Errorf("surcharge trop volumineuse (%d octets maximum)", maxSystemdDropInSize)
+		}
+	}
+	return nil
+}
+
+// Validate vérifie le processus ciblé et le signal
+func (r *ProcessSignalRequest) Validate() error {
+	if r.PID <= 0 {
+		return errors.New("pid invalide")
+	}
+	if r.Signal == "" {
+		return errors.New("signal manquant")
+	}
+	return nil
+}
+
+// Validate vérifie la présence de l'action de diagnostic
+func (r *NetworkDiagnosticRequest) Validate() error {
+	if r.Action == "" {
+		return errors.New("action de diagnostic manquante")
+	}
+	return nil
+}
+
+// Validate vérifie la présence de l'action sur les paquets
+func (r *PackageActionRequest) Validate() error {
+	if r.Action == "" {
+		return errors.New("action manquante")
+	}
+	if r.Timeout < 0 {
+		return errors.New("timeout négatif")
+	}
+	return nil
+}
+
+// Validate vérifie l'imprimante, l'action et les paramètres propres aux travaux
+func (r *PrinterActionRequest) Validate() error {
+	if r.Printer == "" {
+		return errors.New("imprimante manquante")
+	}
+	switch r.Action {
+	case PrinterActionCancelJob, PrinterActionHoldJob, PrinterActionReleaseJob:
+		if r.JobID <= 0 {
+			return errors.New("identifiant de travail invalide")
+		}
+	case PrinterActionMoveJob:
+		if r.JobID <= 0 {
+			return errors.New("identifiant de travail invalide")
+		}
+		if r.Target == "" {
+			return errors.New("imprimante de destination manquante")
+		}
+	case PrinterActionCancelAll, PrinterActionEnable, PrinterActionDisable, PrinterActionAccept,
+		PrinterActionReject, PrinterActionSetDefault, PrinterActionTestPage:
+	default:
+		return fmt.Errorf("action inconnue: %s", r.Action)
+	}
+	return nil
+}
+
+// Validate vérifie que chaque imprimante modifiée ou supprimée est nommée
+func (d *PrinterDelta) Validate() error {
+	for _, printer := range d.Updated {
+		if printer == nil || printer.Name == "" {
+			return errors.New("imprimante sans nom")
+		}
+	}
+	for _, name := range d.Removed {
+		if name == "" {
+			return errors.New("imprimante supprimée sans nom")
+		}
+	}
+	return nil
+}
+
+// Validate vérifie l'imprimante, le format, les options et la présence du document
+func (r *PrintSubmitRequest) Validate() error {
+	if r.Printer == "" {
+		return errors.New("imprimante manquante")
+	}
+	switch r.Format {
+	case PrintFormatPDF, PrintFormatPostScript, PrintFormatText, PrintFormatRaw:
+	default:
+		return fmt.Errorf("format de document inconnu: %s", r.Format)
+	}
+	if len(r.Chunks) == 0 {
+		return errors.New("document vide")
+	}
+
+	options := r.Options
+	if options.Copies < 0 || options.Copies > maxPrintCopies {
+		return fmt.Errorf("nombre d'exemplaires invalide (1 à %d)", maxPrintCopies)
+	}
+	switch options.Duplex {
+	case "", PrintDuplexNone, PrintDuplexLong, PrintDuplexShort:
+	default:
+		return fmt.Errorf("mode recto verso inconnu: %s", options.Duplex)
+	}
+	if options.Media != "" && !printMediaPattern.MatchString(options.Media) {
+		return fmt.Errorf("format de papier invalide: %s", options.Media)
+	}
+	if options.PageRanges != "" && !printPageRangesPattern.MatchString(options.PageRanges) {
+		return fmt.Errorf("pages invalides: %s", options.PageRanges)
+	}
+	return nil
+}
+
+// Validate vérifie la durée d'écoute et les méthodes de découverte demandées
+func (r *PrinterDiscoveryRequest) Validate() error {
+	if r.Timeout < 0 || r.Timeout > maxPrinterDiscoveryTimeout {
+		return fmt.Errorf("durée de découverte invalide (1 à %d secondes)", maxPrinterDiscoveryTimeout)
+	}
+	for _, method := range r.Methods {
+		switch method {
+		case PrinterDiscoveryMDNS, PrinterDiscoverySNMP:
+		default:
+			return fmt.Errorf("méthode de découverte inconnue: %s", method)
+		}
+	}
+	if strings.ContainsAny(r.Community, "\x00\r\n") {
+		return errors.New("communauté SNMP invalide")
+	}
+	return nil
+}
+
+// Validate vérifie la limite de la recherche de pilotes
+func (r *PrinterDriverRequest) Validate() error {
+	if r.Limit < 0 {
+		return errors.New("limite négative")
+	}
+	return nil
+}
+
+// Validate vérifie l'opération, le nom de la file et les paramètres transmis à lpadmin
+func (r *PrinterQueueRequest) Validate() error {
+	switch r.Operation {
+	case PrinterQueueCreate, PrinterQueueModify, PrinterQueueDelete:
+	default:
+		return fmt.Errorf("opération inconnue: %s", r.Operation)
+	}
+	if !printerQueueNamePattern.MatchString(r.Name) {
+		return fmt.Errorf("nom de file invalide: %q (lettres, chiffres, _ . @ + -)", r.Name)
+	}
+	if r.Operation == PrinterQueueDelete {
+		return nil
+	}
+
+	if r.Operation == PrinterQueueCreate && r.URI == "" {
+		return errors.New("URI du périphérique manquante")
+	}
+	if r.URI != "" && !printerDeviceURIPattern.MatchString(r.URI) {
+		return fmt.Errorf("URI du périphérique invalide: %s", r.URI)
+	}
+	if r.Driver != "" && !printerDriverPattern.MatchString(r.Driver) {
+		return fmt.Errorf("pilote invalide: %s", r.Driver)
+	}
+	if strings.ContainsAny(r.Description+r.Location, "\x00\r\n") {
+		return errors.New("description ou emplacement invalide")
+	}
+	for name, value := range r.Options {
+		if !printerOptionPattern.MatchString(name) {
+			return fmt.Errorf("option invalide: %s", name)
+		}
+		if value == "" || strings.ContainsAny(value, "\x00\r\n") {
+			return fmt.Errorf("valeur invalide pour l'option %s", name)
+		}
+	}
+	return nil
+}
+
+// Validate vérifie que chaque service modifié ou supprimé est identifié
+func (d *ServiceDelta) Validate() error {
+	for _, service := range d.Updated {
+		if service == nil || service.Name == "" || service.Type == "" {
+			return errors.New("service sans nom ou sans type")
+		}
+	}
+	for _, ref := range d.Removed {
+		if ref.Name == "" || ref.Type == "" {
+			return errors.New("service supprimé sans nom ou sans type")
+		}
+	}
+	return nil
+}
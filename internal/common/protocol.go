@@ -2,6 +2,8 @@ package common
 
 import (
 	"encoding/json"
+	"log"
+	"reflect"
 	"time"
 )
 
@@ -32,37 +34,70 @@ const (
 	MessageTypeFileCreateDir MessageType = "file_create_dir"
 
 	// Messages de monitoring
-	MessageTypePrinterStatus MessageType = "printer_status"
-	MessageTypeSystemInfo    MessageType = "system_info"
-	MessageTypeHeartbeat     MessageType = "heartbeat"
+	MessageTypePrinterStatus   MessageType = "printer_status"
+	MessageTypePrinterEvents   MessageType = "printer_events"
+	MessageTypePrinterAction   MessageType = "printer_action"
+	MessageTypePrinterResult   MessageType = "printer_result"
+	MessageTypePrintSubmit     MessageType = "print_submit"
+	MessageTypePrinterDiscover MessageType = "printer_discover"
+	MessageTypePrinterDrivers  MessageType = "printer_drivers"
+	MessageTypePrinterQueue    MessageType = "printer_queue"
+	MessageTypeMetrics         MessageType = "metrics"
+	MessageTypeSystemInfo      MessageType = "system_info"
+	MessageTypeInventory       MessageType = "inventory"
+	MessageTypeHeartbeat       MessageType = "heartbeat"
 
 	// Messages de gestion des services
 	MessageTypeServiceList   MessageType = "service_list"
 	MessageTypeServiceStatus MessageType = "service_status"
 	MessageTypeServiceAction MessageType = "service_action"
 	MessageTypeServiceResult MessageType = "service_result"
+	MessageTypeServiceLogs   MessageType = "service_logs"
+	MessageTypeServiceEvents MessageType = "service_events"
 
 	// Messages de gestion des logs
 	MessageTypeLogList    MessageType = "log_list"
 	MessageTypeLogContent MessageType = "log_content"
-	MessageTypeLogStream  MessageType = "log_stream"
+	MessageTypeLogShip    MessageType = "log_ship"
+	MessageTypeLogAlert   MessageType = "log_alert"
+	MessageTypeLogExport  MessageType = "log_export"
+
+	// Messages de gestion des processus
+	MessageTypeProcessList   MessageType = "process_list"
+	MessageTypeProcessSignal MessageType = "process_signal"
+
+	// Messages de diagnostic réseau
+	MessageTypeNetworkDiagnostic MessageType = "network_diagnostic"
+
+	// Messages de gestion des paquets
+	MessageTypePackageAction MessageType = "package_action"
+	MessageTypePackageOutput MessageType = "package_output"
+	MessageTypePackageResult MessageType = "package_result"
+
+	// Messages d'alertes sur l'état des agents (serveur -> clients web)
+	MessageTypeAlert MessageType = "alert"
 
 	// Messages d'erreur
 	MessageTypeError MessageType = "error"
 )
 
 // Message représente un message WebSocket
+// Les données sont transportées en JSON brut et décodées à la demande selon le type du message
 type Message struct {
-	Type      MessageType `json:"type"`
-	ID        string      `json:"id,omitempty"`
-	Data      interface{} `json:"data,omitempty"`
-	Timestamp time.Time   `json:"timestamp"`
-	AgentID   string      `json:"agent_id,omitempty"`
+	Type      MessageType     `json:"type"`
+	ID        string          `json:"id,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	AgentID   string          `json:"agent_id,omitempty"`
+
+	payload interface{} // Données décodées lors de la validation
 }
 
 // AuthData contient les données d'authentification
 type AuthData struct {
-	Token string `json:"token"`
+	Token     string `json:"token"`
+	AgentID   string `json:"agent_id,omitempty"`
+	AgentName string `json:"agent_name,omitempty"`
 }
 
 // CommandData contient les données d'exécution de commande
@@ -101,25 +136,234 @@ type FileChunk struct {
 }
 
 // PrinterInfo contient les informations d'une imprimante
+// Les champs d'état détaillé ne sont renseignés que lorsque l'agent interroge CUPS en IPP
 type PrinterInfo struct {
-	Name        string     `json:"name"`
-	Status      string     `json:"status"`
-	Description string     `json:"description"`
-	Location    string     `json:"location"`
-	URI         string     `json:"uri"`
-	IsDefault   bool       `json:"is_default"`
-	Jobs        []PrintJob `json:"jobs,omitempty"`
+	Name          string          `json:"name"`
+	Status        string          `json:"status"` // idle, processing, stopped, error, offline
+	Description   string          `json:"description"`
+	Location      string          `json:"location"`
+	URI           string          `json:"uri"`
+	IsDefault     bool            `json:"is_default"`
+	Jobs          []PrintJob      `json:"jobs,omitempty"`
+	CompletedJobs []PrintJob      `json:"completed_jobs,omitempty"` // Derniers travaux terminés, annulés ou abandonnés (IPP)
+	State         string          `json:"state,omitempty"`          // printer-state IPP: idle, processing, stopped
+	StateReasons  []string        `json:"state_reasons,omitempty"`  // printer-state-reasons IPP (ex: media-empty-error)
+	StateMessage  string          `json:"state_message,omitempty"`  // Message d'état fourni par l'imprimante
+	AcceptingJobs *bool           `json:"accepting_jobs,omitempty"` // La file accepte-t-elle de nouveaux travaux
+	MakeModel     string          `json:"make_model,omitempty"`
+	QueuedJobs    int             `json:"queued_jobs,omitempty"`
+	Markers       []PrinterMarker `json:"markers,omitempty"` // Niveaux de toner ou d'encre
+	MediaEmpty    bool            `json:"media_empty,omitempty"`
+	MediaJam      bool            `json:"media_jam,omitempty"`
+	MarkerLow     bool            `json:"marker_low,omitempty"`
+	MarkerEmpty   bool            `json:"marker_empty,omitempty"`
+}
+
+// PrinterMarker contient le niveau d'un consommable (toner, encre, tambour...)
+type PrinterMarker struct {
+	Name      string `json:"name"`
+	Type      string `json:"type,omitempty"`  // toner, ink-cartridge, opc...
+	Color     string `json:"color,omitempty"` // #RRGGBB
+	Level     int    `json:"level"`           // Pourcentage, négatif si inconnu
+	LowLevel  int    `json:"low_level,omitempty"`
+	HighLevel int    `json:"high_level,omitempty"`
 }
 
 // PrintJob contient les informations d'un travail d'impression
 type PrintJob struct {
-	ID       int       `json:"id"`
-	Name     string    `json:"name"`
-	User     string    `json:"user"`
-	Size     int64     `json:"size"`
-	Status   string    `json:"status"`
-	Priority int       `json:"priority"`
-	Created  time.Time `json:"created"`
+	ID           int        `json:"id"`
+	Name         string     `json:"name"`
+	User         string     `json:"user"`
+	Size         int64      `json:"size"`
+	Status       string     `json:"status"` // pending, held, processing, stopped, canceled, aborted, completed
+	Priority     int        `json:"priority"`
+	Created      time.Time  `json:"created"`
+	Completed    *time.Time `json:"completed,omitempty"`     // Fin du travail, nil s'il est encore dans la file
+	Pages        int        `json:"pages,omitempty"`         // Pages imprimées (job-impressions-completed)
+	StateReasons []string   `json:"state_reasons,omitempty"` // job-state-reasons IPP
+}
+
+// Actions disponibles sur les imprimantes et leurs travaux
+const (
+	PrinterActionCancelJob  = "cancel_job"
+	PrinterActionCancelAll  = "cancel_all"
+	PrinterActionHoldJob    = "hold_job"
+	PrinterActionReleaseJob = "release_job"
+	PrinterActionMoveJob    = "move_job"
+	PrinterActionEnable     = "enable"
+	PrinterActionDisable    = "disable"
+	PrinterActionAccept     = "accept"
+	PrinterActionReject     = "reject"
+	PrinterActionSetDefault = "set_default"
+	PrinterActionTestPage   = "test_page"
+	PrinterActionPrint      = "print" // Résultat d'une impression à distance (print_submit)
+)
+
+// PrinterActionRequest contient une demande d'action sur une imprimante ou l'un de ses travaux
+type PrinterActionRequest struct {
+	Printer string `json:"printer"`
+	Action  string `json:"action"`
+	JobID   int    `json:"job_id,omitempty"` // Travaux: cancel_job, hold_job, release_job, move_job
+	Target  string `json:"target,omitempty"` // move_job: imprimante de destination
+	Reason  string `json:"reason,omitempty"` // disable, reject: motif affiché par CUPS
+}
+
+// Formats des documents imprimés à distance
+const (
+	PrintFormatPDF        = "pdf"
+	PrintFormatPostScript = "postscript"
+	PrintFormatText       = "text"
+	PrintFormatRaw        = "raw" // Transmis tel quel à l'imprimante (PCL, ZPL...)
+)
+
+// Modes recto verso d'une impression à distance
+const (
+	PrintDuplexNone  = "none"
+	PrintDuplexLong  = "long-edge"
+	PrintDuplexShort = "short-edge"
+)
+
+// PrintOptions contient les options d'un document imprimé à distance
+// Les options vides conservent les réglages par défaut de l'imprimante
+type PrintOptions struct {
+	Copies     int    `json:"copies,omitempty"`
+	Duplex     string `json:"duplex,omitempty"`      // none, long-edge, short-edge
+	Media      string `json:"media,omitempty"`       // A4, Letter, iso_a4_210x297mm...
+	PageRanges string `json:"page_ranges,omitempty"` // 1-3,5
+}
+
+// PrintSubmitRequest contient un document à imprimer sur une imprimante de l'agent
+// Le contenu est transmis en chunks, comme un upload de fichier
+type PrintSubmitRequest struct {
+	Printer string       `json:"printer"`
+	Title   string       `json:"title,omitempty"`
+	Format  string       `json:"format"`
+	Options PrintOptions `json:"options"`
+	Chunks  []*FileChunk `json:"chunks"`
+}
+
+// PrinterActionResult contient le résultat d'une action sur une imprimante
+type PrinterActionResult struct {
+	Printer string `json:"printer"`
+	Action  string `json:"action"`
+	JobID   int    `json:"job_id,omitempty"` // Travail concerné, ou créé par une page de test
+	Target  string `json:"target,omitempty"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+	Output  string `json:"output,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Événements de changement d'état des imprimantes
+const (
+	PrinterEventAdded         = "printer_added"
+	PrinterEventRemoved       = "printer_removed"
+	PrinterEventStatusChanged = "status_changed"
+	PrinterEventJobAdded      = "job_added"
+	PrinterEventJobUpdated    = "job_updated"
+	PrinterEventJobFinished   = "job_finished"
+)
+
+// PrinterEvent décrit un changement survenu sur une imprimante ou l'un de ses travaux
+type PrinterEvent struct {
+	Type           string    `json:"type"`
+	Printer        string    `json:"printer"`
+	Status         string    `json:"status,omitempty"`          // Nouveau statut de l'imprimante ou du travail
+	PreviousStatus string    `json:"previous_status,omitempty"` // Statut avant le changement
+	Job            *PrintJob `json:"job,omitempty"`
+}
+
+// PrinterDelta contient les changements des imprimantes depuis le précédent envoi
+// Updated porte l'état complet des imprimantes ajoutées ou modifiées, y compris lorsque
+// le changement (niveau d'un consommable, raison d'état) ne donne lieu à aucun événement
+type PrinterDelta struct {
+	Updated []*PrinterInfo  `json:"updated,omitempty"`
+	Removed []string        `json:"removed,omitempty"`
+	Events  []*PrinterEvent `json:"events"`
+}
+
+// Méthodes de découverte des imprimantes réseau
+const (
+	PrinterDiscoveryMDNS = "mdns" // DNS-SD (_ipp._tcp, _ipps._tcp, _pdl-datastream._tcp)
+	PrinterDiscoverySNMP = "snmp" // Diffusion SNMPv1 sur les réseaux locaux
+)
+
+// PrinterDiscoveryRequest contient une demande de découverte des imprimantes réseau
+type PrinterDiscoveryRequest struct {
+	Timeout   int      `json:"timeout,omitempty"`   // Durée d'écoute en secondes (défaut 5)
+	Methods   []string `json:"methods,omitempty"`   // mdns, snmp (toutes par défaut)
+	Community string   `json:"community,omitempty"` // Communauté SNMP (défaut public)
+}
+
+// DiscoveredPrinter décrit une imprimante trouvée sur le réseau
+// Les annonces d'un même appareil (IPP, IPPS, socket, SNMP) sont regroupées
+type DiscoveredPrinter struct {
+	Name       string   `json:"name"`                 // Nom annoncé (instance DNS-SD ou sysName)
+	URI        string   `json:"uri"`                  // URI recommandée pour créer la file
+	URIs       []string `json:"uris,omitempty"`       // Toutes les URI trouvées pour l'appareil
+	DNSSDURI   string   `json:"dnssd_uri,omitempty"`  // URI dnssd:// résolue par CUPS à chaque impression
+	Host       string   `json:"host,omitempty"`       // Nom d'hôte annoncé (.local)
+	Address    string   `json:"address,omitempty"`    // Adresse IPv4
+	Methods    []string `json:"methods"`              // Méthodes ayant trouvé l'appareil
+	MakeModel  string   `json:"make_model,omitempty"` // Marque et modèle (TXT ty, hrDeviceDescr)
+	Location   string   `json:"location,omitempty"`   // TXT note, sysLocation
+	UUID       string   `json:"uuid,omitempty"`
+	Formats    []string `json:"formats,omitempty"` // Formats acceptés (TXT pdl)
+	Driverless bool     `json:"driverless"`        // Compatible IPP Everywhere ou AirPrint (pilote "everywhere")
+	Queue      string   `json:"queue,omitempty"`   // File CUPS existante utilisant déjà cet appareil
+}
+
+// PrinterDiscoveryResult contient les imprimantes trouvées sur le réseau de l'agent
+type PrinterDiscoveryResult struct {
+	Printers []*DiscoveredPrinter `json:"printers"`
+	Errors   map[string]string    `json:"errors,omitempty"` // Méthodes en échec et leur erreur
+	Duration float64              `json:"duration"`         // secondes
+}
+
+// PrinterDriverRequest contient une recherche parmi les pilotes CUPS installés (lpinfo -m)
+type PrinterDriverRequest struct {
+	Search string `json:"search,omitempty"` // Filtre sur le nom ou le modèle, insensible à la casse
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// PrinterDriver décrit un pilote utilisable pour créer une file
+type PrinterDriver struct {
+	Name      string `json:"name"`       // Valeur à passer dans Driver (everywhere, drv:///..., lsb/...)
+	MakeModel string `json:"make_model"` // Description fournie par CUPS
+}
+
+// PrinterDriverList contient les pilotes correspondant à une recherche
+type PrinterDriverList struct {
+	Drivers   []*PrinterDriver `json:"drivers"`
+	Truncated bool             `json:"truncated,omitempty"` // Résultats limités à Limit
+}
+
+// Opérations de gestion des files d'impression
+const (
+	PrinterQueueCreate = "create_queue"
+	PrinterQueueModify = "modify_queue"
+	PrinterQueueDelete = "delete_queue"
+)
+
+// Pilotes particuliers d'une file d'impression
+const (
+	PrinterDriverEverywhere = "everywhere" // IPP Everywhere, sans pilote
+	PrinterDriverRaw        = "raw"        // Documents transmis tels quels
+)
+
+// PrinterQueueRequest contient une demande de création, modification ou suppression d'une file CUPS
+// En modification, les champs vides conservent la configuration existante
+type PrinterQueueRequest struct {
+	Operation   string            `json:"operation"`
+	Name        string            `json:"name"`
+	URI         string            `json:"uri,omitempty"`    // ipp://, ipps://, socket://, lpd://, dnssd://, usb://...
+	Driver      string            `json:"driver,omitempty"` // everywhere (défaut en création), raw ou pilote de lpinfo -m
+	PPD         []*FileChunk      `json:"ppd,omitempty"`    // Fichier PPD fourni, prioritaire sur Driver
+	Description string            `json:"description,omitempty"`
+	Location    string            `json:"location,omitempty"`
+	Shared      *bool             `json:"shared,omitempty"`
+	Default     bool              `json:"default,omitempty"`
+	Options     map[string]string `json:"options,omitempty"` // Options passées à lpadmin -o (media-default, sides-default, PageSize...)
 }
 
 // SystemInfo contient les informations système
@@ -135,6 +379,101 @@ type SystemInfo struct {
 	DiskUsed    int64     `json:"disk_used"`
 }
 
+// Inventory contient l'inventaire matériel et logiciel d'une machine
+// Hash est calculé sur le contenu hors CollectedAt et permet de détecter les changements
+type Inventory struct {
+	Hash           string              `json:"hash"`
+	CollectedAt    string              `json:"collected_at"` // RFC3339
+	Hostname       string              `json:"hostname"`
+	OS             string              `json:"os"`
+	Arch           string              `json:"arch"`
+	OSRelease      *OSRelease          `json:"os_release,omitempty"`
+	Kernel         string              `json:"kernel,omitempty"`
+	CPUModel       string              `json:"cpu_model,omitempty"`
+	CPUCores       int                 `json:"cpu_cores"`
+	MemoryTotal    int64               `json:"memory_total"` // octets
+	DMI            *DMIInfo            `json:"dmi,omitempty"`
+	Disks          []*InventoryDisk    `json:"disks,omitempty"`
+	NICs           []*InventoryNIC     `json:"nics,omitempty"`
+	PackageManager string              `json:"package_manager,omitempty"` // dpkg, rpm, apk
+	Packages       []*InventoryPackage `json:"packages,omitempty"`
+}
+
+// OSRelease contient l'identification de la distribution (/etc/os-release)
+type OSRelease struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Version    string `json:"version"`
+	VersionID  string `json:"version_id"`
+	PrettyName string `json:"pretty_name"`
+}
+
+// DMIInfo contient l'identification matérielle de la machine
+type DMIInfo struct {
+	Vendor      string `json:"vendor,omitempty"`
+	Product     string `json:"product,omitempty"`
+	Serial      string `json:"serial,omitempty"`
+	BoardVendor string `json:"board_vendor,omitempty"`
+	BoardName   string `json:"board_name,omitempty"`
+	BIOSVendor  string `json:"bios_vendor,omitempty"`
+	BIOSVersion string `json:"bios_version,omitempty"`
+}
+
+// InventoryDisk contient les informations d'un disque physique
+type InventoryDisk struct {
+	Name       string `json:"name"`
+	Model      string `json:"model,omitempty"`
+	Serial     string `json:"serial,omitempty"`
+	Size       int64  `json:"size"` // octets
+	Rotational bool   `json:"rotational"`
+	Removable  bool   `json:"removable"`
+}
+
+// InventoryNIC contient les informations d'une carte réseau
+type InventoryNIC struct {
+	Name   string `json:"name"`
+	MAC    string `json:"mac"`
+	Driver string `json:"driver,omitempty"`
+	Speed  int    `json:"speed,omitempty"` // Mb/s, 0 si inconnu ou lien absent
+}
+
+// InventoryPackage contient un paquet logiciel installé
+type InventoryPackage struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Arch    string `json:"arch,omitempty"`
+}
+
+// MetricsSample contient un échantillon de métriques collecté par un agent
+type MetricsSample struct {
+	Timestamp    string          `json:"timestamp"`               // RFC3339Nano
+	CPUPercent   float64         `json:"cpu_percent"`             // Utilisation globale du CPU
+	CPUCores     []float64       `json:"cpu_cores,omitempty"`     // Utilisation par cœur
+	MemoryTotal  int64           `json:"memory_total"`            // octets
+	MemoryUsed   int64           `json:"memory_used"`             // octets
+	SwapTotal    int64           `json:"swap_total"`              // octets
+	SwapUsed     int64           `json:"swap_used"`               // octets
+	Disks        []*DiskUsage    `json:"disks,omitempty"`         // Par point de montage
+	Network      []*NetworkUsage `json:"network,omitempty"`       // Par interface
+	ProcessCount int             `json:"process_count,omitempty"` // Nombre de processus
+}
+
+// DiskUsage contient l'occupation d'un point de montage
+type DiskUsage struct {
+	Mount  string `json:"mount"`
+	Device string `json:"device,omitempty"`
+	FSType string `json:"fs_type,omitempty"`
+	Total  int64  `json:"total"`
+	Used   int64  `json:"used"`
+}
+
+// NetworkUsage contient le débit d'une interface réseau depuis l'échantillon précédent
+type NetworkUsage struct {
+	Interface     string  `json:"interface"`
+	RxBytesPerSec float64 `json:"rx_bytes_per_sec"`
+	TxBytesPerSec float64 `json:"tx_bytes_per_sec"`
+}
+
 // ErrorData contient les informations d'erreur
 type ErrorData struct {
 	Code    string `json:"code"`
@@ -145,39 +484,166 @@ type ErrorData struct {
 // ServiceInfo contient les informations d'un service
 type ServiceInfo struct {
 	Name        string `json:"name"`
-	Type        string `json:"type"` // "systemd" ou "docker"
+	Type        string `json:"type"` // "systemd", "docker" ou "compose"
 	Status      string `json:"status"`
 	State       string `json:"state"` // active, inactive, failed, etc.
 	Description string `json:"description,omitempty"`
 	Enabled     bool   `json:"enabled,omitempty"`
 	// Pour Docker
-	ContainerID string `json:"container_id,omitempty"`
-	Image       string `json:"image,omitempty"`
+	ContainerID string            `json:"container_id,omitempty"`
+	Image       string            `json:"image,omitempty"`
+	Created     *time.Time        `json:"created,omitempty"`
+	Ports       []ContainerPort   `json:"ports,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Health      string            `json:"health,omitempty"`  // healthy, unhealthy, starting
+	Stats       *ContainerStats   `json:"stats,omitempty"`   // Conteneurs en cours d'exécution uniquement
+	Project     string            `json:"project,omitempty"` // Projet Docker Compose du conteneur
+	// Pour Docker Compose
+	WorkingDir  string   `json:"working_dir,omitempty"`
+	ConfigFiles []string `json:"config_files,omitempty"`
+	Containers  []string `json:"containers,omitempty"` // Conteneurs du projet
+	// Pour systemd: détail de l'unité, renseigné par la demande de statut uniquement
+	Unit *SystemdUnitDetails `json:"unit,omitempty"`
+}
+
+// SystemdUnitDetails contient l'état détaillé d'une unité systemd
+type SystemdUnitDetails struct {
+	LoadState     string   `json:"load_state"`
+	UnitFileState string   `json:"unit_file_state,omitempty"` // enabled, disabled, masked, static...
+	FragmentPath  string   `json:"fragment_path,omitempty"`   // Fichier de l'unité
+	DropInPaths   []string `json:"drop_in_paths,omitempty"`
+	MainPID       int      `json:"main_pid,omitempty"`
+	Tasks         uint64   `json:"tasks,omitempty"`
+	MemoryCurrent uint64   `json:"memory_current,omitempty"` // octets, 0 sans comptabilité mémoire
+	CPUUsage      uint64   `json:"cpu_usage_nsec,omitempty"` // temps CPU cumulé, 0 sans comptabilité CPU
+	Restarts      int      `json:"restarts"`                 // redémarrages automatiques (Restart=)
+	Result        string   `json:"result,omitempty"`         // success, exit-code, signal, timeout...
+	// Dernière exécution du processus principal
+	ExitCode   string     `json:"exit_code,omitempty"` // exited, killed, dumped
+	ExitStatus int        `json:"exit_status"`         // code de sortie ou numéro du signal
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	ExitedAt   *time.Time `json:"exited_at,omitempty"`
+	// Changements d'état
+	ActiveEnterAt   *time.Time `json:"active_enter_at,omitempty"`
+	ActiveExitAt    *time.Time `json:"active_exit_at,omitempty"`
+	InactiveEnterAt *time.Time `json:"inactive_enter_at,omitempty"`
+	StateChangeAt   *time.Time `json:"state_change_at,omitempty"`
+	// Dépendances
+	Requires   []string `json:"requires,omitempty"`
+	Wants      []string `json:"wants,omitempty"`
+	RequiredBy []string `json:"required_by,omitempty"`
+	WantedBy   []string `json:"wanted_by,omitempty"`
+	After      []string `json:"after,omitempty"`
+	Before     []string `json:"before,omitempty"`
+	Conflicts  []string `json:"conflicts,omitempty"`
+}
+
+// ContainerPort décrit un port exposé par un conteneur
+type ContainerPort struct {
+	IP          string `json:"ip,omitempty"`
+	PrivatePort int    `json:"private_port"`
+	PublicPort  int    `json:"public_port,omitempty"` // 0 si le port n'est pas publié
+	Type        string `json:"type"`                  // tcp, udp, sctp
+}
+
+// ContainerStats contient la consommation de ressources d'un conteneur
+type ContainerStats struct {
+	CPUPercent    float64 `json:"cpu_percent"` // Relatif à un cœur (200% = deux cœurs saturés), comme docker stats
+	MemoryUsage   uint64  `json:"memory_usage"`
+	MemoryLimit   uint64  `json:"memory_limit"`
+	MemoryPercent float64 `json:"memory_percent"`
+	NetworkRx     uint64  `json:"network_rx"`
+	NetworkTx     uint64  `json:"network_tx"`
+	BlockRead     uint64  `json:"block_read"`
+	BlockWrite    uint64  `json:"block_write"`
+	PIDs          uint64  `json:"pids"`
 }
 
 // ServiceAction contient une action à effectuer sur un service
 type ServiceAction struct {
-	Name   string `json:"name"`
-	Type   string `json:"type"`   // "systemd" ou "docker"
-	Action string `json:"action"` // "start", "stop", "restart", "enable", "disable"
+	Name    string                `json:"name"`
+	Type    string                `json:"type"`   // "systemd", "docker" ou "compose"
+	Action  string                `json:"action"` // "start", "stop", "restart", "enable", "disable", "reload", "mask", "unmask", "reset-failed", "cat", "edit"; Docker: "pause", "unpause", "remove", "pull", "recreate", "inspect", "logs"; Compose: "up", "down", "pull", "recreate", "config"
+	Options *ServiceActionOptions `json:"options,omitempty"`
+}
+
+// ServiceActionOptions contient les paramètres facultatifs des actions sur les conteneurs et les unités
+type ServiceActionOptions struct {
+	Timeout    int    `json:"timeout,omitempty"`    // stop, restart, recreate: délai avant l'arrêt forcé, en secondes
+	Force      bool   `json:"force,omitempty"`      // remove: supprime un conteneur en cours d'exécution
+	Volumes    bool   `json:"volumes,omitempty"`    // remove, down: supprime aussi les volumes
+	Image      string `json:"image,omitempty"`      // pull, recreate: image à utiliser (défaut: image du conteneur)
+	Pull       bool   `json:"pull,omitempty"`       // recreate: télécharge les images avant de recréer les conteneurs
+	Tail       int    `json:"tail,omitempty"`       // logs: nombre de dernières lignes (défaut 100)
+	Since      int64  `json:"since,omitempty"`      // logs: horodatage Unix de la première ligne
+	Follow     bool   `json:"follow,omitempty"`     // logs: diffuse les nouvelles lignes jusqu'à l'annulation
+	Timestamps bool   `json:"timestamps,omitempty"` // logs: préfixe chaque ligne par son horodatage
+	Cancel     bool   `json:"cancel,omitempty"`     // logs: interrompt le suivi lancé par la demande de même ID
+	DropIn     string `json:"drop_in,omitempty"`    // edit: nom du fichier de surcharge (défaut override.conf)
+	Content    string `json:"content,omitempty"`    // edit: contenu de la surcharge, vide pour la supprimer
 }
 
 // ServiceResult contient le résultat d'une action sur un service
 type ServiceResult struct {
-	Name    string `json:"name"`
-	Type    string `json:"type"`
-	Action  string `json:"action"`
-	Success bool   `json:"success"`
-	Message string `json:"message,omitempty"`
-	Output  string `json:"output,omitempty"`
+	Name        string          `json:"name"`
+	Type        string          `json:"type"`
+	Action      string          `json:"action"`
+	Success     bool            `json:"success"`
+	Message     string          `json:"message,omitempty"`
+	Output      string          `json:"output,omitempty"`       // logs: lignes demandées; config: fichiers Compose; cat: unité et surcharges
+	Details     json.RawMessage `json:"details,omitempty"`      // inspect: description complète du conteneur
+	ContainerID string          `json:"container_id,omitempty"` // recreate: identifiant du nouveau conteneur
+}
+
+// ServiceLogChunk contient des lignes de logs d'un conteneur diffusées en continu
+// Les lots portent l'ID de la demande, le résultat final est envoyé à la fin du suivi
+type ServiceLogChunk struct {
+	Name  string   `json:"name"`
+	Lines []string `json:"lines"`
+}
+
+// Événements de changement d'état des services
+const (
+	ServiceEventAdded        = "service_added"
+	ServiceEventRemoved      = "service_removed"
+	ServiceEventStateChanged = "state_changed"
+)
+
+// ServiceRef identifie un service d'un agent
+type ServiceRef struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ServiceEvent décrit un changement d'état d'un service
+type ServiceEvent struct {
+	Type           string    `json:"type"`
+	Name           string    `json:"name"`
+	ServiceType    string    `json:"service_type"`
+	State          string    `json:"state,omitempty"`
+	PreviousState  string    `json:"previous_state,omitempty"`
+	Status         string    `json:"status,omitempty"`
+	PreviousStatus string    `json:"previous_status,omitempty"`
+	Time           time.Time `json:"time"` // Détection du changement par l'agent
+}
+
+// ServiceDelta contient les changements d'état des services depuis le précédent envoi
+// Updated porte l'état allégé des services ajoutés ou modifiés: sans statistiques ni activation,
+// qui restent ceux de la dernière liste complète
+type ServiceDelta struct {
+	Updated []*ServiceInfo  `json:"updated,omitempty"`
+	Removed []ServiceRef    `json:"removed,omitempty"`
+	Events  []*ServiceEvent `json:"events"`
 }
 
 // LogSource contient les informations d'une source de logs
 type LogSource struct {
-	Name        string `json:"name"`
-	Type        string `json:"type"` // "agent", "systemd", "file"
-	Path        string `json:"path,omitempty"`
-	Description string `json:"description,omitempty"`
+	Name        string   `json:"name"`
+	Type        string   `json:"type"` // "agent", "systemd", "file", "custom"
+	Path        string   `json:"path,omitempty"`
+	Paths       []string `json:"paths,omitempty"`  // Fichiers d'une source configurée
+	Format      string   `json:"format,omitempty"` // "plain", "json" ou "syslog"
+	Description string   `json:"description,omitempty"`
 }
 
 // LogRequest contient une demande de logs
@@ -199,15 +665,238 @@ type LogEntry struct {
 	Timestamp string `json:"timestamp"`
 	Level     string `json:"level,omitempty"`
 	Source    string `json:"source,omitempty"`
+	Component string `json:"component,omitempty"` // Composant de l'agent à l'origine du message
 	Message   string `json:"message"`
 	Unit      string `json:"unit,omitempty"`
 }
 
+// LogExportRequest contient une demande d'export de logs sur une plage de temps
+// Une requête avec Cancel=true et le même ID interrompt un export en cours
+// Window active le contrôle de flux: l'agent numérote ses morceaux (Seq) et n'en envoie pas plus de Window
+// au-delà du dernier acquitté; le serveur acquitte chaque morceau écrit par une demande portant Ack
+type LogExportRequest struct {
+	LogRequest
+	From   string `json:"from,omitempty"` // RFC3339
+	To     string `json:"to,omitempty"`   // RFC3339
+	Cancel bool   `json:"cancel,omitempty"`
+	Window int    `json:"window,omitempty"`
+	Ack    int    `json:"ack,omitempty"` // Numéro du dernier morceau écrit par le serveur
+}
+
+// LogExportWindow est le nombre de morceaux d'export qu'un agent peut envoyer sans attendre d'acquittement
+const LogExportWindow = 16
+
+// LogExportChunk contient une partie d'un export de logs
+// Le dernier morceau porte Done=true, avec Error renseigné en cas d'échec
+type LogExportChunk struct {
+	Entries []*LogEntry `json:"entries,omitempty"`
+	Seq     int         `json:"seq,omitempty"` // Numéro du morceau, à partir de 1, si le contrôle de flux est actif
+	Done    bool        `json:"done,omitempty"`
+	Error   string      `json:"error,omitempty"`
+}
+
+// ProcessInfo contient les informations d'un processus
+type ProcessInfo struct {
+	PID        int     `json:"pid"`
+	PPID       int     `json:"ppid"`
+	User       string  `json:"user"`
+	Name       string  `json:"name"`
+	CmdLine    string  `json:"cmdline"`
+	State      string  `json:"state"`
+	CPUPercent float64 `json:"cpu_percent"`
+	RSS        int64   `json:"rss"` // octets
+	Threads    int     `json:"threads"`
+	StartTime  string  `json:"start_time"` // RFC3339
+}
+
+// ProcessListRequest contient une demande de liste des processus
+type ProcessListRequest struct {
+	Sort  string `json:"sort,omitempty"`  // cpu, rss, pid, name (défaut: cpu)
+	Limit int    `json:"limit,omitempty"` // 0 = tous
+	User  string `json:"user,omitempty"`  // Filtre sur l'utilisateur
+	Query string `json:"query,omitempty"` // Filtre sur le nom ou la ligne de commande
+}
+
+// ProcessList contient la liste des processus d'un agent
+type ProcessList struct {
+	Processes []*ProcessInfo `json:"processes"`
+	Total     int            `json:"total"` // Nombre de processus avant filtre et limite
+}
+
+// ProcessSignalRequest contient une demande d'envoi de signal à un processus
+type ProcessSignalRequest struct {
+	PID    int    `json:"pid"`
+	Signal string `json:"signal"` // TERM, KILL, HUP
+}
+
+// ProcessSignalResult contient le résultat d'un envoi de signal
+type ProcessSignalResult struct {
+	PID     int    `json:"pid"`
+	Signal  string `json:"signal"`
+	Name    string `json:"name,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Actions de diagnostic réseau
+const (
+	NetworkDiagInterfaces = "interfaces"
+	NetworkDiagRoutes     = "routes"
+	NetworkDiagSockets    = "sockets"
+	NetworkDiagDNS        = "dns"
+	NetworkDiagTCP        = "tcp"
+	NetworkDiagHTTP       = "http"
+)
+
+// NetworkDiagnosticRequest contient une demande de diagnostic réseau
+type NetworkDiagnosticRequest struct {
+	Action  string `json:"action"`
+	Host    string `json:"host,omitempty"`    // dns, tcp
+	Port    int    `json:"port,omitempty"`    // tcp
+	Server  string `json:"server,omitempty"`  // dns: serveur à interroger (ip[:port]), résolveur système par défaut
+	URL     string `json:"url,omitempty"`     // http
+	Method  string `json:"method,omitempty"`  // http: GET ou HEAD (défaut: GET)
+	State   string `json:"state,omitempty"`   // sockets: listen, established (défaut: tous)
+	Timeout int    `json:"timeout,omitempty"` // secondes (défaut: 5)
+}
+
+// NetworkDiagnosticResult contient le résultat d'un diagnostic réseau
+// Seul le champ correspondant à l'action demandée est renseigné
+type NetworkDiagnosticResult struct {
+	Action     string              `json:"action"`
+	Success    bool                `json:"success"`
+	Error      string              `json:"error,omitempty"`
+	DurationMs float64             `json:"duration_ms"`
+	Interfaces []*NetworkInterface `json:"interfaces,omitempty"`
+	Routes     []*NetworkRoute     `json:"routes,omitempty"`
+	Sockets    []*NetworkSocket    `json:"sockets,omitempty"`
+	DNS        *DNSProbeResult     `json:"dns,omitempty"`
+	TCP        *TCPProbeResult     `json:"tcp,omitempty"`
+	HTTP       *HTTPProbeResult    `json:"http,omitempty"`
+}
+
+// NetworkInterface contient les informations d'une interface réseau
+type NetworkInterface struct {
+	Name      string   `json:"name"`
+	MAC       string   `json:"mac,omitempty"`
+	MTU       int      `json:"mtu"`
+	Up        bool     `json:"up"`
+	Loopback  bool     `json:"loopback"`
+	Flags     string   `json:"flags"`
+	Addresses []string `json:"addresses"` // Notation CIDR
+}
+
+// NetworkRoute contient une entrée de la table de routage
+type NetworkRoute struct {
+	Destination string `json:"destination"` // Notation CIDR
+	Gateway     string `json:"gateway,omitempty"`
+	Interface   string `json:"interface"`
+	Metric      int    `json:"metric"`
+	Default     bool   `json:"default"`
+}
+
+// NetworkSocket contient les informations d'un socket TCP ou UDP
+type NetworkSocket struct {
+	Protocol      string `json:"protocol"` // tcp, tcp6, udp, udp6
+	LocalAddress  string `json:"local_address"`
+	RemoteAddress string `json:"remote_address,omitempty"`
+	State         string `json:"state"`
+	PID           int    `json:"pid,omitempty"`
+	Process       string `json:"process,omitempty"`
+}
+
+// DNSProbeResult contient le résultat d'une résolution DNS
+type DNSProbeResult struct {
+	Host      string   `json:"host"`
+	Server    string   `json:"server,omitempty"`
+	Addresses []string `json:"addresses"`
+	CNAME     string   `json:"cname,omitempty"`
+}
+
+// TCPProbeResult contient le résultat d'un test de connexion TCP
+type TCPProbeResult struct {
+	Host          string  `json:"host"`
+	Port          int     `json:"port"`
+	RemoteAddress string  `json:"remote_address,omitempty"`
+	Connected     bool    `json:"connected"`
+	LatencyMs     float64 `json:"latency_ms"`
+}
+
+// HTTPProbeResult contient le résultat d'une sonde HTTP
+type HTTPProbeResult struct {
+	URL           string  `json:"url"`
+	FinalURL      string  `json:"final_url,omitempty"` // Après redirections
+	StatusCode    int     `json:"status_code,omitempty"`
+	Status        string  `json:"status,omitempty"`
+	LatencyMs     float64 `json:"latency_ms"`
+	ContentLength int64   `json:"content_length"`
+	TLSVersion    string  `json:"tls_version,omitempty"`
+	CertExpiry    string  `json:"cert_expiry,omitempty"` // RFC3339
+	CertSubject   string  `json:"cert_subject,omitempty"`
+}
+
+// Actions de gestion des paquets
+const (
+	PackageActionListUpgradable = "list_upgradable"
+	PackageActionInstall        = "install"
+	PackageActionUpgrade        = "upgrade"
+	PackageActionRemove         = "remove"
+)
+
+// PackageActionRequest contient une demande d'opération sur les paquets
+// Une mise à jour sans paquet précisé met à jour l'ensemble du système
+type PackageActionRequest struct {
+	Action   string   `json:"action"`
+	Packages []string `json:"packages,omitempty"`
+	Timeout  int      `json:"timeout,omitempty"` // secondes (défaut: 600)
+}
+
+// PackageOutput contient des lignes de sortie d'une opération en cours
+type PackageOutput struct {
+	Lines []string `json:"lines"`
+}
+
+// UpgradablePackage contient un paquet pour lequel une mise à jour est disponible
+type UpgradablePackage struct {
+	Name             string `json:"name"`
+	CurrentVersion   string `json:"current_version,omitempty"`
+	AvailableVersion string `json:"available_version"`
+	Arch             string `json:"arch,omitempty"`
+	Repository       string `json:"repository,omitempty"`
+}
+
+// PackageActionResult contient le résultat d'une opération sur les paquets
+type PackageActionResult struct {
+	Action     string               `json:"action"`
+	Manager    string               `json:"manager"` // apt, dnf, yum, zypper, apk
+	Packages   []string             `json:"packages,omitempty"`
+	Success    bool                 `json:"success"`
+	ExitCode   int                  `json:"exit_code"`
+	Error      string               `json:"error,omitempty"`
+	Upgradable []*UpgradablePackage `json:"upgradable,omitempty"`
+	Output     []string             `json:"output,omitempty"` // Dernières lignes de sortie
+	DurationMs float64              `json:"duration_ms"`
+}
+
+// LogContent contient les entrées de logs renvoyées pour une requête de contenu
+type LogContent struct {
+	Entries []*LogEntry `json:"entries"`
+	Source  string      `json:"source"`
+	Count   int         `json:"count"`
+}
+
+// LogShipBatch contient un lot d'entrées de logs expédiées en continu au serveur
+type LogShipBatch struct {
+	Source  string      `json:"source"`
+	Type    string      `json:"type"`
+	Entries []*LogEntry `json:"entries"`
+}
+
 // NewMessage crée un nouveau message
 func NewMessage(msgType MessageType, data interface{}) *Message {
 	return &Message{
 		Type:      msgType,
-		Data:      data,
+		Data:      encodePayload(msgType, data),
 		Timestamp: time.Now(),
 	}
 }
@@ -217,11 +906,28 @@ func NewMessageWithID(msgType MessageType, id string, data interface{}) *Message
 	return &Message{
 		Type:      msgType,
 		ID:        id,
-		Data:      data,
+		Data:      encodePayload(msgType, data),
 		Timestamp: time.Now(),
 	}
 }
 
+// encodePayload sérialise les données d'un message, l'absence de données restant absente
+func encodePayload(msgType MessageType, data interface{}) json.RawMessage {
+	switch v := data.(type) {
+	case nil:
+		return nil
+	case json.RawMessage:
+		return v
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("[PROTOCOL] Sérialisation des données du message %s impossible: %v", msgType, err)
+		return nil
+	}
+	return raw
+}
+
 // ToJSON convertit le message en JSON
 func (m *Message) ToJSON() ([]byte, error) {
 	return json.Marshal(m)
@@ -234,6 +940,24 @@ func FromJSON(data []byte) (*Message, error) {
 	return &msg, err
 }
 
+// DecodeData décode les données du message dans la structure fournie
+func (m *Message) DecodeData(v interface{}) error {
+	// Réutiliser les données déjà décodées lors de la validation
+	if m.payload != nil {
+		target := reflect.ValueOf(v)
+		cached := reflect.ValueOf(m.payload)
+		if target.Kind() == reflect.Ptr && !target.IsNil() && target.Type() == cached.Type() {
+			target.Elem().Set(cached.Elem())
+			return nil
+		}
+	}
+
+	if len(m.Data) == 0 {
+		return nil
+	}
+	return json.Unmarshal(m.Data, v)
+}
+
 // IsValid vérifie si le message est valide
 func (m *Message) IsValid() bool {
 	return m.Type != "" && m.Timestamp.IsZero() == false
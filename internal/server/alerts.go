@@ -0,0 +1,395 @@
+package server
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// alertEvaluationInterval est l'intervalle d'évaluation des règles d'alerte
+const alertEvaluationInterval = 30 * time.Second
+
+// printerErrorStates liste les statuts d'imprimante considérés comme en erreur
+var printerErrorStates = map[string]bool{
+	"error":    true,
+	"erreur":   true,
+	"stopped":  true,
+	"disabled": true,
+	"offline":  true,
+}
+
+// agentState est l'état d'un agent connu au moment d'une évaluation
+type agentState struct {
+	id         string
+	lastSeen   time.Time
+	connected  bool
+	metadata   *AgentMetadata
+	systemInfo *common.SystemInfo
+	printers   []*common.PrinterInfo
+	services   []*common.ServiceInfo
+}
+
+// alertCondition est une condition d'alerte constatée lors d'une évaluation
+type alertCondition struct {
+	rule    *AlertRule
+	agentID string
+	subject string
+	message string
+	value   float64
+}
+
+// fingerprint identifie la condition pour la déduplication des alertes
+func (c *alertCondition) fingerprint() string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%d|%s|%s", c.rule.ID, c.agentID, c.subject)))
+	return hex.EncodeToString(sum[:])
+}
+
+// AlertManager évalue périodiquement les règles d'alerte sur l'état des agents
+// Les alertes actives sont dédupliquées par empreinte et passent à l'état résolu lorsque la condition disparaît
+type AlertManager struct {
+	db     *Database
+	hub    *Hub
+	rules  []*AlertRule
+	active map[string]*Alert // Alertes actives par empreinte
+	mu     sync.Mutex
+}
+
+// NewAlertManager crée un nouveau gestionnaire d'alertes
+func NewAlertManager(db *Database, hub *Hub) *AlertManager {
+	return &AlertManager{
+		db:     db,
+		hub:    hub,
+		active: make(map[string]*Alert),
+	}
+}
+
+// ValidateAlertRule vérifie la cohérence d'une règle d'alerte
+func ValidateAlertRule(rule *AlertRule) error {
+	switch rule.Type {
+	case AlertRuleOffline:
+		if rule.Threshold <= 0 {
+			return fmt.Errorf("le seuil doit être une durée en minutes strictement positive")
+		}
+	case AlertRuleDisk, AlertRuleMemory:
+		if rule.Threshold <= 0 || rule.Threshold > 100 {
+			return fmt.Errorf("le seuil doit être un pourcentage entre 0 et 100")
+		}
+	case AlertRulePrinterError, AlertRuleServiceFailed:
+	default:
+		return fmt.Errorf("type de règle inconnu: %s", rule.Type)
+	}
+
+	for _, pattern := range strings.Split(rule.Target, ",") {
+		if _, err := path.Match(strings.TrimSpace(pattern), ""); err != nil {
+			return fmt.Errorf("motif de cible invalide %q: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Load charge les règles et les alertes encore actives
+func (m *AlertManager) Load() error {
+	if err := m.Reload(); err != nil {
+		return err
+	}
+
+	alerts, err := m.db.GetFiringAlerts()
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, alert := range alerts {
+		m.active[alert.Fingerprint] = alert
+	}
+	return nil
+}
+
+// Reload recharge les règles depuis la base de données
+// Les alertes des règles supprimées ou désactivées sont résolues à la prochaine évaluation
+func (m *AlertManager) Reload() error {
+	rules, err := m.db.GetAlertRules()
+	if err != nil {
+		return err
+	}
+
+	enabled := make([]*AlertRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Enabled {
+			enabled = append(enabled, rule)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.rules = enabled
+	return nil
+}
+
+// Run évalue les règles à intervalle régulier
+func (m *AlertManager) Run() {
+	if err := m.Load(); err != nil {
+		log.Printf("[ALERTS] Erreur lors du chargement des alertes: %v", err)
+	}
+
+	ticker := time.NewTicker(alertEvaluationInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.Evaluate(time.Now())
+	}
+}
+
+// Evaluate évalue toutes les règles et met à jour les alertes
+func (m *AlertManager) Evaluate(now time.Time) {
+	states := m.collectAgentStates()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Un agent déconnecté ne signale plus ses disques, imprimantes ni services: seule sa mise hors ligne est évaluée
+	disconnected := make(map[string]bool)
+	for _, state := range states {
+		if !state.connected {
+			disconnected[state.id] = true
+		}
+	}
+	enabled := make(map[uint]bool, len(m.rules))
+	for _, rule := range m.rules {
+		enabled[rule.ID] = true
+	}
+
+	conditions := make(map[string]*alertCondition)
+	for _, rule := range m.rules {
+		for _, state := range states {
+			if disconnected[state.id] && rule.Type != AlertRuleOffline {
+				continue
+			}
+			if !matchAgentSelector(rule.AgentSelector, state.id, state.metadata) {
+				continue
+			}
+			for _, condition := range evaluateAlertRule(rule, state, now) {
+				conditions[condition.fingerprint()] = condition
+			}
+		}
+	}
+
+	// Nouvelles alertes et mises à jour des alertes actives
+	for fingerprint, condition := range conditions {
+		alert, exists := m.active[fingerprint]
+		if !exists {
+			alert = &Alert{
+				Fingerprint:   fingerprint,
+				RuleID:        condition.rule.ID,
+				RuleName:      condition.rule.Name,
+				Type:          condition.rule.Type,
+				Severity:      condition.rule.Severity,
+				AgentID:       condition.agentID,
+				Subject:       condition.subject,
+				Status:        AlertStatusFiring,
+				Message:       condition.message,
+				Value:         condition.value,
+				StartedAt:     now,
+				LastEvaluated: now,
+			}
+			m.active[fingerprint] = alert
+			log.Printf("[ALERTS] Alerte déclenchée: %s (%s)", alert.RuleName, alert.Message)
+			m.persist(alert, true)
+			m.hub.notifier.Notify(alertNotificationEvent(alert))
+			continue
+		}
+
+		alert.LastEvaluated = now
+		if alert.Message != condition.message || math.Abs(alert.Value-condition.value) >= 1 {
+			alert.Message = condition.message
+			alert.Value = condition.value
+			m.persist(alert, false)
+		}
+	}
+
+	// Résolution des alertes dont la condition a disparu
+	for fingerprint, alert := range m.active {
+		if _, firing := conditions[fingerprint]; firing {
+			continue
+		}
+		// Les alertes d'un agent déconnecté restent en l'état jusqu'à ce qu'il signale à nouveau son état
+		if disconnected[alert.AgentID] && alert.Type != AlertRuleOffline && enabled[alert.RuleID] {
+			continue
+		}
+		resolvedAt := now
+		alert.Status = AlertStatusResolved
+		alert.ResolvedAt = &resolvedAt
+		alert.LastEvaluated = now
+		delete(m.active, fingerprint)
+		log.Printf("[ALERTS] Alerte résolue: %s (agent %s)", alert.RuleName, alert.AgentID)
+		m.persist(alert, true)
+		m.hub.notifier.Notify(alertNotificationEvent(alert))
+	}
+}
+
+// Acknowledge acquitte une alerte
+func (m *AlertManager) Acknowledge(id uint, user string) (*Alert, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Privilégier l'instance active pour ne pas perdre l'acquittement à la prochaine évaluation
+	var alert *Alert
+	for _, active := range m.active {
+		if active.ID == id {
+			alert = active
+			break
+		}
+	}
+	if alert == nil {
+		stored, err := m.db.GetAlert(id)
+		if err != nil {
+			return nil, err
+		}
+		alert = stored
+	}
+
+	if alert.AcknowledgedAt == nil {
+		acknowledgedAt := time.Now()
+		alert.AcknowledgedAt = &acknowledgedAt
+		alert.AcknowledgedBy = user
+		m.persist(alert, true)
+	}
+	// Copie: l'instance active reste modifiée par l'évaluation une fois le verrou relâché
+	acknowledged := *alert
+	return &acknowledged, nil
+}
+
+// persist enregistre une alerte et, si demandé, notifie les clients web
+func (m *AlertManager) persist(alert *Alert, broadcast bool) {
+	if err := m.db.SaveAlert(alert); err != nil {
+		log.Printf("[ALERTS] Erreur lors de l'enregistrement de l'alerte: %v", err)
+	}
+	if broadcast {
+		msg := common.NewMessage(common.MessageTypeAlert, alert)
+		msg.AgentID = alert.AgentID
+		m.hub.BroadcastToWebClients(msg)
+	}
+}
+
+// collectAgentStates rassemble l'état des agents connectés et des agents connus en base
+func (m *AlertManager) collectAgentStates() []*agentState {
+	states := make(map[string]*agentState)
+
+	if records, err := m.db.GetAgents(); err != nil {
+		log.Printf("[ALERTS] Erreur lors de la récupération des agents: %v", err)
+	} else {
+		for _, record := range records {
+			states[record.ID] = &agentState{
+				id:       record.ID,
+				lastSeen: record.LastSeen,
+				metadata: &AgentMetadata{Franchise: record.Franchise, Category: record.Category},
+			}
+		}
+	}
+
+	for _, agent := range m.hub.GetAgents() {
+		agent.mu.RLock()
+		lastSeen := agent.LastSeen
+		agent.mu.RUnlock()
+
+		states[agent.ID] = &agentState{
+			id:         agent.ID,
+			lastSeen:   lastSeen,
+			connected:  true,
+			metadata:   m.hub.GetAgentMetadata(agent.ID),
+			systemInfo: agent.GetSystemInfo(),
+			printers:   agent.GetPrinters(),
+			services:   agent.GetServices(),
+		}
+	}
+
+	result := make([]*agentState, 0, len(states))
+	for _, state := range states {
+		result = append(result, state)
+	}
+	return result
+}
+
+// evaluateAlertRule retourne les conditions d'alerte d'une règle pour un agent
+func evaluateAlertRule(rule *AlertRule, state *agentState, now time.Time) []*alertCondition {
+	newCondition := func(subject, message string, value float64) *alertCondition {
+		return &alertCondition{rule: rule, agentID: state.id, subject: subject, message: message, value: value}
+	}
+
+	switch rule.Type {
+	case AlertRuleOffline:
+		if state.lastSeen.IsZero() {
+			return nil
+		}
+		minutes := now.Sub(state.lastSeen).Minutes()
+		if minutes >= rule.Threshold {
+			return []*alertCondition{newCondition("", fmt.Sprintf("Agent %s hors ligne depuis %.0f minutes", state.id, minutes), minutes)}
+		}
+
+	case AlertRuleDisk:
+		if state.systemInfo != nil && state.systemInfo.DiskTotal > 0 {
+			usage := percentOf(state.systemInfo.DiskUsed, state.systemInfo.DiskTotal)
+			if usage >= rule.Threshold {
+				return []*alertCondition{newCondition("", fmt.Sprintf("Disque de l'agent %s occupé à %.1f%%", state.id, usage), usage)}
+			}
+		}
+
+	case AlertRuleMemory:
+		if state.systemInfo != nil && state.systemInfo.MemoryTotal > 0 {
+			usage := percentOf(state.systemInfo.MemoryUsed, state.systemInfo.MemoryTotal)
+			if usage >= rule.Threshold {
+				return []*alertCondition{newCondition("", fmt.Sprintf("Mémoire de l'agent %s occupée à %.1f%%", state.id, usage), usage)}
+			}
+		}
+
+	case AlertRulePrinterError:
+		var conditions []*alertCondition
+		for _, printer := range state.printers {
+			if printer == nil || !printerErrorStates[strings.ToLower(printer.Status)] || !matchAlertTarget(rule.Target, printer.Name) {
+				continue
+			}
+			conditions = append(conditions, newCondition(printer.Name,
+				fmt.Sprintf("Imprimante %s de l'agent %s en erreur (%s)", printer.Name, state.id, printer.Status), 1))
+		}
+		return conditions
+
+	case AlertRuleServiceFailed:
+		var conditions []*alertCondition
+		for _, service := range state.services {
+			if service == nil || !matchAlertTarget(rule.Target, service.Name) {
+				continue
+			}
+			if !strings.EqualFold(service.State, "failed") && !strings.EqualFold(service.Status, "failed") {
+				continue
+			}
+			conditions = append(conditions, newCondition(service.Name,
+				fmt.Sprintf("Service %s de l'agent %s en échec", service.Name, state.id), 1))
+		}
+		return conditions
+	}
+
+	return nil
+}
+
+// matchAlertTarget vérifie si un nom correspond à la cible d'une règle (globs séparés par des virgules)
+func matchAlertTarget(target, name string) bool {
+	target = strings.TrimSpace(target)
+	if target == "" || target == "*" {
+		return true
+	}
+	for _, pattern := range strings.Split(target, ",") {
+		if ok, _ := path.Match(strings.TrimSpace(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,18 @@
 package server
 
 import (
+	"compress/gzip"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"remoteshell/internal/auth"
@@ -99,6 +103,17 @@ func (api *APIServer) setupRoutes() {
 	// WebSocket pour les agents (sans authentification)
 	api.router.GET("/ws", api.wsServer.HandleWebSocket)
 
+	// Exposition Prometheus: protégée par REMOTESHELL_METRICS_TOKEN, ouverte seulement sur demande explicite
+	switch {
+	case api.config != nil && api.config.MetricsToken != "":
+		api.router.GET("/metrics", api.prometheusMetrics)
+	case api.config != nil && api.config.MetricsPublic:
+		log.Printf("[API] /metrics exposé sans authentification (REMOTESHELL_METRICS_PUBLIC)")
+		api.router.GET("/metrics", api.prometheusMetrics)
+	default:
+		log.Printf("[API] /metrics désactivé: définir REMOTESHELL_METRICS_TOKEN pour l'activer")
+	}
+
 	// Routes protégées
 	protected := api.router.Group("/api")
 	protected.Use(auth.AuthMiddleware(api.tokenManager))
@@ -109,7 +124,37 @@ func (api *APIServer) setupRoutes() {
 		protected.PUT("/agents/:id/metadata", api.updateAgentMetadata)
 		protected.POST("/agents/:id/exec", api.executeCommand)
 		protected.GET("/agents/:id/printers", api.getAgentPrinters)
+		protected.GET("/agents/:id/printers/discover", api.discoverPrinters)
+		protected.GET("/agents/:id/printers/drivers", api.getPrinterDrivers)
+		protected.POST("/agents/:id/printers", api.createPrinterQueue)
+		protected.PUT("/agents/:id/printers/:name", api.updatePrinterQueue)
+		protected.DELETE("/agents/:id/printers/:name", api.deletePrinterQueue)
+		protected.POST("/agents/:id/printers/:name/jobs/:job/:action", api.executePrintJobAction)
+		protected.POST("/agents/:id/printers/:name/print", api.submitPrintJob)
+		protected.POST("/agents/:id/printers/:name/:action", api.executePrinterAction)
+		protected.GET("/agents/:id/printers/:name/history", api.getPrinterHistory)
+		protected.GET("/agents/:id/printers/:name/jobs", api.getPrinterJobs)
+		protected.GET("/agents/:id/printers/:name/stats", api.getPrinterStats)
+		protected.GET("/agents/:id/printers/:name/supplies", api.getPrinterSupplies)
 		protected.GET("/agents/:id/system", api.getAgentSystem)
+		protected.GET("/agents/:id/metrics", api.getAgentMetrics)
+
+		// Processus
+		protected.GET("/agents/:id/processes", api.listProcesses)
+		protected.POST("/agents/:id/processes/:pid/signal", api.signalProcess)
+
+		// Diagnostic réseau
+		protected.GET("/agents/:id/network/:action", api.networkDiagnostic)
+
+		// Inventaire
+		protected.GET("/agents/:id/inventory", api.getAgentInventory)
+		protected.GET("/agents/:id/inventory/history", api.getAgentInventoryHistory)
+		protected.GET("/inventory/packages", api.findInstalledPackages)
+
+		// Gestion des paquets
+		protected.GET("/agents/:id/packages/upgradable", api.listUpgradablePackages)
+		protected.POST("/agents/:id/packages/:action", api.runPackageAction)
+		protected.POST("/packages/:action", api.runFleetPackageAction)
 
 		// Fichiers
 		protected.GET("/agents/:id/files", api.listFiles)
@@ -120,12 +165,42 @@ func (api *APIServer) setupRoutes() {
 
 		// Services
 		protected.GET("/agents/:id/services", api.listServices)
+		protected.GET("/agents/:id/services/transitions", api.getServiceTransitions)
+		protected.GET("/agents/:id/services/flapping", api.getServiceFlapping)
 		protected.GET("/agents/:id/services/:service/status", api.getServiceStatus)
 		protected.POST("/agents/:id/services/:service/:action", api.executeServiceAction)
 
 		// Logs
 		protected.GET("/agents/:id/logs", api.listLogSources)
 		protected.GET("/agents/:id/logs/:source", api.getLogContent)
+		protected.GET("/agents/:id/logs/:source/export", api.exportLogs)
+
+		// Logs centralisés
+		protected.GET("/logs/search", api.searchLogs)
+		protected.GET("/logs/alerts", api.getLogAlerts)
+		protected.GET("/logs/alert-rules", api.getLogAlertRules)
+		protected.POST("/logs/alert-rules", api.createLogAlertRule)
+		protected.PUT("/logs/alert-rules/:id", api.updateLogAlertRule)
+		protected.DELETE("/logs/alert-rules/:id", api.deleteLogAlertRule)
+
+		// Alertes sur l'état des agents
+		protected.GET("/alerts", api.getAlerts)
+		protected.POST("/alerts/:id/ack", api.acknowledgeAlert)
+		protected.GET("/alert-rules", api.getAlertRules)
+		protected.POST("/alert-rules", api.createAlertRule)
+		protected.PUT("/alert-rules/:id", api.updateAlertRule)
+		protected.DELETE("/alert-rules/:id", api.deleteAlertRule)
+
+		// Notifications
+		protected.GET("/notification-channels", api.getNotificationChannels)
+		protected.POST("/notification-channels", api.createNotificationChannel)
+		protected.PUT("/notification-channels/:id", api.updateNotificationChannel)
+		protected.DELETE("/notification-channels/:id", api.deleteNotificationChannel)
+		protected.POST("/notification-channels/:id/test", api.testNotificationChannel)
+		protected.GET("/notifications", api.getNotificationLogs)
+
+		// Audit
+		protected.GET("/audit", api.getAuditLogs)
 
 	}
 
@@ -627,7 +702,7 @@ func (api *APIServer) executeCommand(c *gin.Context) {
 	}
 
 	// Créer un message de commande
-	msg := common.NewMessage(common.MessageTypeCommand, &cmdData)
+	msg := common.NewMessageWithID(common.MessageTypeCommand, fmt.Sprintf("%d", time.Now().UnixNano()), &cmdData)
 	msg.AgentID = agentID
 
 	// Envoyer la commande à l'agent
@@ -659,425 +734,528 @@ func (api *APIServer) getAgentPrinters(c *gin.Context) {
 	})
 }
 
-// getAgentSystem retourne les informations système d'un agent
-func (api *APIServer) getAgentSystem(c *gin.Context) {
-	agentID := c.Param("id")
-	agent, exists := api.hub.GetAgent(agentID)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+// executePrinterAction exécute une action sur la file d'une imprimante (activation, acceptation, page de test...)
+func (api *APIServer) executePrinterAction(c *gin.Context) {
+	action, ok := printerQueueActions[c.Param("action")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action inconnue"})
 		return
 	}
 
-	systemInfo := agent.GetSystemInfo()
-	c.JSON(http.StatusOK, gin.H{
-		"agent_id":    agentID,
-		"system_info": systemInfo,
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "corps de requête invalide"})
+			return
+		}
+	}
+
+	api.runPrinterAction(c, &common.PrinterActionRequest{
+		Printer: c.Param("name"),
+		Action:  action,
+		Reason:  body.Reason,
 	})
 }
 
-// listFiles liste les fichiers d'un agent
-func (api *APIServer) listFiles(c *gin.Context) {
-	agentID := c.Param("id")
-	agent, exists := api.hub.GetAgent(agentID)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+// executePrintJobAction exécute une action sur un travail d'impression (annulation, suspension, déplacement)
+func (api *APIServer) executePrintJobAction(c *gin.Context) {
+	action, ok := printerJobActions[c.Param("action")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action inconnue"})
 		return
 	}
 
-	path := c.Query("path")
-	if path == "" {
-		path = "."
+	var jobID int
+	if _, err := fmt.Sscanf(c.Param("job"), "%d", &jobID); err != nil || jobID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "identifiant de travail invalide"})
+		return
 	}
 
-	// Normaliser le chemin : "/" au lieu de "." pour la racine
-	if path == "." || path == "" {
-		path = "/"
+	var body struct {
+		Target string `json:"target"`
 	}
-
-	// Vérifier d'abord le cache (sauf si on force le rafraîchissement via paramètre _t)
-	forceRefresh := c.Query("_t") != ""
-	if !forceRefresh {
-		if files, exists := agent.GetFileCache(path); exists {
-			c.JSON(http.StatusOK, gin.H{
-				"files": files,
-				"path":  path,
-			})
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "corps de requête invalide"})
 			return
 		}
-	} else {
-		log.Printf("[API] listFiles - Rafraîchissement forcé du cache pour: %s", path)
-		agent.ClearFileCache(path)
 	}
 
-	// Si pas dans le cache, demander à l'agent de lister les fichiers
-	fileData := &common.FileData{Path: path}
-	msg := common.NewMessage(common.MessageTypeFileList, fileData)
-	msg.AgentID = agentID
+	api.runPrinterAction(c, &common.PrinterActionRequest{
+		Printer: c.Param("name"),
+		Action:  action,
+		JobID:   jobID,
+		Target:  body.Target,
+	})
+}
 
-	// Envoyer la demande avec réponse (timeout: 5s)
-	response, err := agent.SendMessageWithResponse(msg, 5*time.Second)
+// runPrinterAction transmet une action sur une imprimante à l'agent, l'audite et retourne son résultat
+func (api *APIServer) runPrinterAction(c *gin.Context, req *common.PrinterActionRequest) {
+	agentID := c.Param("id")
+	if _, exists := api.hub.GetAgent(agentID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	target := req.Printer
+	if req.JobID > 0 {
+		target = fmt.Sprintf("%s-%d", req.Printer, req.JobID)
+	}
+	details := req.Reason
+	if req.Target != "" {
+		details = "vers " + req.Target
+	}
+
+	result, err := api.hub.RunPrinterAction(agentID, req)
 	if err != nil {
-		log.Printf("[API] listFiles - Erreur lors de la demande: %v", err)
-		c.JSON(http.StatusOK, gin.H{
-			"files":   []*common.FileData{},
-			"path":    path,
-			"message": "délai d'attente dépassé, l'agent n'a pas répondu",
-		})
+		log.Printf("[API] runPrinterAction - ERREUR: %v", err)
+		api.audit(c, agentID, "printer."+req.Action, target, details, false, err.Error())
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Parser la réponse
-	var files []*common.FileData
-	if filesData, ok := response.Data.([]*common.FileData); ok {
-		files = filesData
-		// Mettre à jour le cache avec le bon chemin
-		agent.UpdateFileCache(path, files)
-	} else if filesInterface, ok := response.Data.([]interface{}); ok {
-		// Convertir []interface{} en []*common.FileData
-		files = make([]*common.FileData, 0, len(filesInterface))
-		for _, item := range filesInterface {
-			if fileMap, ok := item.(map[string]interface{}); ok {
-				fileData := &common.FileData{}
-				if pathVal, exists := fileMap["path"]; exists {
-					if pathStr, ok := pathVal.(string); ok {
-						fileData.Path = pathStr
-					}
-				}
-				if isDir, exists := fileMap["is_dir"]; exists {
-					if isDirBool, ok := isDir.(bool); ok {
-						fileData.IsDir = isDirBool
-					}
-				}
-				if size, exists := fileMap["size"]; exists {
-					if sizeFloat, ok := size.(float64); ok {
-						fileData.Size = int64(sizeFloat)
-					}
-				}
-				if mode, exists := fileMap["mode"]; exists {
-					if modeFloat, ok := mode.(float64); ok {
-						fileData.Mode = uint32(modeFloat)
-					}
-				}
-				if modified, exists := fileMap["modified"]; exists {
-					if modifiedStr, ok := modified.(string); ok {
-						if modifiedTime, err := time.Parse(time.RFC3339, modifiedStr); err == nil {
-							fileData.Modified = modifiedTime
-						}
-					}
-				}
-				files = append(files, fileData)
-			}
-		}
-		// Mettre à jour le cache avec le bon chemin
-		agent.UpdateFileCache(path, files)
-	} else {
-		log.Printf("[API] listFiles - Format de données inattendu: %T", response.Data)
-		files = []*common.FileData{}
+	api.audit(c, agentID, "printer."+req.Action, target, details, result.Success, result.Error)
+
+	if !result.Success {
+		c.JSON(http.StatusBadRequest, gin.H{"error": result.Error, "result": result})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"files": files,
-		"path":  path,
-	})
+	c.JSON(http.StatusOK, result)
 }
 
-// uploadFile upload un fichier vers un agent
-func (api *APIServer) uploadFile(c *gin.Context) {
+// submitPrintJob imprime un document sur une imprimante d'un agent
+// Formulaire multipart: file, et optionnellement title, format (pdf, postscript, text, raw), copies, duplex, media et pages
+func (api *APIServer) submitPrintJob(c *gin.Context) {
 	agentID := c.Param("id")
-	agent, exists := api.hub.GetAgent(agentID)
-	if !exists {
+	if _, exists := api.hub.GetAgent(agentID); !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
 		return
 	}
 
-	// Récupérer le fichier uploadé
 	file, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "fichier manquant"})
 		return
 	}
-
-	path := c.PostForm("path")
-	if path == "" {
-		path = file.Filename
+	if file.Size > maxPrintDocumentSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("document trop volumineux (%d Mo maximum)", maxPrintDocumentSize/(1024*1024))})
+		return
 	}
 
-	// Ouvrir le fichier
 	src, err := file.Open()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'ouverture du fichier"})
 		return
 	}
-	defer src.Close()
-
-	// Lire le fichier par chunks
-	chunks := make([]*common.FileChunk, 0)
-	buffer := make([]byte, 64*1024) // 64KB chunks
-	offset := int64(0)
+	data, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur de lecture du fichier"})
+		return
+	}
 
-	for {
-		n, err := src.Read(buffer)
-		if err != nil && err != io.EOF {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur de lecture du fichier"})
+	req := &common.PrintSubmitRequest{
+		Printer: c.Param("name"),
+		Title:   c.PostForm("title"),
+		Format:  c.PostForm("format"),
+		Options: common.PrintOptions{
+			Duplex:     c.PostForm("duplex"),
+			Media:      c.PostForm("media"),
+			PageRanges: c.PostForm("pages"),
+		},
+		Chunks: printChunks(file.Filename, data),
+	}
+	if req.Title == "" {
+		req.Title = file.Filename
+	}
+	if req.Format == "" {
+		req.Format = detectPrintFormat(data)
+	}
+	if copies := c.PostForm("copies"); copies != "" {
+		if _, err := fmt.Sscanf(copies, "%d", &req.Options.Copies); err != nil || req.Options.Copies < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "nombre d'exemplaires invalide"})
 			return
 		}
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-		if n == 0 {
-			break
-		}
-
-		chunk := &common.FileChunk{
-			Path:   path,
-			Offset: offset,
-			Data:   make([]byte, n),
-			IsLast: false,
-		}
-		copy(chunk.Data, buffer[:n])
+	details := fmt.Sprintf("%s (%s, %d octets)", req.Title, req.Format, len(data))
+	if req.Options.Copies > 1 {
+		details += fmt.Sprintf(", %d exemplaires", req.Options.Copies)
+	}
 
-		chunks = append(chunks, chunk)
-		offset += int64(n)
+	result, err := api.hub.SubmitPrintJob(agentID, req)
+	if err != nil {
+		log.Printf("[API] submitPrintJob - ERREUR: %v", err)
+		api.audit(c, agentID, "printer.print", req.Printer, details, false, err.Error())
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		return
+	}
 
-		if err == io.EOF {
-			chunk.IsLast = true
-			break
-		}
+	target := req.Printer
+	if result.JobID > 0 {
+		target = fmt.Sprintf("%s-%d", req.Printer, result.JobID)
 	}
+	api.audit(c, agentID, "printer.print", target, details, result.Success, result.Error)
 
-	// Envoyer les chunks à l'agent et attendre la confirmation
-	msg := common.NewMessage(common.MessageTypeFileUpload, chunks)
-	msg.AgentID = agentID
+	if !result.Success {
+		c.JSON(http.StatusBadRequest, gin.H{"error": result.Error, "result": result})
+		return
+	}
 
-	log.Printf("[API] uploadFile - Envoi de %d chunks à l'agent %s, ID message: %s", len(chunks), agentID, msg.ID)
+	c.JSON(http.StatusOK, result)
+}
 
-	// Attendre la réponse de l'agent (timeout de 30 secondes)
-	response, err := agent.SendMessageWithResponse(msg, 30*time.Second)
-	if err != nil {
-		log.Printf("[API] uploadFile - Erreur lors de l'upload du fichier: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi du fichier ou timeout"})
+// discoverPrinters recherche les imprimantes présentes sur le réseau d'un agent (mDNS et diffusion SNMP)
+// Paramètres: ?timeout=secondes, ?methods=mdns,snmp, ?community=public
+func (api *APIServer) discoverPrinters(c *gin.Context) {
+	agentID := c.Param("id")
+	if _, exists := api.hub.GetAgent(agentID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
 		return
 	}
 
-	log.Printf("[API] uploadFile - Réponse reçue de l'agent, Type: %s, ID: %s", response.Type, response.ID)
-
-	// Vérifier si l'agent a renvoyé une erreur
-	if response.Type == common.MessageTypeFileError || response.Type == common.MessageTypeError {
-		var errorData *common.ErrorData
-		if errData, ok := response.Data.(*common.ErrorData); ok {
-			errorData = errData
-		} else if errMap, ok := response.Data.(map[string]interface{}); ok {
-			errorData = &common.ErrorData{}
-			if msg, ok := errMap["message"].(string); ok {
-				errorData.Message = msg
-			}
-			if code, ok := errMap["code"].(string); ok {
-				errorData.Code = code
-			}
-		}
-		errorMsg := "erreur lors de l'upload du fichier"
-		if errorData != nil && errorData.Message != "" {
-			errorMsg = errorData.Message
+	req := &common.PrinterDiscoveryRequest{Community: c.Query("community")}
+	if timeout := c.Query("timeout"); timeout != "" {
+		if _, err := fmt.Sscanf(timeout, "%d", &req.Timeout); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "durée de découverte invalide"})
+			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": errorMsg})
+	}
+	if methods := c.Query("methods"); methods != "" {
+		req.Methods = strings.Split(methods, ",")
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Vérifier que c'est bien une confirmation de complétion
-	if response.Type != common.MessageTypeFileComplete {
-		log.Printf("[API] uploadFile - Réponse inattendue: Type=%s (attendu: %s), ID=%s", response.Type, common.MessageTypeFileComplete, response.ID)
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "réponse inattendue de l'agent",
-			"response_type": string(response.Type),
-			"expected_type": string(common.MessageTypeFileComplete),
-		})
+	result, err := api.hub.DiscoverPrinters(agentID, req)
+	if err != nil {
+		log.Printf("[API] discoverPrinters - ERREUR: %v", err)
+		api.audit(c, agentID, "printer.discover", "", strings.Join(req.Methods, ","), false, err.Error())
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
 		return
 	}
+	api.audit(c, agentID, "printer.discover", "", fmt.Sprintf("%d imprimante(s) trouvée(s)", len(result.Printers)), true, "")
 
-	log.Printf("[API] uploadFile - Confirmation reçue, upload réussi pour %s", path)
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id": agentID,
+		"printers": result.Printers,
+		"count":    len(result.Printers),
+		"errors":   result.Errors,
+		"duration": result.Duration,
+	})
+}
 
-	// Invalider le cache des fichiers pour le répertoire parent
-	// pour forcer une relecture lors du prochain listFiles
-	parentPath := getParentPath(path)
-	if parentPath != "" {
-		log.Printf("[API] uploadFile - Invalidation du cache pour le répertoire parent: %s", parentPath)
-		agent.ClearFileCache(parentPath)
+// getPrinterDrivers recherche parmi les pilotes d'impression installés sur un agent (?search=, ?limit=)
+func (api *APIServer) getPrinterDrivers(c *gin.Context) {
+	agentID := c.Param("id")
+	if _, exists := api.hub.GetAgent(agentID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
 	}
 
-	// Enregistrer l'opération dans les logs
-	if api.db != nil {
-		fileLog := &FileLog{
-			AgentID:   agentID,
-			Operation: "upload",
-			Path:      path,
-			Size:      file.Size,
-			Success:   true,
-			CreatedAt: time.Now(),
-		}
-		if err := api.db.LogFile(fileLog); err != nil {
-			log.Printf("Erreur lors de l'enregistrement du log d'upload: %v", err)
+	req := &common.PrinterDriverRequest{Search: c.Query("search")}
+	if limit := c.Query("limit"); limit != "" {
+		if _, err := fmt.Sscanf(limit, "%d", &req.Limit); err != nil || req.Limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limite invalide"})
+			return
 		}
 	}
 
+	list, err := api.hub.ListPrinterDrivers(agentID, req)
+	if err != nil {
+		log.Printf("[API] getPrinterDrivers - ERREUR: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "fichier uploadé",
-		"path":    path,
-		"size":    file.Size,
+		"agent_id":  agentID,
+		"drivers":   list.Drivers,
+		"count":     len(list.Drivers),
+		"truncated": list.Truncated,
 	})
 }
 
-// getParentPath extrait le chemin parent d'un chemin de fichier
-func getParentPath(filePath string) string {
-	if filePath == "" || filePath == "/" {
-		return "/"
-	}
+// printerQueueBody contient la configuration d'une file d'impression à créer ou modifier
+type printerQueueBody struct {
+	Name        string            `json:"name"` // Création uniquement, le nom est pris dans l'URL en modification
+	URI         string            `json:"uri"`
+	Driver      string            `json:"driver"`
+	PPD         []byte            `json:"ppd"` // Contenu du fichier PPD encodé en base64
+	Description string            `json:"description"`
+	Location    string            `json:"location"`
+	Shared      *bool             `json:"shared"`
+	Default     bool              `json:"default"`
+	Options     map[string]string `json:"options"`
+}
 
-	// Normaliser les séparateurs
-	filePath = strings.ReplaceAll(filePath, "\\", "/")
-	
-	// Enlever le dernier séparateur s'il existe
-	filePath = strings.TrimSuffix(filePath, "/")
-	
-	// Trouver le dernier séparateur
-	lastSlash := strings.LastIndex(filePath, "/")
-	if lastSlash == -1 {
-		return "/"
+// createPrinterQueue crée une file d'impression à partir d'un appareil découvert ou d'une URI
+// Sans pilote ni PPD, la file est créée en IPP Everywhere
+func (api *APIServer) createPrinterQueue(c *gin.Context) {
+	var body printerQueueBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "corps de requête invalide"})
+		return
 	}
-	
-	// Extraire le parent
-	parent := filePath[:lastSlash]
-	if parent == "" {
-		return "/"
+	api.runPrinterQueueOperation(c, common.PrinterQueueCreate, body.Name, &body)
+}
+
+// updatePrinterQueue modifie l'URI, le pilote ou les réglages d'une file d'impression
+func (api *APIServer) updatePrinterQueue(c *gin.Context) {
+	var body printerQueueBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "corps de requête invalide"})
+		return
 	}
-	
-	return parent
+	api.runPrinterQueueOperation(c, common.PrinterQueueModify, c.Param("name"), &body)
 }
 
-// downloadFile télécharge un fichier depuis un agent
-func (api *APIServer) downloadFile(c *gin.Context) {
+// deletePrinterQueue supprime une file d'impression
+func (api *APIServer) deletePrinterQueue(c *gin.Context) {
+	api.runPrinterQueueOperation(c, common.PrinterQueueDelete, c.Param("name"), &printerQueueBody{})
+}
+
+// runPrinterQueueOperation transmet une opération sur une file à l'agent, l'audite et retourne son résultat
+func (api *APIServer) runPrinterQueueOperation(c *gin.Context, operation, name string, body *printerQueueBody) {
 	agentID := c.Param("id")
-	agent, exists := api.hub.GetAgent(agentID)
-	if !exists {
+	if _, exists := api.hub.GetAgent(agentID); !exists {
 		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
 		return
 	}
-
-	path := c.Query("path")
-	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "chemin manquant"})
+	if len(body.PPD) > maxPrinterPPDSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("fichier PPD trop volumineux (%d Mo maximum)", maxPrinterPPDSize/(1024*1024))})
 		return
 	}
 
-	// Créer un message de demande de téléchargement
-	fileData := &common.FileData{Path: path}
-	msg := common.NewMessage(common.MessageTypeFileDownload, fileData)
-	msg.AgentID = agentID
+	req := &common.PrinterQueueRequest{
+		Operation:   operation,
+		Name:        name,
+		URI:         body.URI,
+		Driver:      body.Driver,
+		Description: body.Description,
+		Location:    body.Location,
+		Shared:      body.Shared,
+		Default:     body.Default,
+		Options:     body.Options,
+	}
+	if len(body.PPD) > 0 {
+		req.PPD = printChunks(name+".ppd", body.PPD)
+	}
+	if err := req.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// Envoyer la demande à l'agent
-	if err := agent.SendMessage(msg); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi de la demande"})
+	var details []string
+	if req.URI != "" {
+		details = append(details, req.URI)
+	}
+	if len(req.PPD) > 0 {
+		details = append(details, fmt.Sprintf("PPD fourni (%d octets)", len(body.PPD)))
+	} else if req.Driver != "" {
+		details = append(details, "pilote "+req.Driver)
+	}
+
+	result, err := api.hub.ManagePrinterQueue(agentID, req)
+	if err != nil {
+		log.Printf("[API] runPrinterQueueOperation - ERREUR: %v", err)
+		api.audit(c, agentID, "printer."+operation, name, strings.Join(details, ", "), false, err.Error())
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		return
+	}
+
+	api.audit(c, agentID, "printer."+operation, name, strings.Join(details, ", "), result.Success, result.Error)
+
+	if !result.Success {
+		c.JSON(http.StatusBadRequest, gin.H{"error": result.Error, "result": result})
+		return
+	}
+
+	status := http.StatusOK
+	if operation == common.PrinterQueueCreate {
+		status = http.StatusCreated
+	}
+	c.JSON(status, result)
+}
+
+// printerHistoryPeriod lit la période demandée: ?days=N (défaut defaultDays) ou ?from=&to= au format RFC3339
+func printerHistoryPeriod(c *gin.Context, defaultDays int) (time.Time, time.Time, bool) {
+	to := time.Now()
+	if toStr := c.Query("to"); toStr != "" {
+		t, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre to invalide (format RFC3339 attendu)"})
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+
+	days := defaultDays
+	if daysStr := c.Query("days"); daysStr != "" {
+		if _, err := fmt.Sscanf(daysStr, "%d", &days); err != nil || days <= 0 || days > 400 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre days invalide (1 à 400)"})
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	from := to.AddDate(0, 0, -days)
+	if fromStr := c.Query("from"); fromStr != "" {
+		t, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre from invalide (format RFC3339 attendu)"})
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "la date de début doit précéder la date de fin"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// getPrinterHistory retourne les changements d'état d'une imprimante
+func (api *APIServer) getPrinterHistory(c *gin.Context) {
+	if api.db == nil || api.hub.printerLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	from, to, ok := printerHistoryPeriod(c, 7)
+	if !ok {
+		return
+	}
+
+	agentID, printer := c.Param("id"), c.Param("name")
+	logs, err := api.db.GetPrinterHistory(agentID, printer, from, to)
+	if err != nil {
+		log.Printf("[API] getPrinterHistory - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération de l'historique"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "demande de téléchargement envoyée",
-		"path":    path,
+		"agent_id": agentID,
+		"printer":  printer,
+		"from":     from,
+		"to":       to,
+		"entries":  logs,
+		"count":    len(logs),
 	})
 }
 
-// deleteFile supprime un fichier sur un agent
-func (api *APIServer) deleteFile(c *gin.Context) {
-	agentID := c.Param("id")
-	agent, exists := api.hub.GetAgent(agentID)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+// getPrinterJobs retourne les travaux terminés d'une imprimante
+func (api *APIServer) getPrinterJobs(c *gin.Context) {
+	if api.db == nil || api.hub.printerLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
 		return
 	}
 
-	path := c.Query("path")
-	if path == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "chemin manquant"})
+	from, to, ok := printerHistoryPeriod(c, 7)
+	if !ok {
 		return
 	}
 
-	// Créer un message de suppression de fichier
-	fileData := &common.FileData{Path: path}
-	msg := common.NewMessage(common.MessageTypeFileDelete, fileData)
-	msg.AgentID = agentID
+	limit := 200
+	if limitStr := c.Query("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &limit)
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
 
-	// Envoyer la demande à l'agent et attendre la confirmation
-	response, err := agent.SendMessageWithResponse(msg, 10*time.Second)
+	agentID, printer := c.Param("id"), c.Param("name")
+	jobs, err := api.db.GetPrintJobs(agentID, printer, from, to, limit)
 	if err != nil {
-		log.Printf("Erreur lors de la suppression du fichier: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi de la demande ou timeout"})
+		log.Printf("[API] getPrinterJobs - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des travaux"})
 		return
 	}
 
-	// Vérifier si l'agent a renvoyé une erreur
-	if response.Type == common.MessageTypeFileError || response.Type == common.MessageTypeError {
-		var errorData *common.ErrorData
-		if errData, ok := response.Data.(*common.ErrorData); ok {
-			errorData = errData
-		} else if errMap, ok := response.Data.(map[string]interface{}); ok {
-			errorData = &common.ErrorData{}
-			if msg, ok := errMap["message"].(string); ok {
-				errorData.Message = msg
-			}
-			if code, ok := errMap["code"].(string); ok {
-				errorData.Code = code
-			}
-		}
-		errorMsg := "erreur lors de la suppression du fichier"
-		if errorData != nil && errorData.Message != "" {
-			errorMsg = errorData.Message
-		}
-		
-		// Enregistrer l'erreur dans les logs
-		if api.db != nil {
-			fileLog := &FileLog{
-				AgentID:   agentID,
-				Operation: "delete",
-				Path:      path,
-				Success:   false,
-				Error:     errorMsg,
-				CreatedAt: time.Now(),
-			}
-			if err := api.db.LogFile(fileLog); err != nil {
-				log.Printf("Erreur lors de l'enregistrement du log de suppression: %v", err)
-			}
-		}
-		
-		c.JSON(http.StatusInternalServerError, gin.H{"error": errorMsg})
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id": agentID,
+		"printer":  printer,
+		"jobs":     jobs,
+		"count":    len(jobs),
+	})
+}
+
+// getPrinterStats retourne les travaux et pages par jour, la fréquence des erreurs et le temps passé en erreur d'une imprimante
+func (api *APIServer) getPrinterStats(c *gin.Context) {
+	if api.db == nil || api.hub.printerLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
 		return
 	}
 
-	// Invalider le cache des fichiers pour le répertoire parent
-	parentPath := getParentPath(path)
-	if parentPath != "" {
-		log.Printf("[API] deleteFile - Invalidation du cache pour le répertoire parent: %s", parentPath)
-		agent.ClearFileCache(parentPath)
+	from, to, ok := printerHistoryPeriod(c, 30)
+	if !ok {
+		return
 	}
 
-	// Enregistrer l'opération réussie dans les logs
-	if api.db != nil {
-		fileLog := &FileLog{
-			AgentID:   agentID,
-			Operation: "delete",
-			Path:      path,
-			Success:   true,
-			CreatedAt: time.Now(),
-		}
-		if err := api.db.LogFile(fileLog); err != nil {
-			log.Printf("Erreur lors de l'enregistrement du log de suppression: %v", err)
+	stats, err := api.hub.printerLog.Stats(c.Param("id"), c.Param("name"), from, to)
+	if err != nil {
+		log.Printf("[API] getPrinterStats - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors du calcul des statistiques"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// getPrinterSupplies retourne l'historique des niveaux de consommables d'une imprimante et l'estimation de leur épuisement
+func (api *APIServer) getPrinterSupplies(c *gin.Context) {
+	if api.db == nil || api.hub.printerLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	from, _, ok := printerHistoryPeriod(c, 90)
+	if !ok {
+		return
+	}
+
+	agentID, printer := c.Param("id"), c.Param("name")
+
+	// L'état actuel de l'imprimante, si l'agent est connecté, prolonge le dernier relevé jusqu'à maintenant
+	var current *common.PrinterInfo
+	if agent, exists := api.hub.GetAgent(agentID); exists {
+		for _, info := range agent.GetPrinters() {
+			if info != nil && info.Name == printer {
+				current = info
+				break
+			}
 		}
 	}
 
+	supplies, err := api.hub.printerLog.Supplies(agentID, printer, from, current)
+	if err != nil {
+		log.Printf("[API] getPrinterSupplies - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des consommables"})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "fichier supprimé",
-		"path":    path,
+		"agent_id": agentID,
+		"printer":  printer,
+		"supplies": supplies,
+		"count":    len(supplies),
 	})
 }
 
-// createDirectory crée un répertoire sur un agent
-func (api *APIServer) createDirectory(c *gin.Context) {
+// getAgentSystem retourne les informations système d'un agent
+func (api *APIServer) getAgentSystem(c *gin.Context) {
 	agentID := c.Param("id")
 	agent, exists := api.hub.GetAgent(agentID)
 	if !exists {
@@ -1085,417 +1263,2277 @@ func (api *APIServer) createDirectory(c *gin.Context) {
 		return
 	}
 
-	var req struct {
-		Path string `json:"path" binding:"required"`
-	}
+	systemInfo := agent.GetSystemInfo()
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id":    agentID,
+		"system_info": systemInfo,
+	})
+}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "chemin manquant"})
+// listFiles liste les fichiers d'un agent
+func (api *APIServer) listFiles(c *gin.Context) {
+	agentID := c.Param("id")
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
 		return
 	}
 
-	// Créer un message de création de répertoire
-	fileData := &common.FileData{Path: req.Path, IsDir: true}
-	msg := common.NewMessage(common.MessageTypeFileCreateDir, fileData)
+	path := c.Query("path")
+	if path == "" {
+		path = "."
+	}
+
+	// Normaliser le chemin : "/" au lieu de "." pour la racine
+	if path == "." || path == "" {
+		path = "/"
+	}
+
+	// Vérifier d'abord le cache (sauf si on force le rafraîchissement via paramètre _t)
+	forceRefresh := c.Query("_t") != ""
+	if !forceRefresh {
+		if files, exists := agent.GetFileCache(path); exists {
+			c.JSON(http.StatusOK, gin.H{
+				"files": files,
+				"path":  path,
+			})
+			return
+		}
+	} else {
+		log.Printf("[API] listFiles - Rafraîchissement forcé du cache pour: %s", path)
+		agent.ClearFileCache(path)
+	}
+
+	// Si pas dans le cache, demander à l'agent de lister les fichiers
+	fileData := &common.FileData{Path: path}
+	msg := common.NewMessage(common.MessageTypeFileList, fileData)
 	msg.AgentID = agentID
 
-	// Envoyer la demande à l'agent et attendre la confirmation
-	response, err := agent.SendMessageWithResponse(msg, 10*time.Second)
+	// Envoyer la demande avec réponse (timeout: 5s)
+	response, err := agent.SendMessageWithResponse(msg, 5*time.Second)
 	if err != nil {
-		log.Printf("Erreur lors de la création du répertoire: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi de la demande ou timeout"})
+		log.Printf("[API] listFiles - Erreur lors de la demande: %v", err)
+		c.JSON(http.StatusOK, gin.H{
+			"files":   []*common.FileData{},
+			"path":    path,
+			"message": "délai d'attente dépassé, l'agent n'a pas répondu",
+		})
 		return
 	}
 
-	// Vérifier si l'agent a renvoyé une erreur
-	if response.Type == common.MessageTypeFileError || response.Type == common.MessageTypeError {
-		var errorData *common.ErrorData
-		if errData, ok := response.Data.(*common.ErrorData); ok {
-			errorData = errData
-		} else if errMap, ok := response.Data.(map[string]interface{}); ok {
-			errorData = &common.ErrorData{}
-			if msg, ok := errMap["message"].(string); ok {
-				errorData.Message = msg
-			}
-			if code, ok := errMap["code"].(string); ok {
-				errorData.Code = code
-			}
-		}
-		errorMsg := "erreur lors de la création du répertoire"
-		if errorData != nil && errorData.Message != "" {
-			errorMsg = errorData.Message
-		}
-		
-		// Enregistrer l'erreur dans les logs
-		if api.db != nil {
-			fileLog := &FileLog{
-				AgentID:   agentID,
-				Operation: "create_dir",
-				Path:      req.Path,
-				Success:   false,
-				Error:     errorMsg,
-				CreatedAt: time.Now(),
-			}
-			if err := api.db.LogFile(fileLog); err != nil {
-				log.Printf("Erreur lors de l'enregistrement du log de création de répertoire: %v", err)
-			}
+	// Parser la réponse
+	var files []*common.FileData
+	if filesData, err := common.DecodePayload[[]*common.FileData](response); err == nil {
+		files = *filesData
+		if files == nil {
+			files = []*common.FileData{}
 		}
-		
-		c.JSON(http.StatusInternalServerError, gin.H{"error": errorMsg})
+		// Mettre à jour le cache avec le bon chemin
+		agent.UpdateFileCache(path, files)
+	} else {
+		log.Printf("[API] listFiles - Réponse inattendue (%s): %v", response.Type, err)
+		files = []*common.FileData{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"files": files,
+		"path":  path,
+	})
+}
+
+// uploadFile upload un fichier vers un agent
+func (api *APIServer) uploadFile(c *gin.Context) {
+	agentID := c.Param("id")
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
 		return
 	}
 
-	// Invalider le cache des fichiers pour le répertoire parent
-	parentPath := getParentPath(req.Path)
-	if parentPath != "" {
-		log.Printf("[API] createDirectory - Invalidation du cache pour le répertoire parent: %s", parentPath)
-		agent.ClearFileCache(parentPath)
+	// Récupérer le fichier uploadé
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "fichier manquant"})
+		return
+	}
+
+	path := c.PostForm("path")
+	if path == "" {
+		path = file.Filename
+	}
+
+	// Ouvrir le fichier
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'ouverture du fichier"})
+		return
+	}
+	defer src.Close()
+
+	// Lire le fichier par chunks
+	chunks := make([]*common.FileChunk, 0)
+	buffer := make([]byte, 64*1024) // 64KB chunks
+	offset := int64(0)
+
+	for {
+		n, err := src.Read(buffer)
+		if err != nil && err != io.EOF {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur de lecture du fichier"})
+			return
+		}
+
+		if n == 0 {
+			break
+		}
+
+		chunk := &common.FileChunk{
+			Path:   path,
+			Offset: offset,
+			Data:   make([]byte, n),
+			IsLast: false,
+		}
+		copy(chunk.Data, buffer[:n])
+
+		chunks = append(chunks, chunk)
+		offset += int64(n)
+
+		if err == io.EOF {
+			chunk.IsLast = true
+			break
+		}
+	}
+
+	// Envoyer les chunks à l'agent et attendre la confirmation
+	msg := common.NewMessage(common.MessageTypeFileUpload, chunks)
+	msg.AgentID = agentID
+
+	log.Printf("[API] uploadFile - Envoi de %d chunks à l'agent %s, ID message: %s", len(chunks), agentID, msg.ID)
+
+	// Attendre la réponse de l'agent (timeout de 30 secondes)
+	response, err := agent.SendMessageWithResponse(msg, 30*time.Second)
+	if err != nil {
+		log.Printf("[API] uploadFile - Erreur lors de l'upload du fichier: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi du fichier ou timeout"})
+		return
+	}
+
+	log.Printf("[API] uploadFile - Réponse reçue de l'agent, Type: %s, ID: %s", response.Type, response.ID)
+
+	// Vérifier si l'agent a renvoyé une erreur
+	if response.Type == common.MessageTypeFileError || response.Type == common.MessageTypeError {
+		errorMsg := "erreur lors de l'upload du fichier"
+		if errorData, err := common.DecodePayload[common.ErrorData](response); err != nil {
+			log.Printf("[API] Réponse d'erreur de l'agent invalide: %v", err)
+		} else if errorData.Message != "" {
+			errorMsg = errorData.Message
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errorMsg})
+		return
+	}
+
+	// Vérifier que c'est bien une confirmation de complétion
+	if response.Type != common.MessageTypeFileComplete {
+		log.Printf("[API] uploadFile - Réponse inattendue: Type=%s (attendu: %s), ID=%s", response.Type, common.MessageTypeFileComplete, response.ID)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": "réponse inattendue de l'agent",
+			"response_type": string(response.Type),
+			"expected_type": string(common.MessageTypeFileComplete),
+		})
+		return
+	}
+
+	log.Printf("[API] uploadFile - Confirmation reçue, upload réussi pour %s", path)
+
+	// Invalider le cache des fichiers pour le répertoire parent
+	// pour forcer une relecture lors du prochain listFiles
+	parentPath := getParentPath(path)
+	if parentPath != "" {
+		log.Printf("[API] uploadFile - Invalidation du cache pour le répertoire parent: %s", parentPath)
+		agent.ClearFileCache(parentPath)
+	}
+
+	// Enregistrer l'opération dans les logs
+	if api.db != nil {
+		fileLog := &FileLog{
+			AgentID:   agentID,
+			Operation: "upload",
+			Path:      path,
+			Size:      file.Size,
+			Success:   true,
+			CreatedAt: time.Now(),
+		}
+		if err := api.db.LogFile(fileLog); err != nil {
+			log.Printf("Erreur lors de l'enregistrement du log d'upload: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "fichier uploadé",
+		"path":    path,
+		"size":    file.Size,
+	})
+}
+
+// getParentPath extrait le chemin parent d'un chemin de fichier
+func getParentPath(filePath string) string {
+	if filePath == "" || filePath == "/" {
+		return "/"
+	}
+
+	// Normaliser les séparateurs
+	filePath = strings.ReplaceAll(filePath, "\\", "/")
+	
+	// Enlever le dernier séparateur s'il existe
+	filePath = strings.TrimSuffix(filePath, "/")
+	
+	// Trouver le dernier séparateur
+	lastSlash := strings.LastIndex(filePath, "/")
+	if lastSlash == -1 {
+		return "/"
+	}
+	
+	// Extraire le parent
+	parent := filePath[:lastSlash]
+	if parent == "" {
+		return "/"
+	}
+	
+	return parent
+}
+
+// downloadFile télécharge un fichier depuis un agent
+func (api *APIServer) downloadFile(c *gin.Context) {
+	agentID := c.Param("id")
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	path := c.Query("path")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chemin manquant"})
+		return
+	}
+
+	// Créer un message de demande de téléchargement
+	fileData := &common.FileData{Path: path}
+	msg := common.NewMessage(common.MessageTypeFileDownload, fileData)
+	msg.AgentID = agentID
+
+	// Envoyer la demande à l'agent
+	if err := agent.SendMessage(msg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi de la demande"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "demande de téléchargement envoyée",
+		"path":    path,
+	})
+}
+
+// deleteFile supprime un fichier sur un agent
+func (api *APIServer) deleteFile(c *gin.Context) {
+	agentID := c.Param("id")
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	path := c.Query("path")
+	if path == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chemin manquant"})
+		return
+	}
+
+	// Créer un message de suppression de fichier
+	fileData := &common.FileData{Path: path}
+	msg := common.NewMessage(common.MessageTypeFileDelete, fileData)
+	msg.AgentID = agentID
+
+	// Envoyer la demande à l'agent et attendre la confirmation
+	response, err := agent.SendMessageWithResponse(msg, 10*time.Second)
+	if err != nil {
+		log.Printf("Erreur lors de la suppression du fichier: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi de la demande ou timeout"})
+		return
+	}
+
+	// Vérifier si l'agent a renvoyé une erreur
+	if response.Type == common.MessageTypeFileError || response.Type == common.MessageTypeError {
+		errorMsg := "erreur lors de la suppression du fichier"
+		if errorData, err := common.DecodePayload[common.ErrorData](response); err != nil {
+			log.Printf("[API] Réponse d'erreur de l'agent invalide: %v", err)
+		} else if errorData.Message != "" {
+			errorMsg = errorData.Message
+		}
+		
+		// Enregistrer l'erreur dans les logs
+		if api.db != nil {
+			fileLog := &FileLog{
+				AgentID:   agentID,
+				Operation: "delete",
+				Path:      path,
+				Success:   false,
+				Error:     errorMsg,
+				CreatedAt: time.Now(),
+			}
+			if err := api.db.LogFile(fileLog); err != nil {
+				log.Printf("Erreur lors de l'enregistrement du log de suppression: %v", err)
+			}
+		}
+		
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errorMsg})
+		return
+	}
+
+	// Invalider le cache des fichiers pour le répertoire parent
+	parentPath := getParentPath(path)
+	if parentPath != "" {
+		log.Printf("[API] deleteFile - Invalidation du cache pour le répertoire parent: %s", parentPath)
+		agent.ClearFileCache(parentPath)
 	}
 
 	// Enregistrer l'opération réussie dans les logs
 	if api.db != nil {
 		fileLog := &FileLog{
 			AgentID:   agentID,
-			Operation: "create_dir",
-			Path:      req.Path,
+			Operation: "delete",
+			Path:      path,
 			Success:   true,
 			CreatedAt: time.Now(),
 		}
 		if err := api.db.LogFile(fileLog); err != nil {
-			log.Printf("Erreur lors de l'enregistrement du log de création de répertoire: %v", err)
+			log.Printf("Erreur lors de l'enregistrement du log de suppression: %v", err)
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "répertoire créé",
-		"path":    req.Path,
+		"message": "fichier supprimé",
+		"path":    path,
+	})
+}
+
+// createDirectory crée un répertoire sur un agent
+func (api *APIServer) createDirectory(c *gin.Context) {
+	agentID := c.Param("id")
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	var req struct {
+		Path string `json:"path" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "chemin manquant"})
+		return
+	}
+
+	// Créer un message de création de répertoire
+	fileData := &common.FileData{Path: req.Path, IsDir: true}
+	msg := common.NewMessage(common.MessageTypeFileCreateDir, fileData)
+	msg.AgentID = agentID
+
+	// Envoyer la demande à l'agent et attendre la confirmation
+	response, err := agent.SendMessageWithResponse(msg, 10*time.Second)
+	if err != nil {
+		log.Printf("Erreur lors de la création du répertoire: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi de la demande ou timeout"})
+		return
+	}
+
+	// Vérifier si l'agent a renvoyé une erreur
+	if response.Type == common.MessageTypeFileError || response.Type == common.MessageTypeError {
+		errorMsg := "erreur lors de la création du répertoire"
+		if errorData, err := common.DecodePayload[common.ErrorData](response); err != nil {
+			log.Printf("[API] Réponse d'erreur de l'agent invalide: %v", err)
+		} else if errorData.Message != "" {
+			errorMsg = errorData.Message
+		}
+		
+		// Enregistrer l'erreur dans les logs
+		if api.db != nil {
+			fileLog := &FileLog{
+				AgentID:   agentID,
+				Operation: "create_dir",
+				Path:      req.Path,
+				Success:   false,
+				Error:     errorMsg,
+				CreatedAt: time.Now(),
+			}
+			if err := api.db.LogFile(fileLog); err != nil {
+				log.Printf("Erreur lors de l'enregistrement du log de création de répertoire: %v", err)
+			}
+		}
+		
+		c.JSON(http.StatusInternalServerError, gin.H{"error": errorMsg})
+		return
+	}
+
+	// Invalider le cache des fichiers pour le répertoire parent
+	parentPath := getParentPath(req.Path)
+	if parentPath != "" {
+		log.Printf("[API] createDirectory - Invalidation du cache pour le répertoire parent: %s", parentPath)
+		agent.ClearFileCache(parentPath)
+	}
+
+	// Enregistrer l'opération réussie dans les logs
+	if api.db != nil {
+		fileLog := &FileLog{
+			AgentID:   agentID,
+			Operation: "create_dir",
+			Path:      req.Path,
+			Success:   true,
+			CreatedAt: time.Now(),
+		}
+		if err := api.db.LogFile(fileLog); err != nil {
+			log.Printf("Erreur lors de l'enregistrement du log de création de répertoire: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "répertoire créé",
+		"path":    req.Path,
+	})
+}
+
+// getServiceTransitions retourne les changements d'état des services d'un agent
+// ?service= et ?type= restreignent la recherche à un service ou un type de service
+func (api *APIServer) getServiceTransitions(c *gin.Context) {
+	if api.db == nil || api.hub.serviceLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	from, to, ok := printerHistoryPeriod(c, 7)
+	if !ok {
+		return
+	}
+
+	limit := 500
+	if limitStr := c.Query("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &limit)
+	}
+	if limit <= 0 || limit > 5000 {
+		limit = 500
+	}
+
+	agentID := c.Param("id")
+	service, serviceType := c.Query("service"), c.Query("type")
+	transitions, err := api.db.GetServiceTransitions(agentID, service, serviceType, from, to, limit)
+	if err != nil {
+		log.Printf("[API] getServiceTransitions - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération de l'historique"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id":    agentID,
+		"service":     service,
+		"type":        serviceType,
+		"from":        from,
+		"to":          to,
+		"transitions": transitions,
+		"count":       len(transitions),
+	})
+}
+
+// getServiceFlapping retourne les services d'un agent sortis plusieurs fois de l'état actif sur la période
+// ?threshold=N fixe le nombre minimal de sorties (défaut 3), la période par défaut est le dernier jour
+func (api *APIServer) getServiceFlapping(c *gin.Context) {
+	if api.db == nil || api.hub.serviceLog == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	from, to, ok := printerHistoryPeriod(c, 1)
+	if !ok {
+		return
+	}
+
+	threshold := 3
+	if thresholdStr := c.Query("threshold"); thresholdStr != "" {
+		if _, err := fmt.Sscanf(thresholdStr, "%d", &threshold); err != nil || threshold < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre threshold invalide"})
+			return
+		}
+	}
+
+	agentID := c.Param("id")
+	services, err := api.hub.serviceLog.Flapping(agentID, from, to, threshold)
+	if err != nil {
+		log.Printf("[API] getServiceFlapping - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération de l'historique"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id":  agentID,
+		"from":      from,
+		"to":        to,
+		"threshold": threshold,
+		"services":  services,
+		"count":     len(services),
+	})
+}
+
+// listServices liste les services d'un agent
+func (api *APIServer) listServices(c *gin.Context) {
+	agentID := c.Param("id")
+	log.Printf("[API] listServices - Demande de liste de services pour l'agent: %s", agentID)
+
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		log.Printf("[API] listServices - Agent non trouvé: %s", agentID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	// Vérifier d'abord le cache
+	services := agent.GetServices()
+	log.Printf("[API] listServices - Services en cache: %d services", len(services))
+
+	if len(services) > 0 {
+		log.Printf("[API] listServices - Retour des services depuis le cache")
+		c.JSON(http.StatusOK, gin.H{
+			"services": services,
+			"count":    len(services),
+			"agent_id": agentID,
+		})
+		return
+	}
+
+	// Si pas dans le cache, demander à l'agent
+	log.Printf("[API] listServices - Pas de cache, envoi de la demande à l'agent")
+	msg := common.NewMessage(common.MessageTypeServiceList, nil)
+	msg.AgentID = agentID
+	log.Printf("[API] listServices - Message créé avec ID: %s", msg.ID)
+
+	// Envoyer la demande avec réponse
+	log.Printf("[API] listServices - Envoi du message et attente de la réponse (timeout: 5s)")
+	response, err := agent.SendMessageWithResponse(msg, 5*time.Second)
+	if err != nil {
+		// Si erreur de timeout, retourner une liste vide
+		log.Printf("[API] listServices - ERREUR: %v", err)
+		c.JSON(http.StatusOK, gin.H{
+			"services": []interface{}{},
+			"count":    0,
+			"agent_id": agentID,
+			"message":  "délai d'attente dépassé, l'agent n'a pas répondu",
+		})
+		return
+	}
+
+	log.Printf("[API] listServices - Réponse reçue, type: %s", response.Type)
+
+	// Parser la réponse
+	if services, err := common.DecodePayload[[]*common.ServiceInfo](response); err == nil {
+		log.Printf("[API] listServices - Données parsées avec succès: %d services", len(*services))
+		c.JSON(http.StatusOK, gin.H{
+			"services": *services,
+			"count":    len(*services),
+			"agent_id": agentID,
+		})
+		return
+	}
+
+	// Vérifier à nouveau le cache après la réponse
+	log.Printf("[API] listServices - Vérification du cache après réponse")
+	services = agent.GetServices()
+	log.Printf("[API] listServices - Services finaux: %d services", len(services))
+	c.JSON(http.StatusOK, gin.H{
+		"services": services,
+		"count":    len(services),
+		"agent_id": agentID,
+	})
+}
+
+// getServiceStatus obtient le statut détaillé d'un service
+func (api *APIServer) getServiceStatus(c *gin.Context) {
+	agentID := c.Param("id")
+	serviceName := c.Param("service")
+	serviceType := c.Query("type")
+
+	if serviceType == "" {
+		serviceType = "systemd"
+	}
+
+	if _, exists := api.hub.GetAgent(agentID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	status, err := api.hub.GetServiceStatus(agentID, serviceName, serviceType)
+	if err != nil {
+		log.Printf("[API] getServiceStatus - ERREUR: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+// executeServiceAction exécute une action sur un service et retourne son résultat
+// Le corps JSON facultatif contient les options de l'action (délai d'arrêt, image, lignes de logs...)
+// Les logs d'un conteneur avec "follow" sont transmis au fil de l'eau en JSON Lines jusqu'à la déconnexion du client
+func (api *APIServer) executeServiceAction(c *gin.Context) {
+	agentID := c.Param("id")
+	serviceName := c.Param("service")
+	action := c.Param("action")
+	serviceType := c.Query("type")
+
+	if serviceType == "" {
+		serviceType = "systemd"
+	}
+
+	if _, exists := api.hub.GetAgent(agentID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	// Valider l'action
+	if !serviceActions[serviceType][action] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action invalide"})
+		return
+	}
+
+	var options common.ServiceActionOptions
+	if err := c.ShouldBindJSON(&options); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "corps de requête invalide"})
+		return
+	}
+	options.Cancel = false
+
+	serviceAction := &common.ServiceAction{
+		Name:    serviceName,
+		Type:    serviceType,
+		Action:  action,
+		Options: &options,
+	}
+	if err := serviceAction.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if options.Follow {
+		api.followServiceLogs(c, agentID, serviceAction)
+		return
+	}
+
+	result, err := api.hub.RunServiceAction(agentID, serviceAction)
+	if err != nil {
+		log.Printf("[API] executeServiceAction - ERREUR: %v", err)
+		if !serviceReadOnlyActions[action] {
+			api.audit(c, agentID, "service."+action, serviceName, serviceType, false, err.Error())
+		}
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		return
+	}
+	if !serviceReadOnlyActions[action] {
+		errMsg := ""
+		if !result.Success {
+			errMsg = result.Message
+		}
+		api.audit(c, agentID, "service."+action, serviceName, serviceType, result.Success, errMsg)
+	}
+
+	if !result.Success {
+		c.JSON(http.StatusBadGateway, gin.H{"error": result.Message, "result": result})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// followServiceLogs transmet les logs suivis d'un conteneur en JSON Lines
+func (api *APIServer) followServiceLogs(c *gin.Context, agentID string, action *common.ServiceAction) {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+	encoder := json.NewEncoder(c.Writer)
+	c.Writer.Flush()
+
+	result, err := api.hub.FollowServiceLogs(agentID, action, c.Request.Context().Done(), func(lines []string) {
+		encoder.Encode(gin.H{"type": "logs", "lines": lines})
+		c.Writer.Flush()
+	})
+	if err != nil {
+		log.Printf("[API] followServiceLogs - Suivi de %s terminé: %v", action.Name, err)
+		encoder.Encode(gin.H{"type": "error", "error": err.Error()})
+		return
+	}
+	encoder.Encode(gin.H{"type": "result", "result": result})
+}
+
+// listLogSources liste les sources de logs disponibles
+func (api *APIServer) listLogSources(c *gin.Context) {
+	agentID := c.Param("id")
+	log.Printf("[API] listLogSources - Demande de liste de sources de logs pour l'agent: %s", agentID)
+
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		log.Printf("[API] listLogSources - Agent non trouvé: %s", agentID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	// Vérifier d'abord le cache
+	sources := agent.GetLogSources()
+	log.Printf("[API] listLogSources - Sources en cache: %d sources", len(sources))
+
+	if len(sources) > 0 {
+		log.Printf("[API] listLogSources - Retour des sources depuis le cache")
+		c.JSON(http.StatusOK, gin.H{
+			"sources":  sources,
+			"count":    len(sources),
+			"agent_id": agentID,
+		})
+		return
+	}
+
+	// Si pas dans le cache, demander à l'agent
+	log.Printf("[API] listLogSources - Pas de cache, envoi de la demande à l'agent")
+	msg := common.NewMessage(common.MessageTypeLogList, nil)
+	msg.AgentID = agentID
+	log.Printf("[API] listLogSources - Message créé avec ID: %s", msg.ID)
+
+	// Envoyer la demande avec réponse
+	log.Printf("[API] listLogSources - Envoi du message et attente de la réponse (timeout: 5s)")
+	response, err := agent.SendMessageWithResponse(msg, 5*time.Second)
+	if err != nil {
+		log.Printf("[API] listLogSources - ERREUR: %v", err)
+		c.JSON(http.StatusOK, gin.H{
+			"sources":  []interface{}{},
+			"count":    0,
+			"agent_id": agentID,
+			"message":  "délai d'attente dépassé, l'agent n'a pas répondu",
+		})
+		return
+	}
+
+	log.Printf("[API] listLogSources - Réponse reçue, type: %s", response.Type)
+
+	// Parser la réponse
+	if sources, err := common.DecodePayload[[]*common.LogSource](response); err == nil {
+		log.Printf("[API] listLogSources - Données parsées avec succès: %d sources", len(*sources))
+		c.JSON(http.StatusOK, gin.H{
+			"sources":  *sources,
+			"count":    len(*sources),
+			"agent_id": agentID,
+		})
+		return
+	}
+
+	// Vérifier à nouveau le cache après la réponse
+	log.Printf("[API] listLogSources - Vérification du cache après réponse")
+	sources = agent.GetLogSources()
+	log.Printf("[API] listLogSources - Sources finales: %d sources", len(sources))
+	c.JSON(http.StatusOK, gin.H{
+		"sources":  sources,
+		"count":    len(sources),
+		"agent_id": agentID,
+	})
+}
+
+// getLogContent récupère le contenu des logs
+func (api *APIServer) getLogContent(c *gin.Context) {
+	agentID := c.Param("id")
+	source := c.Param("source")
+	log.Printf("[API] getLogContent - Demande de logs pour l'agent %s, source: %s", agentID, source)
+
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		log.Printf("[API] getLogContent - Agent non trouvé: %s", agentID)
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	// Récupérer les paramètres de requête
+	logType := c.Query("type")
+	if logType == "" {
+		logType = "agent"
+	}
+
+	linesStr := c.Query("lines")
+	lines := 100
+	if linesStr != "" {
+		fmt.Sscanf(linesStr, "%d", &lines)
+	}
+
+	log.Printf("[API] getLogContent - Paramètres: type=%s, lines=%d", logType, lines)
+
+	// Créer la requête de logs
+	logReq := &common.LogRequest{
+		Source:   source,
+		Type:     logType,
+		Lines:    lines,
+		Path:     c.Query("path"),
+		Unit:     c.Query("unit"),
+		Priority: c.Query("priority"),
+		Since:    c.Query("since"),
+		Until:    c.Query("until"),
+	}
+
+	msg := common.NewMessage(common.MessageTypeLogContent, logReq)
+	msg.AgentID = agentID
+	log.Printf("[API] getLogContent - Message créé avec ID: %s", msg.ID)
+
+	// Envoyer la demande avec réponse
+	log.Printf("[API] getLogContent - Envoi du message et attente de la réponse (timeout: 10s)")
+	response, err := agent.SendMessageWithResponse(msg, 10*time.Second)
+	if err != nil {
+		log.Printf("[API] getLogContent - ERREUR: %v", err)
+		c.JSON(http.StatusOK, gin.H{
+			"logs":     []interface{}{},
+			"source":   source,
+			"count":    0,
+			"agent_id": agentID,
+			"message":  "délai d'attente dépassé, l'agent n'a pas répondu",
+		})
+		return
+	}
+
+	log.Printf("[API] getLogContent - Réponse reçue, type: %s", response.Type)
+
+	// Parser la réponse
+	content, err := common.DecodePayload[common.LogContent](response)
+	if err == nil {
+		entries := content.Entries
+		if entries == nil {
+			entries = []*common.LogEntry{}
+		}
+		log.Printf("[API] getLogContent - Données parsées avec succès: %d entrées", len(entries))
+		c.JSON(http.StatusOK, gin.H{
+			"logs":     entries,
+			"source":   source,
+			"count":    len(entries),
+			"agent_id": agentID,
+		})
+		return
+	}
+
+	log.Printf("[API] getLogContent - Réponse inattendue (%s): %v", response.Type, err)
+	c.JSON(http.StatusOK, gin.H{
+		"logs":     []interface{}{},
+		"source":   source,
+		"count":    0,
+		"agent_id": agentID,
+	})
+}
+
+// abortResponse coupe la connexion d'une réponse dont les en-têtes sont déjà envoyés
+// Le client constate un transfert incomplet au lieu d'une réponse terminée normalement
+func abortResponse(c *gin.Context) {
+	conn, _, err := c.Writer.Hijack()
+	if err != nil {
+		return
+	}
+	conn.Close()
+}
+
+// exportLogs exporte les logs d'une source sous forme de fichier compressé (texte, JSON Lines ou CSV)
+// Les entrées sont transmises par l'agent en plusieurs messages et écrites au fil de l'eau
+func (api *APIServer) exportLogs(c *gin.Context) {
+	agentID := c.Param("id")
+	source := c.Param("source")
+
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	format := c.DefaultQuery("format", "text")
+	extension, ok := logExportExtensions[format]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format invalide (text, jsonl ou csv)"})
+		return
+	}
+
+	for _, param := range []string{"from", "to"} {
+		if value := c.Query(param); value != "" {
+			if _, err := time.Parse(time.RFC3339, value); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("paramètre %s invalide (format RFC3339 attendu)", param)})
+				return
+			}
+		}
+	}
+
+	logType := c.Query("type")
+	if logType == "" {
+		logType = "agent"
+	}
+
+	exportReq := &common.LogExportRequest{
+		LogRequest: common.LogRequest{
+			Source:   source,
+			Type:     logType,
+			Path:     c.Query("path"),
+			Unit:     c.Query("unit"),
+			Priority: c.Query("priority"),
+		},
+		From:   c.Query("from"),
+		To:     c.Query("to"),
+		Window: common.LogExportWindow,
+	}
+
+	msg := common.NewMessage(common.MessageTypeLogExport, exportReq)
+	msg.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	msg.AgentID = agentID
+
+	stream, closeStream := agent.OpenStream(msg.ID)
+	defer closeStream()
+
+	if err := agent.SendMessage(msg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi de la demande"})
+		return
+	}
+	log.Printf("[API] exportLogs - Export %s demandé à l'agent %s (source: %s, format: %s)", msg.ID, agentID, source, format)
+
+	// Annuler l'export côté agent si le client HTTP abandonne le téléchargement
+	completed := false
+	defer func() {
+		if !completed {
+			cancelMsg := common.NewMessageWithID(common.MessageTypeLogExport, msg.ID, &common.LogExportRequest{Cancel: true})
+			cancelMsg.AgentID = agentID
+			agent.SendMessage(cancelMsg)
+		}
+	}()
+
+	// Attendre le premier morceau avant d'envoyer les en-têtes pour pouvoir signaler une erreur
+	var first common.LogExportChunk
+	select {
+	case response, ok := <-stream:
+		if !ok {
+			c.JSON(http.StatusBadGateway, gin.H{"error": errStreamSaturated.Error()})
+			return
+		}
+		if err := decodeLogExportChunk(response, &first); err != nil {
+			completed = true
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+	case <-time.After(30 * time.Second):
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "délai d'attente dépassé, l'agent n'a pas répondu"})
+		return
+	case <-c.Request.Context().Done():
+		return
+	}
+
+	if first.Done && first.Error != "" {
+		completed = true
+		c.JSON(http.StatusBadGateway, gin.H{"error": first.Error})
+		return
+	}
+
+	filename := fmt.Sprintf("%s-%s-%s.%s.gz", agentID, source, time.Now().Format("20060102-150405"), extension)
+	c.Header("Content-Type", "application/gzip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+
+	gz := gzip.NewWriter(c.Writer)
+	writer := newLogExportWriter(gz, format)
+
+	chunk := first
+	total := 0
+	for {
+		if err := writer.Write(chunk.Entries); err != nil {
+			log.Printf("[API] exportLogs - Écriture interrompue: %v", err)
+			return
+		}
+		total += len(chunk.Entries)
+
+		if chunk.Done {
+			completed = true
+			if chunk.Error != "" {
+				// Les en-têtes sont déjà envoyés: signaler l'erreur dans le fichier
+				writer.WriteError(chunk.Error)
+				log.Printf("[API] exportLogs - Export %s terminé en erreur: %s", msg.ID, chunk.Error)
+			}
+			break
+		}
+
+		writer.Flush()
+		gz.Flush()
+		c.Writer.Flush()
+
+		// Le morceau est transmis au client: l'agent peut envoyer le suivant au-delà de sa fenêtre
+		if chunk.Seq > 0 {
+			ackMsg := common.NewMessageWithID(common.MessageTypeLogExport, msg.ID, &common.LogExportRequest{Ack: chunk.Seq})
+			ackMsg.AgentID = agentID
+			agent.SendMessage(ackMsg)
+		}
+
+		var response *common.Message
+		var ok bool
+		select {
+		case response, ok = <-stream:
+			if !ok {
+				// L'export est annulé côté agent; couper la connexion pour que le fichier tronqué ne passe pas pour complet
+				log.Printf("[API] exportLogs - Export %s interrompu: %v", msg.ID, errStreamSaturated)
+				abortResponse(c)
+				return
+			}
+		case <-time.After(60 * time.Second):
+			writer.WriteError("délai d'attente dépassé, export incomplet")
+			writer.Flush()
+			gz.Close()
+			log.Printf("[API] exportLogs - Export %s interrompu: l'agent ne répond plus", msg.ID)
+			return
+		case <-c.Request.Context().Done():
+			log.Printf("[API] exportLogs - Export %s abandonné par le client", msg.ID)
+			return
+		}
+
+		chunk = common.LogExportChunk{}
+		if err := decodeLogExportChunk(response, &chunk); err != nil {
+			chunk = common.LogExportChunk{Done: true, Error: err.Error()}
+		}
+	}
+
+	writer.Flush()
+	gz.Close()
+	log.Printf("[API] exportLogs - Export %s terminé: %d entrées", msg.ID, total)
+}
+
+// decodeLogExportChunk décode un morceau d'export ou l'erreur renvoyée par l'agent
+func decodeLogExportChunk(response *common.Message, chunk *common.LogExportChunk) error {
+	if response.Type == common.MessageTypeError {
+		return agentError(response)
+	}
+	decoded, err := common.DecodePayload[common.LogExportChunk](response)
+	if err != nil {
+		return fmt.Errorf("réponse d'export invalide: %v", err)
+	}
+	*chunk = *decoded
+	return nil
+}
+
+// prometheusMetrics expose les métriques du hub et des agents au format Prometheus
+func (api *APIServer) prometheusMetrics(c *gin.Context) {
+	if api.config != nil && api.config.MetricsToken != "" {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(api.config.MetricsToken)) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.String(http.StatusUnauthorized, "non autorisé\n")
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := api.hub.WritePrometheusMetrics(c.Writer); err != nil {
+		log.Printf("[API] prometheusMetrics - ERREUR: %v", err)
+	}
+}
+
+// listProcesses retourne la liste des processus d'un agent
+func (api *APIServer) listProcesses(c *gin.Context) {
+	agentID := c.Param("id")
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	req := &common.ProcessListRequest{
+		Sort:  c.DefaultQuery("sort", "cpu"),
+		User:  c.Query("user"),
+		Query: c.Query("q"),
+	}
+	if limitStr := c.Query("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &req.Limit)
+	}
+
+	msg := common.NewMessage(common.MessageTypeProcessList, req)
+	msg.AgentID = agentID
+
+	response, err := agent.SendMessageWithResponse(msg, 10*time.Second)
+	if err != nil {
+		log.Printf("[API] listProcesses - ERREUR: %v", err)
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "l'agent n'a pas répondu"})
+		return
+	}
+
+	if response.Type == common.MessageTypeError {
+		c.JSON(http.StatusBadGateway, gin.H{"error": agentError(response).Error()})
+		return
+	}
+
+	processes, err := common.DecodePayload[common.ProcessList](response)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "réponse de l'agent invalide"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id":  agentID,
+		"processes": processes.Processes,
+		"count":     len(processes.Processes),
+		"total":     processes.Total,
+	})
+}
+
+// signalProcess envoie un signal (TERM, KILL, HUP) à un processus d'un agent
+// L'action est enregistrée dans le journal d'audit
+func (api *APIServer) signalProcess(c *gin.Context) {
+	agentID := c.Param("id")
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	var pid int
+	if _, err := fmt.Sscanf(c.Param("pid"), "%d", &pid); err != nil || pid <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PID invalide"})
+		return
+	}
+
+	var body struct {
+		Signal string `json:"signal"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil || body.Signal == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "signal manquant"})
+		return
+	}
+
+	req := &common.ProcessSignalRequest{PID: pid, Signal: strings.ToUpper(body.Signal)}
+	msg := common.NewMessage(common.MessageTypeProcessSignal, req)
+	msg.AgentID = agentID
+
+	result := &common.ProcessSignalResult{PID: pid, Signal: req.Signal}
+	response, err := agent.SendMessageWithResponse(msg, 10*time.Second)
+	if err != nil {
+		result.Error = "l'agent n'a pas répondu"
+	} else if decoded, err := common.DecodePayload[common.ProcessSignalResult](response); err != nil {
+		result.Error = "réponse de l'agent invalide"
+	} else {
+		result = decoded
+	}
+
+	target := fmt.Sprintf("pid %d", pid)
+	if result.Name != "" {
+		target = fmt.Sprintf("pid %d (%s)", pid, result.Name)
+	}
+	api.audit(c, agentID, "process.signal", target, "SIG"+req.Signal, result.Success, result.Error)
+
+	if !result.Success {
+		status := http.StatusBadRequest
+		if err != nil {
+			status = http.StatusGatewayTimeout
+		}
+		c.JSON(status, gin.H{"error": result.Error, "result": result})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// getAgentInventory retourne le dernier inventaire matériel et logiciel d'un agent
+func (api *APIServer) getAgentInventory(c *gin.Context) {
+	if api.db == nil || api.hub.inventory == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	snapshot, err := api.hub.inventory.Latest(c.Param("id"))
+	if err != nil {
+		log.Printf("[API] getAgentInventory - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération de l'inventaire"})
+		return
+	}
+	if snapshot == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "aucun inventaire pour cet agent"})
+		return
+	}
+
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// getAgentInventoryHistory retourne les versions successives de l'inventaire d'un agent
+func (api *APIServer) getAgentInventoryHistory(c *gin.Context) {
+	if api.db == nil || api.hub.inventory == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	limit := 50
+	if limitStr := c.Query("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &limit)
+	}
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+
+	agentID := c.Param("id")
+	snapshots, err := api.hub.inventory.History(agentID, limit)
+	if err != nil {
+		log.Printf("[API] getAgentInventoryHistory - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération de l'historique"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id":  agentID,
+		"snapshots": snapshots,
+		"count":     len(snapshots),
+	})
+}
+
+// findInstalledPackages recherche un paquet sur l'ensemble des agents
+// ?name=openssl (ou préfixe "libssl*") et, optionnellement, ?below=3.0.2 pour les versions inférieures
+func (api *APIServer) findInstalledPackages(c *gin.Context) {
+	if api.db == nil || api.hub.inventory == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" || name == "*" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre name requis"})
+		return
+	}
+	below := strings.TrimSpace(c.Query("below"))
+
+	packages, err := api.hub.inventory.FindPackage(name, below)
+	if err != nil {
+		log.Printf("[API] findInstalledPackages - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la recherche du paquet"})
+		return
+	}
+
+	agents := make(map[string]bool)
+	for _, pkg := range packages {
+		agents[pkg.AgentID] = true
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":        name,
+		"below":       below,
+		"packages":    packages,
+		"count":       len(packages),
+		"agent_count": len(agents),
+	})
+}
+
+// packageActionBody contient les paramètres d'une opération sur les paquets
+type packageActionBody struct {
+	AgentSelector string   `json:"agent_selector"` // Opérations sur la flotte uniquement
+	Packages      []string `json:"packages"`
+	Timeout       int      `json:"timeout"` // secondes
+}
+
+// packageAuditTarget décrit les paquets visés par une opération pour le journal d'audit
+func packageAuditTarget(packages []string) string {
+	if len(packages) == 0 {
+		return "tous les paquets"
+	}
+	return strings.Join(packages, " ")
+}
+
+// listUpgradablePackages retourne les mises à jour disponibles sur un agent
+func (api *APIServer) listUpgradablePackages(c *gin.Context) {
+	agentID := c.Param("id")
+	if _, exists := api.hub.GetAgent(agentID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	req := &common.PackageActionRequest{Action: common.PackageActionListUpgradable}
+	result, err := api.hub.RunPackageAction(agentID, req, nil)
+	if err != nil {
+		log.Printf("[API] listUpgradablePackages - ERREUR: %v", err)
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		return
+	}
+	if !result.Success {
+		c.JSON(http.StatusBadGateway, gin.H{"error": result.Error, "result": result})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id":   agentID,
+		"manager":    result.Manager,
+		"upgradable": result.Upgradable,
+		"count":      len(result.Upgradable),
+	})
+}
+
+// runPackageAction installe, met à jour ou supprime des paquets sur un agent
+// Avec ?stream=true, la sortie est transmise au fil de l'eau en JSON Lines, suivie du résultat
+func (api *APIServer) runPackageAction(c *gin.Context) {
+	agentID := c.Param("id")
+	if _, exists := api.hub.GetAgent(agentID); !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	action, ok := packageActions[c.Param("action")]
+	if !ok || action == common.PackageActionListUpgradable {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action invalide (install, upgrade ou remove)"})
+		return
+	}
+
+	var body packageActionBody
+	if err := c.ShouldBindJSON(&body); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "corps de requête invalide"})
+		return
+	}
+	if action != common.PackageActionUpgrade && len(body.Packages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "liste de paquets requise"})
+		return
+	}
+
+	req := &common.PackageActionRequest{Action: action, Packages: body.Packages, Timeout: body.Timeout}
+
+	var onOutput func(lines []string)
+	stream := c.Query("stream") == "true"
+	if stream {
+		c.Header("Content-Type", "application/x-ndjson")
+		c.Status(http.StatusOK)
+		encoder := json.NewEncoder(c.Writer)
+		onOutput = func(lines []string) {
+			encoder.Encode(gin.H{"type": "output", "lines": lines})
+			c.Writer.Flush()
+		}
+	}
+
+	result, err := api.hub.RunPackageAction(agentID, req, onOutput)
+	target := packageAuditTarget(req.Packages)
+	if err != nil {
+		log.Printf("[API] runPackageAction - ERREUR: %v", err)
+		api.audit(c, agentID, "package."+action, target, "", false, err.Error())
+		if stream {
+			json.NewEncoder(c.Writer).Encode(gin.H{"type": "error", "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": err.Error()})
+		return
+	}
+	api.audit(c, agentID, "package."+action, target, result.Manager, result.Success, result.Error)
+
+	if stream {
+		json.NewEncoder(c.Writer).Encode(gin.H{"type": "result", "result": result})
+		return
+	}
+	if !result.Success {
+		c.JSON(http.StatusBadGateway, gin.H{"error": result.Error, "result": result})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// fleetPackageResult contient le résultat d'une opération sur les paquets pour un agent de la flotte
+type fleetPackageResult struct {
+	AgentID string                      `json:"agent_id"`
+	Success bool                        `json:"success"`
+	Error   string                      `json:"error,omitempty"`
+	Result  *common.PackageActionResult `json:"result,omitempty"`
+}
+
+// fleetPackageConcurrency limite le nombre d'agents traités simultanément
+const fleetPackageConcurrency = 10
+
+// runFleetPackageAction exécute une opération sur les paquets sur les agents connectés correspondant au sélecteur
+func (api *APIServer) runFleetPackageAction(c *gin.Context) {
+	action, ok := packageActions[c.Param("action")]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action invalide (upgradable, install, upgrade ou remove)"})
+		return
+	}
+
+	var body packageActionBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "corps de requête invalide"})
+		return
+	}
+	// Le sélecteur est obligatoire ("*" pour toute la flotte) pour éviter une opération involontaire sur tous les agents
+	if strings.TrimSpace(body.AgentSelector) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sélecteur d'agents requis (\"*\" pour tous)"})
+		return
+	}
+	if (action == common.PackageActionInstall || action == common.PackageActionRemove) && len(body.Packages) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "liste de paquets requise"})
+		return
+	}
+
+	var agentIDs []string
+	for _, agent := range api.hub.GetAgents() {
+		if matchAgentSelector(body.AgentSelector, agent.ID, api.hub.GetAgentMetadata(agent.ID)) {
+			agentIDs = append(agentIDs, agent.ID)
+		}
+	}
+	sort.Strings(agentIDs)
+
+	results := make([]*fleetPackageResult, len(agentIDs))
+	semaphore := make(chan struct{}, fleetPackageConcurrency)
+	var wg sync.WaitGroup
+	for i, agentID := range agentIDs {
+		wg.Add(1)
+		go func(i int, agentID string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			req := &common.PackageActionRequest{Action: action, Packages: body.Packages, Timeout: body.Timeout}
+			entry := &fleetPackageResult{AgentID: agentID}
+			result, err := api.hub.RunPackageAction(agentID, req, nil)
+			if err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.Result = result
+				entry.Success = result.Success
+				entry.Error = result.Error
+			}
+			results[i] = entry
+		}(i, agentID)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, entry := range results {
+		if entry.Success {
+			succeeded++
+		}
+		if action != common.PackageActionListUpgradable {
+			manager := ""
+			if entry.Result != nil {
+				manager = entry.Result.Manager
+			}
+			api.audit(c, entry.AgentID, "package."+action, packageAuditTarget(body.Packages), manager, entry.Success, entry.Error)
+		}
+	}
+	log.Printf("[API] runFleetPackageAction - %s sur %d agents (%d succès)", action, len(results), succeeded)
+
+	c.JSON(http.StatusOK, gin.H{
+		"action":    action,
+		"results":   results,
+		"count":     len(results),
+		"succeeded": succeeded,
+		"failed":    len(results) - succeeded,
+	})
+}
+
+// networkDiagnostic exécute un diagnostic réseau sur un agent
+// Actions: interfaces, routes, sockets (?state=listen|established), dns (?host&server),
+// tcp (?host&port) et http (?url&method), avec un délai optionnel ?timeout en secondes
+func (api *APIServer) networkDiagnostic(c *gin.Context) {
+	agentID := c.Param("id")
+	agent, exists := api.hub.GetAgent(agentID)
+	if !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+		return
+	}
+
+	req := &common.NetworkDiagnosticRequest{
+		Action: c.Param("action"),
+		Host:   c.Query("host"),
+		Server: c.Query("server"),
+		URL:    c.Query("url"),
+		Method: c.Query("method"),
+		State:  c.Query("state"),
+	}
+	if portStr := c.Query("port"); portStr != "" {
+		fmt.Sscanf(portStr, "%d", &req.Port)
+	}
+	if timeoutStr := c.Query("timeout"); timeoutStr != "" {
+		fmt.Sscanf(timeoutStr, "%d", &req.Timeout)
+	}
+	if req.Timeout <= 0 || req.Timeout > 30 {
+		req.Timeout = 5
+	}
+
+	switch req.Action {
+	case common.NetworkDiagInterfaces, common.NetworkDiagRoutes, common.NetworkDiagSockets:
+	case common.NetworkDiagDNS:
+		if req.Host == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre host requis"})
+			return
+		}
+	case common.NetworkDiagTCP:
+		if req.Host == "" || req.Port <= 0 || req.Port > 65535 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètres host et port requis"})
+			return
+		}
+	case common.NetworkDiagHTTP:
+		if req.URL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre url requis"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "action de diagnostic inconnue"})
+		return
+	}
+
+	msg := common.NewMessage(common.MessageTypeNetworkDiagnostic, req)
+	msg.AgentID = agentID
+
+	// Laisser à l'agent le temps d'atteindre son propre délai avant d'abandonner
+	response, err := agent.SendMessageWithResponse(msg, time.Duration(req.Timeout+5)*time.Second)
+	if err != nil {
+		log.Printf("[API] networkDiagnostic - ERREUR: %v", err)
+		c.JSON(http.StatusGatewayTimeout, gin.H{"error": "l'agent n'a pas répondu"})
+		return
+	}
+
+	if response.Type == common.MessageTypeError {
+		c.JSON(http.StatusBadGateway, gin.H{"error": agentError(response).Error()})
+		return
+	}
+
+	result, err := common.DecodePayload[common.NetworkDiagnosticResult](response)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "réponse de l'agent invalide"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"agent_id": agentID,
+		"result":   result,
+	})
+}
+
+// audit enregistre une action de l'utilisateur courant dans le journal d'audit
+func (api *APIServer) audit(c *gin.Context, agentID, action, target, details string, success bool, errMsg string) {
+	// Les tokens de connexion web portent l'identité dans agent_id/agent_name
+	userID, userName := c.GetString("user_id"), c.GetString("user_name")
+	if userID == "" {
+		userID, userName = c.GetString("agent_id"), c.GetString("agent_name")
+	}
+
+	log.Printf("[AUDIT] %s par %s sur %s: %s %s (succès: %v)", action, userID, agentID, target, details, success)
+	if api.db == nil {
+		return
+	}
+
+	entry := &AuditLog{
+		UserID:    userID,
+		UserName:  userName,
+		AgentID:   agentID,
+		Action:    action,
+		Target:    target,
+		Details:   details,
+		Success:   success,
+		Error:     errMsg,
+		IPAddress: c.ClientIP(),
+		CreatedAt: time.Now(),
+	}
+	if err := api.db.LogAudit(entry); err != nil {
+		log.Printf("[API] audit - ERREUR: %v", err)
+	}
+}
+
+// getAuditLogs retourne les dernières entrées du journal d'audit
+func (api *APIServer) getAuditLogs(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &limit)
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	logs, err := api.db.GetAuditLogs(c.Query("agent_id"), c.Query("action"), limit)
+	if err != nil {
+		log.Printf("[API] getAuditLogs - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération du journal d'audit"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries": logs,
+		"count":   len(logs),
+	})
+}
+
+// getAgentMetrics retourne l'historique des métriques d'un agent
+// Sans paramètre metric, retourne la liste des métriques disponibles
+func (api *APIServer) getAgentMetrics(c *gin.Context) {
+	if api.db == nil || api.hub.metrics == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	agentID := c.Param("id")
+
+	var metrics []string
+	for _, metric := range strings.Split(c.Query("metric"), ",") {
+		if metric = strings.TrimSpace(metric); metric != "" {
+			metrics = append(metrics, metric)
+		}
+	}
+
+	if len(metrics) == 0 {
+		names, err := api.db.GetMetricNames(agentID)
+		if err != nil {
+			log.Printf("[API] getAgentMetrics - ERREUR: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des métriques"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"agent_id": agentID,
+			"metrics":  names,
+		})
+		return
+	}
+
+	query := &MetricsQuery{
+		AgentID: agentID,
+		Metrics: metrics,
+		To:      time.Now(),
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre to invalide (format RFC3339 attendu)"})
+			return
+		}
+		query.To = t
+	}
+	query.From = query.To.Add(-time.Hour)
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre from invalide (format RFC3339 attendu)"})
+			return
+		}
+		query.From = t
+	}
+	if !query.From.Before(query.To) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "la date de début doit précéder la date de fin"})
+		return
+	}
+
+	// Le pas accepte une durée ("5m") ou un nombre de secondes
+	if stepStr := c.Query("step"); stepStr != "" {
+		step, err := time.ParseDuration(stepStr)
+		if err != nil {
+			var seconds int
+			if _, scanErr := fmt.Sscanf(stepStr, "%d", &seconds); scanErr != nil || seconds <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre step invalide"})
+				return
+			}
+			step = time.Duration(seconds) * time.Second
+		}
+		query.Step = step
+	}
+
+	result, err := api.hub.metrics.Query(query)
+	if err != nil {
+		log.Printf("[API] getAgentMetrics - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des métriques"})
+		return
+	}
+
+	// Historique mémoire/disque issu des informations système pour les agents sans métriques détaillées
+	if len(result.Series) == 0 {
+		if logs, err := api.db.GetSystemLogs(agentID, 10000); err == nil {
+			step, _ := time.ParseDuration(result.Step)
+			result.Resolution = "system_info"
+			result.Series = systemLogSeries(logs, metrics, query.From, query.To, step)
+		}
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// searchLogs recherche dans les logs centralisés de toute la flotte
+func (api *APIServer) searchLogs(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	filter := &LogSearchFilter{
+		Query:     c.Query("q"),
+		AgentID:   c.Query("agent_id"),
+		Franchise: c.Query("franchise"),
+		Source:    c.Query("source"),
+	}
+
+	if levels := c.Query("level"); levels != "" {
+		for _, level := range strings.Split(levels, ",") {
+			if level = strings.TrimSpace(level); level != "" {
+				filter.Levels = append(filter.Levels, level)
+			}
+		}
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre from invalide (format RFC3339 attendu)"})
+			return
+		}
+		filter.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "paramètre to invalide (format RFC3339 attendu)"})
+			return
+		}
+		filter.To = t
+	}
+
+	if limitStr := c.Query("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &filter.Limit)
+	}
+	if offsetStr := c.Query("offset"); offsetStr != "" {
+		fmt.Sscanf(offsetStr, "%d", &filter.Offset)
+	}
+
+	records, total, err := api.db.SearchLogs(filter)
+	if err != nil {
+		log.Printf("[API] searchLogs - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la recherche dans les logs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"logs":   records,
+		"count":  len(records),
+		"total":  total,
+		"offset": filter.Offset,
+	})
+}
+
+// getLogAlerts retourne les dernières alertes produites par les règles de logs
+func (api *APIServer) getLogAlerts(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &limit)
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	var ruleID uint
+	if ruleStr := c.Query("rule_id"); ruleStr != "" {
+		fmt.Sscanf(ruleStr, "%d", &ruleID)
+	}
+
+	alerts, err := api.db.GetLogAlerts(c.Query("agent_id"), ruleID, limit)
+	if err != nil {
+		log.Printf("[API] getLogAlerts - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des alertes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// getLogAlertRules retourne les règles d'alerte sur les logs
+func (api *APIServer) getLogAlertRules(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	rules, err := api.db.GetLogAlertRules()
+	if err != nil {
+		log.Printf("[API] getLogAlertRules - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des règles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules": rules,
+		"count": len(rules),
+	})
+}
+
+// createLogAlertRule crée une règle d'alerte sur les logs
+func (api *APIServer) createLogAlertRule(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	rule := &LogAlertRule{Threshold: 1, WindowSeconds: 300, Severity: "warning", Enabled: true}
+	if err := c.ShouldBindJSON(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "données invalides"})
+		return
+	}
+	rule.ID = 0
+
+	api.saveLogAlertRule(c, rule, http.StatusCreated)
+}
+
+// updateLogAlertRule met à jour une règle d'alerte sur les logs
+func (api *APIServer) updateLogAlertRule(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de règle invalide"})
+		return
+	}
+
+	rule, err := api.db.GetLogAlertRule(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "règle non trouvée"})
+		return
+	}
+
+	createdAt := rule.CreatedAt
+	if err := c.ShouldBindJSON(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "données invalides"})
+		return
+	}
+	rule.ID = id
+	rule.CreatedAt = createdAt
+
+	api.saveLogAlertRule(c, rule, http.StatusOK)
+}
+
+// saveLogAlertRule valide et enregistre une règle puis recharge le moteur d'alertes
+func (api *APIServer) saveLogAlertRule(c *gin.Context, rule *LogAlertRule, status int) {
+	if rule.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nom de règle manquant"})
+		return
+	}
+	if _, err := CompileLogAlertRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := api.db.SaveLogAlertRule(rule); err != nil {
+		log.Printf("[API] saveLogAlertRule - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de l'enregistrement de la règle"})
+		return
+	}
+
+	if api.hub.logAlerts != nil {
+		if err := api.hub.logAlerts.Reload(); err != nil {
+			log.Printf("[API] saveLogAlertRule - Erreur lors du rechargement des règles: %v", err)
+		}
+	}
+
+	c.JSON(status, rule)
+}
+
+// deleteLogAlertRule supprime une règle d'alerte sur les logs
+func (api *APIServer) deleteLogAlertRule(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de règle invalide"})
+		return
+	}
+
+	if err := api.db.DeleteLogAlertRule(id); err != nil {
+		log.Printf("[API] deleteLogAlertRule - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la suppression de la règle"})
+		return
+	}
+
+	if api.hub.logAlerts != nil {
+		if err := api.hub.logAlerts.Reload(); err != nil {
+			log.Printf("[API] deleteLogAlertRule - Erreur lors du rechargement des règles: %v", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "règle supprimée"})
+}
+
+// getAlerts retourne les alertes sur l'état des agents
+func (api *APIServer) getAlerts(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &limit)
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	status := c.Query("status")
+	if status != "" && status != AlertStatusFiring && status != AlertStatusResolved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "statut invalide (firing ou resolved)"})
+		return
+	}
+
+	alerts, err := api.db.GetAlerts(c.Query("agent_id"), status, limit)
+	if err != nil {
+		log.Printf("[API] getAlerts - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des alertes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"alerts": alerts,
+		"count":  len(alerts),
+	})
+}
+
+// acknowledgeAlert acquitte une alerte
+func (api *APIServer) acknowledgeAlert(c *gin.Context) {
+	if api.hub.alerts == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID d'alerte invalide"})
+		return
+	}
+
+	user := c.GetString("user_name")
+	if user == "" {
+		user = c.GetString("user_id")
+	}
+
+	alert, err := api.hub.alerts.Acknowledge(id, user)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "alerte non trouvée"})
+		return
+	}
+
+	c.JSON(http.StatusOK, alert)
+}
+
+// getAlertRules retourne les règles d'alerte sur l'état des agents
+func (api *APIServer) getAlertRules(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
+
+	rules, err := api.db.GetAlertRules()
+	if err != nil {
+		log.Printf("[API] getAlertRules - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des règles"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules": rules,
+		"count": len(rules),
 	})
 }
 
-// listServices liste les services d'un agent
-func (api *APIServer) listServices(c *gin.Context) {
-	agentID := c.Param("id")
-	log.Printf("[API] listServices - Demande de liste de services pour l'agent: %s", agentID)
+// createAlertRule crée une règle d'alerte sur l'état des agents
+func (api *APIServer) createAlertRule(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
 
-	agent, exists := api.hub.GetAgent(agentID)
-	if !exists {
-		log.Printf("[API] listServices - Agent non trouvé: %s", agentID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+	rule := &AlertRule{Severity: "warning", Enabled: true}
+	if err := c.ShouldBindJSON(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "données invalides"})
 		return
 	}
+	rule.ID = 0
 
-	// Vérifier d'abord le cache
-	services := agent.GetServices()
-	log.Printf("[API] listServices - Services en cache: %d services", len(services))
+	api.saveAlertRule(c, rule, http.StatusCreated)
+}
 
-	if len(services) > 0 {
-		log.Printf("[API] listServices - Retour des services depuis le cache")
-		c.JSON(http.StatusOK, gin.H{
-			"services": services,
-			"count":    len(services),
-			"agent_id": agentID,
-		})
+// updateAlertRule met à jour une règle d'alerte sur l'état des agents
+func (api *APIServer) updateAlertRule(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
 		return
 	}
 
-	// Si pas dans le cache, demander à l'agent
-	log.Printf("[API] listServices - Pas de cache, envoi de la demande à l'agent")
-	msg := common.NewMessage(common.MessageTypeServiceList, nil)
-	msg.AgentID = agentID
-	log.Printf("[API] listServices - Message créé avec ID: %s", msg.ID)
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de règle invalide"})
+		return
+	}
 
-	// Envoyer la demande avec réponse
-	log.Printf("[API] listServices - Envoi du message et attente de la réponse (timeout: 5s)")
-	response, err := agent.SendMessageWithResponse(msg, 5*time.Second)
+	rule, err := api.db.GetAlertRule(id)
 	if err != nil {
-		// Si erreur de timeout, retourner une liste vide
-		log.Printf("[API] listServices - ERREUR: %v", err)
-		c.JSON(http.StatusOK, gin.H{
-			"services": []interface{}{},
-			"count":    0,
-			"agent_id": agentID,
-			"message":  "délai d'attente dépassé, l'agent n'a pas répondu",
-		})
+		c.JSON(http.StatusNotFound, gin.H{"error": "règle non trouvée"})
 		return
 	}
 
-	log.Printf("[API] listServices - Réponse reçue, type: %s", response.Type)
-
-	// Parser la réponse
-	if services, ok := response.Data.([]interface{}); ok {
-		log.Printf("[API] listServices - Données parsées avec succès: %d services", len(services))
-		c.JSON(http.StatusOK, gin.H{
-			"services": services,
-			"count":    len(services),
-			"agent_id": agentID,
-		})
+	createdAt := rule.CreatedAt
+	if err := c.ShouldBindJSON(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "données invalides"})
 		return
 	}
+	rule.ID = id
+	rule.CreatedAt = createdAt
 
-	// Vérifier à nouveau le cache après la réponse
-	log.Printf("[API] listServices - Vérification du cache après réponse")
-	services = agent.GetServices()
-	log.Printf("[API] listServices - Services finaux: %d services", len(services))
-	c.JSON(http.StatusOK, gin.H{
-		"services": services,
-		"count":    len(services),
-		"agent_id": agentID,
-	})
+	api.saveAlertRule(c, rule, http.StatusOK)
 }
 
-// getServiceStatus obtient le statut d'un service
-func (api *APIServer) getServiceStatus(c *gin.Context) {
-	agentID := c.Param("id")
-	serviceName := c.Param("service")
-	serviceType := c.Query("type")
-
-	if serviceType == "" {
-		serviceType = "systemd"
+// saveAlertRule valide et enregistre une règle puis recharge le gestionnaire d'alertes
+func (api *APIServer) saveAlertRule(c *gin.Context, rule *AlertRule, status int) {
+	if rule.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nom de règle manquant"})
+		return
 	}
-
-	agent, exists := api.hub.GetAgent(agentID)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+	if err := ValidateAlertRule(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Créer un message de demande de statut
-	serviceInfo := &common.ServiceInfo{
-		Name: serviceName,
-		Type: serviceType,
+	if err := api.db.SaveAlertRule(rule); err != nil {
+		log.Printf("[API] saveAlertRule - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de l'enregistrement de la règle"})
+		return
 	}
-	msg := common.NewMessage(common.MessageTypeServiceStatus, serviceInfo)
-	msg.AgentID = agentID
 
-	// Envoyer la demande à l'agent
-	if err := agent.SendMessage(msg); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi de la demande"})
-		return
+	if api.hub.alerts != nil {
+		if err := api.hub.alerts.Reload(); err != nil {
+			log.Printf("[API] saveAlertRule - Erreur lors du rechargement des règles: %v", err)
+		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "demande de statut envoyée",
-		"service": serviceName,
-		"type":    serviceType,
-	})
+	c.JSON(status, rule)
 }
 
-// executeServiceAction exécute une action sur un service
-func (api *APIServer) executeServiceAction(c *gin.Context) {
-	agentID := c.Param("id")
-	serviceName := c.Param("service")
-	action := c.Param("action")
-	serviceType := c.Query("type")
+// deleteAlertRule supprime une règle d'alerte sur l'état des agents
+func (api *APIServer) deleteAlertRule(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
 
-	if serviceType == "" {
-		serviceType = "systemd"
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de règle invalide"})
+		return
 	}
 
-	agent, exists := api.hub.GetAgent(agentID)
-	if !exists {
-		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+	if err := api.db.DeleteAlertRule(id); err != nil {
+		log.Printf("[API] deleteAlertRule - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la suppression de la règle"})
 		return
 	}
 
-	// Valider l'action
-	validActions := map[string]bool{
-		"start":   true,
-		"stop":    true,
-		"restart": true,
-		"enable":  true,
-		"disable": true,
+	if api.hub.alerts != nil {
+		if err := api.hub.alerts.Reload(); err != nil {
+			log.Printf("[API] deleteAlertRule - Erreur lors du rechargement des règles: %v", err)
+		}
 	}
 
-	if !validActions[action] {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "action invalide"})
+	c.JSON(http.StatusOK, gin.H{"message": "règle supprimée"})
+}
+
+// getNotificationChannels retourne les canaux de notification (secrets masqués)
+func (api *APIServer) getNotificationChannels(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
 		return
 	}
 
-	// Créer un message d'action
-	serviceAction := &common.ServiceAction{
-		Name:   serviceName,
-		Type:   serviceType,
-		Action: action,
+	channels, err := api.db.GetNotificationChannels()
+	if err != nil {
+		log.Printf("[API] getNotificationChannels - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération des canaux"})
+		return
 	}
-	msg := common.NewMessage(common.MessageTypeServiceAction, serviceAction)
-	msg.AgentID = agentID
 
-	// Envoyer la demande à l'agent
-	if err := agent.SendMessage(msg); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur d'envoi de la demande"})
-		return
+	redacted := make([]*NotificationChannel, 0, len(channels))
+	for _, channel := range channels {
+		redacted = append(redacted, channel.Redacted())
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "action envoyée",
-		"service": serviceName,
-		"type":    serviceType,
-		"action":  action,
+		"channels": redacted,
+		"count":    len(redacted),
 	})
 }
 
-// listLogSources liste les sources de logs disponibles
-func (api *APIServer) listLogSources(c *gin.Context) {
-	agentID := c.Param("id")
-	log.Printf("[API] listLogSources - Demande de liste de sources de logs pour l'agent: %s", agentID)
+// createNotificationChannel crée un canal de notification
+func (api *APIServer) createNotificationChannel(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
 
-	agent, exists := api.hub.GetAgent(agentID)
-	if !exists {
-		log.Printf("[API] listLogSources - Agent non trouvé: %s", agentID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+	channel := &NotificationChannel{MaxAttempts: 3, Enabled: true}
+	if err := c.ShouldBindJSON(channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "données invalides"})
 		return
 	}
+	channel.ID = 0
 
-	// Vérifier d'abord le cache
-	sources := agent.GetLogSources()
-	log.Printf("[API] listLogSources - Sources en cache: %d sources", len(sources))
+	api.saveNotificationChannel(c, channel, http.StatusCreated)
+}
 
-	if len(sources) > 0 {
-		log.Printf("[API] listLogSources - Retour des sources depuis le cache")
-		c.JSON(http.StatusOK, gin.H{
-			"sources":  sources,
-			"count":    len(sources),
-			"agent_id": agentID,
-		})
+// updateNotificationChannel met à jour un canal de notification
+// Les secrets masqués ou omis conservent leur valeur précédente
+func (api *APIServer) updateNotificationChannel(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
 		return
 	}
 
-	// Si pas dans le cache, demander à l'agent
-	log.Printf("[API] listLogSources - Pas de cache, envoi de la demande à l'agent")
-	msg := common.NewMessage(common.MessageTypeLogList, nil)
-	msg.AgentID = agentID
-	log.Printf("[API] listLogSources - Message créé avec ID: %s", msg.ID)
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de canal invalide"})
+		return
+	}
 
-	// Envoyer la demande avec réponse
-	log.Printf("[API] listLogSources - Envoi du message et attente de la réponse (timeout: 5s)")
-	response, err := agent.SendMessageWithResponse(msg, 5*time.Second)
+	channel, err := api.db.GetNotificationChannel(id)
 	if err != nil {
-		log.Printf("[API] listLogSources - ERREUR: %v", err)
-		c.JSON(http.StatusOK, gin.H{
-			"sources":  []interface{}{},
-			"count":    0,
-			"agent_id": agentID,
-			"message":  "délai d'attente dépassé, l'agent n'a pas répondu",
-		})
+		c.JSON(http.StatusNotFound, gin.H{"error": "canal non trouvé"})
 		return
 	}
 
-	log.Printf("[API] listLogSources - Réponse reçue, type: %s", response.Type)
+	createdAt, secret, password := channel.CreatedAt, channel.Secret, channel.SMTPPassword
+	channel.Secret, channel.SMTPPassword = "", ""
+	if err := c.ShouldBindJSON(channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "données invalides"})
+		return
+	}
+	channel.ID = id
+	channel.CreatedAt = createdAt
+	if channel.Secret == "" || channel.Secret == redactedSecret {
+		channel.Secret = secret
+	}
+	if channel.SMTPPassword == "" || channel.SMTPPassword == redactedSecret {
+		channel.SMTPPassword = password
+	}
 
-	// Parser la réponse
-	if sources, ok := response.Data.([]interface{}); ok {
-		log.Printf("[API] listLogSources - Données parsées avec succès: %d sources", len(sources))
-		c.JSON(http.StatusOK, gin.H{
-			"sources":  sources,
-			"count":    len(sources),
-			"agent_id": agentID,
-		})
+	api.saveNotificationChannel(c, channel, http.StatusOK)
+}
+
+// saveNotificationChannel valide et enregistre un canal puis recharge le gestionnaire de notifications
+func (api *APIServer) saveNotificationChannel(c *gin.Context, channel *NotificationChannel, status int) {
+	if channel.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "nom de canal manquant"})
+		return
+	}
+	if err := ValidateNotificationChannel(channel); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Vérifier à nouveau le cache après la réponse
-	log.Printf("[API] listLogSources - Vérification du cache après réponse")
-	sources = agent.GetLogSources()
-	log.Printf("[API] listLogSources - Sources finales: %d sources", len(sources))
-	c.JSON(http.StatusOK, gin.H{
-		"sources":  sources,
-		"count":    len(sources),
-		"agent_id": agentID,
-	})
+	if err := api.db.SaveNotificationChannel(channel); err != nil {
+		log.Printf("[API] saveNotificationChannel - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de l'enregistrement du canal"})
+		return
+	}
+
+	if api.hub.notifier != nil {
+		if err := api.hub.notifier.Reload(); err != nil {
+			log.Printf("[API] saveNotificationChannel - Erreur lors du rechargement des canaux: %v", err)
+		}
+	}
+
+	c.JSON(status, channel.Redacted())
 }
 
-// getLogContent récupère le contenu des logs
-func (api *APIServer) getLogContent(c *gin.Context) {
-	agentID := c.Param("id")
-	source := c.Param("source")
-	log.Printf("[API] getLogContent - Demande de logs pour l'agent %s, source: %s", agentID, source)
+// deleteNotificationChannel supprime un canal de notification
+func (api *APIServer) deleteNotificationChannel(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
+	}
 
-	agent, exists := api.hub.GetAgent(agentID)
-	if !exists {
-		log.Printf("[API] getLogContent - Agent non trouvé: %s", agentID)
-		c.JSON(http.StatusNotFound, gin.H{"error": "agent non trouvé"})
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de canal invalide"})
 		return
 	}
 
-	// Récupérer les paramètres de requête
-	logType := c.Query("type")
-	if logType == "" {
-		logType = "agent"
+	if err := api.db.DeleteNotificationChannel(id); err != nil {
+		log.Printf("[API] deleteNotificationChannel - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la suppression du canal"})
+		return
 	}
 
-	linesStr := c.Query("lines")
-	lines := 100
-	if linesStr != "" {
-		fmt.Sscanf(linesStr, "%d", &lines)
+	if api.hub.notifier != nil {
+		if err := api.hub.notifier.Reload(); err != nil {
+			log.Printf("[API] deleteNotificationChannel - Erreur lors du rechargement des canaux: %v", err)
+		}
 	}
 
-	log.Printf("[API] getLogContent - Paramètres: type=%s, lines=%d", logType, lines)
+	c.JSON(http.StatusOK, gin.H{"message": "canal supprimé"})
+}
 
-	// Créer la requête de logs
-	logReq := &common.LogRequest{
-		Source:   source,
-		Type:     logType,
-		Lines:    lines,
-		Path:     c.Query("path"),
-		Unit:     c.Query("unit"),
-		Priority: c.Query("priority"),
-		Since:    c.Query("since"),
-		Until:    c.Query("until"),
+// testNotificationChannel envoie une notification de test sur un canal
+func (api *APIServer) testNotificationChannel(c *gin.Context) {
+	if api.db == nil || api.hub.notifier == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
 	}
 
-	msg := common.NewMessage(common.MessageTypeLogContent, logReq)
-	msg.AgentID = agentID
-	log.Printf("[API] getLogContent - Message créé avec ID: %s", msg.ID)
+	var id uint
+	if _, err := fmt.Sscanf(c.Param("id"), "%d", &id); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID de canal invalide"})
+		return
+	}
 
-	// Envoyer la demande avec réponse
-	log.Printf("[API] getLogContent - Envoi du message et attente de la réponse (timeout: 10s)")
-	response, err := agent.SendMessageWithResponse(msg, 10*time.Second)
+	channel, err := api.db.GetNotificationChannel(id)
 	if err != nil {
-		log.Printf("[API] getLogContent - ERREUR: %v", err)
-		c.JSON(http.StatusOK, gin.H{
-			"logs":     []interface{}{},
-			"source":   source,
-			"count":    0,
-			"agent_id": agentID,
-			"message":  "délai d'attente dépassé, l'agent n'a pas répondu",
-		})
+		c.JSON(http.StatusNotFound, gin.H{"error": "canal non trouvé"})
 		return
 	}
 
-	log.Printf("[API] getLogContent - Réponse reçue, type: %s", response.Type)
+	if err := api.hub.notifier.Test(channel); err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("échec de l'envoi: %v", err)})
+		return
+	}
 
-	// Parser la réponse
-	if logData, ok := response.Data.(map[string]interface{}); ok {
-		if entries, ok := logData["entries"].([]interface{}); ok {
-			log.Printf("[API] getLogContent - Données parsées avec succès: %d entrées", len(entries))
-			c.JSON(http.StatusOK, gin.H{
-				"logs":     entries,
-				"source":   source,
-				"count":    len(entries),
-				"agent_id": agentID,
-			})
-			return
-		}
+	c.JSON(http.StatusOK, gin.H{"message": "notification de test envoyée"})
+}
+
+// getNotificationLogs retourne l'historique des envois de notifications
+func (api *APIServer) getNotificationLogs(c *gin.Context) {
+	if api.db == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "base de données indisponible"})
+		return
 	}
 
-	// Sinon, essayer de parser comme un tableau direct
-	if entries, ok := response.Data.([]interface{}); ok {
-		log.Printf("[API] getLogContent - Données parsées comme tableau: %d entrées", len(entries))
-		c.JSON(http.StatusOK, gin.H{
-			"logs":     entries,
-			"source":   source,
-			"count":    len(entries),
-			"agent_id": agentID,
-		})
+	limit := 100
+	if limitStr := c.Query("limit"); limitStr != "" {
+		fmt.Sscanf(limitStr, "%d", &limit)
+	}
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	var channelID uint
+	if channelStr := c.Query("channel_id"); channelStr != "" {
+		fmt.Sscanf(channelStr, "%d", &channelID)
+	}
+
+	logs, err := api.db.GetNotificationLogs(channelID, limit)
+	if err != nil {
+		log.Printf("[API] getNotificationLogs - ERREUR: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "erreur lors de la récupération de l'historique"})
 		return
 	}
 
-	log.Printf("[API] getLogContent - Format de données inattendu: %T", response.Data)
 	c.JSON(http.StatusOK, gin.H{
-		"logs":     []interface{}{},
-		"source":   source,
-		"count":    0,
-		"agent_id": agentID,
+		"notifications": logs,
+		"count":         len(logs),
 	})
 }
 
@@ -10,6 +10,7 @@ import (
 	"github.com/glebarez/sqlite" // Driver SQLite pur Go (pas besoin de CGO)
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/logger"
 )
 
@@ -93,19 +94,75 @@ func (FileLog) TableName() string {
 }
 
 // PrinterLog représente un log d'imprimante
+// Une entrée est enregistrée à chaque changement de statut ou de raisons d'état
 type PrinterLog struct {
-	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
-	AgentID     string    `gorm:"type:varchar(191);index" json:"agent_id"`
-	PrinterName string    `gorm:"type:varchar(255)" json:"printer_name"`
-	Status      string    `gorm:"type:varchar(100)" json:"status"`
-	JobCount    int       `json:"job_count"`
-	CreatedAt   time.Time `gorm:"type:datetime(3);index" json:"created_at"`
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	AgentID        string    `gorm:"type:varchar(191);index" json:"agent_id"`
+	PrinterName    string    `gorm:"type:varchar(255)" json:"printer_name"`
+	Status         string    `gorm:"type:varchar(100)" json:"status"`
+	PreviousStatus string    `gorm:"type:varchar(100)" json:"previous_status,omitempty"`
+	Reasons        string    `gorm:"type:text" json:"reasons,omitempty"` // printer-state-reasons séparées par des virgules
+	Message        string    `gorm:"type:text" json:"message,omitempty"`
+	JobCount       int       `json:"job_count"`
+	CreatedAt      time.Time `gorm:"type:datetime(3);index" json:"created_at"`
 }
 
 func (PrinterLog) TableName() string {
 	return "rms_printer_logs"
 }
 
+// PrintJobRecord représente un travail d'impression sorti de la file d'un agent
+type PrintJobRecord struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	AgentID     string    `gorm:"type:varchar(191);uniqueIndex:idx_print_job,priority:1" json:"agent_id"`
+	PrinterName string    `gorm:"type:varchar(191);uniqueIndex:idx_print_job,priority:2" json:"printer_name"`
+	JobID       int       `gorm:"uniqueIndex:idx_print_job,priority:3" json:"job_id"`
+	Name        string    `gorm:"type:varchar(255)" json:"name"`
+	User        string    `gorm:"type:varchar(255)" json:"user"`
+	Size        int64     `json:"size"`
+	Pages       int       `json:"pages"`
+	Status      string    `gorm:"type:varchar(20)" json:"status"` // completed, canceled, aborted, unknown (sorti de la file sans état final connu)
+	SubmittedAt time.Time `gorm:"type:datetime(3)" json:"submitted_at"`
+	CompletedAt time.Time `gorm:"type:datetime(3);index" json:"completed_at"`
+}
+
+func (PrintJobRecord) TableName() string {
+	return "rms_print_jobs"
+}
+
+// PrinterMarkerLevel représente un relevé du niveau d'un consommable, enregistré lorsqu'il change
+type PrinterMarkerLevel struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	AgentID     string    `gorm:"type:varchar(191);index:idx_printer_marker,priority:1" json:"agent_id"`
+	PrinterName string    `gorm:"type:varchar(191);index:idx_printer_marker,priority:2" json:"printer_name"`
+	Marker      string    `gorm:"type:varchar(191);index:idx_printer_marker,priority:3" json:"marker"`
+	Color       string    `gorm:"type:varchar(50)" json:"color,omitempty"`
+	Level       int       `json:"level"`
+	CreatedAt   time.Time `gorm:"type:datetime(3);index" json:"created_at"`
+}
+
+func (PrinterMarkerLevel) TableName() string {
+	return "rms_printer_marker_levels"
+}
+
+// ServiceTransition représente un changement d'état d'un service, d'un conteneur ou d'un projet Compose
+type ServiceTransition struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	AgentID        string    `gorm:"type:varchar(191);index:idx_service_transition,priority:1" json:"agent_id"`
+	ServiceName    string    `gorm:"type:varchar(191);index:idx_service_transition,priority:2" json:"service_name"`
+	ServiceType    string    `gorm:"type:varchar(20)" json:"service_type"` // systemd, docker, compose
+	Event          string    `gorm:"type:varchar(30)" json:"event"`        // service_added, service_removed, state_changed
+	State          string    `gorm:"type:varchar(50)" json:"state,omitempty"`
+	PreviousState  string    `gorm:"type:varchar(50)" json:"previous_state,omitempty"`
+	Status         string    `gorm:"type:varchar(255)" json:"status,omitempty"`
+	PreviousStatus string    `gorm:"type:varchar(255)" json:"previous_status,omitempty"`
+	CreatedAt      time.Time `gorm:"type:datetime(3);index" json:"created_at"` // Détection du changement par l'agent
+}
+
+func (ServiceTransition) TableName() string {
+	return "rms_service_transitions"
+}
+
 // SystemLog représente un log système
 type SystemLog struct {
 	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
@@ -125,6 +182,269 @@ func (SystemLog) TableName() string {
 	return "rms_system_logs"
 }
 
+// LogRecord représente une entrée de log expédiée par un agent
+type LogRecord struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	AgentID   string    `gorm:"type:varchar(191);index" json:"agent_id"`
+	Source    string    `gorm:"type:varchar(191);index" json:"source"`
+	Type      string    `gorm:"type:varchar(50)" json:"type"`
+	Level     string    `gorm:"type:varchar(20);index" json:"level"`
+	Component string    `gorm:"type:varchar(100)" json:"component,omitempty"`
+	Unit      string    `gorm:"type:varchar(255)" json:"unit,omitempty"`
+	Message   string    `gorm:"type:text" json:"message"`
+	Timestamp time.Time `gorm:"type:datetime(3);index" json:"timestamp"`
+	CreatedAt time.Time `gorm:"type:datetime(3)" json:"created_at"`
+}
+
+func (LogRecord) TableName() string {
+	return "rms_log_entries"
+}
+
+// LogAlertRule représente une règle d'alerte sur motif de logs
+type LogAlertRule struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name           string    `gorm:"type:varchar(255)" json:"name"`
+	Pattern        string    `gorm:"type:varchar(1000)" json:"pattern"`        // Expression régulière
+	SourceSelector string    `gorm:"type:varchar(255)" json:"source_selector"` // Motif glob sur la source ("" = toutes)
+	AgentSelector  string    `gorm:"type:varchar(500)" json:"agent_selector"`  // IDs/globs, franchise:X, category:Y ("" = tous)
+	Threshold      int       `json:"threshold"`                                // Nombre de correspondances déclenchant l'alerte
+	WindowSeconds  int       `json:"window_seconds"`                           // Fenêtre de comptage
+	Severity       string    `gorm:"type:varchar(20)" json:"severity"`
+	Enabled        bool      `json:"enabled"`
+	CreatedAt      time.Time `gorm:"type:datetime(3)" json:"created_at"`
+	UpdatedAt      time.Time `gorm:"type:datetime(3)" json:"updated_at"`
+}
+
+func (LogAlertRule) TableName() string {
+	return "rms_log_alert_rules"
+}
+
+// LogAlert représente une alerte produite par une règle de logs
+type LogAlert struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	RuleID     uint      `gorm:"index" json:"rule_id"`
+	RuleName   string    `gorm:"type:varchar(255)" json:"rule_name"`
+	Severity   string    `gorm:"type:varchar(20)" json:"severity"`
+	AgentID    string    `gorm:"type:varchar(191);index" json:"agent_id"`
+	Source     string    `gorm:"type:varchar(191)" json:"source"`
+	MatchCount int       `json:"match_count"`
+	Sample     string    `gorm:"type:text" json:"sample"` // Dernière ligne correspondante
+	FirstMatch time.Time `gorm:"type:datetime(3)" json:"first_match"`
+	LastMatch  time.Time `gorm:"type:datetime(3)" json:"last_match"`
+	CreatedAt  time.Time `gorm:"type:datetime(3);index" json:"created_at"`
+}
+
+func (LogAlert) TableName() string {
+	return "rms_log_alerts"
+}
+
+// Types de règles d'alerte sur l'état des agents
+const (
+	AlertRuleOffline       = "offline"        // Agent sans activité depuis Threshold minutes
+	AlertRuleDisk          = "disk"           // Occupation du disque au-delà de Threshold %
+	AlertRuleMemory        = "memory"         // Occupation de la mémoire au-delà de Threshold %
+	AlertRulePrinterError  = "printer_error"  // Imprimante dans un état d'erreur
+	AlertRuleServiceFailed = "service_failed" // Service en échec
+)
+
+// Statuts d'une alerte
+const (
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+)
+
+// AlertRule représente une règle d'alerte sur l'état des agents
+type AlertRule struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name          string    `gorm:"type:varchar(255)" json:"name"`
+	Type          string    `gorm:"type:varchar(50)" json:"type"`            // offline, disk, memory, printer_error, service_failed
+	Threshold     float64   `json:"threshold"`                               // Minutes (offline) ou pourcentage (disk, memory)
+	Target        string    `gorm:"type:varchar(500)" json:"target"`         // Globs sur le nom de l'imprimante ou du service ("" = tous)
+	AgentSelector string    `gorm:"type:varchar(500)" json:"agent_selector"` // IDs/globs, franchise:X, category:Y ("" = tous)
+	Severity      string    `gorm:"type:varchar(20)" json:"severity"`
+	Enabled       bool      `json:"enabled"`
+	CreatedAt     time.Time `gorm:"type:datetime(3)" json:"created_at"`
+	UpdatedAt     time.Time `gorm:"type:datetime(3)" json:"updated_at"`
+}
+
+func (AlertRule) TableName() string {
+	return "rms_alert_rules"
+}
+
+// Alert représente une alerte sur l'état d'un agent
+// Une même condition (règle, agent, objet) ne produit qu'une alerte active, identifiée par son empreinte
+type Alert struct {
+	ID             uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Fingerprint    string     `gorm:"type:varchar(191);index" json:"fingerprint"`
+	RuleID         uint       `gorm:"index" json:"rule_id"`
+	RuleName       string     `gorm:"type:varchar(255)" json:"rule_name"`
+	Type           string     `gorm:"type:varchar(50)" json:"type"`
+	Severity       string     `gorm:"type:varchar(20)" json:"severity"`
+	AgentID        string     `gorm:"type:varchar(191);index" json:"agent_id"`
+	Subject        string     `gorm:"type:varchar(255)" json:"subject,omitempty"` // Imprimante ou service concerné
+	Status         string     `gorm:"type:varchar(20);index" json:"status"`
+	Message        string     `gorm:"type:varchar(1000)" json:"message"`
+	Value          float64    `json:"value"`
+	StartedAt      time.Time  `gorm:"type:datetime(3)" json:"started_at"`
+	LastEvaluated  time.Time  `gorm:"type:datetime(3)" json:"last_evaluated"`
+	ResolvedAt     *time.Time `gorm:"type:datetime(3)" json:"resolved_at,omitempty"`
+	AcknowledgedAt *time.Time `gorm:"type:datetime(3)" json:"acknowledged_at,omitempty"`
+	AcknowledgedBy string     `gorm:"type:varchar(255)" json:"acknowledged_by,omitempty"`
+	CreatedAt      time.Time  `gorm:"type:datetime(3);index" json:"created_at"`
+	UpdatedAt      time.Time  `gorm:"type:datetime(3)" json:"updated_at"`
+}
+
+func (Alert) TableName() string {
+	return "rms_alerts"
+}
+
+// InventorySnapshot représente une version de l'inventaire d'un agent
+// Une nouvelle version n'est enregistrée que lorsque l'empreinte de l'inventaire change
+type InventorySnapshot struct {
+	ID             uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	AgentID        string    `gorm:"type:varchar(191);index" json:"agent_id"`
+	Hash           string    `gorm:"type:varchar(64)" json:"hash"`
+	Hostname       string    `gorm:"type:varchar(255)" json:"hostname"`
+	OS             string    `gorm:"type:varchar(255)" json:"os"` // Nom complet de la distribution
+	Kernel         string    `gorm:"type:varchar(255)" json:"kernel"`
+	CPUModel       string    `gorm:"type:varchar(255)" json:"cpu_model"`
+	MemoryTotal    int64     `json:"memory_total"`
+	Vendor         string    `gorm:"type:varchar(255)" json:"vendor"`
+	Product        string    `gorm:"type:varchar(255)" json:"product"`
+	Serial         string    `gorm:"type:varchar(255)" json:"serial"`
+	PackageManager string    `gorm:"type:varchar(20)" json:"package_manager"`
+	PackageCount   int       `json:"package_count"`
+	Changes        string    `gorm:"type:text" json:"-"`     // Changements par rapport à la version précédente (JSON)
+	Data           string    `gorm:"type:longtext" json:"-"` // Inventaire complet (JSON)
+	CollectedAt    time.Time `gorm:"type:datetime(3)" json:"collected_at"`
+	CreatedAt      time.Time `gorm:"type:datetime(3);index" json:"created_at"`
+
+	ChangeList []*InventoryChange `gorm:"-" json:"changes,omitempty"`
+	Inventory  *common.Inventory  `gorm:"-" json:"inventory,omitempty"`
+}
+
+func (InventorySnapshot) TableName() string {
+	return "rms_inventory_snapshots"
+}
+
+// InstalledPackage représente un paquet installé sur un agent d'après son dernier inventaire
+type InstalledPackage struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	AgentID   string    `gorm:"type:varchar(191);index" json:"agent_id"`
+	Name      string    `gorm:"type:varchar(191);index" json:"name"`
+	Version   string    `gorm:"type:varchar(191)" json:"version"`
+	Arch      string    `gorm:"type:varchar(50)" json:"arch,omitempty"`
+	UpdatedAt time.Time `gorm:"type:datetime(3)" json:"updated_at"`
+}
+
+func (InstalledPackage) TableName() string {
+	return "rms_installed_packages"
+}
+
+// AuditLog représente une action sensible effectuée par un utilisateur sur un agent
+type AuditLog struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    string    `gorm:"type:varchar(191);index" json:"user_id"`
+	UserName  string    `gorm:"type:varchar(255)" json:"user_name"`
+	AgentID   string    `gorm:"type:varchar(191);index" json:"agent_id"`
+	Action    string    `gorm:"type:varchar(100);index" json:"action"`
+	Target    string    `gorm:"type:varchar(500)" json:"target"`
+	Details   string    `gorm:"type:text" json:"details,omitempty"`
+	Success   bool      `json:"success"`
+	Error     string    `gorm:"type:varchar(1000)" json:"error,omitempty"`
+	IPAddress string    `gorm:"type:varchar(100)" json:"ip_address"`
+	CreatedAt time.Time `gorm:"type:datetime(3);index" json:"created_at"`
+}
+
+func (AuditLog) TableName() string {
+	return "rms_audit_logs"
+}
+
+// Types de canaux de notification
+const (
+	NotificationChannelWebhook = "webhook" // JSON générique signé par HMAC
+	NotificationChannelSMTP    = "smtp"    // Email
+	NotificationChannelSlack   = "slack"   // Webhook entrant compatible Slack
+	NotificationChannelTeams   = "teams"   // Webhook entrant Microsoft Teams
+)
+
+// NotificationChannel représente un canal de notification externe
+type NotificationChannel struct {
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name         string    `gorm:"type:varchar(255)" json:"name"`
+	Type         string    `gorm:"type:varchar(20)" json:"type"` // webhook, smtp, slack, teams
+	URL          string    `gorm:"type:varchar(1000)" json:"url,omitempty"`
+	Secret       string    `gorm:"type:varchar(255)" json:"secret,omitempty"` // Clé HMAC des webhooks génériques
+	SMTPHost     string    `gorm:"type:varchar(255)" json:"smtp_host,omitempty"`
+	SMTPPort     int       `json:"smtp_port,omitempty"`
+	SMTPUser     string    `gorm:"type:varchar(255)" json:"smtp_user,omitempty"`
+	SMTPPassword string    `gorm:"type:varchar(255)" json:"smtp_password,omitempty"`
+	SMTPFrom     string    `gorm:"type:varchar(255)" json:"smtp_from,omitempty"`
+	SMTPTo       string    `gorm:"type:varchar(1000)" json:"smtp_to,omitempty"` // Destinataires séparés par des virgules
+	Template     string    `gorm:"type:text" json:"template,omitempty"`         // text/template Go ("" = modèle par défaut)
+	Events       string    `gorm:"type:varchar(500)" json:"events"`             // Événements séparés par des virgules ("" = tous)
+	Severities   string    `gorm:"type:varchar(255)" json:"severities"`         // Sévérités séparées par des virgules ("" = toutes)
+	Franchises   string    `gorm:"type:varchar(500)" json:"franchises"`         // Routage par franchise ("" = toutes)
+	Categories   string    `gorm:"type:varchar(500)" json:"categories"`         // Routage par catégorie ("" = toutes)
+	MaxAttempts  int       `json:"max_attempts"`                                // Nombre de tentatives d'envoi
+	Enabled      bool      `json:"enabled"`
+	CreatedAt    time.Time `gorm:"type:datetime(3)" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"type:datetime(3)" json:"updated_at"`
+}
+
+func (NotificationChannel) TableName() string {
+	return "rms_notification_channels"
+}
+
+// NotificationLog représente le résultat de l'envoi d'une notification
+type NotificationLog struct {
+	ID          uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	ChannelID   uint      `gorm:"index" json:"channel_id"`
+	ChannelName string    `gorm:"type:varchar(255)" json:"channel_name"`
+	Event       string    `gorm:"type:varchar(50)" json:"event"`
+	AgentID     string    `gorm:"type:varchar(191);index" json:"agent_id"`
+	Title       string    `gorm:"type:varchar(500)" json:"title"`
+	Status      string    `gorm:"type:varchar(20)" json:"status"` // sent, failed
+	Attempts    int       `json:"attempts"`
+	Error       string    `gorm:"type:varchar(1000)" json:"error,omitempty"`
+	CreatedAt   time.Time `gorm:"type:datetime(3);index" json:"created_at"`
+}
+
+func (NotificationLog) TableName() string {
+	return "rms_notification_logs"
+}
+
+// MetricPoint représente un point de série temporelle de métriques d'un agent
+// Les points bruts sont agrégés en points d'une minute puis d'une heure (Min/Max/Count conservés)
+type MetricPoint struct {
+	ID         uint      `gorm:"primaryKey;autoIncrement" json:"-"`
+	AgentID    string    `gorm:"type:varchar(191);index:idx_metric_series,priority:1" json:"agent_id"`
+	Metric     string    `gorm:"type:varchar(100);index:idx_metric_series,priority:2" json:"metric"`
+	Resolution string    `gorm:"type:varchar(10);index:idx_metric_series,priority:3" json:"resolution"` // raw, 1m, 1h
+	Timestamp  time.Time `gorm:"type:datetime(3);index:idx_metric_series,priority:4;index" json:"timestamp"`
+	Value      float64   `json:"value"`
+	Min        float64   `json:"min"`
+	Max        float64   `json:"max"`
+	Count      int       `json:"count"`
+}
+
+func (MetricPoint) TableName() string {
+	return "rms_metric_points"
+}
+
+// LogSearchFilter contient les critères de recherche dans les logs centralisés
+type LogSearchFilter struct {
+	Query     string
+	AgentID   string
+	Franchise string
+	Source    string
+	Levels    []string
+	From      time.Time
+	To        time.Time
+	Limit     int
+	Offset    int
+}
+
 // NewDatabase crée une nouvelle instance de base de données
 // Si MySQL est configuré, utilise MySQL, sinon utilise SQLite
 func NewDatabase(config *common.Config) (*Database, error) {
@@ -172,7 +492,21 @@ func NewDatabase(config *common.Config) (*Database, error) {
 		&CommandLog{},
 		&FileLog{},
 		&PrinterLog{},
+		&PrintJobRecord{},
+		&PrinterMarkerLevel{},
+		&ServiceTransition{},
 		&SystemLog{},
+		&LogRecord{},
+		&LogAlertRule{},
+		&LogAlert{},
+		&MetricPoint{},
+		&AlertRule{},
+		&Alert{},
+		&NotificationChannel{},
+		&NotificationLog{},
+		&AuditLog{},
+		&InventorySnapshot{},
+		&InstalledPackage{},
 	); err != nil {
 		// Les erreurs de type "Can't DROP" sont normales lors des migrations
 		// On les ignore car les tables sont déjà créées avec les bons index
@@ -289,6 +623,114 @@ func (d *Database) GetPrinterLogs(agentID string, limit int) ([]*PrinterLog, err
 	return logs, err
 }
 
+// GetPrinterHistory récupère les changements d'état d'une imprimante sur une période, du plus ancien au plus récent
+func (d *Database) GetPrinterHistory(agentID, printer string, from, to time.Time) ([]*PrinterLog, error) {
+	var logs []*PrinterLog
+	err := d.db.Where("agent_id = ? AND printer_name = ? AND created_at >= ? AND created_at < ?", agentID, printer, from, to).
+		Order("created_at ASC").Find(&logs).Error
+	return logs, err
+}
+
+// GetLatestPrinterLog récupère le dernier état connu d'une imprimante avant une date
+// Retourne nil si aucun état n'a été enregistré
+func (d *Database) GetLatestPrinterLog(agentID, printer string, before time.Time) (*PrinterLog, error) {
+	var logs []*PrinterLog
+	err := d.db.Where("agent_id = ? AND printer_name = ? AND created_at < ?", agentID, printer, before).
+		Order("created_at DESC").Limit(1).Find(&logs).Error
+	if err != nil || len(logs) == 0 {
+		return nil, err
+	}
+	return logs[0], nil
+}
+
+// SavePrintJobs enregistre des travaux terminés en ignorant ceux déjà connus
+func (d *Database) SavePrintJobs(jobs []*PrintJobRecord) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+	return d.db.Clauses(clause.OnConflict{DoNothing: true}).Create(jobs).Error
+}
+
+// GetPrintJobs récupère les travaux terminés d'une imprimante sur une période, du plus récent au plus ancien
+func (d *Database) GetPrintJobs(agentID, printer string, from, to time.Time, limit int) ([]*PrintJobRecord, error) {
+	var jobs []*PrintJobRecord
+	query := d.db.Where("agent_id = ? AND printer_name = ? AND completed_at >= ? AND completed_at < ?", agentID, printer, from, to).
+		Order("completed_at DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&jobs).Error
+	return jobs, err
+}
+
+// SavePrinterMarkerLevels enregistre des relevés de niveaux de consommables
+func (d *Database) SavePrinterMarkerLevels(levels []*PrinterMarkerLevel) error {
+	if len(levels) == 0 {
+		return nil
+	}
+	return d.db.Create(levels).Error
+}
+
+// GetPrinterMarkerLevels récupère les relevés des consommables d'une imprimante depuis une date, du plus ancien au plus récent
+func (d *Database) GetPrinterMarkerLevels(agentID, printer string, from time.Time) ([]*PrinterMarkerLevel, error) {
+	var levels []*PrinterMarkerLevel
+	err := d.db.Where("agent_id = ? AND printer_name = ? AND created_at >= ?", agentID, printer, from).
+		Order("created_at ASC").Find(&levels).Error
+	return levels, err
+}
+
+// GetLatestPrinterMarkerLevels récupère le dernier relevé de chaque consommable d'une imprimante
+func (d *Database) GetLatestPrinterMarkerLevels(agentID, printer string) ([]*PrinterMarkerLevel, error) {
+	var levels []*PrinterMarkerLevel
+	latest := d.db.Model(&PrinterMarkerLevel{}).Select("MAX(id)").
+		Where("agent_id = ? AND printer_name = ?", agentID, printer).Group("marker")
+	err := d.db.Where("id IN (?)", latest).Find(&levels).Error
+	return levels, err
+}
+
+// CleanupPrinterHistory supprime l'historique des imprimantes antérieur à une date
+func (d *Database) CleanupPrinterHistory(before time.Time) error {
+	if err := d.db.Where("created_at < ?", before).Delete(&PrinterLog{}).Error; err != nil {
+		return err
+	}
+	if err := d.db.Where("completed_at < ?", before).Delete(&PrintJobRecord{}).Error; err != nil {
+		return err
+	}
+	return d.db.Where("created_at < ?", before).Delete(&PrinterMarkerLevel{}).Error
+}
+
+// SaveServiceTransitions enregistre des changements d'état de services
+func (d *Database) SaveServiceTransitions(transitions []*ServiceTransition) error {
+	if len(transitions) == 0 {
+		return nil
+	}
+	return d.db.Create(transitions).Error
+}
+
+// GetServiceTransitions récupère les changements d'état des services d'un agent sur une période, du plus récent au plus ancien
+// service et serviceType sont optionnels
+func (d *Database) GetServiceTransitions(agentID, service, serviceType string, from, to time.Time, limit int) ([]*ServiceTransition, error) {
+	var transitions []*ServiceTransition
+	query := d.db.Where("agent_id = ? AND created_at >= ? AND created_at < ?", agentID, from, to).
+		Order("created_at DESC")
+	if service != "" {
+		query = query.Where("service_name = ?", service)
+	}
+	if serviceType != "" {
+		query = query.Where("service_type = ?", serviceType)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&transitions).Error
+	return transitions, err
+}
+
+// CleanupServiceTransitions supprime les changements d'état des services antérieurs à une date
+func (d *Database) CleanupServiceTransitions(before time.Time) error {
+	return d.db.Where("created_at < ?", before).Delete(&ServiceTransition{}).Error
+}
+
 // LogSystem enregistre les informations système
 func (d *Database) LogSystem(log *SystemLog) error {
 	return d.db.Create(log).Error
@@ -370,7 +812,385 @@ func (d *Database) CleanupOldLogs(days int) error {
 		return err
 	}
 
-	return nil
+	return d.CleanupLogRecords(days)
+}
+
+// SaveLogRecords enregistre un lot d'entrées de logs expédiées
+func (d *Database) SaveLogRecords(records []*LogRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return d.db.CreateInBatches(records, 500).Error
+}
+
+// SearchLogs recherche dans les logs centralisés de toute la flotte
+// Retourne les entrées de la page demandée et le nombre total de résultats
+func (d *Database) SearchLogs(filter *LogSearchFilter) ([]*LogRecord, int64, error) {
+	query := d.db.Model(&LogRecord{})
+
+	if filter.Query != "" {
+		query = query.Where("message LIKE ?", "%"+filter.Query+"%")
+	}
+	if filter.AgentID != "" {
+		query = query.Where("agent_id = ?", filter.AgentID)
+	}
+	if filter.Franchise != "" {
+		query = query.Where("agent_id IN (?)", d.db.Model(&AgentRecord{}).Select("id").Where("franchise = ?", filter.Franchise))
+	}
+	if filter.Source != "" {
+		query = query.Where("source = ?", filter.Source)
+	}
+	if len(filter.Levels) > 0 {
+		query = query.Where("level IN ?", filter.Levels)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("timestamp >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("timestamp <= ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	var records []*LogRecord
+	err := query.Order("timestamp DESC").Limit(limit).Offset(filter.Offset).Find(&records).Error
+	return records, total, err
+}
+
+// GetLogAlertRules récupère toutes les règles d'alerte sur les logs
+func (d *Database) GetLogAlertRules() ([]*LogAlertRule, error) {
+	var rules []*LogAlertRule
+	err := d.db.Order("id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// GetLogAlertRule récupère une règle d'alerte par son ID
+func (d *Database) GetLogAlertRule(id uint) (*LogAlertRule, error) {
+	var rule LogAlertRule
+	if err := d.db.Where("id = ?", id).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// SaveLogAlertRule crée ou met à jour une règle d'alerte
+func (d *Database) SaveLogAlertRule(rule *LogAlertRule) error {
+	return d.db.Save(rule).Error
+}
+
+// DeleteLogAlertRule supprime une règle d'alerte
+func (d *Database) DeleteLogAlertRule(id uint) error {
+	return d.db.Where("id = ?", id).Delete(&LogAlertRule{}).Error
+}
+
+// CreateLogAlert enregistre une alerte produite par une règle de logs
+func (d *Database) CreateLogAlert(alert *LogAlert) error {
+	return d.db.Create(alert).Error
+}
+
+// GetLogAlerts récupère les alertes de logs les plus récentes
+func (d *Database) GetLogAlerts(agentID string, ruleID uint, limit int) ([]*LogAlert, error) {
+	var alerts []*LogAlert
+	query := d.db.Order("created_at DESC")
+
+	if agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	if ruleID != 0 {
+		query = query.Where("rule_id = ?", ruleID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	err := query.Find(&alerts).Error
+	return alerts, err
+}
+
+// CleanupLogRecords supprime les logs centralisés plus anciens que la rétention
+func (d *Database) CleanupLogRecords(days int) error {
+	if days <= 0 {
+		return nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+	return d.db.Where("timestamp < ?", cutoff).Delete(&LogRecord{}).Error
+}
+
+// GetAlertRules récupère toutes les règles d'alerte sur l'état des agents
+func (d *Database) GetAlertRules() ([]*AlertRule, error) {
+	var rules []*AlertRule
+	err := d.db.Order("id ASC").Find(&rules).Error
+	return rules, err
+}
+
+// GetAlertRule récupère une règle d'alerte par son ID
+func (d *Database) GetAlertRule(id uint) (*AlertRule, error) {
+	var rule AlertRule
+	if err := d.db.Where("id = ?", id).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// SaveAlertRule crée ou met à jour une règle d'alerte
+func (d *Database) SaveAlertRule(rule *AlertRule) error {
+	return d.db.Save(rule).Error
+}
+
+// DeleteAlertRule supprime une règle d'alerte
+func (d *Database) DeleteAlertRule(id uint) error {
+	return d.db.Where("id = ?", id).Delete(&AlertRule{}).Error
+}
+
+// SaveAlert crée ou met à jour une alerte
+func (d *Database) SaveAlert(alert *Alert) error {
+	return d.db.Save(alert).Error
+}
+
+// GetAlert récupère une alerte par son ID
+func (d *Database) GetAlert(id uint) (*Alert, error) {
+	var alert Alert
+	if err := d.db.Where("id = ?", id).First(&alert).Error; err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// GetFiringAlerts récupère les alertes actives
+func (d *Database) GetFiringAlerts() ([]*Alert, error) {
+	var alerts []*Alert
+	err := d.db.Where("status = ?", AlertStatusFiring).Find(&alerts).Error
+	return alerts, err
+}
+
+// GetAlerts récupère les alertes les plus récentes
+func (d *Database) GetAlerts(agentID, status string, limit int) ([]*Alert, error) {
+	var alerts []*Alert
+	query := d.db.Order("created_at DESC")
+
+	if agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	err := query.Find(&alerts).Error
+	return alerts, err
+}
+
+// SaveInventorySnapshot enregistre une version de l'inventaire et remplace les paquets installés de l'agent
+func (d *Database) SaveInventorySnapshot(snapshot *InventorySnapshot, packages []*InstalledPackage) error {
+	return d.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(snapshot).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("agent_id = ?", snapshot.AgentID).Delete(&InstalledPackage{}).Error; err != nil {
+			return err
+		}
+		if len(packages) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(packages, 500).Error
+	})
+}
+
+// GetLatestInventorySnapshot récupère la dernière version de l'inventaire d'un agent
+// Retourne nil si aucun inventaire n'a été reçu
+func (d *Database) GetLatestInventorySnapshot(agentID string) (*InventorySnapshot, error) {
+	var snapshots []*InventorySnapshot
+	err := d.db.Where("agent_id = ?", agentID).Order("id DESC").Limit(1).Find(&snapshots).Error
+	if err != nil || len(snapshots) == 0 {
+		return nil, err
+	}
+	return snapshots[0], nil
+}
+
+// GetInventorySnapshots récupère l'historique de l'inventaire d'un agent, sans le contenu complet
+func (d *Database) GetInventorySnapshots(agentID string, limit int) ([]*InventorySnapshot, error) {
+	var snapshots []*InventorySnapshot
+	query := d.db.Omit("data").Where("agent_id = ?", agentID).Order("id DESC")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	err := query.Find(&snapshots).Error
+	return snapshots, err
+}
+
+// CleanupInventorySnapshots purge l'historique des inventaires, la dernière version de chaque agent étant toujours conservée
+// Le contenu complet des versions antérieures à dataBefore est supprimé (seuls les changements restent),
+// les versions antérieures à before sont supprimées
+func (d *Database) CleanupInventorySnapshots(dataBefore, before time.Time) error {
+	// Table dérivée: MySQL refuse une sous-requête sur la table modifiée
+	latest := d.db.Table("(?) AS latest", d.db.Model(&InventorySnapshot{}).Select("MAX(id) AS id").Group("agent_id")).Select("id")
+
+	err := d.db.Model(&InventorySnapshot{}).
+		Where("created_at < ? AND data <> '' AND id NOT IN (?)", dataBefore, latest).
+		Update("data", "").Error
+	if err != nil {
+		return err
+	}
+	return d.db.Where("created_at < ? AND id NOT IN (?)", before, latest).Delete(&InventorySnapshot{}).Error
+}
+
+// FindInstalledPackages récupère les installations d'un paquet sur l'ensemble des agents
+// Un nom terminé par "*" sélectionne tous les paquets de ce préfixe
+func (d *Database) FindInstalledPackages(name string) ([]*InstalledPackage, error) {
+	var packages []*InstalledPackage
+	query := d.db.Order("name, agent_id")
+	if strings.HasSuffix(name, "*") {
+		query = query.Where("name LIKE ?", strings.TrimSuffix(name, "*")+"%")
+	} else {
+		query = query.Where("name = ?", name)
+	}
+	err := query.Find(&packages).Error
+	return packages, err
+}
+
+// LogAudit enregistre une entrée du journal d'audit
+func (d *Database) LogAudit(entry *AuditLog) error {
+	return d.db.Create(entry).Error
+}
+
+// GetAuditLogs récupère les dernières entrées du journal d'audit
+func (d *Database) GetAuditLogs(agentID, action string, limit int) ([]*AuditLog, error) {
+	var logs []*AuditLog
+	query := d.db.Order("created_at DESC")
+
+	if agentID != "" {
+		query = query.Where("agent_id = ?", agentID)
+	}
+	if action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	err := query.Find(&logs).Error
+	return logs, err
+}
+
+// GetNotificationChannels récupère tous les canaux de notification
+func (d *Database) GetNotificationChannels() ([]*NotificationChannel, error) {
+	var channels []*NotificationChannel
+	err := d.db.Order("id ASC").Find(&channels).Error
+	return channels, err
+}
+
+// GetNotificationChannel récupère un canal de notification par son ID
+func (d *Database) GetNotificationChannel(id uint) (*NotificationChannel, error) {
+	var channel NotificationChannel
+	if err := d.db.Where("id = ?", id).First(&channel).Error; err != nil {
+		return nil, err
+	}
+	return &channel, nil
+}
+
+// SaveNotificationChannel crée ou met à jour un canal de notification
+func (d *Database) SaveNotificationChannel(channel *NotificationChannel) error {
+	return d.db.Save(channel).Error
+}
+
+// DeleteNotificationChannel supprime un canal de notification
+func (d *Database) DeleteNotificationChannel(id uint) error {
+	return d.db.Where("id = ?", id).Delete(&NotificationChannel{}).Error
+}
+
+// LogNotification enregistre le résultat de l'envoi d'une notification
+func (d *Database) LogNotification(entry *NotificationLog) error {
+	return d.db.Create(entry).Error
+}
+
+// GetNotificationLogs récupère l'historique des envois de notifications
+func (d *Database) GetNotificationLogs(channelID uint, limit int) ([]*NotificationLog, error) {
+	var logs []*NotificationLog
+	query := d.db.Order("created_at DESC")
+
+	if channelID != 0 {
+		query = query.Where("channel_id = ?", channelID)
+	}
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	err := query.Find(&logs).Error
+	return logs, err
+}
+
+// SaveMetricPoints enregistre un lot de points de métriques
+func (d *Database) SaveMetricPoints(points []*MetricPoint) error {
+	if len(points) == 0 {
+		return nil
+	}
+	return d.db.CreateInBatches(points, 500).Error
+}
+
+// GetMetricPoints récupère les points d'un agent pour une résolution et une plage de temps
+// Un nom de métrique terminé par ".*" sélectionne toutes les métriques de ce préfixe
+func (d *Database) GetMetricPoints(agentID string, metrics []string, resolution string, from, to time.Time) ([]*MetricPoint, error) {
+	var points []*MetricPoint
+	query := d.db.Where("agent_id = ? AND resolution = ?", agentID, resolution).
+		Where("timestamp >= ? AND timestamp <= ?", from, to)
+
+	if len(metrics) > 0 {
+		var exact []string
+		conditions := d.db.Where("1 = 0")
+		for _, metric := range metrics {
+			if strings.HasSuffix(metric, ".*") {
+				conditions = conditions.Or("metric LIKE ?", strings.TrimSuffix(metric, "*")+"%")
+			} else {
+				exact = append(exact, metric)
+			}
+		}
+		if len(exact) > 0 {
+			conditions = conditions.Or("metric IN ?", exact)
+		}
+		query = query.Where(conditions)
+	}
+
+	err := query.Order("timestamp ASC").Find(&points).Error
+	return points, err
+}
+
+// GetMetricNames liste les métriques disponibles pour un agent
+func (d *Database) GetMetricNames(agentID string) ([]string, error) {
+	var names []string
+	err := d.db.Model(&MetricPoint{}).
+		Where("agent_id = ? AND resolution = ?", agentID, "raw").
+		Distinct("metric").Order("metric").Pluck("metric", &names).Error
+	return names, err
+}
+
+// GetLatestMetricTimestamp retourne l'horodatage du point le plus récent d'une résolution
+func (d *Database) GetLatestMetricTimestamp(resolution string) (time.Time, error) {
+	var point MetricPoint
+	err := d.db.Where("resolution = ?", resolution).Order("timestamp DESC").Limit(1).Find(&point).Error
+	return point.Timestamp, err
+}
+
+// GetMetricPointsRange récupère les points de tous les agents d'une résolution sur [from, to[
+func (d *Database) GetMetricPointsRange(resolution string, from, to time.Time) ([]*MetricPoint, error) {
+	var points []*MetricPoint
+	err := d.db.Where("resolution = ? AND timestamp >= ? AND timestamp < ?", resolution, from, to).
+		Order("timestamp ASC").Find(&points).Error
+	return points, err
+}
+
+// CleanupMetricPoints supprime les points d'une résolution antérieurs à la date donnée
+func (d *Database) CleanupMetricPoints(resolution string, before time.Time) error {
+	return d.db.Where("resolution = ? AND timestamp < ?", resolution, before).Delete(&MetricPoint{}).Error
 }
 
 // SaveUser sauvegarde ou met à jour un utilisateur
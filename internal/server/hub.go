@@ -21,6 +21,8 @@ type Agent struct {
 	Services   []*common.ServiceInfo         // Cache des services
 	LogSources []*common.LogSource           // Cache des sources de logs
 	responses  map[string]chan *common.Message
+	streams    map[string]chan *common.Message // Réponses en plusieurs messages (exports)
+	stats      *HubStats                       // Statistiques du hub (messages envoyés, durées)
 	mu         sync.RWMutex
 }
 
@@ -56,13 +58,22 @@ type Hub struct {
 	registerWeb   chan *WebClient
 	unregisterWeb chan *WebClient
 	broadcast     chan *common.Message
-	db            *Database // Référence à la base de données pour sauvegarder les agents
+	db            *Database            // Référence à la base de données pour sauvegarder les agents
+	logRetention  int                  // Rétention des logs centralisés en jours (0 = illimitée)
+	logAlerts     *LogAlertEngine      // Moteur d'alertes sur les logs
+	metrics       *MetricsStore        // Historique des métriques des agents
+	stats         *HubStats            // Statistiques exposées sur /metrics
+	alerts        *AlertManager        // Alertes sur l'état des agents
+	notifier      *Notifier            // Envoi des notifications sur les canaux externes
+	inventory     *InventoryStore      // Historique des inventaires matériels et logiciels
+	printerLog    *PrinterHistoryStore // Historique des états, travaux et consommables des imprimantes
+	serviceLog    *ServiceHistoryStore // Historique des changements d'état des services
 	mu            sync.RWMutex
 }
 
 // NewHub crée un nouveau hub
 func NewHub(db *Database) *Hub {
-	return &Hub{
+	h := &Hub{
 		agents:        make(map[string]*Agent),
 		webClients:    make(map[string]*WebClient),
 		metadata:      make(map[string]*AgentMetadata),
@@ -72,7 +83,18 @@ func NewHub(db *Database) *Hub {
 		unregisterWeb: make(chan *WebClient),
 		broadcast:     make(chan *common.Message, 256),
 		db:            db,
+		stats:         NewHubStats(),
 	}
+	if db != nil {
+		h.logAlerts = NewLogAlertEngine(db, h)
+		h.metrics = NewMetricsStore(db)
+		h.alerts = NewAlertManager(db, h)
+		h.notifier = NewNotifier(db, h)
+		h.inventory = NewInventoryStore(db)
+		h.printerLog = NewPrinterHistoryStore(db)
+		h.serviceLog = NewServiceHistoryStore(db)
+	}
+	return h
 }
 
 // Run démarre le hub
@@ -84,6 +106,25 @@ func (h *Hub) Run() {
 	updateTicker := time.NewTicker(60 * time.Second) // Mise à jour toutes les minutes
 	defer updateTicker.Stop()
 
+	// Ticker pour appliquer la rétention des logs centralisés
+	retentionTicker := time.NewTicker(time.Hour)
+	defer retentionTicker.Stop()
+
+	// Agrégation et rétention des métriques
+	if h.metrics != nil {
+		go h.metrics.Run()
+	}
+
+	// Évaluation des règles d'alerte sur l'état des agents
+	if h.alerts != nil {
+		go h.alerts.Run()
+	}
+
+	// Envoi des notifications
+	if h.notifier != nil {
+		go h.notifier.Run()
+	}
+
 	for {
 		select {
 		case agent := <-h.register:
@@ -107,6 +148,18 @@ func (h *Hub) Run() {
 		case <-updateTicker.C:
 			// Mettre à jour LastSeen des agents actifs dans la base de données
 			h.updateAgentsLastSeen()
+
+		case <-retentionTicker.C:
+			h.cleanupLogRecords()
+			if h.printerLog != nil {
+				h.printerLog.Cleanup(time.Now())
+			}
+			if h.serviceLog != nil {
+				h.serviceLog.Cleanup(time.Now())
+			}
+			if h.inventory != nil {
+				h.inventory.Cleanup(time.Now())
+			}
 		}
 	}
 }
@@ -118,7 +171,9 @@ func (h *Hub) registerAgent(agent *Agent) {
 
 	// Initialiser le map des réponses et le cache de fichiers
 	agent.responses = make(map[string]chan *common.Message)
+	agent.streams = make(map[string]chan *common.Message)
 	agent.FileCache = make(map[string][]*common.FileData)
+	agent.stats = h.stats
 
 	h.agents[agent.ID] = agent
 	log.Printf("Agent enregistré: %s (%s) depuis %s", agent.Name, agent.ID, agent.Conn.RemoteAddr())
@@ -154,6 +209,14 @@ func (h *Hub) registerAgent(agent *Agent) {
 			log.Printf("Agent %s sauvegardé dans la base de données", agent.ID)
 		}
 	}
+
+	h.notifier.Notify(&NotificationEvent{
+		Event:    NotificationEventAgentConnected,
+		Severity: "info",
+		Title:    fmt.Sprintf("Agent %s connecté", agent.Name),
+		Message:  fmt.Sprintf("L'agent %s (%s) s'est connecté depuis %s", agent.Name, agent.ID, agent.Conn.RemoteAddr()),
+		AgentID:  agent.ID,
+	})
 }
 
 // unregisterAgent désenregistre un agent
@@ -177,6 +240,14 @@ func (h *Hub) unregisterAgent(agent *Agent) {
 				log.Printf("Erreur lors de la mise à jour du statut de l'agent %s: %v", agent.ID, err)
 			}
 		}
+
+		h.notifier.Notify(&NotificationEvent{
+			Event:    NotificationEventAgentDisconnected,
+			Severity: "warning",
+			Title:    fmt.Sprintf("Agent %s déconnecté", agent.Name),
+			Message:  fmt.Sprintf("L'agent %s (%s) s'est déconnecté", agent.Name, agent.ID),
+			AgentID:  agent.ID,
+		})
 	}
 }
 
@@ -294,6 +365,27 @@ func (h *Hub) updateAgentsLastSeen() {
 	}
 }
 
+// SetLogRetention définit la rétention des logs centralisés en jours
+func (h *Hub) SetLogRetention(days int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.logRetention = days
+}
+
+// cleanupLogRecords supprime les logs centralisés expirés
+func (h *Hub) cleanupLogRecords() {
+	h.mu.RLock()
+	days := h.logRetention
+	h.mu.RUnlock()
+
+	if h.db == nil || days <= 0 {
+		return
+	}
+	if err := h.db.CleanupLogRecords(days); err != nil {
+		log.Printf("Erreur lors du nettoyage des logs centralisés: %v", err)
+	}
+}
+
 // SendMessage envoie un message à l'agent
 func (a *Agent) SendMessage(message *common.Message) error {
 	a.mu.Lock()
@@ -304,7 +396,17 @@ func (a *Agent) SendMessage(message *common.Message) error {
 		return err
 	}
 
-	return a.Conn.WriteMessage(1, data) // 1 = TextMessage
+	if err := a.Conn.WriteMessage(1, data); err != nil { // 1 = TextMessage
+		return err
+	}
+
+	if a.stats != nil {
+		a.stats.MessageSent("agent", message.Type)
+		if message.Type == common.MessageTypeCommand {
+			a.stats.CommandStarted(message.ID)
+		}
+	}
+	return nil
 }
 
 // SendMessageWithResponse envoie un message et attend une réponse
@@ -329,6 +431,7 @@ func (a *Agent) SendMessageWithResponse(message *common.Message, timeout time.Du
 	}()
 
 	// Envoyer le message
+	started := time.Now()
 	if err := a.SendMessage(message); err != nil {
 		return nil, err
 	}
@@ -336,17 +439,65 @@ func (a *Agent) SendMessageWithResponse(message *common.Message, timeout time.Du
 	// Attendre la réponse avec timeout
 	select {
 	case response := <-responseChan:
+		if a.stats != nil {
+			a.stats.ObserveDuration(message.Type, time.Since(started))
+		}
 		return response, nil
 	case <-time.After(timeout):
 		return nil, fmt.Errorf("timeout en attendant la réponse")
 	}
 }
 
+// agentStreamBuffer est le nombre de messages d'un flux en attente de lecture avant sa saturation
+const agentStreamBuffer = 256
+
+// errStreamSaturated est retournée lorsqu'un flux a été fermé faute d'être lu assez vite
+var errStreamSaturated = fmt.Errorf("flux saturé, le destinataire ne suit pas le rythme de l'agent")
+
+// agentError retourne l'erreur signalée par une réponse de type erreur de l'agent
+func agentError(response *common.Message) error {
+	errorData, err := common.DecodePayload[common.ErrorData](response)
+	if err != nil {
+		return fmt.Errorf("réponse d'erreur de l'agent invalide: %v", err)
+	}
+	return fmt.Errorf("%s", errorData.Message)
+}
+
+// OpenStream ouvre un canal recevant tous les messages de réponse portant cet ID
+// Le canal est fermé si le destinataire ne suit pas le rythme de l'agent (flux saturé)
+// La fonction retournée doit être appelée pour fermer le flux
+func (a *Agent) OpenStream(id string) (<-chan *common.Message, func()) {
+	streamChan := make(chan *common.Message, agentStreamBuffer)
+
+	a.mu.Lock()
+	a.streams[id] = streamChan
+	a.mu.Unlock()
+
+	return streamChan, func() {
+		a.mu.Lock()
+		delete(a.streams, id)
+		a.mu.Unlock()
+	}
+}
+
 // HandleResponse traite une réponse reçue d'un agent
+// Appelée depuis la boucle de lecture de l'agent, elle ne doit jamais bloquer
 func (a *Agent) HandleResponse(response *common.Message) {
-	a.mu.RLock()
+	a.mu.Lock()
+	if streamChan, streaming := a.streams[response.ID]; streaming {
+		// Un flux ne perd pas de messages en silence: saturé, il est fermé et le destinataire abandonne
+		select {
+		case streamChan <- response:
+		default:
+			delete(a.streams, response.ID)
+			close(streamChan)
+			log.Printf("Flux %s de l'agent %s saturé, flux interrompu", response.ID, a.ID)
+		}
+		a.mu.Unlock()
+		return
+	}
 	responseChan, exists := a.responses[response.ID]
-	a.mu.RUnlock()
+	a.mu.Unlock()
 
 	if exists {
 		select {
@@ -373,6 +524,43 @@ func (a *Agent) UpdatePrinters(printers []*common.PrinterInfo) {
 	a.Printers = printers
 }
 
+// ApplyPrinterDelta applique les changements envoyés par l'agent à l'état connu de ses imprimantes
+// Retourne la liste complète des imprimantes après application
+func (a *Agent) ApplyPrinterDelta(delta *common.PrinterDelta) []*common.PrinterInfo {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	removed := make(map[string]bool, len(delta.Removed))
+	for _, name := range delta.Removed {
+		removed[name] = true
+	}
+	updated := make(map[string]*common.PrinterInfo, len(delta.Updated))
+	for _, printer := range delta.Updated {
+		updated[printer.Name] = printer
+	}
+
+	printers := make([]*common.PrinterInfo, 0, len(a.Printers)+len(delta.Updated))
+	for _, printer := range a.Printers {
+		if removed[printer.Name] {
+			continue
+		}
+		if replacement, ok := updated[printer.Name]; ok {
+			printer = replacement
+			delete(updated, printer.Name)
+		}
+		printers = append(printers, printer)
+	}
+	// Les imprimantes restantes sont nouvelles, dans l'ordre envoyé par l'agent
+	for _, printer := range delta.Updated {
+		if _, ok := updated[printer.Name]; ok {
+			printers = append(printers, printer)
+		}
+	}
+
+	a.Printers = printers
+	return printers
+}
+
 // UpdateSystemInfo met à jour les informations système
 func (a *Agent) UpdateSystemInfo(systemInfo *common.SystemInfo) {
 	a.mu.Lock()
@@ -438,6 +626,51 @@ func (a *Agent) UpdateServices(services []*common.ServiceInfo) {
 	a.Services = services
 }
 
+// ApplyServiceDelta applique les changements envoyés par l'agent à l'état connu de ses services
+// L'activation et la consommation des services modifiés restent celles de la dernière liste complète,
+// la consommation d'un conteneur arrêté étant effacée
+func (a *Agent) ApplyServiceDelta(delta *common.ServiceDelta) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := func(name, serviceType string) string { return serviceType + "/" + name }
+	removed := make(map[string]bool, len(delta.Removed))
+	for _, ref := range delta.Removed {
+		removed[key(ref.Name, ref.Type)] = true
+	}
+	updated := make(map[string]*common.ServiceInfo, len(delta.Updated))
+	for _, service := range delta.Updated {
+		updated[key(service.Name, service.Type)] = service
+	}
+
+	services := make([]*common.ServiceInfo, 0, len(a.Services)+len(delta.Updated))
+	for _, service := range a.Services {
+		k := key(service.Name, service.Type)
+		if removed[k] {
+			continue
+		}
+		if replacement, ok := updated[k]; ok {
+			// Copie: la liste précédente peut être en cours de lecture par une requête
+			merged := *replacement
+			merged.Enabled = service.Enabled
+			if merged.State == "active" {
+				merged.Stats = service.Stats
+			}
+			service = &merged
+			delete(updated, k)
+		}
+		services = append(services, service)
+	}
+	// Les services restants sont nouveaux, dans l'ordre envoyé par l'agent
+	for _, service := range delta.Updated {
+		if _, ok := updated[key(service.Name, service.Type)]; ok {
+			services = append(services, service)
+		}
+	}
+
+	a.Services = services
+}
+
 // GetServices retourne les informations des services
 func (a *Agent) GetServices() []*common.ServiceInfo {
 	a.mu.RLock()
@@ -488,6 +721,7 @@ func (h *Hub) BroadcastToWebClients(message *common.Message) {
 	defer h.mu.RUnlock()
 
 	for _, client := range h.webClients {
+		h.stats.MessageSent("web", message.Type)
 		go func(c *WebClient) {
 			if err := c.Conn.SendMessage(message); err != nil {
 				log.Printf("Erreur lors de l'envoi au client web %s: %v", c.ID, err)
@@ -0,0 +1,383 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+const (
+	// inventoryDataRetention est la durée de conservation du contenu complet des versions d'inventaire remplacées
+	inventoryDataRetention = 30 * 24 * time.Hour
+
+	// inventoryHistoryRetention est la durée de conservation de l'historique des inventaires
+	inventoryHistoryRetention = 400 * 24 * time.Hour
+)
+
+// InventoryChange décrit un changement entre deux versions de l'inventaire d'un agent
+// Old est vide pour un ajout, New est vide pour une suppression
+type InventoryChange struct {
+	Field string `json:"field"` // package, kernel, os, cpu_model, memory_total, serial, disk, nic
+	Item  string `json:"item,omitempty"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// InventoryStore conserve l'historique des inventaires et l'index des paquets installés
+type InventoryStore struct {
+	db *Database
+}
+
+// NewInventoryStore crée un nouveau stockage d'inventaire
+func NewInventoryStore(db *Database) *InventoryStore {
+	return &InventoryStore{db: db}
+}
+
+// Save enregistre un inventaire s'il diffère de la dernière version connue
+// Retourne les changements détectés et false si l'inventaire est inchangé
+func (s *InventoryStore) Save(agentID string, inventory *common.Inventory) ([]*InventoryChange, bool, error) {
+	latest, err := s.db.GetLatestInventorySnapshot(agentID)
+	if err != nil {
+		return nil, false, err
+	}
+	if latest != nil && latest.Hash == inventory.Hash {
+		return nil, false, nil
+	}
+
+	var changes []*InventoryChange
+	if latest != nil {
+		var previous common.Inventory
+		if err := json.Unmarshal([]byte(latest.Data), &previous); err == nil {
+			changes = diffInventory(&previous, inventory)
+		}
+	}
+
+	data, err := json.Marshal(inventory)
+	if err != nil {
+		return nil, false, err
+	}
+	changesJSON, _ := json.Marshal(changes)
+
+	now := time.Now()
+	collectedAt, err := time.Parse(time.RFC3339, inventory.CollectedAt)
+	if err != nil {
+		collectedAt = now
+	}
+
+	snapshot := &InventorySnapshot{
+		AgentID:        agentID,
+		Hash:           inventory.Hash,
+		Hostname:       inventory.Hostname,
+		OS:             inventory.OS,
+		Kernel:         inventory.Kernel,
+		CPUModel:       inventory.CPUModel,
+		MemoryTotal:    inventory.MemoryTotal,
+		PackageManager: inventory.PackageManager,
+		PackageCount:   len(inventory.Packages),
+		Changes:        string(changesJSON),
+		Data:           string(data),
+		CollectedAt:    collectedAt,
+		CreatedAt:      now,
+	}
+	if inventory.OSRelease != nil && inventory.OSRelease.PrettyName != "" {
+		snapshot.OS = inventory.OSRelease.PrettyName
+	}
+	if inventory.DMI != nil {
+		snapshot.Vendor = inventory.DMI.Vendor
+		snapshot.Product = inventory.DMI.Product
+		snapshot.Serial = inventory.DMI.Serial
+	}
+
+	packages := make([]*InstalledPackage, 0, len(inventory.Packages))
+	for _, pkg := range inventory.Packages {
+		if pkg == nil || pkg.Name == "" {
+			continue
+		}
+		packages = append(packages, &InstalledPackage{
+			AgentID:   agentID,
+			Name:      pkg.Name,
+			Version:   pkg.Version,
+			Arch:      pkg.Arch,
+			UpdatedAt: now,
+		})
+	}
+
+	if err := s.db.SaveInventorySnapshot(snapshot, packages); err != nil {
+		return nil, false, err
+	}
+	return changes, true, nil
+}
+
+// Latest retourne la dernière version de l'inventaire d'un agent avec son contenu complet
+func (s *InventoryStore) Latest(agentID string) (*InventorySnapshot, error) {
+	snapshot, err := s.db.GetLatestInventorySnapshot(agentID)
+	if err != nil || snapshot == nil {
+		return snapshot, err
+	}
+
+	snapshot.Inventory = &common.Inventory{}
+	if err := json.Unmarshal([]byte(snapshot.Data), snapshot.Inventory); err != nil {
+		return nil, fmt.Errorf("inventaire enregistré invalide: %v", err)
+	}
+	snapshot.ChangeList = decodeInventoryChanges(snapshot.Changes)
+	return snapshot, nil
+}
+
+// History retourne les versions successives de l'inventaire d'un agent avec leurs changements
+func (s *InventoryStore) History(agentID string, limit int) ([]*InventorySnapshot, error) {
+	snapshots, err := s.db.GetInventorySnapshots(agentID, limit)
+	if err != nil {
+		return nil, err
+	}
+	for _, snapshot := range snapshots {
+		snapshot.ChangeList = decodeInventoryChanges(snapshot.Changes)
+	}
+	return snapshots, nil
+}
+
+// Cleanup purge l'historique des inventaires au-delà des durées de rétention
+func (s *InventoryStore) Cleanup(now time.Time) {
+	if err := s.db.CleanupInventorySnapshots(now.Add(-inventoryDataRetention), now.Add(-inventoryHistoryRetention)); err != nil {
+		log.Printf("[INVENTORY] Erreur lors du nettoyage de l'historique des inventaires: %v", err)
+	}
+}
+
+// FindPackage retourne les agents sur lesquels un paquet est installé
+// Si below est renseigné, seules les versions strictement inférieures sont retournées
+func (s *InventoryStore) FindPackage(name, below string) ([]*InstalledPackage, error) {
+	packages, err := s.db.FindInstalledPackages(name)
+	if err != nil || below == "" {
+		return packages, err
+	}
+
+	filtered := make([]*InstalledPackage, 0, len(packages))
+	for _, pkg := range packages {
+		if compareVersions(pkg.Version, below) < 0 {
+			filtered = append(filtered, pkg)
+		}
+	}
+	return filtered, nil
+}
+
+// decodeInventoryChanges décode les changements enregistrés avec une version de l'inventaire
+func decodeInventoryChanges(data string) []*InventoryChange {
+	var changes []*InventoryChange
+	if data != "" {
+		json.Unmarshal([]byte(data), &changes)
+	}
+	return changes
+}
+
+// diffInventory calcule les changements entre deux inventaires
+func diffInventory(previous, current *common.Inventory) []*InventoryChange {
+	var changes []*InventoryChange
+	field := func(name, old, new string) {
+		if old != new {
+			changes = append(changes, &InventoryChange{Field: name, Old: old, New: new})
+		}
+	}
+
+	field("os", osReleaseName(previous), osReleaseName(current))
+	field("kernel", previous.Kernel, current.Kernel)
+	field("cpu_model", previous.CPUModel, current.CPUModel)
+	if previous.MemoryTotal != current.MemoryTotal {
+		field("memory_total", strconv.FormatInt(previous.MemoryTotal, 10), strconv.FormatInt(current.MemoryTotal, 10))
+	}
+	field("serial", dmiSerial(previous), dmiSerial(current))
+
+	oldDisks := make(map[string]string)
+	for _, disk := range previous.Disks {
+		oldDisks[disk.Name] = describeDisk(disk)
+	}
+	newDisks := make(map[string]string)
+	for _, disk := range current.Disks {
+		newDisks[disk.Name] = describeDisk(disk)
+	}
+	changes = append(changes, diffItems("disk", oldDisks, newDisks)...)
+
+	oldNICs := make(map[string]string)
+	for _, nic := range previous.NICs {
+		oldNICs[nic.Name] = nic.MAC
+	}
+	newNICs := make(map[string]string)
+	for _, nic := range current.NICs {
+		newNICs[nic.Name] = nic.MAC
+	}
+	changes = append(changes, diffItems("nic", oldNICs, newNICs)...)
+
+	oldPackages := make(map[string]string)
+	for _, pkg := range previous.Packages {
+		oldPackages[packageKey(pkg)] = pkg.Version
+	}
+	newPackages := make(map[string]string)
+	for _, pkg := range current.Packages {
+		newPackages[packageKey(pkg)] = pkg.Version
+	}
+	changes = append(changes, diffItems("package", oldPackages, newPackages)...)
+
+	return changes
+}
+
+// diffItems compare deux ensembles d'éléments nommés et retourne les ajouts, suppressions et modifications
+func diffItems(field string, previous, current map[string]string) []*InventoryChange {
+	var changes []*InventoryChange
+	for item, old := range previous {
+		if new, exists := current[item]; !exists || new != old {
+			changes = append(changes, &InventoryChange{Field: field, Item: item, Old: old, New: new})
+		}
+	}
+	for item, new := range current {
+		if _, exists := previous[item]; !exists {
+			changes = append(changes, &InventoryChange{Field: field, Item: item, New: new})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Item < changes[j].Item })
+	return changes
+}
+
+// osReleaseName retourne le nom complet de la distribution d'un inventaire
+func osReleaseName(inventory *common.Inventory) string {
+	if inventory.OSRelease == nil {
+		return inventory.OS
+	}
+	return inventory.OSRelease.PrettyName
+}
+
+// dmiSerial retourne le numéro de série matériel d'un inventaire
+func dmiSerial(inventory *common.Inventory) string {
+	if inventory.DMI == nil {
+		return ""
+	}
+	return inventory.DMI.Serial
+}
+
+// describeDisk résume un disque pour la détection des changements
+func describeDisk(disk *common.InventoryDisk) string {
+	return strings.TrimSpace(fmt.Sprintf("%s %s %d", disk.Model, disk.Serial, disk.Size))
+}
+
+// packageKey identifie un paquet, l'architecture distinguant les installations multiarch
+func packageKey(pkg *common.InventoryPackage) string {
+	if pkg.Arch == "" {
+		return pkg.Name
+	}
+	return pkg.Name + ":" + pkg.Arch
+}
+
+// compareVersions compare deux versions de paquet selon l'algorithme de dpkg
+// ([epoch:]upstream[-revision]), également adapté aux versions rpm et apk
+// Retourne -1, 0 ou 1
+func compareVersions(a, b string) int {
+	epochA, upstreamA, revisionA := splitVersion(a)
+	epochB, upstreamB, revisionB := splitVersion(b)
+
+	if epochA != epochB {
+		if epochA < epochB {
+			return -1
+		}
+		return 1
+	}
+	if c := compareVersionPart(upstreamA, upstreamB); c != 0 {
+		return c
+	}
+	return compareVersionPart(revisionA, revisionB)
+}
+
+// splitVersion sépare l'epoch, la version amont et la révision d'une version
+func splitVersion(version string) (int, string, string) {
+	epoch := 0
+	if i := strings.IndexByte(version, ':'); i >= 0 {
+		epoch, _ = strconv.Atoi(version[:i])
+		version = version[i+1:]
+	}
+	if i := strings.LastIndexByte(version, '-'); i >= 0 {
+		return epoch, version[:i], version[i+1:]
+	}
+	return epoch, version, ""
+}
+
+// compareVersionPart compare alternativement les segments non numériques et numériques de deux versions
+func compareVersionPart(a, b string) int {
+	for a != "" || b != "" {
+		var textA, textB string
+		textA, a = splitVersionSegment(a, false)
+		textB, b = splitVersionSegment(b, false)
+		if c := compareVersionText(textA, textB); c != 0 {
+			return c
+		}
+
+		var numA, numB string
+		numA, a = splitVersionSegment(a, true)
+		numB, b = splitVersionSegment(b, true)
+		if c := compareVersionNumber(numA, numB); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// splitVersionSegment extrait le segment initial numérique (digits) ou non numérique d'une version
+func splitVersionSegment(version string, digits bool) (string, string) {
+	i := 0
+	for i < len(version) && isVersionDigit(version[i]) == digits {
+		i++
+	}
+	return version[:i], version[i:]
+}
+
+// compareVersionText compare deux segments non numériques
+// "~" précède la fin de chaîne, qui précède les lettres, qui précèdent les autres caractères
+func compareVersionText(a, b string) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var orderA, orderB int
+		if i < len(a) {
+			orderA = versionCharOrder(a[i])
+		}
+		if i < len(b) {
+			orderB = versionCharOrder(b[i])
+		}
+		if orderA != orderB {
+			if orderA < orderB {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// compareVersionNumber compare deux segments numériques de longueur arbitraire
+func compareVersionNumber(a, b string) int {
+	a = strings.TrimLeft(a, "0")
+	b = strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// versionCharOrder retourne le poids d'un caractère dans la comparaison de versions
+func versionCharOrder(c byte) int {
+	switch {
+	case c == '~':
+		return -1
+	case (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z'):
+		return int(c)
+	default:
+		return int(c) + 256
+	}
+}
+
+// isVersionDigit vérifie si un caractère est un chiffre
+func isVersionDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
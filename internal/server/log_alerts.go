@@ -0,0 +1,241 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// compiledLogRule associe une règle à son expression régulière compilée
+type compiledLogRule struct {
+	rule    *LogAlertRule
+	pattern *regexp.Regexp
+}
+
+// logMatchWindow conserve les correspondances récentes d'une règle pour un agent et une source
+type logMatchWindow struct {
+	matches []time.Time
+	sample  string
+}
+
+// LogAlertEngine évalue les règles d'alerte sur les lignes de logs reçues des agents
+type LogAlertEngine struct {
+	db      *Database
+	hub     *Hub
+	rules   []*compiledLogRule
+	windows map[string]*logMatchWindow // Clé: règle|agent|source
+	mu      sync.Mutex
+}
+
+// NewLogAlertEngine crée un nouveau moteur d'alertes sur les logs
+func NewLogAlertEngine(db *Database, hub *Hub) *LogAlertEngine {
+	engine := &LogAlertEngine{
+		db:      db,
+		hub:     hub,
+		windows: make(map[string]*logMatchWindow),
+	}
+	if err := engine.Reload(); err != nil {
+		log.Printf("Erreur lors du chargement des règles d'alerte sur les logs: %v", err)
+	}
+	return engine
+}
+
+// CompileLogAlertRule valide une règle et compile son expression régulière
+func CompileLogAlertRule(rule *LogAlertRule) (*regexp.Regexp, error) {
+	if rule.Pattern == "" {
+		return nil, fmt.Errorf("motif manquant")
+	}
+	if rule.Threshold < 1 {
+		return nil, fmt.Errorf("le seuil doit être supérieur ou égal à 1")
+	}
+	if rule.WindowSeconds < 1 {
+		return nil, fmt.Errorf("la fenêtre doit être supérieure ou égale à 1 seconde")
+	}
+	if rule.SourceSelector != "" {
+		if _, err := path.Match(rule.SourceSelector, ""); err != nil {
+			return nil, fmt.Errorf("sélecteur de source invalide: %v", err)
+		}
+	}
+	pattern, err := regexp.Compile(rule.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("expression régulière invalide: %v", err)
+	}
+	return pattern, nil
+}
+
+// Reload recharge les règles actives depuis la base de données
+func (e *LogAlertEngine) Reload() error {
+	if e.db == nil {
+		return nil
+	}
+
+	rules, err := e.db.GetLogAlertRules()
+	if err != nil {
+		return err
+	}
+
+	compiled := make([]*compiledLogRule, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		pattern, err := CompileLogAlertRule(rule)
+		if err != nil {
+			log.Printf("Règle d'alerte %d (%s) ignorée: %v", rule.ID, rule.Name, err)
+			continue
+		}
+		compiled = append(compiled, &compiledLogRule{rule: rule, pattern: pattern})
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.rules = compiled
+	// Les fenêtres des règles modifiées ou supprimées repartent de zéro
+	e.windows = make(map[string]*logMatchWindow)
+	return nil
+}
+
+// Evaluate évalue des entrées de logs d'un agent et déclenche les alertes dont le seuil est atteint
+func (e *LogAlertEngine) Evaluate(agentID, source string, entries []*common.LogEntry) {
+	e.mu.Lock()
+	if len(e.rules) == 0 {
+		e.mu.Unlock()
+		return
+	}
+
+	metadata := e.hub.GetAgentMetadata(agentID)
+	now := time.Now()
+	var fired []*LogAlert
+
+	for _, compiled := range e.rules {
+		rule := compiled.rule
+		if !matchAgentSelector(rule.AgentSelector, agentID, metadata) {
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry == nil {
+				continue
+			}
+			entrySource := entry.Source
+			if entrySource == "" {
+				entrySource = source
+			}
+			if rule.SourceSelector != "" {
+				if ok, _ := path.Match(rule.SourceSelector, entrySource); !ok {
+					continue
+				}
+			}
+			if !compiled.pattern.MatchString(entry.Message) {
+				continue
+			}
+
+			matchTime := now
+			if t, err := time.Parse(time.RFC3339Nano, entry.Timestamp); err == nil {
+				matchTime = t
+			}
+
+			key := fmt.Sprintf("%d|%s|%s", rule.ID, agentID, entrySource)
+			window, exists := e.windows[key]
+			if !exists {
+				window = &logMatchWindow{}
+				e.windows[key] = window
+			}
+
+			// Ne garder que les correspondances dans la fenêtre
+			cutoff := matchTime.Add(-time.Duration(rule.WindowSeconds) * time.Second)
+			kept := window.matches[:0]
+			for _, t := range window.matches {
+				if t.After(cutoff) {
+					kept = append(kept, t)
+				}
+			}
+			window.matches = append(kept, matchTime)
+			window.sample = entry.Message
+
+			if len(window.matches) >= rule.Threshold {
+				fired = append(fired, &LogAlert{
+					RuleID:     rule.ID,
+					RuleName:   rule.Name,
+					Severity:   rule.Severity,
+					AgentID:    agentID,
+					Source:     entrySource,
+					MatchCount: len(window.matches),
+					Sample:     window.sample,
+					FirstMatch: window.matches[0],
+					LastMatch:  matchTime,
+					CreatedAt:  now,
+				})
+				// Repartir de zéro pour ne pas déclencher à chaque nouvelle ligne
+				delete(e.windows, key)
+			}
+		}
+	}
+	e.mu.Unlock()
+
+	for _, alert := range fired {
+		e.fire(alert)
+	}
+}
+
+// fire enregistre une alerte et la pousse aux clients web
+func (e *LogAlertEngine) fire(alert *LogAlert) {
+	log.Printf("Alerte de logs déclenchée: règle %q, agent %s, source %s (%d correspondances)",
+		alert.RuleName, alert.AgentID, alert.Source, alert.MatchCount)
+
+	if e.db != nil {
+		if err := e.db.CreateLogAlert(alert); err != nil {
+			log.Printf("Erreur lors de l'enregistrement de l'alerte de logs: %v", err)
+		}
+	}
+
+	msg := common.NewMessage(common.MessageTypeLogAlert, alert)
+	msg.AgentID = alert.AgentID
+	e.hub.BroadcastToWebClients(msg)
+
+	e.hub.notifier.Notify(&NotificationEvent{
+		Event:    NotificationEventLogAlert,
+		Severity: alert.Severity,
+		Title:    fmt.Sprintf("Alerte de logs %s", alert.RuleName),
+		Message:  fmt.Sprintf("%d correspondances dans %s: %s", alert.MatchCount, alert.Source, alert.Sample),
+		AgentID:  alert.AgentID,
+		Data:     alert,
+	})
+}
+
+// matchAgentSelector vérifie si un agent correspond à un sélecteur
+// Le sélecteur est une liste séparée par des virgules d'IDs (globs acceptés),
+// de "franchise:<nom>" ou de "category:<nom>". Un sélecteur vide correspond à tous les agents.
+func matchAgentSelector(selector, agentID string, metadata *AgentMetadata) bool {
+	selector = strings.TrimSpace(selector)
+	if selector == "" || selector == "*" {
+		return true
+	}
+
+	for _, item := range strings.Split(selector, ",") {
+		item = strings.TrimSpace(item)
+		switch {
+		case item == "":
+			continue
+		case strings.HasPrefix(item, "franchise:"):
+			if metadata != nil && strings.EqualFold(metadata.Franchise, strings.TrimPrefix(item, "franchise:")) {
+				return true
+			}
+		case strings.HasPrefix(item, "category:"):
+			if metadata != nil && strings.EqualFold(metadata.Category, strings.TrimPrefix(item, "category:")) {
+				return true
+			}
+		default:
+			if ok, _ := path.Match(item, agentID); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"remoteshell/internal/common"
+)
+
+// logExportExtensions associe les formats d'export à leur extension de fichier
+var logExportExtensions = map[string]string{
+	"text":  "log",
+	"jsonl": "jsonl",
+	"csv":   "csv",
+}
+
+// logExportWriter écrit des entrées de logs dans un format d'export
+type logExportWriter struct {
+	format string
+	buf    *bufio.Writer
+	csv    *csv.Writer
+}
+
+// newLogExportWriter crée un writer d'export pour le format donné
+func newLogExportWriter(w io.Writer, format string) *logExportWriter {
+	writer := &logExportWriter{
+		format: format,
+		buf:    bufio.NewWriterSize(w, 64*1024),
+	}
+	if format == "csv" {
+		writer.csv = csv.NewWriter(writer.buf)
+		writer.csv.Write([]string{"timestamp", "level", "source", "component", "unit", "message"})
+	}
+	return writer
+}
+
+// Write écrit un lot d'entrées
+func (w *logExportWriter) Write(entries []*common.LogEntry) error {
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+
+		var err error
+		switch w.format {
+		case "jsonl":
+			var data []byte
+			if data, err = json.Marshal(entry); err == nil {
+				data = append(data, '\n')
+				_, err = w.buf.Write(data)
+			}
+		case "csv":
+			err = w.csv.Write([]string{entry.Timestamp, entry.Level, entry.Source, entry.Component, entry.Unit, entry.Message})
+		default:
+			_, err = w.buf.WriteString(formatLogExportLine(entry))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteError ajoute une ligne signalant une erreur survenue pendant l'export
+func (w *logExportWriter) WriteError(message string) {
+	w.Write([]*common.LogEntry{{
+		Level:   "error",
+		Source:  "remoteshell",
+		Message: fmt.Sprintf("Export interrompu: %s", message),
+	}})
+}
+
+// Flush vide les tampons vers le writer sous-jacent
+func (w *logExportWriter) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return w.buf.Flush()
+}
+
+// formatLogExportLine formate une entrée en ligne de texte
+func formatLogExportLine(entry *common.LogEntry) string {
+	var parts []string
+	if entry.Timestamp != "" {
+		parts = append(parts, entry.Timestamp)
+	}
+	if entry.Level != "" {
+		parts = append(parts, strings.ToUpper(entry.Level))
+	}
+	if entry.Unit != "" {
+		parts = append(parts, entry.Unit+":")
+	}
+	parts = append(parts, entry.Message)
+	return strings.Join(parts, " ") + "\n"
+}
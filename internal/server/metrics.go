@@ -0,0 +1,427 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// Résolutions des séries de métriques et durée de conservation de chacune
+const (
+	MetricResolutionRaw    = "raw"
+	MetricResolutionMinute = "1m"
+	MetricResolutionHour   = "1h"
+
+	metricRetentionRaw    = 48 * time.Hour
+	metricRetentionMinute = 14 * 24 * time.Hour
+	metricRetentionHour   = 365 * 24 * time.Hour
+
+	// maxMetricPoints limite le nombre de points retournés par série lorsque le pas n'est pas précisé
+	maxMetricPoints = 300
+)
+
+// MetricSeriesPoint est un point d'une série retournée par l'API
+type MetricSeriesPoint struct {
+	Timestamp time.Time `json:"t"`
+	Value     float64   `json:"value"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+}
+
+// MetricSeries est une série temporelle d'une métrique
+type MetricSeries struct {
+	Metric string               `json:"metric"`
+	Points []*MetricSeriesPoint `json:"points"`
+}
+
+// MetricsQuery décrit une requête de séries de métriques
+type MetricsQuery struct {
+	AgentID string
+	Metrics []string // Noms exacts ou préfixes terminés par ".*"
+	From    time.Time
+	To      time.Time
+	Step    time.Duration // 0 = calculé à partir de la plage
+}
+
+// MetricsResult est le résultat d'une requête de séries de métriques
+type MetricsResult struct {
+	AgentID    string          `json:"agent_id"`
+	Resolution string          `json:"resolution"`
+	Step       string          `json:"step"`
+	From       time.Time       `json:"from"`
+	To         time.Time       `json:"to"`
+	Series     []*MetricSeries `json:"series"`
+}
+
+// metricBucket accumule les points d'une métrique sur un intervalle
+type metricBucket struct {
+	agentID string
+	metric  string
+	start   time.Time
+	sum     float64
+	min     float64
+	max     float64
+	count   int
+}
+
+// add ajoute un point au bucket, pondéré par le nombre d'échantillons qu'il représente
+func (b *metricBucket) add(point *MetricPoint) {
+	count := point.Count
+	if count <= 0 {
+		count = 1
+	}
+	if b.count == 0 || point.Min < b.min {
+		b.min = point.Min
+	}
+	if b.count == 0 || point.Max > b.max {
+		b.max = point.Max
+	}
+	b.sum += point.Value * float64(count)
+	b.count += count
+}
+
+// MetricsStore historise les échantillons de métriques des agents
+// Les points bruts sont agrégés à la minute puis à l'heure, chaque résolution ayant sa propre rétention
+type MetricsStore struct {
+	db         *Database
+	watermarks map[string]time.Time // Fin de la dernière agrégation par résolution cible
+	mu         sync.Mutex
+}
+
+// NewMetricsStore crée un nouveau stockage de métriques
+func NewMetricsStore(db *Database) *MetricsStore {
+	return &MetricsStore{
+		db:         db,
+		watermarks: make(map[string]time.Time),
+	}
+}
+
+// Save convertit un échantillon en points bruts et les enregistre
+func (s *MetricsStore) Save(agentID string, sample *common.MetricsSample) error {
+	timestamp := time.Now()
+	if sample.Timestamp != "" {
+		if t, err := time.Parse(time.RFC3339Nano, sample.Timestamp); err == nil {
+			timestamp = t
+		}
+	}
+
+	values := SampleMetricValues(sample)
+	points := make([]*MetricPoint, 0, len(values))
+	for metric, value := range values {
+		points = append(points, &MetricPoint{
+			AgentID:    agentID,
+			Metric:     metric,
+			Resolution: MetricResolutionRaw,
+			Timestamp:  timestamp,
+			Value:      value,
+			Min:        value,
+			Max:        value,
+			Count:      1,
+		})
+	}
+	return s.db.SaveMetricPoints(points)
+}
+
+// SampleMetricValues aplatit un échantillon en valeurs nommées
+// Noms: cpu.percent, cpu.core.N, memory.*, swap.*, disk.<point de montage>.*, net.<interface>.*, processes.count
+func SampleMetricValues(sample *common.MetricsSample) map[string]float64 {
+	values := map[string]float64{
+		"cpu.percent":     sample.CPUPercent,
+		"processes.count": float64(sample.ProcessCount),
+	}
+	for i, core := range sample.CPUCores {
+		values[fmt.Sprintf("cpu.core.%d", i)] = core
+	}
+
+	if sample.MemoryTotal > 0 {
+		values["memory.total"] = float64(sample.MemoryTotal)
+		values["memory.used"] = float64(sample.MemoryUsed)
+		values["memory.percent"] = percentOf(sample.MemoryUsed, sample.MemoryTotal)
+	}
+	if sample.SwapTotal > 0 {
+		values["swap.total"] = float64(sample.SwapTotal)
+		values["swap.used"] = float64(sample.SwapUsed)
+		values["swap.percent"] = percentOf(sample.SwapUsed, sample.SwapTotal)
+	}
+
+	for _, disk := range sample.Disks {
+		if disk == nil || disk.Total <= 0 {
+			continue
+		}
+		prefix := "disk." + disk.Mount
+		values[prefix+".total"] = float64(disk.Total)
+		values[prefix+".used"] = float64(disk.Used)
+		values[prefix+".percent"] = percentOf(disk.Used, disk.Total)
+	}
+
+	for _, iface := range sample.Network {
+		if iface == nil {
+			continue
+		}
+		prefix := "net." + iface.Interface
+		values[prefix+".rx_bps"] = iface.RxBytesPerSec
+		values[prefix+".tx_bps"] = iface.TxBytesPerSec
+	}
+
+	return values
+}
+
+// percentOf calcule un pourcentage d'occupation
+func percentOf(used, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return float64(used) / float64(total) * 100
+}
+
+// Run agrège et purge périodiquement les points de métriques
+func (s *MetricsStore) Run() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.Maintain(time.Now())
+	}
+}
+
+// Maintain effectue les agrégations en retard et applique la rétention
+func (s *MetricsStore) Maintain(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.rollup(MetricResolutionRaw, MetricResolutionMinute, time.Minute, metricRetentionRaw, now); err != nil {
+		log.Printf("[METRICS] Erreur d'agrégation à la minute: %v", err)
+	}
+	if err := s.rollup(MetricResolutionMinute, MetricResolutionHour, time.Hour, metricRetentionMinute, now); err != nil {
+		log.Printf("[METRICS] Erreur d'agrégation à l'heure: %v", err)
+	}
+
+	retentions := map[string]time.Duration{
+		MetricResolutionRaw:    metricRetentionRaw,
+		MetricResolutionMinute: metricRetentionMinute,
+		MetricResolutionHour:   metricRetentionHour,
+	}
+	for resolution, retention := range retentions {
+		if err := s.db.CleanupMetricPoints(resolution, now.Add(-retention)); err != nil {
+			log.Printf("[METRICS] Erreur de purge des points %s: %v", resolution, err)
+		}
+	}
+}
+
+// rollup agrège les intervalles complets de la résolution source vers la résolution cible
+func (s *MetricsStore) rollup(source, target string, period, sourceRetention time.Duration, now time.Time) error {
+	end := now.Truncate(period)
+
+	start, ok := s.watermarks[target]
+	if !ok {
+		latest, err := s.db.GetLatestMetricTimestamp(target)
+		if err != nil {
+			return err
+		}
+		if latest.IsZero() {
+			start = now.Add(-sourceRetention).Truncate(period)
+		} else {
+			start = latest.Add(period)
+		}
+	}
+	if !start.Before(end) {
+		return nil
+	}
+
+	points, err := s.db.GetMetricPointsRange(source, start, end)
+	if err != nil {
+		return err
+	}
+
+	buckets := make(map[string]*metricBucket)
+	for _, point := range points {
+		bucketStart := point.Timestamp.Truncate(period)
+		key := point.AgentID + "|" + point.Metric + "|" + bucketStart.Format(time.RFC3339)
+		bucket, exists := buckets[key]
+		if !exists {
+			bucket = &metricBucket{agentID: point.AgentID, metric: point.Metric, start: bucketStart}
+			buckets[key] = bucket
+		}
+		bucket.add(point)
+	}
+
+	rolled := make([]*MetricPoint, 0, len(buckets))
+	for _, bucket := range buckets {
+		rolled = append(rolled, &MetricPoint{
+			AgentID:    bucket.agentID,
+			Metric:     bucket.metric,
+			Resolution: target,
+			Timestamp:  bucket.start,
+			Value:      bucket.sum / float64(bucket.count),
+			Min:        bucket.min,
+			Max:        bucket.max,
+			Count:      bucket.count,
+		})
+	}
+	if err := s.db.SaveMetricPoints(rolled); err != nil {
+		return err
+	}
+
+	s.watermarks[target] = end
+	return nil
+}
+
+// Query retourne les séries demandées en choisissant la résolution adaptée à la plage et au pas
+func (s *MetricsStore) Query(query *MetricsQuery) (*MetricsResult, error) {
+	span := query.To.Sub(query.From)
+	step := query.Step
+	if step <= 0 {
+		step = span / maxMetricPoints
+	}
+
+	resolution := metricResolutionFor(query.From, step, time.Now())
+	if minStep := metricResolutionPeriod(resolution); step < minStep {
+		step = minStep
+	}
+	if step < time.Second {
+		step = time.Second
+	}
+	step = step.Round(time.Second)
+
+	points, err := s.db.GetMetricPoints(query.AgentID, query.Metrics, resolution, query.From, query.To)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MetricsResult{
+		AgentID:    query.AgentID,
+		Resolution: resolution,
+		Step:       step.String(),
+		From:       query.From,
+		To:         query.To,
+		Series:     bucketMetricSeries(points, step),
+	}, nil
+}
+
+// metricResolutionFor choisit la résolution la plus fine encore conservée pour le début de plage
+// et suffisamment précise pour le pas demandé
+func metricResolutionFor(from time.Time, step time.Duration, now time.Time) string {
+	age := now.Sub(from)
+	switch {
+	case step >= time.Hour || age > metricRetentionMinute:
+		return MetricResolutionHour
+	case step >= time.Minute || age > metricRetentionRaw:
+		return MetricResolutionMinute
+	default:
+		return MetricResolutionRaw
+	}
+}
+
+// metricResolutionPeriod retourne l'intervalle entre deux points d'une résolution
+func metricResolutionPeriod(resolution string) time.Duration {
+	switch resolution {
+	case MetricResolutionHour:
+		return time.Hour
+	case MetricResolutionMinute:
+		return time.Minute
+	default:
+		return 0
+	}
+}
+
+// bucketMetricSeries regroupe les points par métrique et par pas de temps
+func bucketMetricSeries(points []*MetricPoint, step time.Duration) []*MetricSeries {
+	type seriesBuckets struct {
+		order   []time.Time
+		buckets map[time.Time]*metricBucket
+	}
+
+	bySeries := make(map[string]*seriesBuckets)
+	for _, point := range points {
+		series, exists := bySeries[point.Metric]
+		if !exists {
+			series = &seriesBuckets{buckets: make(map[time.Time]*metricBucket)}
+			bySeries[point.Metric] = series
+		}
+
+		start := point.Timestamp.Truncate(step)
+		bucket, exists := series.buckets[start]
+		if !exists {
+			bucket = &metricBucket{metric: point.Metric, start: start}
+			series.buckets[start] = bucket
+			series.order = append(series.order, start)
+		}
+		bucket.add(point)
+	}
+
+	names := make([]string, 0, len(bySeries))
+	for name := range bySeries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := make([]*MetricSeries, 0, len(names))
+	for _, name := range names {
+		series := bySeries[name]
+		out := &MetricSeries{Metric: name, Points: make([]*MetricSeriesPoint, 0, len(series.order))}
+		for _, start := range series.order {
+			bucket := series.buckets[start]
+			out.Points = append(out.Points, &MetricSeriesPoint{
+				Timestamp: start,
+				Value:     bucket.sum / float64(bucket.count),
+				Min:       bucket.min,
+				Max:       bucket.max,
+			})
+		}
+		result = append(result, out)
+	}
+	return result
+}
+
+// systemLogSeries reconstruit des séries mémoire et disque à partir de l'historique SystemLog
+// Utilisé pour les agents qui n'envoient pas encore d'échantillons de métriques
+func systemLogSeries(logs []*SystemLog, metrics []string, from, to time.Time, step time.Duration) []*MetricSeries {
+	var points []*MetricPoint
+	for _, entry := range logs {
+		if entry.CreatedAt.Before(from) || entry.CreatedAt.After(to) {
+			continue
+		}
+		values := map[string]float64{}
+		if entry.MemoryTotal > 0 {
+			values["memory.total"] = float64(entry.MemoryTotal)
+			values["memory.used"] = float64(entry.MemoryUsed)
+			values["memory.percent"] = percentOf(entry.MemoryUsed, entry.MemoryTotal)
+		}
+		if entry.DiskTotal > 0 {
+			values["disk./.total"] = float64(entry.DiskTotal)
+			values["disk./.used"] = float64(entry.DiskUsed)
+			values["disk./.percent"] = percentOf(entry.DiskUsed, entry.DiskTotal)
+		}
+		for metric, value := range values {
+			if !metricSelected(metric, metrics) {
+				continue
+			}
+			points = append(points, &MetricPoint{Metric: metric, Timestamp: entry.CreatedAt, Value: value, Min: value, Max: value, Count: 1})
+		}
+	}
+
+	// GetSystemLogs retourne les entrées les plus récentes en premier
+	sort.Slice(points, func(i, j int) bool { return points[i].Timestamp.Before(points[j].Timestamp) })
+	return bucketMetricSeries(points, step)
+}
+
+// metricSelected indique si une métrique correspond à l'un des noms ou préfixes demandés
+func metricSelected(metric string, metrics []string) bool {
+	if len(metrics) == 0 {
+		return true
+	}
+	for _, selector := range metrics {
+		if selector == metric {
+			return true
+		}
+		if strings.HasSuffix(selector, ".*") && strings.HasPrefix(metric, strings.TrimSuffix(selector, "*")) {
+			return true
+		}
+	}
+	return false
+}
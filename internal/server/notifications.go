@@ -0,0 +1,424 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// Événements pouvant déclencher une notification
+const (
+	NotificationEventAlertFiring       = "alert.firing"
+	NotificationEventAlertResolved     = "alert.resolved"
+	NotificationEventLogAlert          = "log_alert"
+	NotificationEventAgentConnected    = "agent.connected"
+	NotificationEventAgentDisconnected = "agent.disconnected"
+	NotificationEventTest              = "test"
+)
+
+// redactedSecret remplace les secrets dans les réponses de l'API
+const redactedSecret = "********"
+
+// notificationRetryDelay est le délai avant la première nouvelle tentative (doublé à chaque échec)
+const notificationRetryDelay = 5 * time.Second
+
+// NotificationEvent est un événement à notifier sur les canaux externes
+type NotificationEvent struct {
+	Event     string      `json:"event"`
+	Severity  string      `json:"severity,omitempty"`
+	Title     string      `json:"title"`
+	Message   string      `json:"message"`
+	AgentID   string      `json:"agent_id,omitempty"`
+	Franchise string      `json:"franchise,omitempty"`
+	Category  string      `json:"category,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"` // Alerte ou objet à l'origine de l'événement
+}
+
+// defaultNotificationTemplate est le modèle utilisé lorsque le canal n'en définit pas
+const defaultNotificationTemplate = `[{{.Event}}]{{if .Severity}} [{{.Severity}}]{{end}} {{.Title}}
+{{.Message}}{{if .AgentID}}
+Agent: {{.AgentID}}{{if .Franchise}} (franchise {{.Franchise}}){{end}}{{end}}
+{{.Timestamp.Format "2006-01-02 15:04:05 MST"}}`
+
+// Notifier envoie les événements sur les canaux de notification configurés
+type Notifier struct {
+	db       *Database
+	hub      *Hub
+	channels []*NotificationChannel
+	queue    chan *NotificationEvent
+	client   *http.Client
+	mu       sync.RWMutex
+}
+
+// NewNotifier crée un nouveau gestionnaire de notifications
+func NewNotifier(db *Database, hub *Hub) *Notifier {
+	return &Notifier{
+		db:     db,
+		hub:    hub,
+		queue:  make(chan *NotificationEvent, 256),
+		client: &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+// ValidateNotificationChannel vérifie la configuration d'un canal
+func ValidateNotificationChannel(channel *NotificationChannel) error {
+	switch channel.Type {
+	case NotificationChannelWebhook, NotificationChannelSlack, NotificationChannelTeams:
+		if !strings.HasPrefix(channel.URL, "http://") && !strings.HasPrefix(channel.URL, "https://") {
+			return fmt.Errorf("URL du webhook invalide")
+		}
+	case NotificationChannelSMTP:
+		if channel.SMTPHost == "" || channel.SMTPFrom == "" || channel.SMTPTo == "" {
+			return fmt.Errorf("serveur, expéditeur et destinataires SMTP requis")
+		}
+	default:
+		return fmt.Errorf("type de canal inconnu: %s", channel.Type)
+	}
+
+	if channel.Template != "" {
+		if _, err := template.New("notification").Parse(channel.Template); err != nil {
+			return fmt.Errorf("modèle invalide: %v", err)
+		}
+	}
+	return nil
+}
+
+// Redacted retourne une copie du canal sans ses secrets
+func (channel NotificationChannel) Redacted() *NotificationChannel {
+	if channel.Secret != "" {
+		channel.Secret = redactedSecret
+	}
+	if channel.SMTPPassword != "" {
+		channel.SMTPPassword = redactedSecret
+	}
+	return &channel
+}
+
+// Reload recharge les canaux depuis la base de données
+func (n *Notifier) Reload() error {
+	channels, err := n.db.GetNotificationChannels()
+	if err != nil {
+		return err
+	}
+
+	enabled := make([]*NotificationChannel, 0, len(channels))
+	for _, channel := range channels {
+		if channel.Enabled {
+			enabled = append(enabled, channel)
+		}
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.channels = enabled
+	return nil
+}
+
+// Run charge les canaux puis distribue les événements reçus
+func (n *Notifier) Run() {
+	if err := n.Reload(); err != nil {
+		log.Printf("[NOTIFY] Erreur lors du chargement des canaux: %v", err)
+	}
+
+	for event := range n.queue {
+		// Résolu ici plutôt que dans Notify, qui peut être appelé verrou du hub pris
+		if event.AgentID != "" && event.Franchise == "" && event.Category == "" {
+			event.Franchise, event.Category = n.agentRouting(event.AgentID)
+		}
+
+		n.mu.RLock()
+		channels := n.channels
+		n.mu.RUnlock()
+
+		for _, channel := range channels {
+			if channelAccepts(channel, event) {
+				go n.deliver(channel, event)
+			}
+		}
+	}
+}
+
+// Notify met un événement en file d'envoi sans bloquer l'appelant
+// Utilisable sans notifier configuré (récepteur nil)
+func (n *Notifier) Notify(event *NotificationEvent) {
+	if n == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	select {
+	case n.queue <- event:
+	default:
+		log.Printf("[NOTIFY] File de notifications pleine, événement %s ignoré", event.Event)
+	}
+}
+
+// Test envoie un événement de test sur un canal, de façon synchrone et sans nouvelle tentative
+func (n *Notifier) Test(channel *NotificationChannel) error {
+	event := &NotificationEvent{
+		Event:     NotificationEventTest,
+		Severity:  "info",
+		Title:     "Notification de test",
+		Message:   fmt.Sprintf("Le canal %q est correctement configuré.", channel.Name),
+		Timestamp: time.Now(),
+	}
+	err := n.send(channel, event)
+	n.logResult(channel, event, 1, err)
+	return err
+}
+
+// agentRouting retourne la franchise et la catégorie d'un agent, y compris s'il est déconnecté
+func (n *Notifier) agentRouting(agentID string) (string, string) {
+	if metadata := n.hub.GetAgentMetadata(agentID); metadata.Franchise != "" || metadata.Category != "" {
+		return metadata.Franchise, metadata.Category
+	}
+	if record, err := n.db.GetAgent(agentID); err == nil && record != nil {
+		return record.Franchise, record.Category
+	}
+	return "", ""
+}
+
+// channelAccepts vérifie si un événement doit être envoyé sur un canal
+func channelAccepts(channel *NotificationChannel, event *NotificationEvent) bool {
+	return matchList(channel.Events, event.Event) &&
+		matchList(channel.Severities, event.Severity) &&
+		matchList(channel.Franchises, event.Franchise) &&
+		matchList(channel.Categories, event.Category)
+}
+
+// matchList vérifie si une valeur figure dans une liste séparée par des virgules (liste vide = toutes)
+func matchList(list, value string) bool {
+	if strings.TrimSpace(list) == "" {
+		return true
+	}
+	for _, item := range strings.Split(list, ",") {
+		if strings.EqualFold(strings.TrimSpace(item), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver envoie un événement sur un canal avec nouvelles tentatives et délai croissant
+func (n *Notifier) deliver(channel *NotificationChannel, event *NotificationEvent) {
+	maxAttempts := channel.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 3
+	}
+
+	delay := notificationRetryDelay
+	var err error
+	attempt := 1
+	for ; attempt <= maxAttempts; attempt++ {
+		if err = n.send(channel, event); err == nil {
+			break
+		}
+		log.Printf("[NOTIFY] Échec de l'envoi sur le canal %s (tentative %d/%d): %v", channel.Name, attempt, maxAttempts, err)
+		if attempt < maxAttempts {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	if attempt > maxAttempts {
+		attempt = maxAttempts
+	}
+
+	n.logResult(channel, event, attempt, err)
+}
+
+// logResult historise le résultat d'un envoi
+func (n *Notifier) logResult(channel *NotificationChannel, event *NotificationEvent, attempts int, err error) {
+	entry := &NotificationLog{
+		ChannelID:   channel.ID,
+		ChannelName: channel.Name,
+		Event:       event.Event,
+		AgentID:     event.AgentID,
+		Title:       event.Title,
+		Status:      "sent",
+		Attempts:    attempts,
+		CreatedAt:   time.Now(),
+	}
+	if err != nil {
+		entry.Status = "failed"
+		entry.Error = err.Error()
+	}
+	if dbErr := n.db.LogNotification(entry); dbErr != nil {
+		log.Printf("[NOTIFY] Erreur lors de l'enregistrement de l'envoi: %v", dbErr)
+	}
+}
+
+// send envoie un événement selon le type du canal
+func (n *Notifier) send(channel *NotificationChannel, event *NotificationEvent) error {
+	text, err := renderNotification(channel, event)
+	if err != nil {
+		return err
+	}
+
+	switch channel.Type {
+	case NotificationChannelWebhook:
+		payload := struct {
+			*NotificationEvent
+			Text string `json:"text"`
+		}{event, text}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		headers := map[string]string{"X-RemoteShell-Event": event.Event}
+		if channel.Secret != "" {
+			mac := hmac.New(sha256.New, []byte(channel.Secret))
+			mac.Write(body)
+			headers["X-RemoteShell-Signature"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		}
+		return n.postJSON(channel.URL, body, headers)
+
+	case NotificationChannelSlack:
+		body, err := json.Marshal(map[string]string{"text": text})
+		if err != nil {
+			return err
+		}
+		return n.postJSON(channel.URL, body, nil)
+
+	case NotificationChannelTeams:
+		body, err := json.Marshal(map[string]interface{}{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    event.Title,
+			"title":      event.Title,
+			"themeColor": severityColor(event.Severity),
+			"text":       strings.ReplaceAll(text, "\n", "  \n"),
+		})
+		if err != nil {
+			return err
+		}
+		return n.postJSON(channel.URL, body, nil)
+
+	case NotificationChannelSMTP:
+		return sendNotificationMail(channel, event.Title, text)
+	}
+
+	return fmt.Errorf("type de canal inconnu: %s", channel.Type)
+}
+
+// postJSON envoie un corps JSON et vérifie le code de retour
+func (n *Notifier) postJSON(url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("réponse HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(snippet)))
+	}
+	return nil
+}
+
+// sendNotificationMail envoie une notification par email
+func sendNotificationMail(channel *NotificationChannel, subject, text string) error {
+	port := channel.SMTPPort
+	if port == 0 {
+		port = 25
+	}
+	addr := net.JoinHostPort(channel.SMTPHost, strconv.Itoa(port))
+
+	var recipients []string
+	for _, to := range strings.Split(channel.SMTPTo, ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			recipients = append(recipients, to)
+		}
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", channel.SMTPFrom)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(recipients, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	message.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if channel.SMTPUser != "" {
+		auth = smtp.PlainAuth("", channel.SMTPUser, channel.SMTPPassword, channel.SMTPHost)
+	}
+	return smtp.SendMail(addr, auth, channel.SMTPFrom, recipients, message.Bytes())
+}
+
+// renderNotification produit le texte d'un événement à partir du modèle du canal
+func renderNotification(channel *NotificationChannel, event *NotificationEvent) (string, error) {
+	source := channel.Template
+	if source == "" {
+		source = defaultNotificationTemplate
+	}
+	tmpl, err := template.New("notification").Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("modèle invalide: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, event); err != nil {
+		return "", fmt.Errorf("erreur de rendu du modèle: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// severityColor retourne la couleur associée à une sévérité (cartes Teams)
+func severityColor(severity string) string {
+	switch strings.ToLower(severity) {
+	case "critical", "error":
+		return "D32F2F"
+	case "warning":
+		return "F9A825"
+	case "resolved":
+		return "2E7D32"
+	default:
+		return "1976D2"
+	}
+}
+
+// alertNotificationEvent construit l'événement correspondant à un changement d'état d'une alerte
+// À appeler verrou du gestionnaire d'alertes pris: l'événement porte une copie de l'alerte,
+// l'instance active continuant d'être modifiée pendant l'envoi
+func alertNotificationEvent(alert *Alert) *NotificationEvent {
+	snapshot := *alert
+	alert = &snapshot
+	event := &NotificationEvent{
+		Event:    NotificationEventAlertFiring,
+		Severity: alert.Severity,
+		Title:    fmt.Sprintf("Alerte %s", alert.RuleName),
+		Message:  alert.Message,
+		AgentID:  alert.AgentID,
+		Data:     alert,
+	}
+	if alert.Status == AlertStatusResolved {
+		event.Event = NotificationEventAlertResolved
+		event.Title = fmt.Sprintf("Alerte résolue: %s", alert.RuleName)
+	}
+	return event
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// Bornes de la durée d'une opération sur les paquets
+const (
+	defaultPackageActionTimeout = 10 * time.Minute
+	maxPackageActionTimeout     = time.Hour
+)
+
+// packageActionGrace laisse à l'agent le temps de signaler son propre dépassement de délai
+const packageActionGrace = 30 * time.Second
+
+// packageActions associe les actions exposées par l'API aux actions du protocole
+var packageActions = map[string]string{
+	"upgradable": common.PackageActionListUpgradable,
+	"install":    common.PackageActionInstall,
+	"upgrade":    common.PackageActionUpgrade,
+	"remove":     common.PackageActionRemove,
+}
+
+// RunPackageAction exécute une opération sur les paquets d'un agent et attend son résultat
+// onOutput, s'il est renseigné, reçoit la sortie de l'opération au fil de l'exécution
+func (h *Hub) RunPackageAction(agentID string, req *common.PackageActionRequest, onOutput func(lines []string)) (*common.PackageActionResult, error) {
+	agent, exists := h.GetAgent(agentID)
+	if !exists {
+		return nil, fmt.Errorf("agent non trouvé")
+	}
+
+	timeout := defaultPackageActionTimeout
+	if req.Timeout > 0 {
+		timeout = time.Duration(req.Timeout) * time.Second
+		if timeout > maxPackageActionTimeout {
+			timeout = maxPackageActionTimeout
+		}
+	}
+	req.Timeout = int(timeout / time.Second)
+
+	msg := common.NewMessage(common.MessageTypePackageAction, req)
+	msg.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	msg.AgentID = agentID
+
+	stream, closeStream := agent.OpenStream(msg.ID)
+	defer closeStream()
+
+	if err := agent.SendMessage(msg); err != nil {
+		return nil, fmt.Errorf("erreur d'envoi de la demande: %v", err)
+	}
+
+	deadline := time.After(timeout + packageActionGrace)
+	for {
+		select {
+		case response, ok := <-stream:
+			if !ok {
+				// L'opération se poursuit sur l'agent mais sa sortie et son résultat sont perdus
+				return nil, errStreamSaturated
+			}
+			switch response.Type {
+			case common.MessageTypePackageOutput:
+				output, err := common.DecodePayload[common.PackageOutput](response)
+				if err != nil {
+					return nil, fmt.Errorf("réponse de l'agent invalide: %v", err)
+				}
+				if onOutput != nil {
+					onOutput(output.Lines)
+				}
+
+			case common.MessageTypePackageResult:
+				result, err := common.DecodePayload[common.PackageActionResult](response)
+				if err != nil {
+					return nil, fmt.Errorf("réponse de l'agent invalide: %v", err)
+				}
+				return result, nil
+
+			case common.MessageTypeError:
+				return nil, agentError(response)
+			}
+
+		case <-deadline:
+			return nil, fmt.Errorf("délai d'attente dépassé, l'agent n'a pas répondu")
+		}
+	}
+}
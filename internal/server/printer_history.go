@@ -0,0 +1,476 @@
+package server
+
+import (
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+const (
+	// printerHistoryRetention est la durée de conservation de l'historique des imprimantes
+	printerHistoryRetention = 400 * 24 * time.Hour
+
+	// markerRefillThreshold est la hausse de niveau (en points) considérée comme un remplacement de consommable
+	markerRefillThreshold = 10
+
+	// markerForecastMinSpan est la durée d'observation minimale pour estimer la consommation d'un consommable
+	markerForecastMinSpan = 24 * time.Hour
+)
+
+// PrintJobStatusUnknown désigne un travail sorti de la file sans état final connu (collecte par lpstat)
+const PrintJobStatusUnknown = "unknown"
+
+// printerState est le dernier état connu d'une imprimante, utilisé pour détecter les changements
+type printerState struct {
+	status   string
+	reasons  string
+	markers  map[string]int
+	jobs     map[int]common.PrintJob // File lors du dernier rapport, nil avant le premier rapport reçu
+	finished map[int]bool            // Travaux terminés déjà enregistrés
+}
+
+// PrinterDayStats résume l'activité d'une imprimante sur une journée
+type PrinterDayStats struct {
+	Date     string `json:"date"` // AAAA-MM-JJ
+	Jobs     int    `json:"jobs"`
+	Pages    int    `json:"pages"`
+	Bytes    int64  `json:"bytes"`
+	Canceled int    `json:"canceled"`
+	Aborted  int    `json:"aborted"`
+}
+
+// PrinterStats résume l'activité et la disponibilité d'une imprimante sur une période
+type PrinterStats struct {
+	AgentID        string             `json:"agent_id"`
+	Printer        string             `json:"printer"`
+	From           time.Time          `json:"from"`
+	To             time.Time          `json:"to"`
+	Days           []*PrinterDayStats `json:"days"`
+	Jobs           int                `json:"jobs"`
+	Pages          int                `json:"pages"`
+	ErrorCount     int                `json:"error_count"` // Nombre de passages en erreur
+	ErrorSeconds   float64            `json:"error_seconds"`
+	OfflineSeconds float64            `json:"offline_seconds"`
+	StoppedSeconds float64            `json:"stopped_seconds"`
+	Availability   *float64           `json:"availability,omitempty"` // Part du temps observé hors erreur et hors ligne (0-1)
+	Reasons        map[string]int     `json:"reasons"`                // Nombre d'apparitions de chaque raison d'état
+}
+
+// MarkerLevelPoint est un relevé de niveau d'un consommable
+type MarkerLevelPoint struct {
+	Timestamp time.Time `json:"t"`
+	Level     int       `json:"level"`
+}
+
+// MarkerForecast décrit l'historique d'un consommable et l'estimation de son épuisement
+type MarkerForecast struct {
+	Marker        string              `json:"marker"`
+	Color         string              `json:"color,omitempty"`
+	Level         int                 `json:"level"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+	LastRefill    *time.Time          `json:"last_refill,omitempty"`
+	RatePerDay    *float64            `json:"rate_per_day,omitempty"` // Consommation moyenne en points de pourcentage par jour
+	DaysRemaining *float64            `json:"days_remaining,omitempty"`
+	EmptyAt       *time.Time          `json:"empty_at,omitempty"`
+	History       []*MarkerLevelPoint `json:"history"`
+}
+
+// PrinterHistoryStore enregistre les changements d'état, les travaux terminés et les niveaux de consommables des imprimantes
+type PrinterHistoryStore struct {
+	db     *Database
+	mu     sync.Mutex
+	states map[string]*printerState // Par agent et imprimante
+}
+
+// NewPrinterHistoryStore crée un nouveau stockage de l'historique des imprimantes
+func NewPrinterHistoryStore(db *Database) *PrinterHistoryStore {
+	return &PrinterHistoryStore{
+		db:     db,
+		states: make(map[string]*printerState),
+	}
+}
+
+// Record compare le rapport d'un agent au dernier état connu de ses imprimantes et enregistre les différences
+func (s *PrinterHistoryStore) Record(agentID string, printers []*common.PrinterInfo) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var logs []*PrinterLog
+	var jobs []*PrintJobRecord
+	var levels []*PrinterMarkerLevel
+
+	for _, printer := range printers {
+		if printer == nil || printer.Name == "" {
+			continue
+		}
+		state, err := s.state(agentID, printer.Name)
+		if err != nil {
+			return err
+		}
+
+		reasons := strings.Join(printer.StateReasons, ",")
+		if printer.Status != state.status || reasons != state.reasons {
+			logs = append(logs, &PrinterLog{
+				AgentID:        agentID,
+				PrinterName:    printer.Name,
+				Status:         printer.Status,
+				PreviousStatus: state.status,
+				Reasons:        reasons,
+				Message:        printer.StateMessage,
+				JobCount:       len(printer.Jobs),
+				CreatedAt:      now,
+			})
+			state.status = printer.Status
+			state.reasons = reasons
+		}
+
+		for _, marker := range printer.Markers {
+			if marker.Level < 0 {
+				continue
+			}
+			if last, ok := state.markers[marker.Name]; ok && last == marker.Level {
+				continue
+			}
+			levels = append(levels, &PrinterMarkerLevel{
+				AgentID:     agentID,
+				PrinterName: printer.Name,
+				Marker:      marker.Name,
+				Color:       marker.Color,
+				Level:       marker.Level,
+				CreatedAt:   now,
+			})
+			state.markers[marker.Name] = marker.Level
+		}
+
+		jobs = append(jobs, state.finishedJobs(agentID, printer, now)...)
+	}
+
+	if err := s.save(logs, jobs, levels); err != nil {
+		// Recharger l'état depuis la base au prochain rapport pour ne pas perdre les changements
+		for key := range s.states {
+			if strings.HasPrefix(key, agentID+"/") {
+				delete(s.states, key)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// save enregistre les changements détectés lors d'un rapport
+func (s *PrinterHistoryStore) save(logs []*PrinterLog, jobs []*PrintJobRecord, levels []*PrinterMarkerLevel) error {
+	for _, entry := range logs {
+		if err := s.db.LogPrinter(entry); err != nil {
+			return err
+		}
+	}
+	if err := s.db.SavePrintJobs(jobs); err != nil {
+		return err
+	}
+	return s.db.SavePrinterMarkerLevels(levels)
+}
+
+// state retourne le dernier état connu d'une imprimante, chargé depuis la base au premier rapport
+func (s *PrinterHistoryStore) state(agentID, printer string) (*printerState, error) {
+	key := agentID + "/" + printer
+	if state, ok := s.states[key]; ok {
+		return state, nil
+	}
+
+	state := &printerState{
+		markers:  make(map[string]int),
+		finished: make(map[int]bool),
+	}
+	latest, err := s.db.GetLatestPrinterLog(agentID, printer, time.Now().Add(time.Second))
+	if err != nil {
+		return nil, err
+	}
+	if latest != nil {
+		state.status = latest.Status
+		state.reasons = latest.Reasons
+	}
+	levels, err := s.db.GetLatestPrinterMarkerLevels(agentID, printer)
+	if err != nil {
+		return nil, err
+	}
+	for _, level := range levels {
+		state.markers[level.Marker] = level.Level
+	}
+
+	s.states[key] = state
+	return state, nil
+}
+
+// finishedJobs retourne les travaux terminés remontés par l'agent et ceux sortis de la file depuis le rapport précédent
+// La file courante remplace ensuite celle du rapport précédent
+func (st *printerState) finishedJobs(agentID string, printer *common.PrinterInfo, now time.Time) []*PrintJobRecord {
+	var records []*PrintJobRecord
+	reported := make(map[int]bool, len(printer.CompletedJobs))
+
+	for _, job := range printer.CompletedJobs {
+		reported[job.ID] = true
+		if st.finished[job.ID] {
+			continue
+		}
+		completedAt := now
+		if job.Completed != nil {
+			completedAt = *job.Completed
+		}
+		status := job.Status
+		if status == "" {
+			status = "completed"
+		}
+		records = append(records, newPrintJobRecord(agentID, printer.Name, job, status, completedAt))
+	}
+
+	queue := make(map[int]common.PrintJob, len(printer.Jobs))
+	for _, job := range printer.Jobs {
+		queue[job.ID] = job
+	}
+
+	// Sans historique IPP, un travail qui a quitté la file est enregistré sans état final
+	for id, job := range st.jobs {
+		if _, queued := queue[id]; queued || reported[id] || st.finished[id] {
+			continue
+		}
+		records = append(records, newPrintJobRecord(agentID, printer.Name, job, PrintJobStatusUnknown, now))
+	}
+
+	st.jobs = queue
+	st.finished = reported
+	for _, record := range records {
+		st.finished[record.JobID] = true
+	}
+	return records
+}
+
+// newPrintJobRecord construit l'enregistrement d'un travail terminé
+func newPrintJobRecord(agentID, printer string, job common.PrintJob, status string, completedAt time.Time) *PrintJobRecord {
+	return &PrintJobRecord{
+		AgentID:     agentID,
+		PrinterName: printer,
+		JobID:       job.ID,
+		Name:        job.Name,
+		User:        job.User,
+		Size:        job.Size,
+		Pages:       job.Pages,
+		Status:      status,
+		SubmittedAt: job.Created,
+		CompletedAt: completedAt,
+	}
+}
+
+// Stats calcule l'activité journalière, les erreurs et la disponibilité d'une imprimante sur une période
+func (s *PrinterHistoryStore) Stats(agentID, printer string, from, to time.Time) (*PrinterStats, error) {
+	stats := &PrinterStats{
+		AgentID: agentID,
+		Printer: printer,
+		From:    from,
+		To:      to,
+		Reasons: make(map[string]int),
+	}
+
+	// Une entrée par jour de la période, y compris les jours sans activité
+	days := make(map[string]*PrinterDayStats)
+	for day := truncateDay(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		dayStats := &PrinterDayStats{Date: day.Format("2006-01-02")}
+		days[dayStats.Date] = dayStats
+		stats.Days = append(stats.Days, dayStats)
+	}
+
+	jobs, err := s.db.GetPrintJobs(agentID, printer, from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, job := range jobs {
+		dayStats, ok := days[job.CompletedAt.Local().Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		switch job.Status {
+		case "canceled":
+			dayStats.Canceled++
+		case "aborted":
+			dayStats.Aborted++
+		default:
+			dayStats.Jobs++
+			dayStats.Pages += job.Pages
+			dayStats.Bytes += job.Size
+			stats.Jobs++
+			stats.Pages += job.Pages
+		}
+	}
+
+	logs, err := s.db.GetPrinterHistory(agentID, printer, from, to)
+	if err != nil {
+		return nil, err
+	}
+	initial, err := s.db.GetLatestPrinterLog(agentID, printer, from)
+	if err != nil {
+		return nil, err
+	}
+
+	end := to
+	if now := time.Now(); now.Before(end) {
+		end = now
+	}
+
+	// Cumuler la durée passée dans chaque statut, à partir du dernier état connu avant la période
+	status, reasons, cursor := "", "", from
+	if initial != nil {
+		status, reasons = initial.Status, initial.Reasons
+	}
+	var observed float64
+	accumulate := func(until time.Time) {
+		if status == "" || !until.After(cursor) {
+			return
+		}
+		seconds := until.Sub(cursor).Seconds()
+		observed += seconds
+		switch status {
+		case "error":
+			stats.ErrorSeconds += seconds
+		case "offline":
+			stats.OfflineSeconds += seconds
+		case "stopped":
+			stats.StoppedSeconds += seconds
+		}
+	}
+
+	for _, entry := range logs {
+		accumulate(entry.CreatedAt)
+		if entry.Status == "error" && status != "error" {
+			stats.ErrorCount++
+		}
+		// Compter les raisons qui apparaissent par rapport à l'état précédent
+		previous := splitReasons(reasons)
+		for reason := range splitReasons(entry.Reasons) {
+			if !previous[reason] {
+				stats.Reasons[reason]++
+			}
+		}
+		status, reasons, cursor = entry.Status, entry.Reasons, entry.CreatedAt
+	}
+	accumulate(end)
+
+	if observed > 0 {
+		availability := 1 - (stats.ErrorSeconds+stats.OfflineSeconds)/observed
+		stats.Availability = &availability
+	}
+	return stats, nil
+}
+
+// Supplies retourne l'historique des consommables d'une imprimante depuis une date et estime leur épuisement
+// current est l'état actuel de l'imprimante s'il est connu, afin de prolonger la dernière valeur relevée jusqu'à maintenant
+func (s *PrinterHistoryStore) Supplies(agentID, printer string, from time.Time, current *common.PrinterInfo) ([]*MarkerForecast, error) {
+	levels, err := s.db.GetPrinterMarkerLevels(agentID, printer, from)
+	if err != nil {
+		return nil, err
+	}
+
+	var forecasts []*MarkerForecast
+	byMarker := make(map[string]*MarkerForecast)
+	for _, level := range levels {
+		forecast, ok := byMarker[level.Marker]
+		if !ok {
+			forecast = &MarkerForecast{Marker: level.Marker}
+			byMarker[level.Marker] = forecast
+			forecasts = append(forecasts, forecast)
+		}
+		forecast.Color = level.Color
+		forecast.Level = level.Level
+		forecast.UpdatedAt = level.CreatedAt
+		forecast.History = append(forecast.History, &MarkerLevelPoint{Timestamp: level.CreatedAt, Level: level.Level})
+	}
+
+	now := time.Now()
+	for _, forecast := range forecasts {
+		points := forecast.History
+		// Le niveau n'est enregistré que lorsqu'il change: s'il est inchangé, il vaut encore maintenant
+		if current != nil {
+			for _, marker := range current.Markers {
+				if marker.Name == forecast.Marker && marker.Level == forecast.Level {
+					points = append(points, &MarkerLevelPoint{Timestamp: now, Level: marker.Level})
+					break
+				}
+			}
+		}
+		forecastMarker(forecast, points, now)
+	}
+	return forecasts, nil
+}
+
+// forecastMarker estime la consommation d'un consommable par régression linéaire depuis son dernier remplacement
+func forecastMarker(forecast *MarkerForecast, points []*MarkerLevelPoint, now time.Time) {
+	start := 0
+	for i := 1; i < len(points); i++ {
+		if points[i].Level-points[i-1].Level >= markerRefillThreshold {
+			start = i
+			refill := points[i].Timestamp
+			forecast.LastRefill = &refill
+		}
+	}
+	points = points[start:]
+	if len(points) < 2 || points[len(points)-1].Timestamp.Sub(points[0].Timestamp) < markerForecastMinSpan {
+		return
+	}
+
+	// Pente en points de pourcentage par jour
+	origin := points[0].Timestamp
+	var sumX, sumY, sumXY, sumXX float64
+	for _, point := range points {
+		x := point.Timestamp.Sub(origin).Hours() / 24
+		y := float64(point.Level)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(points))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	if slope >= 0 {
+		return
+	}
+
+	rate := math.Round(-slope*100) / 100
+	forecast.RatePerDay = &rate
+
+	last := points[len(points)-1]
+	emptyAt := last.Timestamp.Add(time.Duration(float64(last.Level) / -slope * 24 * float64(time.Hour)))
+	remaining := math.Max(0, math.Round(emptyAt.Sub(now).Hours()/24*10)/10)
+	forecast.EmptyAt = &emptyAt
+	forecast.DaysRemaining = &remaining
+}
+
+// Cleanup supprime l'historique des imprimantes expiré
+func (s *PrinterHistoryStore) Cleanup(now time.Time) {
+	if err := s.db.CleanupPrinterHistory(now.Add(-printerHistoryRetention)); err != nil {
+		log.Printf("[PRINTER] Erreur lors du nettoyage de l'historique des imprimantes: %v", err)
+	}
+}
+
+// splitReasons retourne l'ensemble des raisons d'état d'une liste séparée par des virgules
+func splitReasons(reasons string) map[string]bool {
+	set := make(map[string]bool)
+	for _, reason := range strings.Split(reasons, ",") {
+		if reason != "" && reason != "none" {
+			set[reason] = true
+		}
+	}
+	return set
+}
+
+// truncateDay retourne le début de la journée locale contenant t
+func truncateDay(t time.Time) time.Time {
+	t = t.Local()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"remoteshell/internal/common"
+)
+
+// printerActionTimeout laisse à l'agent le temps d'exécuter la commande CUPS et de répondre
+const printerActionTimeout = 40 * time.Second
+
+// printSubmitTimeout laisse le temps de transférer le document à l'agent et de le mettre en file
+const printSubmitTimeout = 2 * time.Minute
+
+// printerQueueTimeout laisse à lpadmin le temps d'interroger l'imprimante lors de la création d'une file sans pilote
+const printerQueueTimeout = 90 * time.Second
+
+// defaultPrinterDiscoveryTimeout est la durée d'écoute appliquée par l'agent lorsqu'aucune n'est demandée
+const defaultPrinterDiscoveryTimeout = 5 * time.Second
+
+// printerDiscoveryMargin s'ajoute à la durée d'écoute pour laisser à l'agent le temps de répondre
+const printerDiscoveryMargin = 10 * time.Second
+
+// maxPrinterPPDSize borne la taille d'un fichier PPD fourni pour créer une file
+const maxPrinterPPDSize = 5 * 1024 * 1024
+
+// maxPrintDocumentSize borne la taille d'un document imprimé à distance
+const maxPrintDocumentSize = 50 * 1024 * 1024
+
+// printChunkSize est la taille des chunks du document transmis à l'agent
+const printChunkSize = 64 * 1024
+
+// printerQueueActions associe les actions exposées par l'API sur une file d'impression aux actions du protocole
+var printerQueueActions = map[string]string{
+	"cancel-all": common.PrinterActionCancelAll,
+	"enable":     common.PrinterActionEnable,
+	"disable":    common.PrinterActionDisable,
+	"accept":     common.PrinterActionAccept,
+	"reject":     common.PrinterActionReject,
+	"default":    common.PrinterActionSetDefault,
+	"test-page":  common.PrinterActionTestPage,
+}
+
+// printerJobActions associe les actions exposées par l'API sur un travail d'impression aux actions du protocole
+var printerJobActions = map[string]string{
+	"cancel":  common.PrinterActionCancelJob,
+	"hold":    common.PrinterActionHoldJob,
+	"release": common.PrinterActionReleaseJob,
+	"move":    common.PrinterActionMoveJob,
+}
+
+// RunPrinterAction exécute une action sur une imprimante d'un agent et attend son résultat
+func (h *Hub) RunPrinterAction(agentID string, req *common.PrinterActionRequest) (*common.PrinterActionResult, error) {
+	return h.runPrinterRequest(agentID, common.MessageTypePrinterAction, req, printerActionTimeout)
+}
+
+// SubmitPrintJob transmet un document à imprimer à un agent et attend la création du travail
+func (h *Hub) SubmitPrintJob(agentID string, req *common.PrintSubmitRequest) (*common.PrinterActionResult, error) {
+	return h.runPrinterRequest(agentID, common.MessageTypePrintSubmit, req, printSubmitTimeout)
+}
+
+// DiscoverPrinters lance une découverte des imprimantes sur le réseau d'un agent et attend son résultat
+func (h *Hub) DiscoverPrinters(agentID string, req *common.PrinterDiscoveryRequest) (*common.PrinterDiscoveryResult, error) {
+	timeout := printerDiscoveryMargin + defaultPrinterDiscoveryTimeout
+	if req.Timeout > 0 {
+		timeout = printerDiscoveryMargin + time.Duration(req.Timeout)*time.Second
+	}
+	response, err := h.sendPrinterRequest(agentID, common.MessageTypePrinterDiscover, req, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := common.DecodePayload[common.PrinterDiscoveryResult](response)
+	if err != nil {
+		return nil, fmt.Errorf("réponse de l'agent invalide")
+	}
+	return result, nil
+}
+
+// ListPrinterDrivers recherche parmi les pilotes d'impression installés sur un agent
+func (h *Hub) ListPrinterDrivers(agentID string, req *common.PrinterDriverRequest) (*common.PrinterDriverList, error) {
+	response, err := h.sendPrinterRequest(agentID, common.MessageTypePrinterDrivers, req, printerActionTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := common.DecodePayload[common.PrinterDriverList](response)
+	if err != nil {
+		return nil, fmt.Errorf("réponse de l'agent invalide")
+	}
+	return list, nil
+}
+
+// ManagePrinterQueue crée, modifie ou supprime une file d'impression d'un agent et attend le résultat
+func (h *Hub) ManagePrinterQueue(agentID string, req *common.PrinterQueueRequest) (*common.PrinterActionResult, error) {
+	return h.runPrinterRequest(agentID, common.MessageTypePrinterQueue, req, printerQueueTimeout)
+}
+
+// runPrinterRequest envoie une demande relative aux imprimantes et attend le résultat de l'agent
+func (h *Hub) runPrinterRequest(agentID string, msgType common.MessageType, req interface{}, timeout time.Duration) (*common.PrinterActionResult, error) {
+	response, err := h.sendPrinterRequest(agentID, msgType, req, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := common.DecodePayload[common.PrinterActionResult](response)
+	if err != nil {
+		return nil, fmt.Errorf("réponse de l'agent invalide")
+	}
+	return result, nil
+}
+
+// sendPrinterRequest envoie une demande relative aux imprimantes et retourne la réponse de l'agent
+// Une réponse d'erreur de l'agent est convertie en erreur
+func (h *Hub) sendPrinterRequest(agentID string, msgType common.MessageType, req interface{}, timeout time.Duration) (*common.Message, error) {
+	agent, exists := h.GetAgent(agentID)
+	if !exists {
+		return nil, fmt.Errorf("agent non trouvé")
+	}
+
+	msg := common.NewMessage(msgType, req)
+	msg.AgentID = agentID
+
+	response, err := agent.SendMessageWithResponse(msg, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("délai d'attente dépassé, l'agent n'a pas répondu")
+	}
+
+	if response.Type == common.MessageTypeError {
+		return nil, agentError(response)
+	}
+	return response, nil
+}
+
+// detectPrintFormat déduit le format d'un document de son contenu
+// Un contenu binaire qui n'est ni PDF ni PostScript est transmis tel quel à l'imprimante
+func detectPrintFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF-")):
+		return common.PrintFormatPDF
+	case bytes.HasPrefix(data, []byte("%!")):
+		return common.PrintFormatPostScript
+	case utf8.Valid(data) && bytes.IndexByte(data, 0) < 0:
+		return common.PrintFormatText
+	}
+	return common.PrintFormatRaw
+}
+
+// printChunks découpe un document en chunks pour le transfert vers l'agent
+func printChunks(name string, data []byte) []*common.FileChunk {
+	var chunks []*common.FileChunk
+	for offset := 0; offset < len(data); offset += printChunkSize {
+		end := offset + printChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunks = append(chunks, &common.FileChunk{
+			Path:   name,
+			Offset: int64(offset),
+			Data:   data[offset:end],
+			IsLast: end == len(data),
+		})
+	}
+	return chunks
+}
@@ -0,0 +1,357 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// requestDurationBuckets sont les bornes (en secondes) de l'histogramme des durées de requêtes
+var requestDurationBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// commandTrackingTimeout est la durée après laquelle une commande sans résultat n'est plus suivie
+const commandTrackingTimeout = 10 * time.Minute
+
+// durationHistogram est un histogramme cumulatif au format Prometheus
+type durationHistogram struct {
+	counts []uint64 // Un compteur par borne de requestDurationBuckets
+	count  uint64
+	sum    float64
+}
+
+// observe ajoute une durée à l'histogramme
+func (h *durationHistogram) observe(seconds float64) {
+	for i, bound := range requestDurationBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// messageCounterKey identifie un compteur de messages
+type messageCounterKey struct {
+	peer        string // agent ou web
+	messageType common.MessageType
+}
+
+// HubStats accumule les statistiques d'activité du hub exposées sur /metrics
+type HubStats struct {
+	received  map[messageCounterKey]uint64
+	sent      map[messageCounterKey]uint64
+	durations map[common.MessageType]*durationHistogram
+	commands  map[string]time.Time // Commandes en cours par ID de message
+	mu        sync.Mutex
+}
+
+// NewHubStats crée un nouvel ensemble de statistiques
+func NewHubStats() *HubStats {
+	return &HubStats{
+		received:  make(map[messageCounterKey]uint64),
+		sent:      make(map[messageCounterKey]uint64),
+		durations: make(map[common.MessageType]*durationHistogram),
+		commands:  make(map[string]time.Time),
+	}
+}
+
+// MessageReceived compte un message reçu d'un agent ou d'un client web
+func (s *HubStats) MessageReceived(peer string, messageType common.MessageType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received[messageCounterKey{peer, messageType}]++
+}
+
+// MessageSent compte un message envoyé à un agent ou à un client web
+func (s *HubStats) MessageSent(peer string, messageType common.MessageType) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sent[messageCounterKey{peer, messageType}]++
+}
+
+// ObserveDuration enregistre la durée d'une requête vers un agent
+func (s *HubStats) ObserveDuration(messageType common.MessageType, duration time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observeLocked(messageType, duration)
+}
+
+// observeLocked enregistre une durée, le verrou étant déjà pris
+func (s *HubStats) observeLocked(messageType common.MessageType, duration time.Duration) {
+	histogram, exists := s.durations[messageType]
+	if !exists {
+		histogram = &durationHistogram{counts: make([]uint64, len(requestDurationBuckets))}
+		s.durations[messageType] = histogram
+	}
+	histogram.observe(duration.Seconds())
+}
+
+// CommandStarted note le départ d'une commande pour mesurer sa durée jusqu'au résultat
+func (s *HubStats) CommandStarted(id string) {
+	if id == "" {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for commandID, started := range s.commands {
+		if now.Sub(started) > commandTrackingTimeout {
+			delete(s.commands, commandID)
+		}
+	}
+	s.commands[id] = now
+}
+
+// CommandDone enregistre la durée d'une commande terminée
+func (s *HubStats) CommandDone(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	started, exists := s.commands[id]
+	if !exists {
+		return
+	}
+	delete(s.commands, id)
+	s.observeLocked(common.MessageTypeCommand, time.Since(started))
+}
+
+// prometheusFamily regroupe les échantillons d'une métrique
+type prometheusFamily struct {
+	help       string
+	metricType string
+	lines      []string
+}
+
+// prometheusWriter construit une exposition au format texte de Prometheus
+// Les échantillons sont regroupés par métrique, comme l'exige le format
+type prometheusWriter struct {
+	families map[string]*prometheusFamily
+	order    []string
+}
+
+// newPrometheusWriter crée un writer vide
+func newPrometheusWriter() *prometheusWriter {
+	return &prometheusWriter{families: make(map[string]*prometheusFamily)}
+}
+
+// header déclare une métrique avec sa description et son type
+func (p *prometheusWriter) header(name, help, metricType string) {
+	if _, exists := p.families[name]; exists {
+		return
+	}
+	p.families[name] = &prometheusFamily{help: help, metricType: metricType}
+	p.order = append(p.order, name)
+}
+
+// sample ajoute une valeur avec ses labels (paires nom, valeur) à la métrique déclarée par header
+// Les suffixes _bucket, _sum et _count sont rattachés à leur histogramme
+func (p *prometheusWriter) sample(name string, value float64, labels ...string) {
+	family := p.families[name]
+	if family == nil {
+		for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+			if base := strings.TrimSuffix(name, suffix); base != name && p.families[base] != nil {
+				family = p.families[base]
+				break
+			}
+		}
+	}
+	if family == nil {
+		p.header(name, name, "untyped")
+		family = p.families[name]
+	}
+
+	line := name
+	if len(labels) > 0 {
+		pairs := make([]string, 0, len(labels)/2)
+		for i := 0; i+1 < len(labels); i += 2 {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], escapePrometheusLabel(labels[i+1])))
+		}
+		line += "{" + strings.Join(pairs, ",") + "}"
+	}
+	family.lines = append(family.lines, line+" "+formatPrometheusValue(value))
+}
+
+// WriteTo écrit l'exposition complète
+func (p *prometheusWriter) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, name := range p.order {
+		family := p.families[name]
+		n, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, family.help, name, family.metricType)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+		for _, line := range family.lines {
+			n, err := io.WriteString(w, line+"\n")
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, nil
+}
+
+// formatPrometheusValue formate une valeur numérique
+func formatPrometheusValue(value float64) string {
+	return fmt.Sprintf("%g", value)
+}
+
+// escapePrometheusLabel échappe une valeur de label
+func escapePrometheusLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+// WritePrometheusMetrics écrit les métriques du hub et des agents connectés
+func (h *Hub) WritePrometheusMetrics(w io.Writer) error {
+	p := newPrometheusWriter()
+
+	h.mu.RLock()
+	agents := make([]*Agent, 0, len(h.agents))
+	for _, agent := range h.agents {
+		agents = append(agents, agent)
+	}
+	webClients := len(h.webClients)
+	metadata := make(map[string]AgentMetadata, len(h.metadata))
+	for agentID, meta := range h.metadata {
+		if meta != nil {
+			metadata[agentID] = *meta
+		}
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+
+	p.header("remoteshell_agents_connected", "Nombre d'agents connectés.", "gauge")
+	p.sample("remoteshell_agents_connected", float64(len(agents)))
+	p.header("remoteshell_web_clients_connected", "Nombre de clients web connectés.", "gauge")
+	p.sample("remoteshell_web_clients_connected", float64(webClients))
+
+	pending := 0
+	for _, agent := range agents {
+		agent.mu.RLock()
+		pending += len(agent.responses)
+		agent.mu.RUnlock()
+	}
+	p.header("remoteshell_pending_responses", "Nombre de requêtes en attente de réponse d'un agent.", "gauge")
+	p.sample("remoteshell_pending_responses", float64(pending))
+
+	h.stats.write(p)
+
+	for _, agent := range agents {
+		meta := metadata[agent.ID]
+		labels := []string{"agent_id", agent.ID, "franchise", meta.Franchise, "category", meta.Category}
+		writeAgentMetrics(p, agent, labels)
+	}
+
+	_, err := p.WriteTo(w)
+	return err
+}
+
+// write écrit les compteurs de messages et les histogrammes de durée
+func (s *HubStats) write(p *prometheusWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counters := []struct {
+		name   string
+		help   string
+		values map[messageCounterKey]uint64
+	}{
+		{"remoteshell_messages_received_total", "Messages WebSocket reçus par type.", s.received},
+		{"remoteshell_messages_sent_total", "Messages WebSocket envoyés par type.", s.sent},
+	}
+	for _, counter := range counters {
+		p.header(counter.name, counter.help, "counter")
+		keys := make([]messageCounterKey, 0, len(counter.values))
+		for key := range counter.values {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i].peer != keys[j].peer {
+				return keys[i].peer < keys[j].peer
+			}
+			return keys[i].messageType < keys[j].messageType
+		})
+		for _, key := range keys {
+			p.sample(counter.name, float64(counter.values[key]), "peer", key.peer, "type", string(key.messageType))
+		}
+	}
+
+	const histogramName = "remoteshell_request_duration_seconds"
+	p.header(histogramName, "Durée des requêtes vers les agents (commandes jusqu'au résultat, requêtes jusqu'à la réponse).", "histogram")
+	types := make([]string, 0, len(s.durations))
+	for messageType := range s.durations {
+		types = append(types, string(messageType))
+	}
+	sort.Strings(types)
+	for _, messageType := range types {
+		histogram := s.durations[common.MessageType(messageType)]
+		for i, bound := range requestDurationBuckets {
+			p.sample(histogramName+"_bucket", float64(histogram.counts[i]), "type", messageType, "le", formatPrometheusValue(bound))
+		}
+		p.sample(histogramName+"_bucket", float64(histogram.count), "type", messageType, "le", "+Inf")
+		p.sample(histogramName+"_sum", histogram.sum, "type", messageType)
+		p.sample(histogramName+"_count", float64(histogram.count), "type", messageType)
+	}
+}
+
+// writeAgentMetrics écrit les jauges d'un agent à partir de ses dernières informations système et imprimantes
+func writeAgentMetrics(p *prometheusWriter, agent *Agent, labels []string) {
+	agent.mu.RLock()
+	lastSeen := agent.LastSeen
+	agent.mu.RUnlock()
+
+	p.header("remoteshell_agent_last_seen_timestamp_seconds", "Horodatage de la dernière activité de l'agent.", "gauge")
+	p.sample("remoteshell_agent_last_seen_timestamp_seconds", float64(lastSeen.Unix()), labels...)
+
+	if info := agent.GetSystemInfo(); info != nil {
+		gauges := []struct {
+			name  string
+			help  string
+			value float64
+		}{
+			{"remoteshell_agent_uptime_seconds", "Durée de fonctionnement de la machine.", float64(info.Uptime)},
+			{"remoteshell_agent_memory_total_bytes", "Mémoire totale.", float64(info.MemoryTotal)},
+			{"remoteshell_agent_memory_used_bytes", "Mémoire utilisée.", float64(info.MemoryUsed)},
+			{"remoteshell_agent_disk_total_bytes", "Taille du disque système.", float64(info.DiskTotal)},
+			{"remoteshell_agent_disk_used_bytes", "Espace utilisé sur le disque système.", float64(info.DiskUsed)},
+		}
+		for _, gauge := range gauges {
+			p.header(gauge.name, gauge.help, "gauge")
+			p.sample(gauge.name, gauge.value, labels...)
+		}
+
+		p.header("remoteshell_agent_info", "Informations descriptives de l'agent (valeur toujours 1).", "gauge")
+		p.sample("remoteshell_agent_info", 1, append(append([]string{}, labels...), "hostname", info.Hostname, "os", info.OS, "arch", info.Arch)...)
+
+		periods := []string{"1m", "5m", "15m"}
+		for i, load := range info.LoadAvg {
+			if i >= len(periods) {
+				break
+			}
+			p.header("remoteshell_agent_load_average", "Charge moyenne de la machine.", "gauge")
+			p.sample("remoteshell_agent_load_average", load, append(append([]string{}, labels...), "period", periods[i])...)
+		}
+	}
+
+	for _, printer := range agent.GetPrinters() {
+		if printer == nil {
+			continue
+		}
+		printerLabels := append(append([]string{}, labels...), "printer", printer.Name)
+
+		p.header("remoteshell_printer_status", "Statut de l'imprimante (1 pour le statut courant).", "gauge")
+		p.sample("remoteshell_printer_status", 1, append(printerLabels, "status", printer.Status)...)
+		p.header("remoteshell_printer_jobs", "Nombre de travaux dans la file d'impression.", "gauge")
+		p.sample("remoteshell_printer_jobs", float64(len(printer.Jobs)), printerLabels...)
+	}
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// serviceHistoryRetention est la durée de conservation des changements d'état des services
+const serviceHistoryRetention = 90 * 24 * time.Hour
+
+// ServiceFlapping résume l'instabilité d'un service sur une période
+type ServiceFlapping struct {
+	Name           string    `json:"name"`
+	Type           string    `json:"type"`
+	Flaps          int       `json:"flaps"`       // Nombre de sorties de l'état actif
+	Transitions    int       `json:"transitions"` // Nombre total de changements d'état
+	State          string    `json:"state"`       // État après le dernier changement
+	LastTransition time.Time `json:"last_transition"`
+}
+
+// ServiceHistoryStore enregistre les changements d'état des services signalés par les agents
+type ServiceHistoryStore struct {
+	db *Database
+}
+
+// NewServiceHistoryStore crée un nouveau stockage de l'historique des services
+func NewServiceHistoryStore(db *Database) *ServiceHistoryStore {
+	return &ServiceHistoryStore{db: db}
+}
+
+// Record enregistre les événements d'un delta envoyé par un agent
+func (s *ServiceHistoryStore) Record(agentID string, events []*common.ServiceEvent) error {
+	now := time.Now()
+	transitions := make([]*ServiceTransition, 0, len(events))
+	for _, event := range events {
+		if event == nil || event.Name == "" {
+			continue
+		}
+		// L'heure de l'agent est conservée, sauf si elle est absente ou dans le futur (horloge décalée)
+		createdAt := event.Time
+		if createdAt.IsZero() || createdAt.After(now) {
+			createdAt = now
+		}
+		transitions = append(transitions, &ServiceTransition{
+			AgentID:        agentID,
+			ServiceName:    event.Name,
+			ServiceType:    event.ServiceType,
+			Event:          event.Type,
+			State:          event.State,
+			PreviousState:  event.PreviousState,
+			Status:         event.Status,
+			PreviousStatus: event.PreviousStatus,
+			CreatedAt:      createdAt,
+		})
+	}
+	return s.db.SaveServiceTransitions(transitions)
+}
+
+// Flapping retourne les services d'un agent sortis au moins threshold fois de l'état actif sur une période,
+// du plus instable au plus stable
+func (s *ServiceHistoryStore) Flapping(agentID string, from, to time.Time, threshold int) ([]*ServiceFlapping, error) {
+	transitions, err := s.db.GetServiceTransitions(agentID, "", "", from, to, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make(map[string]*ServiceFlapping)
+	// Les transitions sont triées de la plus récente à la plus ancienne
+	for _, transition := range transitions {
+		if transition.Event != common.ServiceEventStateChanged {
+			continue
+		}
+		key := transition.ServiceType + "/" + transition.ServiceName
+		service, ok := services[key]
+		if !ok {
+			service = &ServiceFlapping{
+				Name:           transition.ServiceName,
+				Type:           transition.ServiceType,
+				State:          transition.State,
+				LastTransition: transition.CreatedAt,
+			}
+			services[key] = service
+		}
+		service.Transitions++
+		if transition.PreviousState == "active" && transition.State != "active" {
+			service.Flaps++
+		}
+	}
+
+	result := make([]*ServiceFlapping, 0, len(services))
+	for _, service := range services {
+		if service.Flaps >= threshold {
+			result = append(result, service)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Flaps != result[j].Flaps {
+			return result[i].Flaps > result[j].Flaps
+		}
+		if result[i].Transitions != result[j].Transitions {
+			return result[i].Transitions > result[j].Transitions
+		}
+		return result[i].LastTransition.After(result[j].LastTransition)
+	})
+	return result, nil
+}
+
+// Cleanup supprime les changements d'état au-delà de la durée de rétention
+func (s *ServiceHistoryStore) Cleanup(now time.Time) {
+	if err := s.db.CleanupServiceTransitions(now.Add(-serviceHistoryRetention)); err != nil {
+		log.Printf("[SERVICE] Erreur lors du nettoyage de l'historique des services: %v", err)
+	}
+}
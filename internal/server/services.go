@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"remoteshell/internal/common"
+)
+
+// Délais d'attente du résultat d'une action sur un service
+const (
+	serviceStatusTimeout        = 30 * time.Second
+	defaultServiceActionTimeout = 60 * time.Second
+	// Le téléchargement d'images et la recréation de conteneurs peuvent être longs
+	longServiceActionTimeout = 11 * time.Minute
+)
+
+// serviceActions liste les actions acceptées par type de service
+var serviceActions = map[string]map[string]bool{
+	"systemd": {
+		"start": true, "stop": true, "restart": true, "reload": true, "enable": true, "disable": true,
+		"mask": true, "unmask": true, "reset-failed": true, "cat": true, "edit": true,
+	},
+	"docker": {
+		"start": true, "stop": true, "restart": true, "pause": true, "unpause": true, "remove": true,
+		"inspect": true, "logs": true, "pull": true, "recreate": true,
+	},
+	"compose": {
+		"up": true, "down": true, "start": true, "stop": true, "restart": true,
+		"pull": true, "recreate": true, "config": true,
+	},
+}
+
+// serviceReadOnlyActions ne modifient pas le service et ne sont pas auditées
+var serviceReadOnlyActions = map[string]bool{"inspect": true, "logs": true, "config": true, "cat": true}
+
+// RunServiceAction exécute une action sur un service d'un agent et attend son résultat
+func (h *Hub) RunServiceAction(agentID string, action *common.ServiceAction) (*common.ServiceResult, error) {
+	agent, exists := h.GetAgent(agentID)
+	if !exists {
+		return nil, fmt.Errorf("agent non trouvé")
+	}
+
+	// Les actions Compose enchaînent les opérations sur tous les conteneurs du projet
+	timeout := defaultServiceActionTimeout
+	if action.Type == "compose" || action.Action == "pull" || action.Action == "recreate" {
+		timeout = longServiceActionTimeout
+	}
+
+	msg := common.NewMessage(common.MessageTypeServiceAction, action)
+	msg.AgentID = agentID
+
+	response, err := agent.SendMessageWithResponse(msg, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return decodeServiceResult(response)
+}
+
+// GetServiceStatus demande à un agent l'état détaillé d'un service
+func (h *Hub) GetServiceStatus(agentID, name, serviceType string) (*common.ServiceInfo, error) {
+	agent, exists := h.GetAgent(agentID)
+	if !exists {
+		return nil, fmt.Errorf("agent non trouvé")
+	}
+
+	msg := common.NewMessage(common.MessageTypeServiceStatus, &common.ServiceInfo{Name: name, Type: serviceType})
+	msg.AgentID = agentID
+
+	response, err := agent.SendMessageWithResponse(msg, serviceStatusTimeout)
+	if err != nil {
+		return nil, err
+	}
+	if response.Type == common.MessageTypeError {
+		return nil, agentError(response)
+	}
+
+	status, err := common.DecodePayload[common.ServiceInfo](response)
+	if err != nil {
+		return nil, fmt.Errorf("réponse de l'agent invalide: %v", err)
+	}
+	return status, nil
+}
+
+// FollowServiceLogs suit les logs d'un conteneur jusqu'à la fin du suivi ou la fermeture de stop
+// onLines reçoit les lignes au fil de l'eau; le suivi est annulé côté agent si stop est fermé
+func (h *Hub) FollowServiceLogs(agentID string, action *common.ServiceAction, stop <-chan struct{}, onLines func(lines []string)) (*common.ServiceResult, error) {
+	agent, exists := h.GetAgent(agentID)
+	if !exists {
+		return nil, fmt.Errorf("agent non trouvé")
+	}
+
+	msg := common.NewMessage(common.MessageTypeServiceAction, action)
+	msg.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	msg.AgentID = agentID
+
+	stream, closeStream := agent.OpenStream(msg.ID)
+	defer closeStream()
+
+	if err := agent.SendMessage(msg); err != nil {
+		return nil, fmt.Errorf("erreur d'envoi de la demande: %v", err)
+	}
+
+	cancelFollow := func() {
+		cancel := *action
+		cancel.Options = &common.ServiceActionOptions{Cancel: true}
+		cancelMsg := common.NewMessageWithID(common.MessageTypeServiceAction, msg.ID, &cancel)
+		cancelMsg.AgentID = agentID
+		agent.SendMessage(cancelMsg)
+	}
+
+	for {
+		select {
+		case response, ok := <-stream:
+			if !ok {
+				cancelFollow()
+				return nil, errStreamSaturated
+			}
+			if response.Type != common.MessageTypeServiceLogs {
+				return decodeServiceResult(response)
+			}
+			chunk, err := common.DecodePayload[common.ServiceLogChunk](response)
+			if err != nil {
+				cancelFollow()
+				return nil, fmt.Errorf("réponse de l'agent invalide: %v", err)
+			}
+			onLines(chunk.Lines)
+
+		case <-stop:
+			cancelFollow()
+			return nil, fmt.Errorf("suivi interrompu")
+		}
+	}
+}
+
+// decodeServiceResult extrait le résultat d'une action de la réponse de l'agent
+func decodeServiceResult(response *common.Message) (*common.ServiceResult, error) {
+	if response.Type == common.MessageTypeError {
+		return nil, agentError(response)
+	}
+
+	result, err := common.DecodePayload[common.ServiceResult](response)
+	if err != nil {
+		return nil, fmt.Errorf("réponse de l'agent invalide: %v", err)
+	}
+	return result, nil
+}
@@ -101,19 +101,14 @@ func (ws *WebSocketServer) handleConnection(conn WebSocketConn) {
 			if msg.Type == common.MessageTypeAuth {
 				// Vérifier le type de token pour distinguer agent et client web
 				// Si le token n'est pas le token simple d'authentification, c'est probablement un client web
-				if tokenData, ok := msg.Data.(map[string]interface{}); ok {
-					if token, exists := tokenData["token"]; exists {
-						if tokenStr, ok := token.(string); ok {
-							// Si ce n'est pas le token simple d'auth, c'est un client web avec un token JWT
-							if tokenStr != ws.authToken && tokenStr != "" {
-								// C'est un client web avec un token JWT
-								webClient = &WebClient{
-									ID:   fmt.Sprintf("webclient_%d", time.Now().UnixNano()),
-									Conn: conn,
-								}
-								ws.hub.registerWeb <- webClient
-							}
+				if authData, err := common.DecodePayload[common.AuthData](msg); err == nil {
+					// Si ce n'est pas le token simple d'auth, c'est un client web avec un token JWT
+					if authData.Token != ws.authToken {
+						webClient = &WebClient{
+							ID:   fmt.Sprintf("webclient_%d", time.Now().UnixNano()),
+							Conn: conn,
 						}
+						ws.hub.registerWeb <- webClient
 					}
 				}
 			} else {
@@ -126,6 +121,18 @@ func (ws *WebSocketServer) handleConnection(conn WebSocketConn) {
 			}
 		}
 
+		if webClient != nil {
+			ws.hub.stats.MessageReceived("web", msg.Type)
+		} else {
+			ws.hub.stats.MessageReceived("agent", msg.Type)
+		}
+
+		// Valider les données du message avant de le traiter
+		if err := msg.ValidatePayload(common.ToServer); err != nil {
+			ws.rejectPayload(conn, msg, agent, err)
+			continue
+		}
+
 		// Traiter le message
 		if err := ws.handleMessage(conn, msg, &agent); err != nil {
 			log.Printf("Erreur de traitement du message: %v", err)
@@ -172,9 +179,21 @@ func (ws *WebSocketServer) handleMessage(conn WebSocketConn, msg *common.Message
 	case common.MessageTypePrinterStatus:
 		return ws.handlePrinterStatus(conn, msg, agent)
 
+	case common.MessageTypePrinterEvents:
+		return ws.handlePrinterEvents(conn, msg, agent)
+
+	case common.MessageTypePrinterResult, common.MessageTypePrinterDiscover, common.MessageTypePrinterDrivers:
+		return ws.handlePrinterResult(conn, msg, agent)
+
 	case common.MessageTypeSystemInfo:
 		return ws.handleSystemInfo(conn, msg, agent)
 
+	case common.MessageTypeInventory:
+		return ws.handleInventory(conn, msg, agent)
+
+	case common.MessageTypeMetrics:
+		return ws.handleMetrics(conn, msg, agent)
+
 	case common.MessageTypeHeartbeat:
 		return ws.handleHeartbeat(conn, msg, agent)
 
@@ -185,7 +204,10 @@ func (ws *WebSocketServer) handleMessage(conn WebSocketConn, msg *common.Message
 	case common.MessageTypeServiceStatus:
 		return ws.handleServiceStatus(conn, msg, agent)
 
-	case common.MessageTypeServiceResult:
+	case common.MessageTypeServiceEvents:
+		return ws.handleServiceEvents(conn, msg, agent)
+
+	case common.MessageTypeServiceResult, common.MessageTypeServiceLogs:
 		return ws.handleServiceResult(conn, msg, agent)
 
 	// Gestion des logs
@@ -195,6 +217,24 @@ func (ws *WebSocketServer) handleMessage(conn WebSocketConn, msg *common.Message
 	case common.MessageTypeLogContent:
 		return ws.handleLogContent(conn, msg, agent)
 
+	case common.MessageTypeLogShip:
+		return ws.handleLogShip(conn, msg, agent)
+
+	case common.MessageTypeLogExport:
+		return ws.handleLogExport(conn, msg, agent)
+
+	// Messages de gestion des processus
+	case common.MessageTypeProcessList, common.MessageTypeProcessSignal:
+		return ws.handleProcessResponse(conn, msg, agent)
+
+	// Messages de diagnostic réseau
+	case common.MessageTypeNetworkDiagnostic:
+		return ws.handleNetworkDiagnostic(conn, msg, agent)
+
+	// Messages de gestion des paquets
+	case common.MessageTypePackageOutput, common.MessageTypePackageResult:
+		return ws.handlePackageResponse(conn, msg, agent)
+
 	// Messages d'erreur
 	case common.MessageTypeError:
 		return ws.handleError(conn, msg, agent)
@@ -208,37 +248,13 @@ func (ws *WebSocketServer) handleMessage(conn WebSocketConn, msg *common.Message
 
 // handleAuth traite l'authentification
 func (ws *WebSocketServer) handleAuth(conn WebSocketConn, msg *common.Message, agent **Agent) error {
-	var token string
-	var agentID, agentName string
-
 	// Extraire le token et les infos agent depuis les données
-	switch data := msg.Data.(type) {
-	case *common.AuthData:
-		token = data.Token
-	case map[string]interface{}:
-		if tokenVal, exists := data["token"]; exists {
-			if tokenStr, ok := tokenVal.(string); ok {
-				token = tokenStr
-			} else {
-				return ws.sendAuthError(conn, "token invalide")
-			}
-		} else {
-			return ws.sendAuthError(conn, "token manquant")
-		}
-		// Extraire agentID et agentName depuis map si disponibles
-		if agentIDVal, exists := data["agent_id"]; exists {
-			if agentIDStr, ok := agentIDVal.(string); ok {
-				agentID = agentIDStr
-			}
-		}
-		if agentNameVal, exists := data["agent_name"]; exists {
-			if agentNameStr, ok := agentNameVal.(string); ok {
-				agentName = agentNameStr
-			}
-		}
-	default:
+	authData, err := common.DecodePayload[common.AuthData](msg)
+	if err != nil {
 		return ws.sendAuthError(conn, "format de données invalide")
 	}
+	token := authData.Token
+	agentID, agentName := authData.AgentID, authData.AgentName
 
 	// Utiliser agentID depuis le message si disponible
 	if agentID == "" && msg.AgentID != "" {
@@ -336,6 +352,8 @@ func (ws *WebSocketServer) handleCommandDone(conn WebSocketConn, msg *common.Mes
 		return ws.sendError(conn, "non authentifié")
 	}
 
+	ws.hub.stats.CommandDone(msg.ID)
+
 	// Créer un message de résultat pour le client
 	resultMsg := &common.Message{
 		Type:      "command_result",
@@ -435,62 +453,20 @@ func (ws *WebSocketServer) handleFileList(conn WebSocketConn, msg *common.Messag
 		return ws.sendError(conn, "non authentifié")
 	}
 
-	log.Printf("[WS] handleFileList - Message reçu, ID: %s, Type de données: %T", msg.ID, msg.Data)
-
-	// Si c'est une réponse d'un agent avec des données de fichiers
-	// Gérer []*common.FileData et []interface{} (après sérialisation JSON)
-	var files []*common.FileData
-	var filesOk bool
-	
-	if filesData, ok := msg.Data.([]*common.FileData); ok {
-		files = filesData
-		filesOk = true
-	} else if filesInterface, ok := msg.Data.([]interface{}); ok {
-		// Convertir []interface{} en []*common.FileData
-		files = make([]*common.FileData, 0, len(filesInterface))
-		for _, item := range filesInterface {
-			if fileMap, ok := item.(map[string]interface{}); ok {
-				fileData := &common.FileData{}
-				if pathVal, exists := fileMap["path"]; exists {
-					if pathStr, ok := pathVal.(string); ok {
-						fileData.Path = pathStr
-					}
-				}
-				if isDir, exists := fileMap["is_dir"]; exists {
-					if isDirBool, ok := isDir.(bool); ok {
-						fileData.IsDir = isDirBool
-					}
-				}
-				if size, exists := fileMap["size"]; exists {
-					if sizeFloat, ok := size.(float64); ok {
-						fileData.Size = int64(sizeFloat)
-					}
-				}
-				if mode, exists := fileMap["mode"]; exists {
-					if modeFloat, ok := mode.(float64); ok {
-						fileData.Mode = uint32(modeFloat)
-					}
-				}
-				if modified, exists := fileMap["modified"]; exists {
-					if modifiedStr, ok := modified.(string); ok {
-						if modifiedTime, err := time.Parse(time.RFC3339, modifiedStr); err == nil {
-							fileData.Modified = modifiedTime
-						}
-					}
-				}
-				files = append(files, fileData)
-			}
-		}
-		filesOk = true
+	log.Printf("[WS] handleFileList - Message reçu, ID: %s", msg.ID)
+
+	files, err := common.DecodePayload[[]*common.FileData](msg)
+	if err != nil {
+		return err
 	}
-	
-	if filesOk && len(files) > 0 {
+
+	if len(*files) > 0 {
 		// Extraire le chemin depuis les données
 		// Pour les fichiers à la racine, les chemins seront comme "/bin", "/usr", etc.
 		// Pour les sous-répertoires, ils seront comme "/home/user", "/var/log", etc.
 		var path string
-		if len(files) > 0 {
-			firstPath := files[0].Path
+		if len(*files) > 0 {
+			firstPath := (*files)[0].Path
 			// Si le chemin commence par "/" et n'a qu'un seul "/" (ex: "/bin", "/usr")
 			// ou s'il a exactement "/", c'est la racine
 			if firstPath == "/" {
@@ -527,33 +503,22 @@ func (ws *WebSocketServer) handleFileList(conn WebSocketConn, msg *common.Messag
 			path = "/"
 		}
 
-		log.Printf("[WS] handleFileList - Chemin détecté: %s pour %d fichiers", path, len(files))
+		log.Printf("[WS] handleFileList - Chemin détecté: %s pour %d fichiers", path, len(*files))
 
 		// Mettre à jour le cache de fichiers
-		(*agent).UpdateFileCache(path, files)
-
-		// Si le message a un ID, c'est une réponse à une demande
-		if msg.ID != "" {
-			log.Printf("[WS] handleFileList - Envoi de la réponse au canal, ID: %s", msg.ID)
-			(*agent).HandleResponse(msg)
-		} else {
-			log.Printf("[WS] handleFileList - Message sans ID, pas de réponse attendue")
-		}
+		(*agent).UpdateFileCache(path, *files)
+	}
 
-		return nil
-	} else if _, ok := msg.Data.(*common.FileData); ok {
-		// C'est une demande de liste, transférer à l'agent
-		(*agent).UpdateLastSeen()
-		return (*agent).SendMessage(msg)
-	} else if _, ok := msg.Data.(map[string]interface{}); ok {
-		// C'est peut-être une demande avec le chemin dans une map
-		(*agent).UpdateLastSeen()
-		return (*agent).SendMessage(msg)
+	// Si le message a un ID, c'est une réponse à une demande
+	if msg.ID != "" {
+		log.Printf("[WS] handleFileList - Envoi de la réponse au canal, ID: %s", msg.ID)
+		(*agent).HandleResponse(msg)
+	} else {
+		log.Printf("[WS] handleFileList - Message sans ID, pas de réponse attendue")
 	}
 
-	// Sinon, transférer le message à l'agent
 	(*agent).UpdateLastSeen()
-	return (*agent).SendMessage(msg)
+	return nil
 }
 
 // handlePrinterStatus traite le statut des imprimantes
@@ -562,12 +527,61 @@ func (ws *WebSocketServer) handlePrinterStatus(conn WebSocketConn, msg *common.M
 		return ws.sendError(conn, "non authentifié")
 	}
 
+	(*agent).UpdateLastSeen()
+
+	printers, err := common.DecodePayload[[]*common.PrinterInfo](msg)
+	if err != nil {
+		return err
+	}
+
 	// Mettre à jour les informations des imprimantes
-	if printers, ok := msg.Data.([]*common.PrinterInfo); ok {
-		(*agent).UpdatePrinters(printers)
+	(*agent).UpdatePrinters(*printers)
+	ws.recordPrinters(*agent, *printers)
+	return nil
+}
+
+// handlePrinterEvents applique les changements d'état des imprimantes et les diffuse aux clients web
+func (ws *WebSocketServer) handlePrinterEvents(conn WebSocketConn, msg *common.Message, agent **Agent) error {
+	if *agent == nil {
+		return ws.sendError(conn, "non authentifié")
 	}
 
 	(*agent).UpdateLastSeen()
+
+	delta, err := common.DecodePayload[common.PrinterDelta](msg)
+	if err != nil {
+		return err
+	}
+
+	printers := (*agent).ApplyPrinterDelta(delta)
+	ws.recordPrinters(*agent, printers)
+
+	msg.AgentID = (*agent).ID
+	ws.hub.BroadcastToWebClients(msg)
+	return nil
+}
+
+// recordPrinters historise les changements d'état, les travaux terminés et les niveaux de consommables
+func (ws *WebSocketServer) recordPrinters(agent *Agent, printers []*common.PrinterInfo) {
+	if ws.hub.printerLog == nil {
+		return
+	}
+	if err := ws.hub.printerLog.Record(agent.ID, printers); err != nil {
+		log.Printf("[PRINTER] Erreur d'enregistrement de l'historique des imprimantes de l'agent %s: %v", agent.ID, err)
+	}
+}
+
+// handlePrinterResult transmet le résultat d'une action, d'une découverte ou d'une recherche de pilotes à la requête en attente
+func (ws *WebSocketServer) handlePrinterResult(conn WebSocketConn, msg *common.Message, agent **Agent) error {
+	if *agent == nil {
+		return ws.sendError(conn, "non authentifié")
+	}
+
+	(*agent).UpdateLastSeen()
+
+	if msg.ID != "" {
+		(*agent).HandleResponse(msg)
+	}
 	return nil
 }
 
@@ -577,12 +591,88 @@ func (ws *WebSocketServer) handleSystemInfo(conn WebSocketConn, msg *common.Mess
 		return ws.sendError(conn, "non authentifié")
 	}
 
+	(*agent).UpdateLastSeen()
+
+	systemInfo, err := common.DecodePayload[common.SystemInfo](msg)
+	if err != nil {
+		return fmt.Errorf("informations système invalides: %v", err)
+	}
+
 	// Mettre à jour les informations système
-	if systemInfo, ok := msg.Data.(*common.SystemInfo); ok {
-		(*agent).UpdateSystemInfo(systemInfo)
+	(*agent).UpdateSystemInfo(systemInfo)
+
+	// Historiser l'échantillon
+	if ws.hub.db != nil {
+		systemLog := &SystemLog{
+			AgentID:     (*agent).ID,
+			Hostname:    systemInfo.Hostname,
+			OS:          systemInfo.OS,
+			Arch:        systemInfo.Arch,
+			Uptime:      systemInfo.Uptime,
+			MemoryTotal: systemInfo.MemoryTotal,
+			MemoryUsed:  systemInfo.MemoryUsed,
+			DiskTotal:   systemInfo.DiskTotal,
+			DiskUsed:    systemInfo.DiskUsed,
+			CreatedAt:   time.Now(),
+		}
+		if err := ws.hub.db.LogSystem(systemLog); err != nil {
+			log.Printf("Erreur lors de l'enregistrement des informations système: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// handleMetrics traite un échantillon de métriques
+func (ws *WebSocketServer) handleMetrics(conn WebSocketConn, msg *common.Message, agent **Agent) error {
+	if *agent == nil {
+		return ws.sendError(conn, "non authentifié")
+	}
+
+	(*agent).UpdateLastSeen()
+
+	if ws.hub.metrics == nil {
+		return nil
+	}
+
+	sample, err := common.DecodePayload[common.MetricsSample](msg)
+	if err != nil {
+		return fmt.Errorf("échantillon de métriques invalide: %v", err)
+	}
+
+	if err := ws.hub.metrics.Save((*agent).ID, sample); err != nil {
+		log.Printf("Erreur lors de l'enregistrement des métriques: %v", err)
+	}
+
+	return nil
+}
+
+// handleInventory enregistre l'inventaire envoyé par un agent
+func (ws *WebSocketServer) handleInventory(conn WebSocketConn, msg *common.Message, agent **Agent) error {
+	if *agent == nil {
+		return ws.sendError(conn, "non authentifié")
 	}
 
 	(*agent).UpdateLastSeen()
+
+	if ws.hub.inventory == nil {
+		return nil
+	}
+
+	inventory, err := common.DecodePayload[common.Inventory](msg)
+	if err != nil {
+		return fmt.Errorf("inventaire invalide: %v", err)
+	}
+
+	changes, saved, err := ws.hub.inventory.Save((*agent).ID, inventory)
+	if err != nil {
+		log.Printf("Erreur lors de l'enregistrement de l'inventaire: %v", err)
+		return nil
+	}
+	if saved {
+		log.Printf("[INVENTORY] Nouvel inventaire pour l'agent %s (%d paquets, %d changements)", (*agent).ID, len(inventory.Packages), len(changes))
+	}
+
 	return nil
 }
 
@@ -608,49 +698,18 @@ func (ws *WebSocketServer) handleServiceList(conn WebSocketConn, msg *common.Mes
 	}
 
 	log.Printf("[WS] handleServiceList - Message reçu de l'agent %s, ID: %s", (*agent).ID, msg.ID)
-	log.Printf("[WS] handleServiceList - Type de données: %T", msg.Data)
+
+	services, err := common.DecodePayload[[]*common.ServiceInfo](msg)
+	if err != nil {
+		return err
+	}
 
 	// Mettre à jour les informations des services
-	if services, ok := msg.Data.([]interface{}); ok {
-		log.Printf("[WS] handleServiceList - Données sont []interface{} avec %d services", len(services))
-		// Convertir en slice de ServiceInfo
-		serviceInfos := make([]*common.ServiceInfo, 0, len(services))
-		for i, svc := range services {
-			if svcMap, ok := svc.(map[string]interface{}); ok {
-				serviceInfo := &common.ServiceInfo{}
-				if name, ok := svcMap["name"].(string); ok {
-					serviceInfo.Name = name
-				}
-				if typ, ok := svcMap["type"].(string); ok {
-					serviceInfo.Type = typ
-				}
-				if status, ok := svcMap["status"].(string); ok {
-					serviceInfo.Status = status
-				}
-				if state, ok := svcMap["state"].(string); ok {
-					serviceInfo.State = state
-				}
-				if desc, ok := svcMap["description"].(string); ok {
-					serviceInfo.Description = desc
-				}
-				if enabled, ok := svcMap["enabled"].(bool); ok {
-					serviceInfo.Enabled = enabled
-				}
-				if containerID, ok := svcMap["container_id"].(string); ok {
-					serviceInfo.ContainerID = containerID
-				}
-				if image, ok := svcMap["image"].(string); ok {
-					serviceInfo.Image = image
-				}
-				serviceInfos = append(serviceInfos, serviceInfo)
-				log.Printf("[WS] handleServiceList - Service %d: %s (%s) - %s", i, serviceInfo.Name, serviceInfo.Type, serviceInfo.State)
-			}
-		}
-		log.Printf("[WS] handleServiceList - Mise à jour du cache avec %d services", len(serviceInfos))
-		(*agent).UpdateServices(serviceInfos)
-	} else {
-		log.Printf("[WS] handleServiceList - Les données ne sont PAS []interface{}, type: %T", msg.Data)
+	for i, serviceInfo := range *services {
+		log.Printf("[WS] handleServiceList - Service %d: %s (%s) - %s", i, serviceInfo.Name, serviceInfo.Type, serviceInfo.State)
 	}
+	log.Printf("[WS] handleServiceList - Mise à jour du cache avec %d services", len(*services))
+	(*agent).UpdateServices(*services)
 
 	// Si le message a un ID, c'est une réponse à une demande
 	if msg.ID != "" {
@@ -679,7 +738,32 @@ func (ws *WebSocketServer) handleServiceStatus(conn WebSocketConn, msg *common.M
 	return nil
 }
 
-// handleServiceResult traite le résultat d'une action sur un service
+// handleServiceEvents applique les changements d'état des services, les historise et les diffuse aux clients web
+func (ws *WebSocketServer) handleServiceEvents(conn WebSocketConn, msg *common.Message, agent **Agent) error {
+	if *agent == nil {
+		return ws.sendError(conn, "non authentifié")
+	}
+
+	(*agent).UpdateLastSeen()
+
+	delta, err := common.DecodePayload[common.ServiceDelta](msg)
+	if err != nil {
+		return err
+	}
+
+	(*agent).ApplyServiceDelta(delta)
+	if ws.hub.serviceLog != nil {
+		if err := ws.hub.serviceLog.Record((*agent).ID, delta.Events); err != nil {
+			log.Printf("[SERVICE] Erreur d'enregistrement des changements d'état des services de l'agent %s: %v", (*agent).ID, err)
+		}
+	}
+
+	msg.AgentID = (*agent).ID
+	ws.hub.BroadcastToWebClients(msg)
+	return nil
+}
+
+// handleServiceResult traite le résultat d'une action sur un service et les logs de conteneur suivis
 func (ws *WebSocketServer) handleServiceResult(conn WebSocketConn, msg *common.Message, agent **Agent) error {
 	if *agent == nil {
 		return ws.sendError(conn, "non authentifié")
@@ -702,37 +786,18 @@ func (ws *WebSocketServer) handleLogList(conn WebSocketConn, msg *common.Message
 	}
 
 	log.Printf("[WS] handleLogList - Message reçu de l'agent %s, ID: %s", (*agent).ID, msg.ID)
-	log.Printf("[WS] handleLogList - Type de données: %T", msg.Data)
+
+	sources, err := common.DecodePayload[[]*common.LogSource](msg)
+	if err != nil {
+		return err
+	}
 
 	// Mettre à jour les informations des sources de logs
-	if sources, ok := msg.Data.([]interface{}); ok {
-		log.Printf("[WS] handleLogList - Données sont []interface{} avec %d sources", len(sources))
-		// Convertir en slice de LogSource
-		logSources := make([]*common.LogSource, 0, len(sources))
-		for i, src := range sources {
-			if srcMap, ok := src.(map[string]interface{}); ok {
-				logSource := &common.LogSource{}
-				if name, ok := srcMap["name"].(string); ok {
-					logSource.Name = name
-				}
-				if typ, ok := srcMap["type"].(string); ok {
-					logSource.Type = typ
-				}
-				if path, ok := srcMap["path"].(string); ok {
-					logSource.Path = path
-				}
-				if desc, ok := srcMap["description"].(string); ok {
-					logSource.Description = desc
-				}
-				logSources = append(logSources, logSource)
-				log.Printf("[WS] handleLogList - Source %d: %s (%s)", i, logSource.Name, logSource.Type)
-			}
-		}
-		log.Printf("[WS] handleLogList - Mise à jour du cache avec %d sources", len(logSources))
-		(*agent).UpdateLogSources(logSources)
-	} else {
-		log.Printf("[WS] handleLogList - Les données ne sont PAS []interface{}, type: %T", msg.Data)
+	for i, logSource := range *sources {
+		log.Printf("[WS] handleLogList - Source %d: %s (%s)", i, logSource.Name, logSource.Type)
 	}
+	log.Printf("[WS] handleLogList - Mise à jour du cache avec %d sources", len(*sources))
+	(*agent).UpdateLogSources(*sources)
 
 	// Si le message a un ID, c'est une réponse à une demande
 	if msg.ID != "" {
@@ -757,12 +822,8 @@ func (ws *WebSocketServer) handleLogContent(conn WebSocketConn, msg *common.Mess
 
 	// Si c'est une réponse avec des logs
 	if msg.ID != "" {
-		if logData, ok := msg.Data.(map[string]interface{}); ok {
-			if entries, ok := logData["entries"]; ok {
-				if entriesSlice, ok := entries.([]interface{}); ok {
-					log.Printf("[WS] handleLogContent - Logs reçus: %d entrées", len(entriesSlice))
-				}
-			}
+		if content, err := common.DecodePayload[common.LogContent](msg); err == nil {
+			log.Printf("[WS] handleLogContent - Logs reçus: %d entrées", len(content.Entries))
 		}
 		log.Printf("[WS] handleLogContent - Envoi de la réponse au canal")
 		(*agent).HandleResponse(msg)
@@ -772,6 +833,113 @@ func (ws *WebSocketServer) handleLogContent(conn WebSocketConn, msg *common.Mess
 	return nil
 }
 
+// handleLogShip enregistre un lot de logs expédiés par un agent
+func (ws *WebSocketServer) handleLogShip(conn WebSocketConn, msg *common.Message, agent **Agent) error {
+	if *agent == nil {
+		return ws.sendError(conn, "non authentifié")
+	}
+
+	(*agent).UpdateLastSeen()
+
+	batch, err := common.DecodePayload[common.LogShipBatch](msg)
+	if err != nil {
+		return fmt.Errorf("lot de logs invalide: %v", err)
+	}
+
+	if ws.hub.logAlerts != nil {
+		ws.hub.logAlerts.Evaluate((*agent).ID, batch.Source, batch.Entries)
+	}
+
+	if ws.hub.db == nil || len(batch.Entries) == 0 {
+		return nil
+	}
+
+	records := make([]*LogRecord, 0, len(batch.Entries))
+	now := time.Now()
+	for _, entry := range batch.Entries {
+		if entry == nil {
+			continue
+		}
+		timestamp, err := time.Parse(time.RFC3339Nano, entry.Timestamp)
+		if err != nil {
+			timestamp = now
+		}
+		source := entry.Source
+		if source == "" {
+			source = batch.Source
+		}
+		records = append(records, &LogRecord{
+			AgentID:   (*agent).ID,
+			Source:    source,
+			Type:      batch.Type,
+			Level:     entry.Level,
+			Component: entry.Component,
+			Unit:      entry.Unit,
+			Message:   entry.Message,
+			Timestamp: timestamp,
+			CreatedAt: now,
+		})
+	}
+
+	return ws.hub.db.SaveLogRecords(records)
+}
+
+// handleLogExport transmet les morceaux d'un export de logs à la requête HTTP en attente
+func (ws *WebSocketServer) handleLogExport(conn WebSocketConn, msg *common.Message, agent **Agent) error {
+	if *agent == nil {
+		return ws.sendError(conn, "non authentifié")
+	}
+
+	(*agent).UpdateLastSeen()
+
+	if msg.ID != "" {
+		(*agent).HandleResponse(msg)
+	}
+	return nil
+}
+
+// handleProcessResponse transmet les réponses de gestion des processus à la requête en attente
+func (ws *WebSocketServer) handleProcessResponse(conn WebSocketConn, msg *common.Message, agent **Agent) error {
+	if *agent == nil {
+		return ws.sendError(conn, "non authentifié")
+	}
+
+	(*agent).UpdateLastSeen()
+
+	if msg.ID != "" {
+		(*agent).HandleResponse(msg)
+	}
+	return nil
+}
+
+// handleNetworkDiagnostic transmet les résultats de diagnostic réseau à la requête en attente
+func (ws *WebSocketServer) handleNetworkDiagnostic(conn WebSocketConn, msg *common.Message, agent **Agent) error {
+	if *agent == nil {
+		return ws.sendError(conn, "non authentifié")
+	}
+
+	(*agent).UpdateLastSeen()
+
+	if msg.ID != "" {
+		(*agent).HandleResponse(msg)
+	}
+	return nil
+}
+
+// handlePackageResponse transmet la sortie et le résultat des opérations sur les paquets à la requête en attente
+func (ws *WebSocketServer) handlePackageResponse(conn WebSocketConn, msg *common.Message, agent **Agent) error {
+	if *agent == nil {
+		return ws.sendError(conn, "non authentifié")
+	}
+
+	(*agent).UpdateLastSeen()
+
+	if msg.ID != "" {
+		(*agent).HandleResponse(msg)
+	}
+	return nil
+}
+
 // handleError traite les messages d'erreur de l'agent
 func (ws *WebSocketServer) handleError(conn WebSocketConn, msg *common.Message, agent **Agent) error {
 	if *agent == nil {
@@ -798,6 +966,30 @@ func (ws *WebSocketServer) handleError(conn WebSocketConn, msg *common.Message,
 	return nil
 }
 
+// rejectPayload signale à l'émetteur que les données de son message sont invalides
+// Lorsqu'il s'agit de la réponse d'un agent, la requête en attente reçoit aussi l'erreur
+func (ws *WebSocketServer) rejectPayload(conn WebSocketConn, msg *common.Message, agent *Agent, err error) {
+	log.Printf("[WS] Message %s rejeté: %v", msg.Type, err)
+
+	switch msg.Type {
+	case common.MessageTypeAuth:
+		ws.sendAuthError(conn, err.Error())
+		return
+	case common.MessageTypeError:
+		// Ne pas répondre à une erreur par une erreur
+		return
+	}
+
+	errorMsg := common.NewPayloadErrorMessage(msg, err)
+	if agent != nil && msg.ID != "" {
+		errorMsg.AgentID = agent.ID
+		agent.HandleResponse(errorMsg)
+	}
+	if sendErr := conn.SendMessage(errorMsg); sendErr != nil {
+		log.Printf("[WS] Erreur d'envoi du rejet de message: %v", sendErr)
+	}
+}
+
 // sendAuthError envoie une erreur d'authentification
 func (ws *WebSocketServer) sendAuthError(conn WebSocketConn, message string) error {
 	errorMsg := common.NewMessage(common.MessageTypeAuthError, &common.ErrorData{